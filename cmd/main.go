@@ -3,13 +3,22 @@ package main
 import (
 	"ROOmail/config"
 	_ "ROOmail/docs"
+	"ROOmail/internal/eventbus"
+	"ROOmail/internal/notify"
 	"ROOmail/internal/router"
+	"ROOmail/internal/scheduler"
 	"ROOmail/pkg/db"
 	"ROOmail/pkg/logger"
+	"ROOmail/pkg/utils/jwt_token"
+	"context"
+	"errors"
 	"github.com/joho/godotenv"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
 // @title Документация ROOmail API
@@ -45,13 +54,69 @@ func main() {
 
 	database := db.DB
 
-	r := router.InitRouter(database, cfg)
+	// Контекст сервера: отменяется по сигналу остановки, вместе с ним завершаются фоновые задачи
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	keySet, err := loadSigningKeys(cfg)
+	if err != nil {
+		log.Error("Failed to load token signing keys: ", err)
+		os.Exit(1)
+	}
+	jwt_token.SetKeySet(keySet)
+	go keySet.StartRotation(ctx, time.Minute, log)
+
+	// Каналы уведомлений: в приложении всегда, почта и webhook - если настроены.
+	// Письма уходят через очередь, чтобы медленный SMTP-сервер не задерживал запросы.
+	bus := eventbus.NewBus()
+	inApp := notify.NewInAppNotifier(bus)
+	notifiers := []notify.Notifier{inApp}
+	var mailer *notify.TaskMailer
+	if cfg.SMTPHost != "" {
+		mailQueue := notify.NewQueue(notify.NewSMTPNotifier(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.SMTPFrom), 1000, log)
+		mailQueue.Start(ctx, 2)
+		notifiers = append(notifiers, mailQueue)
+		mailer = notify.NewTaskMailer(mailQueue, cfg.AppURL)
+	}
+	if cfg.WebhookURL != "" {
+		notifiers = append(notifiers, notify.NewWebhookNotifier(cfg.WebhookURL))
+	}
+
+	r, err := router.InitRouter(ctx, database, cfg, mailer, bus)
+	if err != nil {
+		log.Error("Failed to initialize router: ", err)
+		os.Exit(1)
+	}
+
+	// Планировщик запускается после роутера, чтобы обработчики шины событий уже были зарегистрированы
+	reminderScheduler := scheduler.NewReminderScheduler(database, notifiers, cfg.ReminderDaysBefore, cfg.ReminderInterval, log)
+	go reminderScheduler.Start(ctx)
 
 	serverAddr := "https://localhost" + cfg.ServerAddress
 	log.Infof("Server started at %s", serverAddr)
 
-	err := http.ListenAndServeTLS(cfg.ServerAddress, os.Getenv("CERT_FILE"), os.Getenv("KEY_FILE"), r)
-	if err != nil {
+	server := &http.Server{Addr: cfg.ServerAddress, Handler: r}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Error("Failed to shut down HTTPS server: ", err)
+		}
+	}()
+
+	err = server.ListenAndServeTLS(os.Getenv("CERT_FILE"), os.Getenv("KEY_FILE"))
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
 		log.Fatalf("Failed to start HTTPS server: %v", err)
 	}
+	log.Info("Сервер остановлен")
+}
+
+// loadSigningKeys возвращает ключи подписи токенов: из каталога JWT_KEYS_DIR, если он
+// задан, иначе общий секрет JWT_SECRET
+func loadSigningKeys(cfg config.Config) (*jwt_token.KeySet, error) {
+	if cfg.JWTKeysDir == "" {
+		return jwt_token.NewSecretKeySet(cfg.JWTSecret)
+	}
+	return jwt_token.LoadKeySet(cfg.JWTKeysDir, cfg.JWTAlgorithm, cfg.JWTKeyRotation)
 }
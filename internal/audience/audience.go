@@ -0,0 +1,193 @@
+package audience
+
+import (
+	"ROOmail/internal/models"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"golang.org/x/net/context"
+)
+
+var (
+	ErrEmptyAudience = errors.New("Не указаны получатели")
+	ErrUnknownRole   = errors.New("Неизвестная роль")
+	ErrUnknownGroup  = errors.New("Группа пользователей не найдена")
+	ErrUnknownUser   = errors.New("Пользователь не найден")
+	ErrNoRecipients  = errors.New("По выбранным условиям не найдено ни одного пользователя")
+)
+
+// Querier - общий интерфейс пула соединений и транзакции
+type Querier interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// Recipient - получатель рассылки; GroupID - группа, через которую он попал в рассылку
+// (nil, если пользователь выбран напрямую, по роли или «всем»)
+type Recipient struct {
+	UserID  int
+	GroupID *int
+}
+
+// Direct превращает список пользователей, выбранных напрямую, в получателей
+func Direct(userIDs []int) []Recipient {
+	recipients := make([]Recipient, 0, len(userIDs))
+	for _, id := range uniq(userIDs) {
+		recipients = append(recipients, Recipient{UserID: id})
+	}
+	return recipients
+}
+
+// UserIDs возвращает идентификаторы пользователей получателей
+func UserIDs(recipients []Recipient) []int {
+	ids := make([]int, 0, len(recipients))
+	for _, r := range recipients {
+		ids = append(ids, r.UserID)
+	}
+	return ids
+}
+
+// Resolve раскрывает условия рассылки в список получателей без повторов. Если
+// пользователь попал в рассылку напрямую и через группу, источником считается прямой выбор;
+// если через несколько групп - группа с меньшим ID.
+func Resolve(ctx context.Context, q Querier, target models.Audience) ([]Recipient, error) {
+	if !target.All && target.Role == "" && len(target.GroupIDs) == 0 && len(target.UserIDs) == 0 {
+		return nil, ErrEmptyAudience
+	}
+	if target.Role != "" {
+		var known bool
+		err := q.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM roles WHERE name = $1)`, target.Role).Scan(&known)
+		if err != nil {
+			return nil, fmt.Errorf("Не удалось проверить роль: %w", err)
+		}
+		if !known {
+			return nil, ErrUnknownRole
+		}
+	}
+
+	groupIDs := uniq(target.GroupIDs)
+	userIDs := uniq(target.UserIDs)
+	if err := CheckUsers(ctx, q, userIDs); err != nil {
+		return nil, err
+	}
+
+	if len(groupIDs) > 0 {
+		var found int
+		err := q.QueryRow(ctx, `SELECT COUNT(*) FROM user_groups WHERE id = ANY($1)`, groupIDs).Scan(&found)
+		if err != nil {
+			return nil, fmt.Errorf("Не удалось проверить группы пользователей: %w", err)
+		}
+		if found != len(groupIDs) {
+			return nil, ErrUnknownGroup
+		}
+	}
+
+	rows, err := q.Query(ctx, `
+		SELECT u.id, g.group_id
+		FROM users u
+		LEFT JOIN LATERAL (
+			SELECT MIN(gm.group_id) AS group_id
+			FROM user_group_members gm
+			WHERE gm.user_id = u.id AND gm.group_id = ANY($4)
+		) g ON TRUE
+		-- Отключенные пользователи получают только адресованное им лично
+		WHERE u.id = ANY($3)
+		   OR (u.is_active AND ($1 OR u.role = $2 OR g.group_id IS NOT NULL))
+		ORDER BY u.id
+	`, target.All, target.Role, userIDs, groupIDs)
+	if err != nil {
+		return nil, fmt.Errorf("Не удалось определить получателей: %w", err)
+	}
+	defer rows.Close()
+
+	var result []Recipient
+	for rows.Next() {
+		var r Recipient
+		if err := rows.Scan(&r.UserID, &r.GroupID); err != nil {
+			return nil, fmt.Errorf("Не удалось прочитать получателя: %w", err)
+		}
+		result = append(result, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("Не удалось определить получателей: %w", err)
+	}
+	if len(result) == 0 {
+		return nil, ErrNoRecipients
+	}
+	return result, nil
+}
+
+// CheckUsers проверяет, что все пользователи существуют
+func CheckUsers(ctx context.Context, q Querier, userIDs []int) error {
+	userIDs = uniq(userIDs)
+	if len(userIDs) == 0 {
+		return nil
+	}
+
+	var found int
+	err := q.QueryRow(ctx, `SELECT COUNT(*) FROM users WHERE id = ANY($1)`, userIDs).Scan(&found)
+	if err != nil {
+		return fmt.Errorf("Не удалось проверить пользователей: %w", err)
+	}
+	if found != len(userIDs) {
+		return ErrUnknownUser
+	}
+	return nil
+}
+
+// FanOut назначает объект (задачу, объявление) получателям одним запросом.
+// Таблица должна содержать колонки <column>, user_id, group_id и sent_by с первичным
+// ключом по (<column>, user_id). Возвращает пользователей, которым объект назначен впервые.
+func FanOut(ctx context.Context, q Querier, table, column string, id int, recipients []Recipient, sentBy int) ([]int, error) {
+	if len(recipients) == 0 {
+		return nil, nil
+	}
+
+	userIDs := make([]int, 0, len(recipients))
+	groupIDs := make([]*int, 0, len(recipients))
+	for _, r := range recipients {
+		userIDs = append(userIDs, r.UserID)
+		groupIDs = append(groupIDs, r.GroupID)
+	}
+
+	query := fmt.Sprintf(`
+		INSERT INTO %s (%s, user_id, group_id, sent_by)
+		SELECT $1, r.user_id, r.group_id, $4
+		FROM unnest($2::integer[], $3::integer[]) AS r(user_id, group_id)
+		ON CONFLICT DO NOTHING
+		RETURNING user_id
+	`, table, column)
+	rows, err := q.Query(ctx, query, id, userIDs, groupIDs, sentBy)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to assign %s %d to users: %w", table, id, err)
+	}
+	defer rows.Close()
+
+	var added []int
+	for rows.Next() {
+		var userID int
+		if err := rows.Scan(&userID); err != nil {
+			return nil, fmt.Errorf("Failed to scan assigned user: %w", err)
+		}
+		added = append(added, userID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("Failed to assign %s %d to users: %w", table, id, err)
+	}
+	return added, nil
+}
+
+func uniq(ids []int) []int {
+	seen := make(map[int]struct{}, len(ids))
+	result := make([]int, 0, len(ids))
+	for _, id := range ids {
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+		result = append(result, id)
+	}
+	return result
+}
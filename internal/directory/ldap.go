@@ -0,0 +1,297 @@
+package directory
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+var (
+	// ErrUserNotFound - в каталоге нет такой учетной записи; вход можно проверить в другом источнике
+	ErrUserNotFound       = errors.New("пользователь не найден в каталоге")
+	ErrInvalidCredentials = errors.New("неверные учетные данные")
+	// ErrNoRole - ни одна группа пользователя не сопоставлена роли и роль по умолчанию не задана
+	ErrNoRole = errors.New("группам пользователя в каталоге не назначена роль")
+)
+
+// Config - параметры подключения к LDAP-каталогу (OpenLDAP, Active Directory)
+type Config struct {
+	URL string
+	// BindDN и BindPassword - служебная учетная запись для поиска пользователей.
+	// Если BindDN пуст, поиск выполняется анонимно.
+	BindDN       string
+	BindPassword string
+	BaseDN       string
+	// UserFilter - фильтр поиска, %s заменяется экранированным именем пользователя
+	UserFilter string
+	// Атрибуты записи пользователя: имя для входа, почта, ФИО и группы
+	UsernameAttribute string
+	EmailAttribute    string
+	NameAttribute     string
+	GroupAttribute    string
+	// GroupRoles сопоставляет группы ролям; при членстве в нескольких группах выигрывает первая
+	GroupRoles []GroupRole
+	// DefaultRole назначается, если ни одна группа не сопоставлена; пустая строка запрещает вход
+	DefaultRole string
+	StartTLS    bool
+	// AllowInsecure разрешает подключение по ldap:// без StartTLS. Пароли пользователей
+	// при этом передаются открытым текстом, поэтому без явного разрешения такой адрес отклоняется.
+	AllowInsecure bool
+	Timeout       time.Duration
+}
+
+// GroupRole - роль ROOmail для членов группы каталога
+type GroupRole struct {
+	Group string
+	Role  string
+}
+
+// Account - учетная запись, найденная в каталоге
+type Account struct {
+	DN       string
+	Username string
+	Email    string
+	FullName string
+	Role     string
+}
+
+// Conn - операции LDAP, которые нужны для входа. Реализуется *ldap.Conn, в тестах - заглушкой.
+type Conn interface {
+	Bind(username, password string) error
+	Search(request *ldap.SearchRequest) (*ldap.SearchResult, error)
+	Close() error
+}
+
+// Dialer открывает соединение с каталогом
+type Dialer func() (Conn, error)
+
+type groupRole struct {
+	dn   *ldap.DN
+	role string
+}
+
+// Directory проверяет пароли пользователей привязкой (bind) к LDAP-каталогу
+type Directory struct {
+	cfg        Config
+	dial       Dialer
+	groupRoles []groupRole
+}
+
+// New проверяет конфигурацию и возвращает каталог, подключающийся по cfg.URL
+func New(cfg Config) (*Directory, error) {
+	d, err := NewWithDialer(cfg, nil)
+	if err != nil {
+		return nil, err
+	}
+	d.dial = d.dialURL
+	return d, nil
+}
+
+// NewWithDialer возвращает каталог с собственным способом подключения, например к заглушке в тестах
+func NewWithDialer(cfg Config, dial Dialer) (*Directory, error) {
+	if cfg.URL == "" && dial == nil {
+		return nil, errors.New("не задан адрес LDAP-сервера")
+	}
+	if cfg.URL != "" {
+		if err := checkURL(cfg); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.BaseDN == "" {
+		return nil, errors.New("не задан базовый DN для поиска пользователей")
+	}
+	if cfg.UserFilter == "" {
+		cfg.UserFilter = "(&(objectClass=person)(uid=%s))"
+	}
+	if !strings.Contains(cfg.UserFilter, "%s") {
+		return nil, fmt.Errorf("фильтр поиска пользователей %q не содержит %%s", cfg.UserFilter)
+	}
+	if cfg.UsernameAttribute == "" {
+		cfg.UsernameAttribute = "uid"
+	}
+	if cfg.EmailAttribute == "" {
+		cfg.EmailAttribute = "mail"
+	}
+	if cfg.NameAttribute == "" {
+		cfg.NameAttribute = "cn"
+	}
+	if cfg.GroupAttribute == "" {
+		cfg.GroupAttribute = "memberOf"
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+
+	d := &Directory{cfg: cfg, dial: dial}
+	for _, mapping := range cfg.GroupRoles {
+		dn, err := ldap.ParseDN(mapping.Group)
+		if err != nil {
+			return nil, fmt.Errorf("некорректный DN группы %q: %w", mapping.Group, err)
+		}
+		d.groupRoles = append(d.groupRoles, groupRole{dn: dn, role: mapping.Role})
+	}
+	return d, nil
+}
+
+// checkURL проверяет схему адреса: пароли не должны передаваться по сети открытым текстом
+func checkURL(cfg Config) error {
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return fmt.Errorf("некорректный адрес LDAP-сервера %q: %w", cfg.URL, err)
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "ldaps", "ldapi":
+		return nil
+	case "ldap":
+		if cfg.StartTLS || cfg.AllowInsecure {
+			return nil
+		}
+		return fmt.Errorf("адрес %q без шифрования: используйте ldaps://, включите StartTLS или явно разрешите незащищенное подключение", cfg.URL)
+	default:
+		return fmt.Errorf("неизвестная схема адреса LDAP-сервера %q, допустимы ldap, ldaps и ldapi", u.Scheme)
+	}
+}
+
+// Roles возвращает роли, которые каталог может назначить: из сопоставлений групп и роль по умолчанию
+func (d *Directory) Roles() []string {
+	seen := make(map[string]bool)
+	var roles []string
+	for _, mapping := range d.groupRoles {
+		if !seen[mapping.role] {
+			seen[mapping.role] = true
+			roles = append(roles, mapping.role)
+		}
+	}
+	if d.cfg.DefaultRole != "" && !seen[d.cfg.DefaultRole] {
+		roles = append(roles, d.cfg.DefaultRole)
+	}
+	return roles
+}
+
+// ParseGroupRoles разбирает сопоставление групп ролям в формате "DN группы:роль;DN группы:роль".
+// DN содержит запятые и знаки равенства, поэтому роль отделяется последним двоеточием.
+func ParseGroupRoles(value string) ([]GroupRole, error) {
+	var result []GroupRole
+	for _, part := range strings.Split(value, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		i := strings.LastIndex(part, ":")
+		if i <= 0 || i == len(part)-1 {
+			return nil, fmt.Errorf("некорректное сопоставление группы и роли %q, ожидается \"DN группы:роль\"", part)
+		}
+		result = append(result, GroupRole{Group: strings.TrimSpace(part[:i]), Role: strings.TrimSpace(part[i+1:])})
+	}
+	return result, nil
+}
+
+// Authenticate находит пользователя служебной учетной записью, проверяет пароль привязкой
+// от имени найденной записи и определяет роль по группам
+func (d *Directory) Authenticate(username, password string) (*Account, error) {
+	// Привязка с пустым паролем - анонимная и на многих серверах завершается успешно
+	if username == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	conn, err := d.dial()
+	if err != nil {
+		return nil, fmt.Errorf("не удалось подключиться к LDAP-серверу: %w", err)
+	}
+	defer conn.Close()
+
+	if d.cfg.BindDN != "" {
+		if err := conn.Bind(d.cfg.BindDN, d.cfg.BindPassword); err != nil {
+			return nil, fmt.Errorf("не удалось войти служебной учетной записью LDAP: %w", err)
+		}
+	}
+
+	result, err := conn.Search(ldap.NewSearchRequest(
+		d.cfg.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, int(d.cfg.Timeout.Seconds()), false,
+		fmt.Sprintf(d.cfg.UserFilter, ldap.EscapeFilter(username)),
+		[]string{d.cfg.UsernameAttribute, d.cfg.EmailAttribute, d.cfg.NameAttribute, d.cfg.GroupAttribute},
+		nil,
+	))
+	if err != nil && !ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+		return nil, fmt.Errorf("не удалось найти пользователя в каталоге: %w", err)
+	}
+	switch {
+	case result == nil || len(result.Entries) == 0:
+		return nil, ErrUserNotFound
+	case len(result.Entries) > 1:
+		return nil, fmt.Errorf("имени %q в каталоге соответствует несколько записей", username)
+	}
+	entry := result.Entries[0]
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("не удалось проверить пароль в каталоге: %w", err)
+	}
+
+	role, err := d.roleFor(entry.GetEqualFoldAttributeValues(d.cfg.GroupAttribute))
+	if err != nil {
+		return nil, err
+	}
+
+	account := &Account{
+		DN:       entry.DN,
+		Username: entry.GetEqualFoldAttributeValue(d.cfg.UsernameAttribute),
+		Email:    entry.GetEqualFoldAttributeValue(d.cfg.EmailAttribute),
+		FullName: entry.GetEqualFoldAttributeValue(d.cfg.NameAttribute),
+		Role:     role,
+	}
+	if account.Username == "" {
+		account.Username = username
+	}
+	return account, nil
+}
+
+// roleFor возвращает роль первой сопоставленной группы, в которой состоит пользователь
+func (d *Directory) roleFor(groups []string) (string, error) {
+	member := make([]*ldap.DN, 0, len(groups))
+	for _, group := range groups {
+		if dn, err := ldap.ParseDN(group); err == nil {
+			member = append(member, dn)
+		}
+	}
+
+	for _, mapping := range d.groupRoles {
+		for _, dn := range member {
+			if mapping.dn.EqualFold(dn) {
+				return mapping.role, nil
+			}
+		}
+	}
+	if d.cfg.DefaultRole == "" {
+		return "", ErrNoRole
+	}
+	return d.cfg.DefaultRole, nil
+}
+
+func (d *Directory) dialURL() (Conn, error) {
+	conn, err := ldap.DialURL(d.cfg.URL, ldap.DialWithDialer(&net.Dialer{Timeout: d.cfg.Timeout}))
+	if err != nil {
+		return nil, err
+	}
+	conn.SetTimeout(d.cfg.Timeout)
+
+	if d.cfg.StartTLS {
+		var host string
+		if u, err := url.Parse(d.cfg.URL); err == nil {
+			host = u.Hostname()
+		}
+		if err := conn.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("не удалось установить TLS-соединение: %w", err)
+		}
+	}
+	return conn, nil
+}
@@ -0,0 +1,190 @@
+package directory_test
+
+import (
+	"ROOmail/internal/directory"
+	"strings"
+	"testing"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	serviceDN       = "cn=roomail,ou=services,dc=school,dc=ru"
+	servicePassword = "service-secret"
+	teachersGroup   = "cn=teachers,ou=groups,dc=school,dc=ru"
+	adminsGroup     = "cn=admins,ou=groups,dc=school,dc=ru"
+)
+
+// fakeDirectory - каталог в памяти: записи пользователей и их пароли
+type fakeDirectory struct {
+	entries   []*ldap.Entry
+	passwords map[string]string
+	searches  []*ldap.SearchRequest
+}
+
+type fakeConn struct {
+	dir   *fakeDirectory
+	bound string
+}
+
+func (c *fakeConn) Bind(username, password string) error {
+	if c.dir.passwords[username] != password || password == "" {
+		return ldap.NewError(ldap.LDAPResultInvalidCredentials, nil)
+	}
+	c.bound = username
+	return nil
+}
+
+func (c *fakeConn) Search(request *ldap.SearchRequest) (*ldap.SearchResult, error) {
+	if c.bound != serviceDN {
+		return nil, ldap.NewError(ldap.LDAPResultInsufficientAccessRights, nil)
+	}
+	c.dir.searches = append(c.dir.searches, request)
+
+	result := &ldap.SearchResult{}
+	for _, entry := range c.dir.entries {
+		if strings.Contains(request.Filter, "(uid="+entry.GetAttributeValue("uid")+")") {
+			result.Entries = append(result.Entries, entry)
+		}
+	}
+	return result, nil
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func newFakeDirectory(t *testing.T, defaultRole string) (*directory.Directory, *fakeDirectory) {
+	fake := &fakeDirectory{
+		entries: []*ldap.Entry{
+			ldap.NewEntry("uid=ivanova,ou=people,dc=school,dc=ru", map[string][]string{
+				"uid":      {"ivanova"},
+				"mail":     {"ivanova@school.ru"},
+				"cn":       {"Иванова Анна"},
+				"memberOf": {"CN=Teachers,OU=Groups,DC=school,DC=ru", adminsGroup},
+			}),
+			ldap.NewEntry("uid=petrov,ou=people,dc=school,dc=ru", map[string][]string{
+				"uid":      {"petrov"},
+				"memberOf": {"cn=students,ou=groups,dc=school,dc=ru"},
+			}),
+		},
+		passwords: map[string]string{
+			serviceDN:                               servicePassword,
+			"uid=ivanova,ou=people,dc=school,dc=ru": "teacher-pass",
+			"uid=petrov,ou=people,dc=school,dc=ru":  "student-pass",
+		},
+	}
+
+	dir, err := directory.NewWithDialer(directory.Config{
+		BindDN:       serviceDN,
+		BindPassword: servicePassword,
+		BaseDN:       "dc=school,dc=ru",
+		GroupRoles: []directory.GroupRole{
+			{Group: teachersGroup, Role: "teachers"},
+			{Group: adminsGroup, Role: "admin"},
+		},
+		DefaultRole: defaultRole,
+	}, func() (directory.Conn, error) {
+		return &fakeConn{dir: fake}, nil
+	})
+	require.NoError(t, err)
+	return dir, fake
+}
+
+func TestAuthenticate(t *testing.T) {
+	dir, _ := newFakeDirectory(t, "")
+
+	account, err := dir.Authenticate("ivanova", "teacher-pass")
+	require.NoError(t, err)
+	assert.Equal(t, "ivanova", account.Username)
+	assert.Equal(t, "ivanova@school.ru", account.Email)
+	assert.Equal(t, "Иванова Анна", account.FullName)
+	// Группы сравниваются без учета регистра, выигрывает первое сопоставление
+	assert.Equal(t, "teachers", account.Role)
+}
+
+func TestAuthenticateFailures(t *testing.T) {
+	dir, _ := newFakeDirectory(t, "")
+
+	_, err := dir.Authenticate("ivanova", "wrong")
+	assert.ErrorIs(t, err, directory.ErrInvalidCredentials)
+
+	_, err = dir.Authenticate("ivanova", "")
+	assert.ErrorIs(t, err, directory.ErrInvalidCredentials, "пустой пароль означает анонимную привязку")
+
+	_, err = dir.Authenticate("sidorov", "any")
+	assert.ErrorIs(t, err, directory.ErrUserNotFound)
+
+	_, err = dir.Authenticate("petrov", "student-pass")
+	assert.ErrorIs(t, err, directory.ErrNoRole)
+}
+
+func TestAuthenticateDefaultRole(t *testing.T) {
+	dir, _ := newFakeDirectory(t, "users")
+
+	account, err := dir.Authenticate("petrov", "student-pass")
+	require.NoError(t, err)
+	assert.Equal(t, "users", account.Role)
+}
+
+func TestAuthenticateEscapesFilter(t *testing.T) {
+	dir, fake := newFakeDirectory(t, "users")
+
+	_, err := dir.Authenticate("*)(uid=ivanova", "teacher-pass")
+	assert.ErrorIs(t, err, directory.ErrUserNotFound)
+	require.Len(t, fake.searches, 1)
+	assert.Equal(t, `(&(objectClass=person)(uid=\2a\29\28uid=ivanova))`, fake.searches[0].Filter)
+}
+
+func TestParseGroupRoles(t *testing.T) {
+	roles, err := directory.ParseGroupRoles(adminsGroup + ":admin; " + teachersGroup + ":teachers;")
+	require.NoError(t, err)
+	assert.Equal(t, []directory.GroupRole{
+		{Group: adminsGroup, Role: "admin"},
+		{Group: teachersGroup, Role: "teachers"},
+	}, roles)
+
+	_, err = directory.ParseGroupRoles(adminsGroup)
+	assert.Error(t, err)
+
+	_, err = directory.NewWithDialer(directory.Config{
+		BaseDN:     "dc=school,dc=ru",
+		GroupRoles: []directory.GroupRole{{Group: "not a dn", Role: "admin"}},
+	}, func() (directory.Conn, error) { return nil, nil })
+	assert.Error(t, err)
+}
+
+func TestNewRequiresEncryption(t *testing.T) {
+	cases := []struct {
+		name string
+		cfg  directory.Config
+		ok   bool
+	}{
+		{"ldaps", directory.Config{URL: "ldaps://ldap.school.ru"}, true},
+		{"ldap with StartTLS", directory.Config{URL: "ldap://ldap.school.ru", StartTLS: true}, true},
+		{"ldap without StartTLS", directory.Config{URL: "ldap://ldap.school.ru"}, false},
+		{"ldap allowed explicitly", directory.Config{URL: "ldap://ldap.school.ru", AllowInsecure: true}, true},
+		{"unknown scheme", directory.Config{URL: "http://ldap.school.ru"}, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.cfg.BaseDN = "dc=school,dc=ru"
+			_, err := directory.New(tc.cfg)
+			if tc.ok {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestRoles(t *testing.T) {
+	dir, _ := newFakeDirectory(t, "users")
+	assert.Equal(t, []string{"teachers", "admin", "users"}, dir.Roles())
+
+	dir, _ = newFakeDirectory(t, "admin")
+	assert.Equal(t, []string{"teachers", "admin"}, dir.Roles())
+}
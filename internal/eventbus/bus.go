@@ -0,0 +1,136 @@
+package eventbus
+
+import (
+	"sync"
+	"time"
+)
+
+// Типы событий, которые получают клиенты
+const (
+	TaskAssigned          = "task.assigned"
+	TaskUpdated           = "task.updated"
+	TaskDeleted           = "task.deleted"
+	TaskReminder          = "task.reminder"
+	ResponseReviewed      = "response.reviewed"
+	MessageReceived       = "message.received"
+	AnnouncementPublished = "announcement.published"
+	UserUpdated           = "user.updated"
+)
+
+// Event - событие для конкретных пользователей
+type Event struct {
+	Type      string    `json:"type"`
+	UserIDs   []int     `json:"-"`
+	TaskID    int       `json:"task_id,omitempty"`
+	Title     string    `json:"title,omitempty"`
+	Message   string    `json:"message"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// For сообщает, адресовано ли событие пользователю
+func (e Event) For(userID int) bool {
+	for _, id := range e.UserIDs {
+		if id == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// Handler синхронно обрабатывает каждое опубликованное событие
+type Handler func(Event)
+
+// Bus - внутренняя шина событий в памяти процесса. Сервисы публикуют события,
+// подписчики (SSE-клиенты) получают их через каналы, а обработчики, которым нельзя
+// терять события (входящие уведомления), вызываются синхронно при публикации.
+type Bus struct {
+	mu       sync.RWMutex
+	subs     map[int]map[*Subscription]struct{}
+	handlers []Handler
+}
+
+type Subscription struct {
+	C      <-chan Event
+	ch     chan Event
+	userID int
+	bus    *Bus
+	once   sync.Once
+}
+
+func NewBus() *Bus {
+	return &Bus{subs: make(map[int]map[*Subscription]struct{})}
+}
+
+// Subscribe создает подписку на события пользователя с буфером заданного размера.
+// События других пользователей в буфер подписки не попадают.
+func (b *Bus) Subscribe(userID, buffer int) *Subscription {
+	ch := make(chan Event, buffer)
+	sub := &Subscription{C: ch, ch: ch, userID: userID, bus: b}
+
+	b.mu.Lock()
+	if b.subs[userID] == nil {
+		b.subs[userID] = make(map[*Subscription]struct{})
+	}
+	b.subs[userID][sub] = struct{}{}
+	b.mu.Unlock()
+
+	return sub
+}
+
+// AddHandler регистрирует обработчик, который вызывается для каждого события
+func (b *Bus) AddHandler(h Handler) {
+	b.mu.Lock()
+	b.handlers = append(b.handlers, h)
+	b.mu.Unlock()
+}
+
+// Close отписывает подписчика и закрывает его канал
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		s.bus.mu.Lock()
+		delete(s.bus.subs[s.userID], s)
+		if len(s.bus.subs[s.userID]) == 0 {
+			delete(s.bus.subs, s.userID)
+		}
+		s.bus.mu.Unlock()
+		close(s.ch)
+	})
+}
+
+// Publish передает событие обработчикам и рассылает его подписчикам адресатов. Рассылка
+// подписчикам не блокируется: если буфер подписчика заполнен, событие для него пропускается.
+func (b *Bus) Publish(e Event) {
+	if b == nil || len(e.UserIDs) == 0 {
+		return
+	}
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = time.Now()
+	}
+
+	// Обработчики вызываются вне блокировки: они обращаются к базе и могут сами
+	// публиковать события или подписываться, не задерживая подписку и отписку клиентов
+	b.mu.RLock()
+	handlers := b.handlers
+	b.mu.RUnlock()
+
+	for _, h := range handlers {
+		h(e)
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	sent := make(map[int]bool, len(e.UserIDs))
+	for _, userID := range e.UserIDs {
+		if sent[userID] {
+			continue
+		}
+		sent[userID] = true
+		for sub := range b.subs[userID] {
+			select {
+			case sub.ch <- e:
+			default:
+			}
+		}
+	}
+}
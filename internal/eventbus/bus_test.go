@@ -0,0 +1,102 @@
+package eventbus_test
+
+import (
+	"ROOmail/internal/eventbus"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBusDeliversEventsToSubscribers(t *testing.T) {
+	bus := eventbus.NewBus()
+	sub := bus.Subscribe(3, 1)
+	defer sub.Close()
+
+	bus.Publish(eventbus.Event{Type: eventbus.TaskAssigned, UserIDs: []int{2, 3}, TaskID: 10})
+
+	e := <-sub.C
+	assert.Equal(t, eventbus.TaskAssigned, e.Type)
+	assert.True(t, e.For(3))
+	assert.False(t, e.For(4))
+	assert.False(t, e.CreatedAt.IsZero())
+}
+
+func TestBusDoesNotBlockOnFullSubscriber(t *testing.T) {
+	bus := eventbus.NewBus()
+	sub := bus.Subscribe(1, 1)
+	defer sub.Close()
+
+	bus.Publish(eventbus.Event{Type: eventbus.TaskUpdated, UserIDs: []int{1}})
+	bus.Publish(eventbus.Event{Type: eventbus.TaskDeleted, UserIDs: []int{1}})
+
+	assert.Equal(t, eventbus.TaskUpdated, (<-sub.C).Type)
+	assert.Len(t, sub.C, 0)
+}
+
+func TestBusFiltersEventsByUser(t *testing.T) {
+	bus := eventbus.NewBus()
+	sub := bus.Subscribe(1, 1)
+	defer sub.Close()
+
+	// Поток чужих событий не вытесняет из буфера событие подписчика
+	for i := 0; i < 10; i++ {
+		bus.Publish(eventbus.Event{Type: eventbus.TaskUpdated, UserIDs: []int{2}})
+	}
+	bus.Publish(eventbus.Event{Type: eventbus.TaskAssigned, UserIDs: []int{2, 1, 1}})
+
+	assert.Equal(t, eventbus.TaskAssigned, (<-sub.C).Type)
+	assert.Len(t, sub.C, 0)
+}
+
+func TestBusCallsHandlers(t *testing.T) {
+	bus := eventbus.NewBus()
+	var handled []eventbus.Event
+	bus.AddHandler(func(e eventbus.Event) { handled = append(handled, e) })
+
+	bus.Publish(eventbus.Event{Type: eventbus.ResponseReviewed, UserIDs: []int{4}})
+	bus.Publish(eventbus.Event{Type: eventbus.TaskUpdated})
+
+	assert.Len(t, handled, 1)
+	assert.Equal(t, eventbus.ResponseReviewed, handled[0].Type)
+}
+
+func TestBusHandlerCanUseBus(t *testing.T) {
+	bus := eventbus.NewBus()
+	sub := bus.Subscribe(1, 2)
+	defer sub.Close()
+
+	// Обработчик вызывается вне блокировки шины и может подписываться и публиковать события
+	bus.AddHandler(func(e eventbus.Event) {
+		if e.Type == eventbus.TaskAssigned {
+			bus.Subscribe(2, 1).Close()
+			bus.Publish(eventbus.Event{Type: eventbus.TaskReminder, UserIDs: e.UserIDs})
+		}
+	})
+
+	done := make(chan struct{})
+	go func() {
+		bus.Publish(eventbus.Event{Type: eventbus.TaskAssigned, UserIDs: []int{1}})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("публикация из обработчика заблокировала шину")
+	}
+
+	assert.Equal(t, eventbus.TaskReminder, (<-sub.C).Type)
+	assert.Equal(t, eventbus.TaskAssigned, (<-sub.C).Type)
+}
+
+func TestSubscriptionClose(t *testing.T) {
+	bus := eventbus.NewBus()
+	sub := bus.Subscribe(1, 1)
+	sub.Close()
+	sub.Close()
+
+	bus.Publish(eventbus.Event{Type: eventbus.TaskUpdated, UserIDs: []int{1}})
+
+	_, ok := <-sub.C
+	assert.False(t, ok)
+}
@@ -0,0 +1,322 @@
+package announcements
+
+import (
+	"ROOmail/internal/audience"
+	"ROOmail/internal/models"
+	"ROOmail/pkg/logger"
+	"ROOmail/pkg/utils"
+	"ROOmail/pkg/utils/jwt_token"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+)
+
+type AnnouncementHandler struct {
+	service *AnnouncementService
+	log     logger.Logger
+}
+
+func NewAnnouncementHandler(service *AnnouncementService, log logger.Logger) *AnnouncementHandler {
+	return &AnnouncementHandler{service: service,
+		log: log,
+	}
+}
+
+// CreateAnnouncementHandler публикует объявление
+// @Summary Создать объявление
+// @Description Рассылает объявление всем пользователям (audience.all), пользователям роли (audience.role), участникам групп (audience.group_ids) и/или отдельным пользователям (audience.user_ids). Условия объединяются. При requires_ack получатели должны подтвердить ознакомление.
+// @Tags Объявления
+// @Accept json
+// @Produce json
+// @Param announcement body models.AnnouncementRequest true "Объявление"
+// @Success 201 {object} map[string]interface{} "Объявление опубликовано"
+// @Failure 400 {string} string "Некорректный запрос"
+// @Failure 401 {string} string "Неавторизованный доступ"
+// @Failure 500 {string} string "Ошибка сервера"
+// @Router /admin/announcements/create [post]
+func (h *AnnouncementHandler) CreateAnnouncementHandler(w http.ResponseWriter, r *http.Request) {
+	h.log.Info("Получен запрос на создание объявления")
+
+	var req models.AnnouncementRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.log.Error("Предоставлен некорректный JSON", err)
+		http.Error(w, "Некорректный JSON", http.StatusBadRequest)
+		return
+	}
+
+	userClaims, ok := r.Context().Value("user").(*jwt_token.Claims)
+	if !ok {
+		h.log.Error("Попытка неавторизованного доступа")
+		http.Error(w, "Неавторизованный доступ", http.StatusUnauthorized)
+		return
+	}
+
+	announcementID, err := h.service.Create(r.Context(), req, userClaims.UserID)
+	if err != nil {
+		h.log.Error("Не удалось создать объявление: ", err)
+		switch {
+		case errors.Is(err, ErrEmptyAnnouncement),
+			errors.Is(err, audience.ErrEmptyAudience),
+			errors.Is(err, audience.ErrUnknownRole),
+			errors.Is(err, audience.ErrUnknownGroup),
+			errors.Is(err, audience.ErrUnknownUser),
+			errors.Is(err, audience.ErrNoRecipients):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, "Не удалось создать объявление", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	h.log.Info("Объявление опубликовано", " announcementID: ", announcementID, " createdBy: ", userClaims.UserID)
+
+	w.WriteHeader(http.StatusCreated)
+	w.Write([]byte(fmt.Sprintf(`{"message": "Объявление опубликовано", "announcement_id": %d}`, announcementID)))
+}
+
+// ListAnnouncementsHandler возвращает все объявления со статистикой ознакомления
+// @Summary Список объявлений
+// @Tags Объявления
+// @Produce json
+// @Param limit query int false "Размер страницы (по умолчанию 30, не более 100)"
+// @Param before_id query int false "Вернуть объявления старше указанного ID"
+// @Success 200 {object} models.AnnouncementPage "Страница объявлений"
+// @Failure 400 {string} string "Некорректные параметры запроса"
+// @Failure 500 {string} string "Ошибка сервера"
+// @Router /admin/announcements/list [get]
+func (h *AnnouncementHandler) ListAnnouncementsHandler(w http.ResponseWriter, r *http.Request) {
+	limit, beforeID, ok := parsePage(w, r)
+	if !ok {
+		return
+	}
+
+	page, err := h.service.List(r.Context(), beforeID, limit)
+	if err != nil {
+		h.log.Error("Не удалось получить объявления: ", err)
+		http.Error(w, "Не удалось получить объявления", http.StatusInternalServerError)
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusOK, page)
+}
+
+// AnnouncementReportHandler возвращает отчет о том, кто ознакомился с объявлением
+// @Summary Отчет об ознакомлении
+// @Tags Объявления
+// @Produce json
+// @Param id path int true "ID объявления"
+// @Param status query string false "pending - не подтвердившие, acknowledged - подтвердившие"
+// @Success 200 {object} models.AnnouncementReport "Отчет"
+// @Failure 400 {string} string "Некорректный запрос"
+// @Failure 404 {string} string "Объявление не найдено"
+// @Failure 500 {string} string "Ошибка сервера"
+// @Router /admin/announcements/report/{id} [get]
+func (h *AnnouncementHandler) AnnouncementReportHandler(w http.ResponseWriter, r *http.Request) {
+	announcementID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		h.log.Error("Некорректный идентификатор объявления", err)
+		http.Error(w, "Некорректный идентификатор объявления", http.StatusBadRequest)
+		return
+	}
+
+	report, err := h.service.Report(r.Context(), announcementID, r.URL.Query().Get("status"))
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidReportFilter):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, ErrAnnouncementNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		default:
+			h.log.Error("Не удалось получить отчет по объявлению: ", err)
+			http.Error(w, "Не удалось получить отчет", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusOK, report)
+}
+
+// DeleteAnnouncementHandler удаляет объявление у всех получателей
+// @Summary Удалить объявление
+// @Tags Объявления
+// @Produce json
+// @Param id path int true "ID объявления"
+// @Success 200 {object} map[string]string "Объявление удалено"
+// @Failure 400 {string} string "Некорректный идентификатор объявления"
+// @Failure 404 {string} string "Объявление не найдено"
+// @Failure 500 {string} string "Ошибка сервера"
+// @Router /admin/announcements/delete/{id} [delete]
+func (h *AnnouncementHandler) DeleteAnnouncementHandler(w http.ResponseWriter, r *http.Request) {
+	announcementID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		h.log.Error("Некорректный идентификатор объявления", err)
+		http.Error(w, "Некорректный идентификатор объявления", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.Delete(r.Context(), announcementID); err != nil {
+		if errors.Is(err, ErrAnnouncementNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		h.log.Error("Не удалось удалить объявление: ", err)
+		http.Error(w, "Не удалось удалить объявление", http.StatusInternalServerError)
+		return
+	}
+
+	h.log.Info("Объявление удалено", " announcementID: ", announcementID)
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"message": "Объявление удалено"}`))
+}
+
+// MyAnnouncementsHandler возвращает объявления текущего пользователя
+// @Summary Мои объявления
+// @Tags Объявления
+// @Produce json
+// @Param limit query int false "Размер страницы (по умолчанию 30, не более 100)"
+// @Param before_id query int false "Вернуть объявления старше указанного ID"
+// @Param pending query bool false "Только ожидающие подтверждения"
+// @Success 200 {object} models.AnnouncementPage "Страница объявлений"
+// @Failure 400 {string} string "Некорректные параметры запроса"
+// @Failure 401 {string} string "Неавторизованный доступ"
+// @Failure 500 {string} string "Ошибка сервера"
+// @Router /announcements [get]
+func (h *AnnouncementHandler) MyAnnouncementsHandler(w http.ResponseWriter, r *http.Request) {
+	userClaims, ok := r.Context().Value("user").(*jwt_token.Claims)
+	if !ok {
+		h.log.Error("Попытка неавторизованного доступа")
+		http.Error(w, "Неавторизованный доступ", http.StatusUnauthorized)
+		return
+	}
+
+	limit, beforeID, ok := parsePage(w, r)
+	if !ok {
+		return
+	}
+
+	var pending bool
+	if raw := r.URL.Query().Get("pending"); raw != "" {
+		var err error
+		if pending, err = strconv.ParseBool(raw); err != nil {
+			http.Error(w, "Некорректное значение параметра pending", http.StatusBadRequest)
+			return
+		}
+	}
+
+	page, err := h.service.ListForUser(r.Context(), userClaims.UserID, beforeID, limit, pending)
+	if err != nil {
+		h.log.Error("Не удалось получить объявления: ", err)
+		http.Error(w, "Не удалось получить объявления", http.StatusInternalServerError)
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusOK, page)
+}
+
+// GetAnnouncementHandler возвращает объявление и отмечает его прочитанным
+// @Summary Получить объявление
+// @Tags Объявления
+// @Produce json
+// @Param id path int true "ID объявления"
+// @Success 200 {object} models.Announcement "Объявление"
+// @Failure 400 {string} string "Некорректный идентификатор объявления"
+// @Failure 401 {string} string "Неавторизованный доступ"
+// @Failure 404 {string} string "Объявление не найдено"
+// @Failure 500 {string} string "Ошибка сервера"
+// @Router /announcements/get/{id} [get]
+func (h *AnnouncementHandler) GetAnnouncementHandler(w http.ResponseWriter, r *http.Request) {
+	userClaims, ok := r.Context().Value("user").(*jwt_token.Claims)
+	if !ok {
+		h.log.Error("Попытка неавторизованного доступа")
+		http.Error(w, "Неавторизованный доступ", http.StatusUnauthorized)
+		return
+	}
+
+	announcementID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		h.log.Error("Некорректный идентификатор объявления", err)
+		http.Error(w, "Некорректный идентификатор объявления", http.StatusBadRequest)
+		return
+	}
+
+	announcement, err := h.service.Get(r.Context(), announcementID, userClaims.UserID)
+	if err != nil {
+		if errors.Is(err, ErrAnnouncementNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		h.log.Error("Не удалось получить объявление: ", err)
+		http.Error(w, "Не удалось получить объявление", http.StatusInternalServerError)
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusOK, announcement)
+}
+
+// AcknowledgeHandler подтверждает ознакомление с объявлением
+// @Summary Подтвердить ознакомление
+// @Tags Объявления
+// @Produce json
+// @Param id path int true "ID объявления"
+// @Success 200 {object} map[string]string "Ознакомление подтверждено"
+// @Failure 400 {string} string "Объявление не требует подтверждения"
+// @Failure 401 {string} string "Неавторизованный доступ"
+// @Failure 404 {string} string "Объявление не найдено"
+// @Failure 500 {string} string "Ошибка сервера"
+// @Router /announcements/ack/{id} [post]
+func (h *AnnouncementHandler) AcknowledgeHandler(w http.ResponseWriter, r *http.Request) {
+	userClaims, ok := r.Context().Value("user").(*jwt_token.Claims)
+	if !ok {
+		h.log.Error("Попытка неавторизованного доступа")
+		http.Error(w, "Неавторизованный доступ", http.StatusUnauthorized)
+		return
+	}
+
+	announcementID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		h.log.Error("Некорректный идентификатор объявления", err)
+		http.Error(w, "Некорректный идентификатор объявления", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.Acknowledge(r.Context(), announcementID, userClaims.UserID); err != nil {
+		switch {
+		case errors.Is(err, ErrAckNotRequired):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, ErrAnnouncementNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		default:
+			h.log.Error("Не удалось подтвердить ознакомление: ", err)
+			http.Error(w, "Не удалось подтвердить ознакомление", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	h.log.Info("Ознакомление с объявлением подтверждено", " announcementID: ", announcementID, " userID: ", userClaims.UserID)
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"message": "Ознакомление подтверждено"}`))
+}
+
+// parsePage разбирает параметры limit и before_id; при ошибке ответ уже отправлен
+func parsePage(w http.ResponseWriter, r *http.Request) (limit, beforeID int, ok bool) {
+	q := r.URL.Query()
+	var err error
+	if raw := q.Get("limit"); raw != "" {
+		if limit, err = strconv.Atoi(raw); err != nil {
+			http.Error(w, "Некорректное значение параметра limit", http.StatusBadRequest)
+			return 0, 0, false
+		}
+	}
+	if raw := q.Get("before_id"); raw != "" {
+		if beforeID, err = strconv.Atoi(raw); err != nil {
+			http.Error(w, "Некорректное значение параметра before_id", http.StatusBadRequest)
+			return 0, 0, false
+		}
+	}
+	return limit, beforeID, true
+}
@@ -0,0 +1,286 @@
+package announcements
+
+import (
+	"ROOmail/internal/audience"
+	"ROOmail/internal/eventbus"
+	"ROOmail/internal/models"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"golang.org/x/net/context"
+	"strings"
+)
+
+const (
+	defaultPageSize = 30
+	maxPageSize     = 100
+)
+
+var (
+	ErrAnnouncementNotFound = errors.New("Объявление не найдено")
+	ErrEmptyAnnouncement    = errors.New("Заголовок объявления обязателен")
+	ErrAckNotRequired       = errors.New("Объявление не требует подтверждения")
+	ErrInvalidReportFilter  = errors.New("Некорректный фильтр отчета")
+)
+
+type AnnouncementService struct {
+	db  *pgxpool.Pool
+	bus *eventbus.Bus
+}
+
+func NewAnnouncementService(db *pgxpool.Pool, bus *eventbus.Bus) *AnnouncementService {
+	return &AnnouncementService{db: db, bus: bus}
+}
+
+// Create сохраняет объявление и рассылает его всем пользователям, подходящим под условия
+func (s *AnnouncementService) Create(ctx context.Context, req models.AnnouncementRequest, createdBy int) (int, error) {
+	req.Title = strings.TrimSpace(req.Title)
+	if req.Title == "" {
+		return 0, ErrEmptyAnnouncement
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	recipients, err := audience.Resolve(ctx, tx, req.Audience)
+	if err != nil {
+		return 0, err
+	}
+
+	var announcementID int
+	err = tx.QueryRow(ctx, `
+		INSERT INTO announcements (title, body, requires_ack, audience, created_by)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id
+	`, req.Title, req.Body, req.RequiresAck, req.Audience, createdBy).Scan(&announcementID)
+	if err != nil {
+		return 0, fmt.Errorf("Не удалось сохранить объявление: %w", err)
+	}
+
+	delivered, err := audience.FanOut(ctx, tx, "announcement_recipients", "announcement_id", announcementID, recipients, createdBy)
+	if err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("Не удалось сохранить объявление: %w", err)
+	}
+
+	message := fmt.Sprintf("Новое объявление: %s", req.Title)
+	if req.RequiresAck {
+		message = fmt.Sprintf("Новое объявление: %s. Требуется подтвердить ознакомление", req.Title)
+	}
+	s.bus.Publish(eventbus.Event{
+		Type:    eventbus.AnnouncementPublished,
+		UserIDs: delivered,
+		Title:   req.Title,
+		Message: message,
+	})
+
+	return announcementID, nil
+}
+
+// List возвращает все объявления со статистикой ознакомления от новых к старым
+func (s *AnnouncementService) List(ctx context.Context, beforeID, limit int) (*models.AnnouncementPage, error) {
+	limit = pageSize(limit)
+
+	rows, err := s.db.Query(ctx, `
+		SELECT a.id, a.title, a.body, a.requires_ack, a.audience, COALESCE(a.created_by, 0), a.created_at,
+		       COUNT(ar.user_id)::int, COUNT(ar.acknowledged_at)::int
+		FROM announcements a
+		LEFT JOIN announcement_recipients ar ON ar.announcement_id = a.id
+		WHERE ($1 = 0 OR a.id < $1)
+		GROUP BY a.id
+		ORDER BY a.id DESC
+		LIMIT $2
+	`, beforeID, limit+1)
+	if err != nil {
+		return nil, fmt.Errorf("Не удалось получить объявления: %w", err)
+	}
+	defer rows.Close()
+
+	page := &models.AnnouncementPage{Announcements: []models.Announcement{}}
+	for rows.Next() {
+		var a models.Announcement
+		var total, acknowledged int
+		if err := rows.Scan(&a.ID, &a.Title, &a.Body, &a.RequiresAck, &a.Audience, &a.CreatedBy, &a.CreatedAt, &total, &acknowledged); err != nil {
+			return nil, fmt.Errorf("Не удалось прочитать объявление: %w", err)
+		}
+		a.RecipientsCount = &total
+		a.AcknowledgedCount = &acknowledged
+		page.Announcements = append(page.Announcements, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("Не удалось получить объявления: %w", err)
+	}
+
+	trimPage(page, limit)
+	return page, nil
+}
+
+// ListForUser возвращает объявления, адресованные пользователю; pendingOnly - только ожидающие подтверждения
+func (s *AnnouncementService) ListForUser(ctx context.Context, userID, beforeID, limit int, pendingOnly bool) (*models.AnnouncementPage, error) {
+	limit = pageSize(limit)
+
+	rows, err := s.db.Query(ctx, `
+		SELECT a.id, a.title, a.body, a.requires_ack, COALESCE(a.created_by, 0), a.created_at, ar.read_at, ar.acknowledged_at
+		FROM announcement_recipients ar
+		JOIN announcements a ON a.id = ar.announcement_id
+		WHERE ar.user_id = $1
+		  AND ($2 = 0 OR a.id < $2)
+		  AND (NOT $3 OR (a.requires_ack AND ar.acknowledged_at IS NULL))
+		ORDER BY a.id DESC
+		LIMIT $4
+	`, userID, beforeID, pendingOnly, limit+1)
+	if err != nil {
+		return nil, fmt.Errorf("Не удалось получить объявления: %w", err)
+	}
+	defer rows.Close()
+
+	page := &models.AnnouncementPage{Announcements: []models.Announcement{}}
+	for rows.Next() {
+		var a models.Announcement
+		if err := rows.Scan(&a.ID, &a.Title, &a.Body, &a.RequiresAck, &a.CreatedBy, &a.CreatedAt, &a.ReadAt, &a.AcknowledgedAt); err != nil {
+			return nil, fmt.Errorf("Не удалось прочитать объявление: %w", err)
+		}
+		page.Announcements = append(page.Announcements, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("Не удалось получить объявления: %w", err)
+	}
+
+	trimPage(page, limit)
+	return page, nil
+}
+
+// Get возвращает объявление получателю и отмечает его прочитанным
+func (s *AnnouncementService) Get(ctx context.Context, announcementID, userID int) (*models.Announcement, error) {
+	var a models.Announcement
+	err := s.db.QueryRow(ctx, `
+		UPDATE announcement_recipients ar
+		SET read_at = COALESCE(ar.read_at, NOW())
+		FROM announcements a
+		WHERE a.id = ar.announcement_id AND ar.announcement_id = $1 AND ar.user_id = $2
+		RETURNING a.id, a.title, a.body, a.requires_ack, COALESCE(a.created_by, 0), a.created_at, ar.read_at, ar.acknowledged_at
+	`, announcementID, userID).Scan(&a.ID, &a.Title, &a.Body, &a.RequiresAck, &a.CreatedBy, &a.CreatedAt, &a.ReadAt, &a.AcknowledgedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrAnnouncementNotFound
+		}
+		return nil, fmt.Errorf("Не удалось получить объявление: %w", err)
+	}
+	return &a, nil
+}
+
+// Acknowledge фиксирует, что получатель ознакомился с объявлением. Повторное подтверждение
+// не меняет исходное время.
+func (s *AnnouncementService) Acknowledge(ctx context.Context, announcementID, userID int) error {
+	var requiresAck bool
+	err := s.db.QueryRow(ctx, `
+		SELECT a.requires_ack
+		FROM announcement_recipients ar
+		JOIN announcements a ON a.id = ar.announcement_id
+		WHERE ar.announcement_id = $1 AND ar.user_id = $2
+	`, announcementID, userID).Scan(&requiresAck)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrAnnouncementNotFound
+		}
+		return fmt.Errorf("Не удалось получить объявление: %w", err)
+	}
+	if !requiresAck {
+		return ErrAckNotRequired
+	}
+
+	_, err = s.db.Exec(ctx, `
+		UPDATE announcement_recipients
+		SET read_at = COALESCE(read_at, NOW()),
+		    acknowledged_at = COALESCE(acknowledged_at, NOW())
+		WHERE announcement_id = $1 AND user_id = $2
+	`, announcementID, userID)
+	if err != nil {
+		return fmt.Errorf("Не удалось подтвердить ознакомление: %w", err)
+	}
+	return nil
+}
+
+// Report возвращает отчет об ознакомлении. filter: "" - все получатели,
+// "pending" - не подтвердившие, "acknowledged" - подтвердившие.
+func (s *AnnouncementService) Report(ctx context.Context, announcementID int, filter string) (*models.AnnouncementReport, error) {
+	if filter != "" && filter != "pending" && filter != "acknowledged" {
+		return nil, ErrInvalidReportFilter
+	}
+
+	report := &models.AnnouncementReport{AnnouncementID: announcementID, Recipients: []models.AnnouncementRecipient{}}
+	err := s.db.QueryRow(ctx, `
+		SELECT a.title, a.requires_ack,
+		       COUNT(ar.user_id)::int, COUNT(ar.read_at)::int, COUNT(ar.acknowledged_at)::int
+		FROM announcements a
+		LEFT JOIN announcement_recipients ar ON ar.announcement_id = a.id
+		WHERE a.id = $1
+		GROUP BY a.id
+	`, announcementID).Scan(&report.Title, &report.RequiresAck, &report.Total, &report.Read, &report.Acknowledged)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrAnnouncementNotFound
+		}
+		return nil, fmt.Errorf("Не удалось получить объявление: %w", err)
+	}
+
+	rows, err := s.db.Query(ctx, `
+		SELECT ar.user_id, u.username, ar.read_at, ar.acknowledged_at
+		FROM announcement_recipients ar
+		JOIN users u ON u.id = ar.user_id
+		WHERE ar.announcement_id = $1
+		  AND ($2 = '' OR ($2 = 'pending') = (ar.acknowledged_at IS NULL))
+		ORDER BY u.username
+	`, announcementID, filter)
+	if err != nil {
+		return nil, fmt.Errorf("Не удалось получить получателей объявления: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var r models.AnnouncementRecipient
+		if err := rows.Scan(&r.UserID, &r.Username, &r.ReadAt, &r.AcknowledgedAt); err != nil {
+			return nil, fmt.Errorf("Не удалось прочитать получателя: %w", err)
+		}
+		report.Recipients = append(report.Recipients, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("Не удалось получить получателей объявления: %w", err)
+	}
+	return report, nil
+}
+
+func (s *AnnouncementService) Delete(ctx context.Context, announcementID int) error {
+	tag, err := s.db.Exec(ctx, `DELETE FROM announcements WHERE id = $1`, announcementID)
+	if err != nil {
+		return fmt.Errorf("Не удалось удалить объявление: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrAnnouncementNotFound
+	}
+	return nil
+}
+
+func pageSize(limit int) int {
+	if limit <= 0 {
+		return defaultPageSize
+	}
+	if limit > maxPageSize {
+		return maxPageSize
+	}
+	return limit
+}
+
+func trimPage(page *models.AnnouncementPage, limit int) {
+	if len(page.Announcements) > limit {
+		page.Announcements = page.Announcements[:limit]
+		page.NextBeforeID = page.Announcements[limit-1].ID
+	}
+}
@@ -0,0 +1,108 @@
+package announcements_test
+
+import (
+	"ROOmail/internal/audience"
+	"ROOmail/internal/handlers/announcements"
+	"ROOmail/internal/models"
+	"ROOmail/pkg/testdb"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateValidation(t *testing.T) {
+	pool := testdb.New(t)
+	ctx := context.Background()
+	adminID := testdb.CreateUser(t, pool, "admin", models.RoleAdmin)
+	service := announcements.NewAnnouncementService(pool, nil)
+
+	cases := []struct {
+		name string
+		req  models.AnnouncementRequest
+		err  error
+	}{
+		{"empty title", models.AnnouncementRequest{Title: "  ", Audience: models.Audience{All: true}}, announcements.ErrEmptyAnnouncement},
+		{"empty audience", models.AnnouncementRequest{Title: "Приказ"}, audience.ErrEmptyAudience},
+		{"unknown role", models.AnnouncementRequest{Title: "Приказ", Audience: models.Audience{Role: "director"}}, audience.ErrUnknownRole},
+		{"unknown group", models.AnnouncementRequest{Title: "Приказ", Audience: models.Audience{GroupIDs: []int{100}}}, audience.ErrUnknownGroup},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := service.Create(ctx, tc.req, adminID)
+			assert.ErrorIs(t, err, tc.err)
+		})
+	}
+}
+
+func TestCreateAndAcknowledge(t *testing.T) {
+	pool := testdb.New(t)
+	ctx := context.Background()
+	adminID := testdb.CreateUser(t, pool, "admin", models.RoleAdmin)
+	school := testdb.CreateUser(t, pool, "school", "users")
+	kindergarten := testdb.CreateUser(t, pool, "kindergarten", "users")
+	disabled := testdb.CreateUser(t, pool, "disabled", "users")
+	_, err := pool.Exec(ctx, `UPDATE users SET is_active = false WHERE id = $1`, disabled)
+	require.NoError(t, err)
+
+	service := announcements.NewAnnouncementService(pool, nil)
+	id, err := service.Create(ctx, models.AnnouncementRequest{
+		Title:       "Приказ о каникулах",
+		RequiresAck: true,
+		Audience:    models.Audience{Role: "users"},
+	}, adminID)
+	require.NoError(t, err)
+
+	// Отключенный пользователь не попадает в рассылку по роли
+	report, err := service.Report(ctx, id, "")
+	require.NoError(t, err)
+	assert.Equal(t, 2, report.Total)
+	assert.Zero(t, report.Acknowledged)
+
+	_, err = service.Get(ctx, id, disabled)
+	assert.ErrorIs(t, err, announcements.ErrAnnouncementNotFound)
+	assert.ErrorIs(t, service.Acknowledge(ctx, id, adminID), announcements.ErrAnnouncementNotFound)
+
+	require.NoError(t, service.Acknowledge(ctx, id, school))
+	require.NoError(t, service.Acknowledge(ctx, id, school))
+
+	pending, err := service.Report(ctx, id, "pending")
+	require.NoError(t, err)
+	require.Len(t, pending.Recipients, 1)
+	assert.Equal(t, kindergarten, pending.Recipients[0].UserID)
+
+	acknowledged, err := service.Report(ctx, id, "acknowledged")
+	require.NoError(t, err)
+	assert.Equal(t, 1, acknowledged.Acknowledged)
+	assert.Equal(t, 1, acknowledged.Read)
+	require.Len(t, acknowledged.Recipients, 1)
+	assert.Equal(t, school, acknowledged.Recipients[0].UserID)
+
+	_, err = service.Report(ctx, id, "late")
+	assert.ErrorIs(t, err, announcements.ErrInvalidReportFilter)
+
+	page, err := service.ListForUser(ctx, kindergarten, 0, 0, true)
+	require.NoError(t, err)
+	require.Len(t, page.Announcements, 1)
+	assert.Equal(t, id, page.Announcements[0].ID)
+}
+
+func TestAcknowledgeNotRequired(t *testing.T) {
+	pool := testdb.New(t)
+	ctx := context.Background()
+	adminID := testdb.CreateUser(t, pool, "admin", models.RoleAdmin)
+	userID := testdb.CreateUser(t, pool, "school", "users")
+
+	service := announcements.NewAnnouncementService(pool, nil)
+	id, err := service.Create(ctx, models.AnnouncementRequest{
+		Title:    "График работы",
+		Audience: models.Audience{UserIDs: []int{userID, userID}},
+	}, adminID)
+	require.NoError(t, err)
+
+	a, err := service.Get(ctx, id, userID)
+	require.NoError(t, err)
+	assert.NotNil(t, a.ReadAt)
+	assert.ErrorIs(t, service.Acknowledge(ctx, id, userID), announcements.ErrAckNotRequired)
+}
@@ -0,0 +1,136 @@
+package apikeys
+
+import (
+	"ROOmail/internal/handlers/roles"
+	"ROOmail/internal/models"
+	"ROOmail/pkg/logger"
+	"ROOmail/pkg/utils"
+	"ROOmail/pkg/utils/jwt_token"
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+)
+
+type APIKeyHandler struct {
+	service *APIKeyService
+	log     logger.Logger
+}
+
+func NewAPIKeyHandler(service *APIKeyService, log logger.Logger) *APIKeyHandler {
+	return &APIKeyHandler{service: service,
+		log: log,
+	}
+}
+
+// ListAPIKeysHandler возвращает API-ключи всех пользователей или одного пользователя
+// @Summary Список API-ключей
+// @Description Возвращает ключи со сроком действия, временем последнего использования и отметкой об отзыве. Сами ключи не хранятся и не возвращаются.
+// @Tags API-ключи
+// @Produce json
+// @Param user_id query int false "ID пользователя"
+// @Success 200 {array} models.APIKey "API-ключи"
+// @Failure 400 {string} string "Некорректный идентификатор пользователя"
+// @Failure 500 {string} string "Ошибка сервера"
+// @Router /admin/api-keys/list [get]
+func (h *APIKeyHandler) ListAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	var userID *int
+	if raw := r.URL.Query().Get("user_id"); raw != "" {
+		id, err := strconv.Atoi(raw)
+		if err != nil {
+			http.Error(w, "Некорректный идентификатор пользователя", http.StatusBadRequest)
+			return
+		}
+		userID = &id
+	}
+
+	keys, err := h.service.List(r.Context(), userID)
+	if err != nil {
+		h.log.Error("Не удалось получить API-ключи: ", err)
+		http.Error(w, "Не удалось получить API-ключи", http.StatusInternalServerError)
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusOK, keys)
+}
+
+// CreateAPIKeyHandler выпускает API-ключ для интеграции
+// @Summary Выпустить API-ключ
+// @Description Ключ действует от имени пользователя user_id, но только в пределах разрешений scopes, которые есть и у его роли. Ключ передается в заголовке X-API-Key и возвращается только в этом ответе. По ключу недоступны маршруты, которые меняют учетные данные и права: создание, изменение и удаление пользователей и ролей, сброс MFA, снятие блокировок входа, завершение сессий других пользователей, выпуск API-ключей.
+// @Tags API-ключи
+// @Accept json
+// @Produce json
+// @Param key body models.APIKeyRequest true "Название, владелец, разрешения и срок действия"
+// @Success 201 {object} models.APIKeyCreated "Ключ выпущен"
+// @Failure 400 {string} string "Некорректные данные"
+// @Failure 401 {string} string "Неавторизованный доступ"
+// @Failure 403 {string} string "Разрешение нельзя выдать или роль владельца шире ваших прав"
+// @Failure 404 {string} string "Пользователь не найден"
+// @Failure 500 {string} string "Ошибка сервера"
+// @Router /admin/api-keys/create [post]
+func (h *APIKeyHandler) CreateAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	userClaims, ok := r.Context().Value("user").(*jwt_token.Claims)
+	if !ok {
+		h.log.Error("Попытка неавторизованного доступа")
+		http.Error(w, "Неавторизованный доступ", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.APIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.log.Error("Ошибка декодирования JSON", err)
+		http.Error(w, "Некорректный JSON", http.StatusBadRequest)
+		return
+	}
+
+	key, err := h.service.Create(r.Context(), req, userClaims)
+	if err != nil {
+		h.writeError(w, "Не удалось выпустить API-ключ", err)
+		return
+	}
+
+	h.log.Info("Выпущен API-ключ ", "keyID: ", key.ID, " userID: ", key.UserID, " issuerID: ", userClaims.UserID)
+	utils.RespondJSON(w, http.StatusCreated, key)
+}
+
+// RevokeAPIKeyHandler отзывает API-ключ
+// @Summary Отозвать API-ключ
+// @Tags API-ключи
+// @Produce json
+// @Param id path int true "ID ключа"
+// @Success 200 {object} map[string]string "Ключ отозван"
+// @Failure 400 {string} string "Некорректный идентификатор ключа"
+// @Failure 404 {string} string "Ключ не найден или уже отозван"
+// @Failure 500 {string} string "Ошибка сервера"
+// @Router /admin/api-keys/revoke/{id} [delete]
+func (h *APIKeyHandler) RevokeAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		h.log.Error("Некорректный идентификатор ключа", err)
+		http.Error(w, "Некорректный идентификатор ключа", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.Revoke(r.Context(), id); err != nil {
+		h.writeError(w, "Не удалось отозвать API-ключ", err)
+		return
+	}
+
+	h.log.Info("API-ключ отозван ", "keyID: ", id)
+	utils.RespondJSON(w, http.StatusOK, map[string]string{"message": "API-ключ отозван"})
+}
+
+func (h *APIKeyHandler) writeError(w http.ResponseWriter, message string, err error) {
+	h.log.Error(message+": ", err)
+	switch {
+	case errors.Is(err, ErrInvalidName), errors.Is(err, ErrNoScopes), errors.Is(err, ErrUnknownPermission), errors.Is(err, ErrInvalidExpiry):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, ErrScopeNotAllowed), errors.Is(err, roles.ErrRoleNotAllowed):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, ErrUserNotFound), errors.Is(err, ErrAPIKeyNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	default:
+		http.Error(w, message, http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,146 @@
+package apikeys
+
+import (
+	"ROOmail/internal/handlers/roles"
+	"ROOmail/internal/models"
+	"ROOmail/pkg/utils/jwt_token"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"golang.org/x/net/context"
+	"strings"
+	"time"
+)
+
+var (
+	ErrAPIKeyNotFound    = errors.New("API-ключ не найден или уже отозван")
+	ErrInvalidName       = errors.New("Название ключа обязательно (не более 100 символов)")
+	ErrNoScopes          = errors.New("Укажите хотя бы одно разрешение ключа")
+	ErrUnknownPermission = errors.New("Неизвестное разрешение")
+	ErrScopeNotAllowed   = errors.New("Нельзя выдать ключу разрешение, которого нет у вас")
+	ErrInvalidExpiry     = errors.New("Срок действия ключа должен быть в будущем")
+	ErrUserNotFound      = errors.New("Пользователь не найден")
+)
+
+type APIKeyService struct {
+	db *pgxpool.Pool
+}
+
+func NewAPIKeyService(db *pgxpool.Pool) *APIKeyService {
+	return &APIKeyService{db: db}
+}
+
+// List возвращает ключи, включая отозванные и истекшие, начиная с новых.
+// Если userID равен nil, возвращаются ключи всех пользователей.
+func (s *APIKeyService) List(ctx context.Context, userID *int) ([]models.APIKey, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT k.id, k.name, k.prefix, k.user_id, u.username, k.scopes, k.created_by,
+		       k.created_at, k.expires_at, k.last_used_at, k.revoked_at
+		FROM api_keys k
+		JOIN users u ON u.id = k.user_id
+		WHERE $1::integer IS NULL OR k.user_id = $1
+		ORDER BY k.created_at DESC
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("Не удалось получить API-ключи: %w", err)
+	}
+	defer rows.Close()
+
+	keys := []models.APIKey{}
+	for rows.Next() {
+		var key models.APIKey
+		err := rows.Scan(&key.ID, &key.Name, &key.Prefix, &key.UserID, &key.Username, &key.Scopes, &key.CreatedBy,
+			&key.CreatedAt, &key.ExpiresAt, &key.LastUsedAt, &key.RevokedAt)
+		if err != nil {
+			return nil, fmt.Errorf("Не удалось прочитать API-ключ: %w", err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// Create выпускает ключ от имени пользователя req.UserID. Выдающий (issuer) может передать
+// ключу только те разрешения, которые есть у него самого, и выпустить ключ только для
+// пользователя, роль которого в пределах его разрешений.
+func (s *APIKeyService) Create(ctx context.Context, req models.APIKeyRequest, issuer *jwt_token.Claims) (*models.APIKeyCreated, error) {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len([]rune(req.Name)) > 100 {
+		return nil, ErrInvalidName
+	}
+	if len(req.Scopes) == 0 {
+		return nil, ErrNoScopes
+	}
+	for _, scope := range req.Scopes {
+		if !issuer.HasPermission(scope) {
+			return nil, fmt.Errorf("%w: %s", ErrScopeNotAllowed, scope)
+		}
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return nil, ErrInvalidExpiry
+	}
+
+	var unknown []string
+	err := s.db.QueryRow(ctx, `
+		SELECT ARRAY(SELECT DISTINCT scope FROM unnest($1::text[]) AS scope
+		             WHERE scope NOT IN (SELECT code FROM permissions) ORDER BY scope)
+	`, req.Scopes).Scan(&unknown)
+	if err != nil {
+		return nil, fmt.Errorf("Не удалось проверить разрешения: %w", err)
+	}
+	if len(unknown) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownPermission, strings.Join(unknown, ", "))
+	}
+
+	var role string
+	err = s.db.QueryRow(ctx, `SELECT role FROM users WHERE id = $1`, req.UserID).Scan(&role)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("Не удалось получить пользователя: %w", err)
+	}
+	if err := roles.Grantable(ctx, s.db, issuer, role); err != nil {
+		return nil, err
+	}
+
+	plain, prefix, hash, err := jwt_token.NewAPIKey()
+	if err != nil {
+		return nil, fmt.Errorf("Не удалось создать API-ключ: %w", err)
+	}
+
+	created := &models.APIKeyCreated{Key: plain}
+	err = s.db.QueryRow(ctx, `
+		WITH k AS (
+			INSERT INTO api_keys (name, prefix, key_hash, user_id, scopes, created_by, expires_at)
+			SELECT $1, $2, $3, $4, ARRAY(SELECT DISTINCT unnest($5::text[]) ORDER BY 1), $6, $7
+			RETURNING id, name, prefix, user_id, scopes, created_by, created_at, expires_at
+		)
+		SELECT k.id, k.name, k.prefix, k.user_id, u.username, k.scopes, k.created_by, k.created_at, k.expires_at
+		FROM k
+		JOIN users u ON u.id = k.user_id
+	`, req.Name, prefix, hash, req.UserID, req.Scopes, issuer.UserID, req.ExpiresAt).Scan(
+		&created.ID, &created.Name, &created.Prefix, &created.UserID, &created.Username, &created.Scopes,
+		&created.CreatedBy, &created.CreatedAt, &created.ExpiresAt)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.ConstraintName == "api_keys_user_id_fkey" {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("Не удалось создать API-ключ: %w", err)
+	}
+	return created, nil
+}
+
+// Revoke отзывает ключ; запросы с ним сразу перестают приниматься
+func (s *APIKeyService) Revoke(ctx context.Context, id int) error {
+	tag, err := s.db.Exec(ctx, `UPDATE api_keys SET revoked_at = NOW() WHERE id = $1 AND revoked_at IS NULL`, id)
+	if err != nil {
+		return fmt.Errorf("Не удалось отозвать API-ключ: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package apikeys_test
+
+import (
+	"ROOmail/internal/handlers/apikeys"
+	"ROOmail/internal/handlers/roles"
+	"ROOmail/internal/models"
+	"ROOmail/pkg/db"
+	"ROOmail/pkg/testdb"
+	"ROOmail/pkg/utils/jwt_token"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// authorize передает ключ через JWTMiddleware и возвращает код ответа и claims запроса
+func authorize(t *testing.T, pool *pgxpool.Pool, key string, next func(http.Handler) http.Handler) (int, *jwt_token.Claims) {
+	t.Helper()
+	db.DB = pool
+	t.Cleanup(func() { db.DB = nil })
+
+	var claims *jwt_token.Claims
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, _ = r.Context().Value("user").(*jwt_token.Claims)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/tasks/list", nil)
+	req.Header.Set(jwt_token.APIKeyHeader, key)
+	rec := httptest.NewRecorder()
+	jwt_token.JWTMiddleware(next(handler)).ServeHTTP(rec, req)
+	return rec.Code, claims
+}
+
+func noop(next http.Handler) http.Handler { return next }
+
+func TestCreateAPIKey(t *testing.T) {
+	pool := testdb.New(t)
+	ctx := context.Background()
+	service := apikeys.NewAPIKeyService(pool)
+	admin := testdb.Claims(t, pool, testdb.CreateUser(t, pool, "root", models.RoleAdmin))
+	teacherID := testdb.CreateUser(t, pool, "teacher", "users")
+	teacher := testdb.Claims(t, pool, teacherID)
+
+	past := time.Now().Add(-time.Minute)
+	unknown := &jwt_token.Claims{UserID: admin.UserID, Permissions: []string{"tasks:fly"}}
+	cases := []struct {
+		name   string
+		req    models.APIKeyRequest
+		issuer *jwt_token.Claims
+		err    error
+	}{
+		{"empty name", models.APIKeyRequest{Name: " ", UserID: teacherID, Scopes: []string{models.PermTasksRead}}, admin, apikeys.ErrInvalidName},
+		{"no scopes", models.APIKeyRequest{Name: "CRM", UserID: teacherID}, admin, apikeys.ErrNoScopes},
+		{"scope not allowed", models.APIKeyRequest{Name: "CRM", UserID: teacherID, Scopes: []string{models.PermTasksRead}}, teacher, apikeys.ErrScopeNotAllowed},
+		{"unknown scope", models.APIKeyRequest{Name: "CRM", UserID: teacherID, Scopes: []string{"tasks:fly"}}, unknown, apikeys.ErrUnknownPermission},
+		{"expired", models.APIKeyRequest{Name: "CRM", UserID: teacherID, Scopes: []string{models.PermTasksRead}, ExpiresAt: &past}, admin, apikeys.ErrInvalidExpiry},
+		{"unknown user", models.APIKeyRequest{Name: "CRM", UserID: 1_000_000, Scopes: []string{models.PermTasksRead}}, admin, apikeys.ErrUserNotFound},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := service.Create(ctx, tc.req, tc.issuer)
+			assert.ErrorIs(t, err, tc.err)
+		})
+	}
+
+	created, err := service.Create(ctx, models.APIKeyRequest{
+		Name:   " CRM ",
+		UserID: teacherID,
+		Scopes: []string{models.PermTasksRead, models.PermTasksExecute, models.PermTasksRead},
+	}, admin)
+	require.NoError(t, err)
+	assert.Equal(t, "CRM", created.Name)
+	assert.Equal(t, "teacher", created.Username)
+	assert.Equal(t, []string{models.PermTasksExecute, models.PermTasksRead}, created.Scopes)
+	require.NotNil(t, created.CreatedBy)
+	assert.Equal(t, admin.UserID, *created.CreatedBy)
+
+	// Хранится только хеш ключа
+	var hash string
+	require.NoError(t, pool.QueryRow(ctx, `SELECT key_hash FROM api_keys WHERE id = $1`, created.ID).Scan(&hash))
+	assert.Equal(t, jwt_token.HashAPIKey(created.Key), hash)
+
+	list, err := service.List(ctx, &teacherID)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, created.ID, list[0].ID)
+	assert.Equal(t, created.Prefix, list[0].Prefix)
+
+	otherID := admin.UserID
+	list, err = service.List(ctx, &otherID)
+	require.NoError(t, err)
+	assert.Empty(t, list)
+
+	// Ключ действует только в пределах разрешений, которые есть и у роли владельца
+	code, claims := authorize(t, pool, created.Key, noop)
+	require.Equal(t, http.StatusOK, code)
+	require.NotNil(t, claims)
+	assert.Equal(t, teacherID, claims.UserID)
+	assert.Equal(t, created.ID, claims.APIKeyID)
+	assert.Equal(t, []string{models.PermTasksExecute}, claims.Permissions)
+
+	// Маршруты, которые меняют учетные данные и права, по ключу недоступны
+	code, _ = authorize(t, pool, created.Key, jwt_token.SessionOnlyMiddleware)
+	assert.Equal(t, http.StatusForbidden, code)
+}
+
+func TestCreateAPIKeyWithinOwnPermissions(t *testing.T) {
+	pool := testdb.New(t)
+	ctx := context.Background()
+	service := apikeys.NewAPIKeyService(pool)
+	admin := testdb.Claims(t, pool, testdb.CreateUser(t, pool, "root", models.RoleAdmin))
+	teacherID := testdb.CreateUser(t, pool, "teacher", "users")
+
+	require.NoError(t, roles.NewRoleService(pool).Create(ctx, models.RoleRequest{
+		Name:        "integrations",
+		Permissions: []string{models.PermSecurityManage, models.PermTasksRead, models.PermTasksExecute},
+	}, admin))
+	issuer := testdb.Claims(t, pool, testdb.CreateUser(t, pool, "integrator", "integrations"))
+
+	// Ключ от имени администратора дал бы доступ к его разрешениям, которых у выдающего нет
+	_, err := service.Create(ctx, models.APIKeyRequest{Name: "CRM", UserID: admin.UserID, Scopes: []string{models.PermTasksRead}}, issuer)
+	assert.ErrorIs(t, err, roles.ErrRoleNotAllowed)
+	list, err := service.List(ctx, nil)
+	require.NoError(t, err)
+	assert.Empty(t, list)
+
+	_, err = service.Create(ctx, models.APIKeyRequest{Name: "CRM", UserID: teacherID, Scopes: []string{models.PermTasksExecute}}, issuer)
+	require.NoError(t, err)
+}
+
+func TestRevokeAPIKey(t *testing.T) {
+	pool := testdb.New(t)
+	ctx := context.Background()
+	service := apikeys.NewAPIKeyService(pool)
+	admin := testdb.Claims(t, pool, testdb.CreateUser(t, pool, "root", models.RoleAdmin))
+
+	created, err := service.Create(ctx, models.APIKeyRequest{Name: "CRM", UserID: admin.UserID, Scopes: []string{models.PermTasksRead}}, admin)
+	require.NoError(t, err)
+	code, _ := authorize(t, pool, created.Key, noop)
+	require.Equal(t, http.StatusOK, code)
+
+	require.NoError(t, service.Revoke(ctx, created.ID))
+	assert.ErrorIs(t, service.Revoke(ctx, created.ID), apikeys.ErrAPIKeyNotFound)
+	assert.ErrorIs(t, service.Revoke(ctx, created.ID+1), apikeys.ErrAPIKeyNotFound)
+
+	code, claims := authorize(t, pool, created.Key, noop)
+	assert.Equal(t, http.StatusUnauthorized, code)
+	assert.Nil(t, claims)
+
+	list, err := service.List(ctx, nil)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.NotNil(t, list[0].RevokedAt)
+}
@@ -1,19 +1,39 @@
 package auth
 
 import (
+	"ROOmail/internal/handlers/roles"
+	"ROOmail/internal/models"
+	"ROOmail/internal/passwords"
+	"ROOmail/internal/tokens"
 	"ROOmail/pkg/logger"
 	"ROOmail/pkg/utils"
 	"ROOmail/pkg/utils/jwt_token"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 )
 
 var (
-	authService = AuthServiceInstance()
-	log         = logger.NewZapLogger()
+	authService    = AuthServiceInstance()
+	log            = logger.NewZapLogger()
+	passwordPolicy = passwords.NewPolicy(8, 3, 0, nil)
+	lockouts       *LockoutService
+	tokenStore     *tokens.Store
 )
 
+// SetTokenStore задает хранилище refresh-токенов
+func SetTokenStore(store *tokens.Store) {
+	tokenStore = store
+}
+
+// SetPasswordPolicy задает политику паролей, по которой определяется истечение пароля при входе
+func SetPasswordPolicy(policy *passwords.Policy) {
+	passwordPolicy = policy
+}
+
 type LoginRequest struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
@@ -23,18 +43,34 @@ type LoginResponse struct {
 	Token    string `json:"token"`
 	Username string `json:"username"`
 	Role     string `json:"role"`
+	// RefreshToken обменивается на новую пару токенов через /auth/refresh
+	RefreshToken     string    `json:"refresh_token"`
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+	// MustChangePassword - пароль назначен администратором или истек, его нужно сменить через /user/password
+	MustChangePassword bool       `json:"must_change_password"`
+	PasswordExpiresAt  *time.Time `json:"password_expires_at,omitempty"`
+	// RecoveryCodes - коды восстановления, выданные при настройке второго фактора во время входа
+	RecoveryCodes []string `json:"recovery_codes,omitempty"`
+}
+
+// SetLockoutService включает защиту от подбора паролей
+func SetLockoutService(service *LockoutService) {
+	lockouts = service
 }
 
 // LoginHandler handles user login
 // @Summary Вход пользователя
-// @Description Аутентифицирует пользователя и возвращает jwt_token токен
+// @Description Аутентифицирует пользователя и возвращает jwt_token токен. Флаг must_change_password означает, что пароль нужно сменить: его потребовал администратор или истек срок действия. До смены пароля через /user/password остальные маршруты отвечают 403.
+// @Description Если у пользователя включена двухфакторная аутентификация или она обязательна для его роли, вместо токенов возвращается models.MFAChallenge с промежуточным токеном для /auth/mfa/verify.
 // @Tags auth
 // @Accept json
 // @Produce json
 // @Param loginRequest body LoginRequest true "Имя пользователя и пароль"
 // @Success 200 {object} LoginResponse "Успешный вход"
+// @Success 202 {object} models.MFAChallenge "Нужен код подтверждения"
 // @Failure 400 {object} map[string]string "Некорректный запрос"
 // @Failure 401 {object} map[string]string "Неверное имя пользователя или пароль"
+// @Failure 429 {object} map[string]string "Вход временно заблокирован, время ожидания в заголовке Retry-After"
 // @Failure 500 {object} map[string]string "Ошибка генерации токена"
 // @Router /auth/login [post]
 func LoginHandler(w http.ResponseWriter, r *http.Request) {
@@ -46,36 +82,147 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	ip := utils.ClientIP(r)
+	if lockouts != nil {
+		retryAfter, err := lockouts.Attempt(ctx, req.Username, ip)
+		if err != nil {
+			// Сбой проверки не должен закрывать вход всем пользователям
+			log.Error("Ошибка проверки блокировки входа: ", err)
+		}
+		if retryAfter > 0 {
+			log.Warn("Вход заблокирован: ", req.Username, " с адреса ", ip)
+			w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())))
+			utils.RespondJSON(w, http.StatusTooManyRequests, map[string]string{"error": "Слишком много неудачных попыток входа, повторите позже"})
+			return
+		}
+	}
+
 	log.Info("Попытка входа пользователя: ", req.Username)
 	user, err := authService.AuthenticateUser(ctx, req.Username, req.Password)
 	if err != nil {
-		log.Warn("Неудачная попытка входа пользователя: ", req.Username)
+		log.Warn("Неудачная попытка входа пользователя: ", req.Username, " с адреса ", ip)
 		utils.RespondJSON(w, http.StatusUnauthorized, map[string]string{"error": "Неверное имя пользователя или пароль"})
 		return
 	}
 
-	token, err := jwt_token.GenerateJWT(user.ID, user.Username, user.Role)
+	// Счетчик неудач сбрасывается только после второго фактора, в completeLogin: иначе верный
+	// пароль обнулял бы неудачные попытки подбора кода
+	if lockouts != nil {
+		if err := lockouts.Release(ctx, req.Username, ip); err != nil {
+			log.Error("Ошибка учета успешной попытки входа: ", err)
+		}
+	}
+
+	if mfa != nil && (user.TOTPEnabled || mfa.Required(user.Role)) {
+		token, expiresAt, err := mfa.NewChallenge(ctx, user.ID)
+		if err != nil {
+			log.Error("Ошибка создания промежуточного токена для пользователя: ", req.Username, " - ", err)
+			utils.RespondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Ошибка при генерации токена"})
+			return
+		}
+		log.Info("Пароль пользователя проверен, ожидается код подтверждения: ", user.Username)
+		utils.RespondJSON(w, http.StatusAccepted, models.MFAChallenge{
+			MFARequired:   true,
+			SetupRequired: !user.TOTPEnabled,
+			MFAToken:      token,
+			ExpiresAt:     expiresAt,
+		})
+		return
+	}
+
+	completeLogin(w, r, user, nil)
+}
+
+// completeLogin открывает сессию и отвечает токенами после всех проверок входа
+func completeLogin(w http.ResponseWriter, r *http.Request, user *models.User, recoveryCodes []string) {
+	if lockouts != nil {
+		if err := lockouts.Reset(r.Context(), user.Username); err != nil {
+			log.Error("Ошибка сброса счетчика неудачных попыток: ", err)
+		}
+	}
+
+	pair, err := tokenStore.Issue(r.Context(), user, models.SessionMeta{IP: utils.ClientIP(r), UserAgent: r.UserAgent()})
 	if err != nil {
-		log.Error("Ошибка генерации токена для пользователя: ", req.Username, " - ", err)
+		log.Error("Ошибка генерации токена для пользователя: ", user.Username, " - ", err)
 		utils.RespondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Ошибка при генерации токена"})
 		return
 	}
 
 	resp := LoginResponse{
-		Token:    token,
-		Username: user.Username,
-		Role:     user.Role,
+		Token:              pair.AccessToken,
+		RefreshToken:       pair.RefreshToken,
+		RefreshExpiresAt:   pair.RefreshExpiresAt,
+		Username:           user.Username,
+		Role:               user.Role,
+		MustChangePassword: user.MustChangePassword || passwordPolicy.Expired(user.PasswordChangedAt, time.Now()),
+		PasswordExpiresAt:  passwordPolicy.ExpiresAt(user.PasswordChangedAt),
+		RecoveryCodes:      recoveryCodes,
 	}
 	log.Info("Успешный вход пользователя: ", user.Username)
 	utils.RespondJSON(w, http.StatusOK, resp)
 }
 
+// RefreshRequest - refresh-токен для продления сессии или выхода
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// RefreshResponse - новая пара токенов
+type RefreshResponse struct {
+	Token            string    `json:"token"`
+	RefreshToken     string    `json:"refresh_token"`
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+}
+
+// RefreshHandler обменивает refresh-токен на новую пару токенов
+// @Summary Продление сессии
+// @Description Выдает новый токен доступа и новый refresh-токен; предъявленный refresh-токен становится недействительным. Повторное предъявление уже использованного refresh-токена отзывает все токены этой цепочки.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body RefreshRequest true "Refresh-токен"
+// @Success 200 {object} RefreshResponse "Новая пара токенов"
+// @Failure 400 {object} map[string]string "Некорректный запрос"
+// @Failure 401 {object} map[string]string "Refresh-токен недействителен, истек или уже использован"
+// @Failure 500 {object} map[string]string "Ошибка генерации токена"
+// @Router /auth/refresh [post]
+func RefreshHandler(w http.ResponseWriter, r *http.Request) {
+	var req RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		utils.RespondJSON(w, http.StatusBadRequest, map[string]string{"error": "Некорректный запрос"})
+		return
+	}
+
+	pair, err := tokenStore.Rotate(r.Context(), req.RefreshToken)
+	if err != nil {
+		switch {
+		case errors.Is(err, tokens.ErrRefreshTokenReused):
+			log.Warn("Повторное использование refresh-токена с адреса ", utils.ClientIP(r), ", цепочка отозвана")
+			utils.RespondJSON(w, http.StatusUnauthorized, map[string]string{"error": err.Error()})
+		case errors.Is(err, tokens.ErrInvalidRefreshToken):
+			utils.RespondJSON(w, http.StatusUnauthorized, map[string]string{"error": err.Error()})
+		default:
+			log.Error("Ошибка продления сессии: ", err)
+			utils.RespondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Ошибка при генерации токена"})
+		}
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusOK, RefreshResponse{
+		Token:            pair.AccessToken,
+		RefreshToken:     pair.RefreshToken,
+		RefreshExpiresAt: pair.RefreshExpiresAt,
+	})
+}
+
 // LogoutHandler handles user logout
 // @Summary Выход пользователя
-// @Description Отзывает jwt_token токен пользователя
+// @Description Отзывает jwt_token токен пользователя и завершает его сессию: после выхода ни токен, ни refresh-токены этой сессии больше не принимаются. Если в теле передан refresh_token другой сессии, завершается и она.
 // @Tags auth
+// @Accept json
 // @Produce json
 // @Param Authorization header string true "Bearer <token>"
+// @Param request body RefreshRequest false "Refresh-токен сессии"
 // @Success 200 {object} map[string]string "Успешный выход"
 // @Failure 401 {object} map[string]string "Требуется заголовок авторизации или он некорректен"
 // @Failure 500 {object} map[string]string "Ошибка отзыва токена"
@@ -98,11 +245,110 @@ func LogoutHandler(w http.ResponseWriter, r *http.Request) {
 
 	token := parts[1]
 	if err := authService.RevokeToken(ctx, token); err != nil {
-		log.Error("Ошибка отзыва токена: ", token, " - ", err)
+		if errors.Is(err, ErrInvalidToken) {
+			log.Warn("Попытка выхода с недействительным токеном")
+			utils.RespondJSON(w, http.StatusUnauthorized, map[string]string{"error": "Недействительный токен"})
+			return
+		}
+		log.Error("Ошибка отзыва токена: ", err)
 		utils.RespondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Ошибка при отзыве токена"})
 		return
 	}
 
-	log.Info("Пользователь вышел, токен отозван: ", token)
+	// Токен уже проверен при отзыве, поэтому ошибку разбора можно не обрабатывать
+	if claims, err := jwt_token.ParseToken(token); err == nil && claims.SessionID != "" {
+		err := tokenStore.RevokeSession(ctx, claims.SessionID, &claims.UserID)
+		if err != nil && !errors.Is(err, tokens.ErrSessionNotFound) {
+			log.Error("Ошибка завершения сессии: ", err)
+			utils.RespondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Ошибка при отзыве токена"})
+			return
+		}
+	}
+
+	// Тело необязательно: клиенты без refresh-токена отправляют пустой запрос
+	var req RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err == nil && req.RefreshToken != "" {
+		if err := tokenStore.Revoke(ctx, req.RefreshToken); err != nil {
+			log.Error("Ошибка отзыва refresh-токена: ", err)
+			utils.RespondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Ошибка при отзыве токена"})
+			return
+		}
+	}
+
+	log.Info("Пользователь вышел, токен отозван")
 	utils.RespondJSON(w, http.StatusOK, map[string]string{"message": "Выход выполнен успешно"})
 }
+
+// ListLockoutsHandler возвращает счетчики неудачных попыток входа
+// @Summary Блокировки входа
+// @Description Возвращает счетчики неудачных попыток входа по именам пользователей и IP-адресам. С active=true - только действующие блокировки.
+// @Tags auth
+// @Produce json
+// @Param active query bool false "Только действующие блокировки"
+// @Success 200 {array} models.LoginLockout "Счетчики и блокировки"
+// @Failure 400 {object} map[string]string "Некорректный параметр active"
+// @Failure 500 {object} map[string]string "Ошибка получения блокировок"
+// @Router /admin/auth/lockouts [get]
+func ListLockoutsHandler(w http.ResponseWriter, r *http.Request) {
+	activeOnly := false
+	if raw := r.URL.Query().Get("active"); raw != "" {
+		var err error
+		if activeOnly, err = strconv.ParseBool(raw); err != nil {
+			utils.RespondJSON(w, http.StatusBadRequest, map[string]string{"error": "Некорректное значение параметра active"})
+			return
+		}
+	}
+
+	result, err := lockouts.List(r.Context(), activeOnly)
+	if err != nil {
+		log.Error("Ошибка получения блокировок входа: ", err)
+		utils.RespondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Ошибка получения блокировок"})
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusOK, result)
+}
+
+// UnlockHandler снимает блокировку входа
+// @Summary Снять блокировку входа
+// @Description Сбрасывает счетчики неудачных попыток и снимает блокировку для имени пользователя и/или IP-адреса.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body models.UnlockRequest true "Имя пользователя и/или IP-адрес"
+// @Success 200 {object} map[string]string "Блокировка снята"
+// @Failure 400 {object} map[string]string "Некорректный запрос"
+// @Failure 401 {object} map[string]string "Неавторизованный доступ"
+// @Failure 403 {object} map[string]string "Роль пользователя шире прав администратора"
+// @Failure 500 {object} map[string]string "Ошибка снятия блокировки"
+// @Router /admin/auth/unlock [post]
+func UnlockHandler(w http.ResponseWriter, r *http.Request) {
+	userClaims, ok := r.Context().Value("user").(*jwt_token.Claims)
+	if !ok {
+		utils.RespondJSON(w, http.StatusUnauthorized, map[string]string{"error": "Неавторизованный доступ"})
+		return
+	}
+
+	var req models.UnlockRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondJSON(w, http.StatusBadRequest, map[string]string{"error": "Некорректный запрос"})
+		return
+	}
+
+	if err := lockouts.Unlock(r.Context(), req, userClaims); err != nil {
+		if errors.Is(err, ErrNothingToUnlock) {
+			utils.RespondJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, roles.ErrRoleNotAllowed) {
+			utils.RespondJSON(w, http.StatusForbidden, map[string]string{"error": err.Error()})
+			return
+		}
+		log.Error("Ошибка снятия блокировки входа: ", err)
+		utils.RespondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Ошибка снятия блокировки"})
+		return
+	}
+
+	log.Info("Блокировка входа снята: ", req.Username, " ", req.IP)
+	utils.RespondJSON(w, http.StatusOK, map[string]string{"message": "Блокировка снята"})
+}
@@ -0,0 +1,145 @@
+package auth_test
+
+import (
+	"ROOmail/internal/handlers/auth"
+	"ROOmail/internal/models"
+	"ROOmail/internal/tokens"
+	"ROOmail/internal/totp"
+	"ROOmail/pkg/db"
+	"ROOmail/pkg/testdb"
+	"ROOmail/pkg/utils/jwt_token"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupLogin подключает обработчики входа к тестовой базе
+func setupLogin(t *testing.T) (*pgxpool.Pool, *auth.MFAService) {
+	pool := testdb.New(t)
+	db.DB = pool
+	t.Cleanup(func() {
+		db.DB = nil
+		auth.SetLockoutService(nil)
+		auth.SetMFAService(nil)
+	})
+
+	keys, err := jwt_token.NewSecretKeySet("auth-test-secret")
+	require.NoError(t, err)
+	jwt_token.SetKeySet(keys)
+
+	mfa := auth.NewMFAService(pool, "ROOmail", nil)
+	auth.SetTokenStore(tokens.NewStore(pool, time.Hour))
+	auth.SetLockoutService(newLockoutService(pool))
+	auth.SetMFAService(mfa)
+	return pool, mfa
+}
+
+// post вызывает обработчик с JSON-телом и возвращает код и разобранный ответ
+func post(t *testing.T, handler http.HandlerFunc, body interface{}, response interface{}) int {
+	payload, err := json.Marshal(body)
+	require.NoError(t, err)
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(payload))
+	req.RemoteAddr = "10.0.0.1:40000"
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	if response != nil && rec.Code < http.StatusBadRequest {
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), response))
+	}
+	return rec.Code
+}
+
+func usernameFailures(t *testing.T, pool *pgxpool.Pool, username string) int {
+	var count int
+	err := pool.QueryRow(context.Background(),
+		`SELECT COALESCE(SUM(failed_count), 0) FROM login_failures WHERE kind = 'username' AND key = $1`, username).Scan(&count)
+	require.NoError(t, err)
+	return count
+}
+
+func TestLoginWithMFA(t *testing.T) {
+	pool, mfa := setupLogin(t)
+	ctx := context.Background()
+	userID := testdb.CreateUser(t, pool, "teacher", "users")
+
+	setup, err := mfa.Setup(ctx, userID)
+	require.NoError(t, err)
+	code, err := totp.Code(setup.Secret, totp.Step(time.Now()), 6)
+	require.NoError(t, err)
+	recoveryCodes, err := mfa.Enable(ctx, userID, code)
+	require.NoError(t, err)
+	require.NotEmpty(t, recoveryCodes)
+
+	// Неудачная попытка подбора уже учтена
+	_, err = newLockoutService(pool).Attempt(ctx, "teacher", "10.0.0.9")
+	require.NoError(t, err)
+
+	var challenge models.MFAChallenge
+	status := post(t, auth.LoginHandler, auth.LoginRequest{Username: "teacher", Password: testdb.Password}, &challenge)
+	require.Equal(t, http.StatusAccepted, status)
+	assert.True(t, challenge.MFARequired)
+	assert.False(t, challenge.SetupRequired)
+	require.NotEmpty(t, challenge.MFAToken)
+
+	// Верный пароль без второго фактора не сбрасывает счетчик неудач
+	assert.Equal(t, 1, usernameFailures(t, pool, "teacher"))
+
+	status = post(t, auth.MFAVerifyHandler, models.MFAChallengeRequest{MFAToken: challenge.MFAToken, Code: "000000"}, nil)
+	assert.Equal(t, http.StatusUnauthorized, status)
+	assert.Equal(t, 2, usernameFailures(t, pool, "teacher"))
+
+	var login auth.LoginResponse
+	status = post(t, auth.MFAVerifyHandler, models.MFAChallengeRequest{MFAToken: challenge.MFAToken, Code: recoveryCodes[0]}, &login)
+	require.Equal(t, http.StatusOK, status)
+	assert.NotEmpty(t, login.Token)
+	assert.NotEmpty(t, login.RefreshToken)
+	assert.Equal(t, "teacher", login.Username)
+	assert.Zero(t, usernameFailures(t, pool, "teacher"))
+
+	// Промежуточный токен одноразовый
+	status = post(t, auth.MFAVerifyHandler, models.MFAChallengeRequest{MFAToken: challenge.MFAToken, Code: recoveryCodes[1]}, nil)
+	assert.Equal(t, http.StatusUnauthorized, status)
+}
+
+func TestLoginMFALockout(t *testing.T) {
+	pool, mfa := setupLogin(t)
+	ctx := context.Background()
+	userID := testdb.CreateUser(t, pool, "teacher", "users")
+
+	setup, err := mfa.Setup(ctx, userID)
+	require.NoError(t, err)
+	code, err := totp.Code(setup.Secret, totp.Step(time.Now()), 6)
+	require.NoError(t, err)
+	recoveryCodes, err := mfa.Enable(ctx, userID, code)
+	require.NoError(t, err)
+
+	var challenge models.MFAChallenge
+	require.Equal(t, http.StatusAccepted, post(t, auth.LoginHandler, auth.LoginRequest{Username: "teacher", Password: testdb.Password}, &challenge))
+
+	// Подбор кода блокирует вход так же, как подбор пароля: после порога не принимается и верный код
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusUnauthorized, post(t, auth.MFAVerifyHandler, models.MFAChallengeRequest{MFAToken: challenge.MFAToken, Code: "000000"}, nil))
+	}
+	assert.Equal(t, http.StatusTooManyRequests, post(t, auth.MFAVerifyHandler, models.MFAChallengeRequest{MFAToken: challenge.MFAToken, Code: recoveryCodes[0]}, nil))
+	assert.Equal(t, http.StatusTooManyRequests, post(t, auth.LoginHandler, auth.LoginRequest{Username: "teacher", Password: testdb.Password}, nil))
+}
+
+func TestLoginWithoutMFA(t *testing.T) {
+	pool, _ := setupLogin(t)
+	testdb.CreateUser(t, pool, "teacher", "users")
+
+	var login auth.LoginResponse
+	require.Equal(t, http.StatusOK, post(t, auth.LoginHandler, auth.LoginRequest{Username: "teacher", Password: testdb.Password}, &login))
+	assert.NotEmpty(t, login.Token)
+	assert.False(t, login.MustChangePassword)
+
+	assert.Equal(t, http.StatusUnauthorized, post(t, auth.LoginHandler, auth.LoginRequest{Username: "teacher", Password: "wrong"}, nil))
+	assert.Equal(t, 1, usernameFailures(t, pool, "teacher"))
+}
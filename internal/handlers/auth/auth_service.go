@@ -3,23 +3,40 @@ package auth
 import (
 	"ROOmail/internal/models"
 	"ROOmail/pkg/db"
+	"ROOmail/pkg/logger"
 	"ROOmail/pkg/utils"
 	"ROOmail/pkg/utils/jwt_token"
 	"context"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
 )
 
+var (
+	ErrInvalidToken       = errors.New("Недействительный токен")
+	ErrInvalidCredentials = errors.New("неверные учетные данные")
+	// ErrUnknownUser - источник не знает пользователя, вход проверяется в следующем источнике
+	ErrUnknownUser = errors.New("пользователь не найден")
+)
+
 type AuthInterface interface {
 	AuthenticateUser(ctx context.Context, username, password string) (*models.User, error)
-	IsTokenRevoked(token string) bool
-	CleanupRevokedTokens()
+	IsTokenRevoked(ctx context.Context, tokenID string) (bool, error)
+	CleanupRevokedTokens(ctx context.Context, interval time.Duration, log logger.Logger)
 	RevokeToken(ctx context.Context, token string) error
 }
 
+// Authenticator проверяет имя пользователя и пароль в одном источнике учетных записей
+// и возвращает учетную запись ROOmail
+type Authenticator interface {
+	Authenticate(ctx context.Context, username, password string) (*models.User, error)
+}
+
+// AuthService проверяет учетные данные по источникам учетных записей и хранит отозванные
+// токены в таблице revoked_tokens по идентификатору (jti). JWTMiddleware проверяет ее при каждом запросе.
 type AuthService struct {
-	blacklist sync.Map
+	authenticators []Authenticator
 }
 
 var instance *AuthService
@@ -27,57 +44,101 @@ var once sync.Once
 
 func AuthServiceInstance() *AuthService {
 	once.Do(func() {
-		instance = &AuthService{}
+		instance = &AuthService{authenticators: []Authenticator{LocalAuthenticator{}}}
 	})
 	return instance
 }
 
+// SetAuthenticators задает источники учетных записей в порядке проверки. По умолчанию
+// используются только локальные учетные записи. Вызывается при запуске, до обработки запросов.
+func (s *AuthService) SetAuthenticators(authenticators ...Authenticator) {
+	s.authenticators = authenticators
+}
+
+// AuthenticateUser проверяет учетные данные в источниках по порядку: следующий источник
+// опрашивается, только если предыдущий не знает пользователя
 func (s *AuthService) AuthenticateUser(ctx context.Context, username, password string) (*models.User, error) {
+	for _, authenticator := range s.authenticators {
+		user, err := authenticator.Authenticate(ctx, username, password)
+		if errors.Is(err, ErrUnknownUser) {
+			continue
+		}
+		if err != nil {
+			time.Sleep(1 * time.Second)
+			return nil, err
+		}
+		return user, nil
+	}
+
+	// Неизвестное имя отвечает так же и с той же задержкой, что и неверный пароль
+	time.Sleep(1 * time.Second)
+	return nil, ErrInvalidCredentials
+}
+
+// LocalAuthenticator проверяет пароль по хешу в таблице users. Учетные записи из каталога
+// он не проверяет: их пароль хранится в каталоге.
+type LocalAuthenticator struct{}
+
+func (LocalAuthenticator) Authenticate(ctx context.Context, username, password string) (*models.User, error) {
 	user, err := db.GetUserByUsername(ctx, username)
-	if err != nil {
-		return nil, fmt.Errorf("не удалось выполнить аутентификацию пользователя")
+	if err != nil || user.AuthSource != models.AuthSourceLocal {
+		return nil, ErrUnknownUser
 	}
 
 	if !utils.CheckPassword(password, user.Password) {
-		time.Sleep(1 * time.Second)
-		return nil, fmt.Errorf("неверные учетные данные")
+		return nil, ErrInvalidCredentials
 	}
 
 	return user, nil
 }
 
+// RevokeToken отзывает токен до истечения его срока действия
 func (s *AuthService) RevokeToken(ctx context.Context, token string) error {
-	if ctx.Err() != nil {
-		return fmt.Errorf("context canceled or deadline exceeded")
+	claims, err := jwt_token.ParseToken(token)
+	if err != nil || claims.ID == "" || claims.ExpiresAt == nil {
+		return ErrInvalidToken
 	}
 
-	s.blacklist.Store(token, true)
+	_, err = db.DB.Exec(ctx, `
+		INSERT INTO revoked_tokens (jti, user_id, expires_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (jti) DO NOTHING
+	`, claims.ID, claims.UserID, claims.ExpiresAt.Time)
+	if err != nil {
+		return fmt.Errorf("не удалось отозвать токен: %w", err)
+	}
 	return nil
 }
 
-func (s *AuthService) IsTokenRevoked(token string) bool {
-	_, revoked := s.blacklist.Load(token)
-	return revoked
+func (s *AuthService) IsTokenRevoked(ctx context.Context, tokenID string) (bool, error) {
+	var revoked bool
+	err := db.DB.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = $1)`, tokenID).Scan(&revoked)
+	if err != nil {
+		return false, fmt.Errorf("не удалось проверить отзыв токена: %w", err)
+	}
+	return revoked, nil
 }
 
-func (s *AuthService) CleanupRevokedTokens() {
-	ticker := time.NewTicker(24 * time.Hour)
+// CleanupRevokedTokens периодически удаляет записи об отозванных токенах,
+// срок действия которых уже истек, пока не отменен контекст
+func (s *AuthService) CleanupRevokedTokens(ctx context.Context, interval time.Duration, log logger.Logger) {
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
 	for {
-		<-ticker.C
-
-		s.blacklist.Range(func(key, value interface{}) bool {
-			token, ok := key.(string)
-			if !ok {
-				return true
-			}
-
-			if jwt_token.IsTokenExpired(token) {
-				s.blacklist.Delete(token)
-			}
-
-			return true
-		})
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		tag, err := db.DB.Exec(ctx, `DELETE FROM revoked_tokens WHERE expires_at < NOW()`)
+		if err != nil {
+			log.Error("Не удалось удалить истекшие отозванные токены: ", err)
+			continue
+		}
+		if tag.RowsAffected() > 0 {
+			log.Info("Удалено истекших отозванных токенов: ", tag.RowsAffected())
+		}
 	}
 }
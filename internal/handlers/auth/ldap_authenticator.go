@@ -0,0 +1,91 @@
+package auth
+
+import (
+	"ROOmail/internal/directory"
+	"ROOmail/internal/models"
+	"ROOmail/pkg/db"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"strings"
+)
+
+// LDAPAuthenticator проверяет пароль в LDAP-каталоге и создает учетную запись ROOmail при
+// первом входе. Роль, почта и ФИО берутся из каталога при каждом входе, поэтому изменения
+// групп в каталоге действуют со следующего входа.
+type LDAPAuthenticator struct {
+	directory *directory.Directory
+	db        *pgxpool.Pool
+}
+
+func NewLDAPAuthenticator(dir *directory.Directory, db *pgxpool.Pool) *LDAPAuthenticator {
+	return &LDAPAuthenticator{directory: dir, db: db}
+}
+
+// CheckRoles проверяет, что роли из сопоставлений групп и роль по умолчанию существуют.
+// Вызывается при запуске: иначе ошибка в настройке обнаружится только при входе пользователя.
+func (a *LDAPAuthenticator) CheckRoles(ctx context.Context) error {
+	var unknown []string
+	err := a.db.QueryRow(ctx, `
+		SELECT ARRAY(SELECT role FROM unnest($1::text[]) AS role
+		             WHERE role NOT IN (SELECT name FROM roles) ORDER BY role)
+	`, a.directory.Roles()).Scan(&unknown)
+	if err != nil {
+		return fmt.Errorf("не удалось проверить роли каталога: %w", err)
+	}
+	if len(unknown) > 0 {
+		return fmt.Errorf("роли %s из настроек LDAP не существуют", strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+func (a *LDAPAuthenticator) Authenticate(ctx context.Context, username, password string) (*models.User, error) {
+	account, err := a.directory.Authenticate(username, password)
+	switch {
+	case errors.Is(err, directory.ErrUserNotFound):
+		return nil, ErrUnknownUser
+	case errors.Is(err, directory.ErrInvalidCredentials):
+		return nil, ErrInvalidCredentials
+	case errors.Is(err, directory.ErrNoRole):
+		log.Warn("Вход через LDAP отклонен, группам пользователя не назначена роль: ", username)
+		return nil, ErrInvalidCredentials
+	case err != nil:
+		log.Error("Ошибка входа через LDAP: ", err)
+		return nil, ErrInvalidCredentials
+	}
+
+	if err := a.provision(ctx, account); err != nil {
+		log.Error("Не удалось создать учетную запись пользователя из LDAP: ", account.Username, " - ", err)
+		return nil, ErrInvalidCredentials
+	}
+
+	// Отключенная учетная запись не находится, а локальная с тем же именем не подменяется
+	user, err := db.GetUserByUsername(ctx, account.Username)
+	if err != nil || user.AuthSource != models.AuthSourceLDAP {
+		return nil, ErrInvalidCredentials
+	}
+	return user, nil
+}
+
+// provision создает учетную запись пользователя каталога или обновляет ее данными из каталога.
+// Локальная учетная запись с тем же именем не меняется. Пароль в ROOmail не хранится:
+// пустой хеш не совпадает ни с одним паролем.
+func (a *LDAPAuthenticator) provision(ctx context.Context, account *directory.Account) error {
+	var id int
+	err := a.db.QueryRow(ctx, `
+		INSERT INTO users (username, password_hash, role, email, full_name, auth_source)
+		VALUES ($1, '', $2, NULLIF($3, ''), NULLIF($4, ''), $5)
+		ON CONFLICT (username) DO UPDATE
+		SET role = EXCLUDED.role,
+		    email = COALESCE(EXCLUDED.email, users.email),
+		    full_name = COALESCE(EXCLUDED.full_name, users.full_name)
+		WHERE users.auth_source = EXCLUDED.auth_source
+		RETURNING id
+	`, account.Username, account.Role, account.Email, account.FullName, models.AuthSourceLDAP).Scan(&id)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("не удалось сохранить пользователя: %w", err)
+	}
+	return nil
+}
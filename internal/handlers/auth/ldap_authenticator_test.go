@@ -0,0 +1,146 @@
+package auth_test
+
+import (
+	"ROOmail/internal/directory"
+	"ROOmail/internal/handlers/auth"
+	"ROOmail/internal/models"
+	"ROOmail/pkg/db"
+	"ROOmail/pkg/testdb"
+	"context"
+	"testing"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	ldapAdminsGroup   = "cn=admins,ou=groups,dc=school,dc=ru"
+	ldapTeachersGroup = "cn=teachers,ou=groups,dc=school,dc=ru"
+)
+
+// ldapConn - каталог в памяти с записями пользователей; пароль каждого - "secret"
+type ldapConn struct {
+	entries map[string]*ldap.Entry
+}
+
+func (c *ldapConn) Bind(username, password string) error {
+	if password != "secret" {
+		return ldap.NewError(ldap.LDAPResultInvalidCredentials, nil)
+	}
+	return nil
+}
+
+func (c *ldapConn) Search(request *ldap.SearchRequest) (*ldap.SearchResult, error) {
+	result := &ldap.SearchResult{}
+	for uid, entry := range c.entries {
+		if request.Filter == "(&(objectClass=person)(uid="+uid+"))" {
+			result.Entries = append(result.Entries, entry)
+		}
+	}
+	return result, nil
+}
+
+func (c *ldapConn) Close() error {
+	return nil
+}
+
+func (c *ldapConn) put(uid, mail, name string, groups ...string) {
+	c.entries[uid] = ldap.NewEntry("uid="+uid+",ou=people,dc=school,dc=ru", map[string][]string{
+		"uid":      {uid},
+		"mail":     {mail},
+		"cn":       {name},
+		"memberOf": groups,
+	})
+}
+
+func newLDAPAuthenticator(t *testing.T, pool *pgxpool.Pool, groupRoles []directory.GroupRole, defaultRole string) (*auth.LDAPAuthenticator, *ldapConn) {
+	conn := &ldapConn{entries: make(map[string]*ldap.Entry)}
+	dir, err := directory.NewWithDialer(directory.Config{
+		BaseDN:      "dc=school,dc=ru",
+		GroupRoles:  groupRoles,
+		DefaultRole: defaultRole,
+	}, func() (directory.Conn, error) {
+		return conn, nil
+	})
+	require.NoError(t, err)
+	return auth.NewLDAPAuthenticator(dir, pool), conn
+}
+
+func TestLDAPAuthenticatorProvision(t *testing.T) {
+	pool := testdb.New(t)
+	db.DB = pool
+	t.Cleanup(func() { db.DB = nil })
+	ctx := context.Background()
+
+	authenticator, conn := newLDAPAuthenticator(t, pool, []directory.GroupRole{
+		{Group: ldapAdminsGroup, Role: models.RoleAdmin},
+	}, "users")
+
+	type account struct {
+		role, email, fullName, source, passwordHash string
+	}
+	load := func(username string) account {
+		var a account
+		require.NoError(t, pool.QueryRow(ctx, `
+			SELECT role, COALESCE(email, ''), COALESCE(full_name, ''), auth_source, password_hash
+			FROM users WHERE username = $1
+		`, username).Scan(&a.role, &a.email, &a.fullName, &a.source, &a.passwordHash))
+		return a
+	}
+
+	// При первом входе учетная запись создается без пароля
+	conn.put("ivanova", "ivanova@school.ru", "Иванова Анна", ldapTeachersGroup)
+	user, err := authenticator.Authenticate(ctx, "ivanova", "secret")
+	require.NoError(t, err)
+	assert.Equal(t, "ivanova", user.Username)
+	assert.Equal(t, "users", user.Role)
+	assert.Equal(t, account{"users", "ivanova@school.ru", "Иванова Анна", models.AuthSourceLDAP, ""}, load("ivanova"))
+
+	// При следующем входе роль берется из каталога, пустые атрибуты данные не стирают
+	conn.put("ivanova", "", "", ldapTeachersGroup, ldapAdminsGroup)
+	user, err = authenticator.Authenticate(ctx, "ivanova", "secret")
+	require.NoError(t, err)
+	assert.Equal(t, models.RoleAdmin, user.Role)
+	assert.Equal(t, account{models.RoleAdmin, "ivanova@school.ru", "Иванова Анна", models.AuthSourceLDAP, ""}, load("ivanova"))
+
+	_, err = authenticator.Authenticate(ctx, "ivanova", "wrong")
+	assert.ErrorIs(t, err, auth.ErrInvalidCredentials)
+	_, err = authenticator.Authenticate(ctx, "sidorov", "secret")
+	assert.ErrorIs(t, err, auth.ErrUnknownUser)
+
+	// Локальная учетная запись с тем же именем не подменяется и не меняется
+	testdb.CreateUser(t, pool, "petrov", "users")
+	local := load("petrov")
+	conn.put("petrov", "petrov@school.ru", "Петров Петр", ldapAdminsGroup)
+	_, err = authenticator.Authenticate(ctx, "petrov", "secret")
+	assert.ErrorIs(t, err, auth.ErrInvalidCredentials)
+	assert.Equal(t, local, load("petrov"))
+
+	// Отключенная учетная запись каталога не входит
+	_, err = pool.Exec(ctx, `UPDATE users SET is_active = false WHERE username = 'ivanova'`)
+	require.NoError(t, err)
+	_, err = authenticator.Authenticate(ctx, "ivanova", "secret")
+	assert.ErrorIs(t, err, auth.ErrInvalidCredentials)
+}
+
+func TestLDAPAuthenticatorCheckRoles(t *testing.T) {
+	pool := testdb.New(t)
+	ctx := context.Background()
+
+	authenticator, _ := newLDAPAuthenticator(t, pool, []directory.GroupRole{
+		{Group: ldapAdminsGroup, Role: models.RoleAdmin},
+	}, "users")
+	assert.NoError(t, authenticator.CheckRoles(ctx))
+
+	authenticator, _ = newLDAPAuthenticator(t, pool, []directory.GroupRole{
+		{Group: ldapAdminsGroup, Role: models.RoleAdmin},
+		{Group: ldapTeachersGroup, Role: "teachers"},
+	}, "")
+	assert.ErrorContains(t, authenticator.CheckRoles(ctx), "teachers")
+
+	// Роль по умолчанию тоже проверяется
+	authenticator, _ = newLDAPAuthenticator(t, pool, nil, "pupils")
+	assert.ErrorContains(t, authenticator.CheckRoles(ctx), "pupils")
+}
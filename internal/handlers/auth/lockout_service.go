@@ -0,0 +1,199 @@
+package auth
+
+import (
+	"ROOmail/internal/handlers/roles"
+	"ROOmail/internal/models"
+	"ROOmail/pkg/logger"
+	"ROOmail/pkg/utils/jwt_token"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"golang.org/x/net/context"
+	"math"
+	"time"
+)
+
+var ErrNothingToUnlock = errors.New("Укажите имя пользователя или IP-адрес")
+
+// LockoutPolicy - пороги блокировки входа. Счетчик неудач сбрасывается,
+// если с начала окна прошло больше Window.
+type LockoutPolicy struct {
+	MaxUserFailures int
+	MaxIPFailures   int
+	Window          time.Duration
+	LockDuration    time.Duration
+}
+
+// LockoutService считает неудачные попытки входа в Postgres и временно блокирует
+// вход по имени пользователя и по IP-адресу после превышения порога.
+type LockoutService struct {
+	db     *pgxpool.Pool
+	policy LockoutPolicy
+	log    logger.Logger
+}
+
+func NewLockoutService(db *pgxpool.Pool, policy LockoutPolicy, log logger.Logger) *LockoutService {
+	return &LockoutService{db: db, policy: policy, log: log}
+}
+
+// Attempt учитывает попытку входа до проверки пароля или кода и возвращает, сколько осталось ждать
+// до снятия блокировки; 0 - попытку можно проверять. Проверка и учет выполняются одним запросом,
+// поэтому параллельные запросы не могут проверить больше паролей, чем позволяет порог: попытка
+// сверх порога в пределах окна блокирует вход и отклоняется. Успешную попытку нужно вернуть через Release.
+func (s *LockoutService) Attempt(ctx context.Context, username, ip string) (time.Duration, error) {
+	rows, err := s.db.Query(ctx, `
+		INSERT INTO login_failures AS lf (kind, key, failed_count, window_started_at, last_failed_at)
+		SELECT t.kind, t.key, 1, NOW(), NOW()
+		FROM (VALUES ('username', $1::varchar, $2::int), ('ip', $3::varchar, $4::int)) AS t (kind, key, max_failures)
+		WHERE t.key <> '' AND t.max_failures > 0
+		ON CONFLICT (kind, key) DO UPDATE SET
+			failed_count = CASE
+				WHEN lf.locked_until > NOW() THEN lf.failed_count
+				WHEN lf.window_started_at < NOW() - $5 * interval '1 second' THEN 1
+				WHEN lf.failed_count >= CASE lf.kind WHEN 'username' THEN $2 ELSE $4 END THEN 0
+				ELSE lf.failed_count + 1 END,
+			window_started_at = CASE
+				WHEN lf.locked_until > NOW() THEN lf.window_started_at
+				WHEN lf.window_started_at < NOW() - $5 * interval '1 second' THEN NOW()
+				WHEN lf.failed_count >= CASE lf.kind WHEN 'username' THEN $2 ELSE $4 END THEN NOW()
+				ELSE lf.window_started_at END,
+			locked_until = CASE
+				WHEN lf.locked_until > NOW() THEN lf.locked_until
+				WHEN lf.window_started_at < NOW() - $5 * interval '1 second' THEN lf.locked_until
+				WHEN lf.failed_count >= CASE lf.kind WHEN 'username' THEN $2 ELSE $4 END THEN NOW() + $6 * interval '1 second'
+				ELSE lf.locked_until END,
+			last_failed_at = CASE WHEN lf.locked_until > NOW() THEN lf.last_failed_at ELSE NOW() END
+		RETURNING lf.kind, lf.key, EXTRACT(EPOCH FROM lf.locked_until - NOW())::float8, lf.window_started_at = NOW()
+	`, username, s.policy.MaxUserFailures, ip, s.policy.MaxIPFailures, s.policy.Window.Seconds(), s.policy.LockDuration.Seconds())
+	if err != nil {
+		return 0, fmt.Errorf("не удалось учесть попытку входа: %w", err)
+	}
+	defer rows.Close()
+
+	var wait time.Duration
+	for rows.Next() {
+		var kind, key string
+		var seconds *float64
+		var windowStarted bool
+		if err := rows.Scan(&kind, &key, &seconds, &windowStarted); err != nil {
+			return 0, fmt.Errorf("не удалось учесть попытку входа: %w", err)
+		}
+		if seconds == nil || *seconds <= 0 {
+			continue
+		}
+		// Блокировка, установленная этой попыткой, начинает новое окно
+		if windowStarted {
+			s.log.Warn("Вход заблокирован после неудачных попыток: ", kind, " ", key)
+		}
+		if lockedFor := time.Duration(math.Ceil(*seconds)) * time.Second; lockedFor > wait {
+			wait = lockedFor
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("не удалось учесть попытку входа: %w", err)
+	}
+	return wait, nil
+}
+
+// Release возвращает попытку, учтенную Attempt, если пароль или код оказались верными
+func (s *LockoutService) Release(ctx context.Context, username, ip string) error {
+	_, err := s.db.Exec(ctx, `
+		UPDATE login_failures SET failed_count = GREATEST(failed_count - 1, 0)
+		WHERE (kind = 'username' AND key = $1) OR (kind = 'ip' AND key = $2)
+	`, username, ip)
+	if err != nil {
+		return fmt.Errorf("не удалось вернуть попытку входа: %w", err)
+	}
+	return nil
+}
+
+// Reset сбрасывает счетчик по имени пользователя после успешного входа.
+// Счетчик IP-адреса не сбрасывается: иначе вход в свою учетную запись позволял бы
+// продолжать перебор чужих паролей с того же адреса.
+func (s *LockoutService) Reset(ctx context.Context, username string) error {
+	_, err := s.db.Exec(ctx, `DELETE FROM login_failures WHERE kind = 'username' AND key = $1`, username)
+	if err != nil {
+		return fmt.Errorf("не удалось сбросить счетчик неудачных попыток: %w", err)
+	}
+	return nil
+}
+
+// List возвращает счетчики неудачных попыток; activeOnly - только действующие блокировки
+func (s *LockoutService) List(ctx context.Context, activeOnly bool) ([]models.LoginLockout, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT kind, key, failed_count, last_failed_at, locked_until
+		FROM login_failures
+		WHERE NOT $1 OR locked_until > NOW()
+		ORDER BY COALESCE(locked_until, last_failed_at) DESC
+	`, activeOnly)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось получить блокировки входа: %w", err)
+	}
+	defer rows.Close()
+
+	lockouts := []models.LoginLockout{}
+	for rows.Next() {
+		var l models.LoginLockout
+		if err := rows.Scan(&l.Kind, &l.Key, &l.FailedCount, &l.LastFailedAt, &l.LockedUntil); err != nil {
+			return nil, fmt.Errorf("не удалось прочитать блокировку входа: %w", err)
+		}
+		lockouts = append(lockouts, l)
+	}
+	return lockouts, rows.Err()
+}
+
+// Unlock снимает блокировку и сбрасывает счетчики для имени пользователя и/или IP-адреса.
+// Снять блокировку с учетной записи можно, только если ее роль в пределах разрешений actor.
+func (s *LockoutService) Unlock(ctx context.Context, req models.UnlockRequest, actor *jwt_token.Claims) error {
+	if req.Username == "" && req.IP == "" {
+		return ErrNothingToUnlock
+	}
+
+	if req.Username != "" {
+		var role string
+		err := s.db.QueryRow(ctx, `SELECT role FROM users WHERE username = $1`, req.Username).Scan(&role)
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			// Счетчик ведется и для имен, которых нет среди пользователей
+		case err != nil:
+			return fmt.Errorf("не удалось получить пользователя: %w", err)
+		default:
+			if err := roles.Grantable(ctx, s.db, actor, role); err != nil {
+				return err
+			}
+		}
+	}
+
+	_, err := s.db.Exec(ctx, `
+		DELETE FROM login_failures
+		WHERE (kind = 'username' AND key = $1) OR (kind = 'ip' AND key = $2)
+	`, req.Username, req.IP)
+	if err != nil {
+		return fmt.Errorf("не удалось снять блокировку входа: %w", err)
+	}
+	return nil
+}
+
+// StartCleanup периодически удаляет устаревшие счетчики, пока не отменен контекст
+func (s *LockoutService) StartCleanup(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		_, err := s.db.Exec(ctx, `
+			DELETE FROM login_failures
+			WHERE last_failed_at < NOW() - $1 * interval '1 second'
+			  AND (locked_until IS NULL OR locked_until < NOW())
+		`, s.policy.Window.Seconds())
+		if err != nil {
+			s.log.Error("Не удалось удалить устаревшие счетчики попыток входа: ", err)
+		}
+	}
+}
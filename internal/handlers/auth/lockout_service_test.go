@@ -0,0 +1,145 @@
+package auth_test
+
+import (
+	"ROOmail/internal/handlers/auth"
+	"ROOmail/internal/handlers/roles"
+	"ROOmail/internal/models"
+	"ROOmail/pkg/logger"
+	"ROOmail/pkg/testdb"
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newLockoutService(pool *pgxpool.Pool) *auth.LockoutService {
+	return auth.NewLockoutService(pool, auth.LockoutPolicy{
+		MaxUserFailures: 3,
+		MaxIPFailures:   10,
+		Window:          time.Hour,
+		LockDuration:    time.Minute,
+	}, logger.NewZapLogger())
+}
+
+func TestLockoutAttempt(t *testing.T) {
+	pool := testdb.New(t)
+	ctx := context.Background()
+	lockouts := newLockoutService(pool)
+	admin := testdb.Claims(t, pool, testdb.CreateUser(t, pool, "root", models.RoleAdmin))
+
+	for i := 0; i < 3; i++ {
+		wait, err := lockouts.Attempt(ctx, "teacher", "10.0.0.1")
+		require.NoError(t, err)
+		assert.Zero(t, wait, "попытка %d", i+1)
+	}
+
+	// Попытка сверх порога блокирует вход и сама отклоняется
+	wait, err := lockouts.Attempt(ctx, "teacher", "10.0.0.2")
+	require.NoError(t, err)
+	assert.InDelta(t, time.Minute.Seconds(), wait.Seconds(), 2)
+
+	// Блокировка по имени действует с любого адреса, другим пользователям вход открыт
+	wait, err = lockouts.Attempt(ctx, "teacher", "10.0.0.3")
+	require.NoError(t, err)
+	assert.Positive(t, wait)
+	wait, err = lockouts.Attempt(ctx, "director", "10.0.0.1")
+	require.NoError(t, err)
+	assert.Zero(t, wait)
+
+	active, err := lockouts.List(ctx, true)
+	require.NoError(t, err)
+	require.Len(t, active, 1)
+	assert.Equal(t, models.LockoutKindUsername, active[0].Kind)
+
+	require.NoError(t, lockouts.Unlock(ctx, models.UnlockRequest{Username: "teacher"}, admin))
+	wait, err = lockouts.Attempt(ctx, "teacher", "10.0.0.1")
+	require.NoError(t, err)
+	assert.Zero(t, wait)
+}
+
+func TestLockoutRelease(t *testing.T) {
+	pool := testdb.New(t)
+	ctx := context.Background()
+	lockouts := newLockoutService(pool)
+
+	// Успешные попытки возвращаются и не приближают блокировку
+	for i := 0; i < 10; i++ {
+		wait, err := lockouts.Attempt(ctx, "teacher", "10.0.0.1")
+		require.NoError(t, err)
+		require.Zero(t, wait, "попытка %d", i+1)
+		require.NoError(t, lockouts.Release(ctx, "teacher", "10.0.0.1"))
+	}
+
+	// По истечении окна счетчик начинается заново
+	for i := 0; i < 3; i++ {
+		_, err := lockouts.Attempt(ctx, "teacher", "10.0.0.1")
+		require.NoError(t, err)
+	}
+	_, err := pool.Exec(ctx, `UPDATE login_failures SET window_started_at = NOW() - interval '2 hours'`)
+	require.NoError(t, err)
+	wait, err := lockouts.Attempt(ctx, "teacher", "10.0.0.1")
+	require.NoError(t, err)
+	assert.Zero(t, wait)
+}
+
+func TestLockoutAttemptConcurrent(t *testing.T) {
+	pool := testdb.New(t)
+	lockouts := newLockoutService(pool)
+
+	// Параллельные запросы не проверяют больше паролей, чем позволяет порог
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	allowed := 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			wait, err := lockouts.Attempt(context.Background(), "teacher", "")
+			assert.NoError(t, err)
+			if err == nil && wait == 0 {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 3, allowed)
+}
+
+func TestManageAccountsWithinOwnPermissions(t *testing.T) {
+	pool := testdb.New(t)
+	ctx := context.Background()
+	lockouts := newLockoutService(pool)
+	mfa := auth.NewMFAService(pool, "ROOmail", nil)
+	admin := testdb.Claims(t, pool, testdb.CreateUser(t, pool, "root", models.RoleAdmin))
+	teacherID := testdb.CreateUser(t, pool, "teacher", "users")
+
+	require.NoError(t, roles.NewRoleService(pool).Create(ctx, models.RoleRequest{
+		Name:        "security",
+		Permissions: []string{models.PermSecurityManage, models.PermTasksExecute},
+	}, admin))
+	officer := testdb.Claims(t, pool, testdb.CreateUser(t, pool, "officer", "security"))
+
+	for i := 0; i < 4; i++ {
+		_, err := lockouts.Attempt(ctx, "root", "10.0.0.1")
+		require.NoError(t, err)
+	}
+
+	// Блокировку и второй фактор администратора не снимет пользователь с меньшими правами
+	err := lockouts.Unlock(ctx, models.UnlockRequest{Username: "root"}, officer)
+	assert.ErrorIs(t, err, roles.ErrRoleNotAllowed)
+	active, err := lockouts.List(ctx, true)
+	require.NoError(t, err)
+	assert.NotEmpty(t, active)
+	assert.ErrorIs(t, mfa.Reset(ctx, admin.UserID, officer), roles.ErrRoleNotAllowed)
+
+	require.NoError(t, lockouts.Unlock(ctx, models.UnlockRequest{Username: "root"}, admin))
+	require.NoError(t, lockouts.Unlock(ctx, models.UnlockRequest{Username: "unknown", IP: "10.0.0.1"}, officer))
+	require.NoError(t, mfa.Reset(ctx, teacherID, officer))
+	assert.ErrorIs(t, mfa.Reset(ctx, 1_000_000, officer), auth.ErrUserNotFound)
+}
@@ -0,0 +1,331 @@
+package auth
+
+import (
+	"ROOmail/internal/handlers/roles"
+	"ROOmail/internal/models"
+	"ROOmail/pkg/utils"
+	"ROOmail/pkg/utils/jwt_token"
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+)
+
+var mfa *MFAService
+
+// SetMFAService включает двухфакторную аутентификацию при входе
+func SetMFAService(service *MFAService) {
+	mfa = service
+}
+
+// MFAVerifyHandler завершает вход кодом подтверждения
+// @Summary Подтверждение входа кодом
+// @Description Обменивает промежуточный токен из /auth/login и код из приложения-аутентификатора (или код восстановления) на токены сессии. Если второй фактор настраивается при входе (setup_required), код подтверждает настройку, а в ответе возвращаются коды восстановления.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body models.MFAChallengeRequest true "Промежуточный токен и код"
+// @Success 200 {object} LoginResponse "Успешный вход"
+// @Failure 400 {object} map[string]string "Некорректный запрос"
+// @Failure 401 {object} map[string]string "Неверный код или недействительный промежуточный токен"
+// @Failure 429 {object} map[string]string "Вход временно заблокирован, время ожидания в заголовке Retry-After"
+// @Failure 500 {object} map[string]string "Ошибка сервера"
+// @Router /auth/mfa/verify [post]
+func MFAVerifyHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var req models.MFAChallengeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.MFAToken == "" || req.Code == "" {
+		utils.RespondJSON(w, http.StatusBadRequest, map[string]string{"error": "Некорректный запрос"})
+		return
+	}
+
+	user, err := mfa.Challenge(ctx, req.MFAToken, true)
+	if err != nil {
+		writeMFAError(w, err)
+		return
+	}
+
+	ip := utils.ClientIP(r)
+	if lockouts != nil {
+		retryAfter, err := lockouts.Attempt(ctx, user.Username, ip)
+		if err != nil {
+			log.Error("Ошибка проверки блокировки входа: ", err)
+		}
+		if retryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())))
+			utils.RespondJSON(w, http.StatusTooManyRequests, map[string]string{"error": "Слишком много неудачных попыток входа, повторите позже"})
+			return
+		}
+	}
+
+	var recoveryCodes []string
+	if user.TOTPEnabled {
+		err = mfa.Verify(ctx, user.ID, req.Code)
+	} else {
+		recoveryCodes, err = mfa.Enable(ctx, user.ID, req.Code)
+	}
+	if err != nil {
+		if errors.Is(err, ErrInvalidMFACode) {
+			log.Warn("Неверный код подтверждения входа пользователя: ", user.Username, " с адреса ", ip)
+		} else if lockouts != nil {
+			// Попытка не проверялась, поэтому не считается неудачной
+			if err := lockouts.Release(ctx, user.Username, ip); err != nil {
+				log.Error("Ошибка учета попытки входа: ", err)
+			}
+		}
+		writeMFAError(w, err)
+		return
+	}
+	if lockouts != nil {
+		if err := lockouts.Release(ctx, user.Username, ip); err != nil {
+			log.Error("Ошибка учета успешной попытки входа: ", err)
+		}
+	}
+
+	if err := mfa.CompleteChallenge(ctx, req.MFAToken); err != nil {
+		log.Error("Ошибка удаления промежуточного токена: ", err)
+	}
+	if recoveryCodes != nil {
+		log.Info("Пользователь настроил двухфакторную аутентификацию при входе: ", user.Username)
+	}
+	completeLogin(w, r, user, recoveryCodes)
+}
+
+// MFALoginSetupHandler выдает секрет для настройки обязательного второго фактора во время входа
+// @Summary Настройка второго фактора при входе
+// @Description Для пользователей, которым второй фактор обязателен, но еще не настроен. Возвращает секрет и otpauth-ссылку для QR-кода; вход завершается через /auth/mfa/verify с кодом из приложения.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body models.MFAChallengeRequest true "Промежуточный токен"
+// @Success 200 {object} models.MFASetup "Секрет для приложения-аутентификатора"
+// @Failure 400 {object} map[string]string "Некорректный запрос"
+// @Failure 401 {object} map[string]string "Недействительный промежуточный токен"
+// @Failure 409 {object} map[string]string "Второй фактор уже настроен"
+// @Failure 500 {object} map[string]string "Ошибка сервера"
+// @Router /auth/mfa/setup [post]
+func MFALoginSetupHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.MFAChallengeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.MFAToken == "" {
+		utils.RespondJSON(w, http.StatusBadRequest, map[string]string{"error": "Некорректный запрос"})
+		return
+	}
+
+	user, err := mfa.Challenge(r.Context(), req.MFAToken, false)
+	if err != nil {
+		writeMFAError(w, err)
+		return
+	}
+	if user.TOTPEnabled {
+		writeMFAError(w, ErrMFAAlreadyEnabled)
+		return
+	}
+
+	setup, err := mfa.Setup(r.Context(), user.ID)
+	if err != nil {
+		writeMFAError(w, err)
+		return
+	}
+	utils.RespondJSON(w, http.StatusOK, setup)
+}
+
+// MFAStatusHandler возвращает состояние второго фактора текущего пользователя
+// @Summary Состояние двухфакторной аутентификации
+// @Tags auth
+// @Produce json
+// @Success 200 {object} models.MFAStatus "Состояние"
+// @Failure 401 {object} map[string]string "Неавторизованный доступ"
+// @Failure 500 {object} map[string]string "Ошибка сервера"
+// @Router /user/mfa [get]
+func MFAStatusHandler(w http.ResponseWriter, r *http.Request) {
+	userClaims, ok := r.Context().Value("user").(*jwt_token.Claims)
+	if !ok {
+		utils.RespondJSON(w, http.StatusUnauthorized, map[string]string{"error": "Неавторизованный доступ"})
+		return
+	}
+
+	status, err := mfa.Status(r.Context(), userClaims.UserID, userClaims.Role)
+	if err != nil {
+		writeMFAError(w, err)
+		return
+	}
+	utils.RespondJSON(w, http.StatusOK, status)
+}
+
+// MFASetupHandler выдает новый секрет для приложения-аутентификатора
+// @Summary Настроить второй фактор
+// @Description Возвращает секрет и otpauth-ссылку для QR-кода. Второй фактор включается после подтверждения кодом через /user/mfa/enable.
+// @Tags auth
+// @Produce json
+// @Success 200 {object} models.MFASetup "Секрет для приложения-аутентификатора"
+// @Failure 401 {object} map[string]string "Неавторизованный доступ"
+// @Failure 409 {object} map[string]string "Второй фактор уже включен"
+// @Failure 500 {object} map[string]string "Ошибка сервера"
+// @Router /user/mfa/setup [post]
+func MFASetupHandler(w http.ResponseWriter, r *http.Request) {
+	userClaims, ok := r.Context().Value("user").(*jwt_token.Claims)
+	if !ok {
+		utils.RespondJSON(w, http.StatusUnauthorized, map[string]string{"error": "Неавторизованный доступ"})
+		return
+	}
+
+	setup, err := mfa.Setup(r.Context(), userClaims.UserID)
+	if err != nil {
+		writeMFAError(w, err)
+		return
+	}
+	utils.RespondJSON(w, http.StatusOK, setup)
+}
+
+// MFAEnableHandler включает второй фактор
+// @Summary Включить второй фактор
+// @Description Проверяет код из приложения-аутентификатора и включает двухфакторную аутентификацию. Коды восстановления возвращаются один раз.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body models.MFACodeRequest true "Код из приложения"
+// @Success 200 {object} models.RecoveryCodes "Коды восстановления"
+// @Failure 400 {object} map[string]string "Некорректный запрос или настройка не начата"
+// @Failure 401 {object} map[string]string "Неверный код"
+// @Failure 409 {object} map[string]string "Второй фактор уже включен"
+// @Failure 500 {object} map[string]string "Ошибка сервера"
+// @Router /user/mfa/enable [post]
+func MFAEnableHandler(w http.ResponseWriter, r *http.Request) {
+	userClaims, req, ok := decodeMFACode(w, r)
+	if !ok {
+		return
+	}
+
+	codes, err := mfa.Enable(r.Context(), userClaims.UserID, req.Code)
+	if err != nil {
+		writeMFAError(w, err)
+		return
+	}
+
+	log.Info("Пользователь включил двухфакторную аутентификацию: ", userClaims.Username)
+	utils.RespondJSON(w, http.StatusOK, models.RecoveryCodes{RecoveryCodes: codes})
+}
+
+// MFADisableHandler отключает второй фактор
+// @Summary Отключить второй фактор
+// @Description Требует действующий код из приложения или код восстановления. Недоступно, если второй фактор обязателен для роли.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body models.MFACodeRequest true "Код"
+// @Success 200 {object} map[string]string "Второй фактор отключен"
+// @Failure 400 {object} map[string]string "Некорректный запрос или второй фактор не включен"
+// @Failure 401 {object} map[string]string "Неверный код"
+// @Failure 403 {object} map[string]string "Второй фактор обязателен для роли"
+// @Failure 500 {object} map[string]string "Ошибка сервера"
+// @Router /user/mfa/disable [post]
+func MFADisableHandler(w http.ResponseWriter, r *http.Request) {
+	userClaims, req, ok := decodeMFACode(w, r)
+	if !ok {
+		return
+	}
+
+	if err := mfa.Disable(r.Context(), userClaims.UserID, userClaims.Role, req.Code); err != nil {
+		writeMFAError(w, err)
+		return
+	}
+
+	log.Info("Пользователь отключил двухфакторную аутентификацию: ", userClaims.Username)
+	utils.RespondJSON(w, http.StatusOK, map[string]string{"message": "Двухфакторная аутентификация отключена"})
+}
+
+// MFARecoveryCodesHandler выдает новые коды восстановления взамен прежних
+// @Summary Новые коды восстановления
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body models.MFACodeRequest true "Код"
+// @Success 200 {object} models.RecoveryCodes "Коды восстановления"
+// @Failure 400 {object} map[string]string "Некорректный запрос или второй фактор не включен"
+// @Failure 401 {object} map[string]string "Неверный код"
+// @Failure 500 {object} map[string]string "Ошибка сервера"
+// @Router /user/mfa/recovery-codes [post]
+func MFARecoveryCodesHandler(w http.ResponseWriter, r *http.Request) {
+	userClaims, req, ok := decodeMFACode(w, r)
+	if !ok {
+		return
+	}
+
+	codes, err := mfa.RegenerateRecoveryCodes(r.Context(), userClaims.UserID, req.Code)
+	if err != nil {
+		writeMFAError(w, err)
+		return
+	}
+	utils.RespondJSON(w, http.StatusOK, models.RecoveryCodes{RecoveryCodes: codes})
+}
+
+// MFAResetHandler сбрасывает второй фактор пользователя, например при потере устройства
+// @Summary Сбросить второй фактор пользователя
+// @Description Удаляет секрет и коды восстановления. Если второй фактор обязателен для роли, пользователь настроит его заново при следующем входе.
+// @Tags auth
+// @Produce json
+// @Param id path int true "ID пользователя"
+// @Success 200 {object} map[string]string "Второй фактор сброшен"
+// @Failure 400 {object} map[string]string "Некорректный идентификатор пользователя"
+// @Failure 401 {object} map[string]string "Неавторизованный доступ"
+// @Failure 403 {object} map[string]string "Роль пользователя шире прав администратора"
+// @Failure 404 {object} map[string]string "Пользователь не найден"
+// @Failure 500 {object} map[string]string "Ошибка сервера"
+// @Router /admin/auth/mfa/reset/{id} [delete]
+func MFAResetHandler(w http.ResponseWriter, r *http.Request) {
+	userClaims, ok := r.Context().Value("user").(*jwt_token.Claims)
+	if !ok {
+		utils.RespondJSON(w, http.StatusUnauthorized, map[string]string{"error": "Неавторизованный доступ"})
+		return
+	}
+
+	userID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.RespondJSON(w, http.StatusBadRequest, map[string]string{"error": "Некорректный идентификатор пользователя"})
+		return
+	}
+
+	if err := mfa.Reset(r.Context(), userID, userClaims); err != nil {
+		writeMFAError(w, err)
+		return
+	}
+
+	log.Info("Двухфакторная аутентификация пользователя сброшена администратором, userID: ", userID)
+	utils.RespondJSON(w, http.StatusOK, map[string]string{"message": "Двухфакторная аутентификация сброшена"})
+}
+
+func decodeMFACode(w http.ResponseWriter, r *http.Request) (*jwt_token.Claims, models.MFACodeRequest, bool) {
+	var req models.MFACodeRequest
+	userClaims, ok := r.Context().Value("user").(*jwt_token.Claims)
+	if !ok {
+		utils.RespondJSON(w, http.StatusUnauthorized, map[string]string{"error": "Неавторизованный доступ"})
+		return nil, req, false
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+		utils.RespondJSON(w, http.StatusBadRequest, map[string]string{"error": "Некорректный запрос"})
+		return nil, req, false
+	}
+	return userClaims, req, true
+}
+
+func writeMFAError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, ErrInvalidMFACode), errors.Is(err, ErrInvalidChallenge):
+		status = http.StatusUnauthorized
+	case errors.Is(err, ErrMFANotEnabled), errors.Is(err, ErrMFANotSetUp):
+		status = http.StatusBadRequest
+	case errors.Is(err, ErrMFARequired), errors.Is(err, roles.ErrRoleNotAllowed):
+		status = http.StatusForbidden
+	case errors.Is(err, ErrMFAAlreadyEnabled):
+		status = http.StatusConflict
+	case errors.Is(err, ErrUserNotFound):
+		status = http.StatusNotFound
+	default:
+		log.Error("Ошибка двухфакторной аутентификации: ", err)
+		utils.RespondJSON(w, status, map[string]string{"error": "Ошибка сервера"})
+		return
+	}
+	utils.RespondJSON(w, status, map[string]string{"error": err.Error()})
+}
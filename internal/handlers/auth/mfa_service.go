@@ -0,0 +1,355 @@
+package auth
+
+import (
+	"ROOmail/internal/audience"
+	"ROOmail/internal/handlers/roles"
+	"ROOmail/internal/models"
+	"ROOmail/internal/totp"
+	"ROOmail/pkg/logger"
+	"ROOmail/pkg/utils/jwt_token"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"golang.org/x/net/context"
+	"strings"
+	"time"
+)
+
+var (
+	ErrMFANotEnabled     = errors.New("Двухфакторная аутентификация не включена")
+	ErrMFAAlreadyEnabled = errors.New("Двухфакторная аутентификация уже включена")
+	ErrMFANotSetUp       = errors.New("Сначала получите секрет для приложения-аутентификатора")
+	ErrMFARequired       = errors.New("Для вашей роли двухфакторная аутентификация обязательна")
+	ErrInvalidMFACode    = errors.New("Неверный код подтверждения")
+	ErrInvalidChallenge  = errors.New("Промежуточный токен недействителен, истек или исчерпаны попытки, войдите заново")
+	ErrUserNotFound      = errors.New("Пользователь не найден")
+)
+
+const (
+	// recoveryCodeCount - сколько кодов восстановления выдается за раз
+	recoveryCodeCount = 10
+	// challengeTTL - время на ввод кода после проверки пароля
+	challengeTTL = 5 * time.Minute
+	// challengeAttempts - сколько кодов можно ввести по одному промежуточному токену
+	challengeAttempts = 5
+)
+
+// MFAService управляет вторым фактором входа: TOTP (RFC 6238) и одноразовыми кодами
+// восстановления. Для ролей из requiredRoles второй фактор обязателен.
+type MFAService struct {
+	db            *pgxpool.Pool
+	issuer        string
+	requiredRoles map[string]bool
+}
+
+func NewMFAService(db *pgxpool.Pool, issuer string, requiredRoles []string) *MFAService {
+	roles := make(map[string]bool, len(requiredRoles))
+	for _, role := range requiredRoles {
+		roles[role] = true
+	}
+	return &MFAService{db: db, issuer: issuer, requiredRoles: roles}
+}
+
+// Required сообщает, обязателен ли второй фактор для роли
+func (s *MFAService) Required(role string) bool {
+	return s.requiredRoles[role]
+}
+
+// Status возвращает состояние второго фактора пользователя
+func (s *MFAService) Status(ctx context.Context, userID int, role string) (*models.MFAStatus, error) {
+	status := &models.MFAStatus{Required: s.Required(role)}
+	err := s.db.QueryRow(ctx, `
+		SELECT u.totp_enabled,
+		       (SELECT COUNT(*) FROM mfa_recovery_codes c WHERE c.user_id = u.id AND c.used_at IS NULL)
+		FROM users u
+		WHERE u.id = $1
+	`, userID).Scan(&status.Enabled, &status.RecoveryCodesLeft)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось получить состояние двухфакторной аутентификации: %w", err)
+	}
+	return status, nil
+}
+
+// Setup создает новый секрет для пользователя, у которого второй фактор еще не включен.
+// Секрет начинает действовать после подтверждения кодом в Enable.
+func (s *MFAService) Setup(ctx context.Context, userID int) (*models.MFASetup, error) {
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	var username string
+	err = s.db.QueryRow(ctx, `
+		UPDATE users SET totp_secret = $2, totp_last_step = NULL
+		WHERE id = $1 AND NOT totp_enabled
+		RETURNING username
+	`, userID, secret).Scan(&username)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrMFAAlreadyEnabled
+		}
+		return nil, fmt.Errorf("не удалось сохранить секрет TOTP: %w", err)
+	}
+
+	return &models.MFASetup{
+		Secret:          secret,
+		ProvisioningURI: totp.ProvisioningURI(s.issuer, username, secret),
+	}, nil
+}
+
+// Enable включает второй фактор после проверки кода из приложения и возвращает коды восстановления
+func (s *MFAService) Enable(ctx context.Context, userID int, code string) ([]string, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var secret *string
+	var enabled bool
+	err = tx.QueryRow(ctx, `SELECT totp_secret, totp_enabled FROM users WHERE id = $1 FOR UPDATE`, userID).Scan(&secret, &enabled)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось получить секрет TOTP: %w", err)
+	}
+	if enabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	if secret == nil {
+		return nil, ErrMFANotSetUp
+	}
+
+	step, ok := totp.Validate(*secret, code, time.Now())
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE users SET totp_enabled = true, totp_last_step = $2 WHERE id = $1`, userID, step)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось включить двухфакторную аутентификацию: %w", err)
+	}
+
+	codes, err := replaceRecoveryCodes(ctx, tx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("Failed to commit MFA enrollment: %w", err)
+	}
+	return codes, nil
+}
+
+// Verify проверяет код из приложения или код восстановления пользователя с включенным вторым фактором.
+// Принятый код нельзя использовать повторно.
+func (s *MFAService) Verify(ctx context.Context, userID int, code string) error {
+	var secret *string
+	var enabled bool
+	err := s.db.QueryRow(ctx, `SELECT totp_secret, totp_enabled FROM users WHERE id = $1`, userID).Scan(&secret, &enabled)
+	if err != nil {
+		return fmt.Errorf("не удалось получить секрет TOTP: %w", err)
+	}
+	if !enabled || secret == nil {
+		return ErrMFANotEnabled
+	}
+
+	if step, ok := totp.Validate(*secret, code, time.Now()); ok {
+		tag, err := s.db.Exec(ctx, `
+			UPDATE users SET totp_last_step = $2
+			WHERE id = $1 AND (totp_last_step IS NULL OR totp_last_step < $2)
+		`, userID, step)
+		if err != nil {
+			return fmt.Errorf("не удалось сохранить использованный код: %w", err)
+		}
+		if tag.RowsAffected() == 0 {
+			return ErrInvalidMFACode
+		}
+		return nil
+	}
+
+	tag, err := s.db.Exec(ctx, `
+		UPDATE mfa_recovery_codes SET used_at = NOW()
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+	`, userID, hashSecret(normalizeRecoveryCode(code)))
+	if err != nil {
+		return fmt.Errorf("не удалось проверить код восстановления: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+// Disable отключает второй фактор после проверки кода. Для обязательных ролей отключение запрещено.
+func (s *MFAService) Disable(ctx context.Context, userID int, role, code string) error {
+	if s.Required(role) {
+		return ErrMFARequired
+	}
+	if err := s.Verify(ctx, userID, code); err != nil {
+		return err
+	}
+	return s.clear(ctx, userID, nil)
+}
+
+// RegenerateRecoveryCodes заменяет коды восстановления новыми после проверки кода
+func (s *MFAService) RegenerateRecoveryCodes(ctx context.Context, userID int, code string) ([]string, error) {
+	if err := s.Verify(ctx, userID, code); err != nil {
+		return nil, err
+	}
+	return replaceRecoveryCodes(ctx, s.db, userID)
+}
+
+// Reset удаляет секрет и коды восстановления пользователя, например при потере устройства.
+// Если для роли второй фактор обязателен, при следующем входе его придется настроить заново.
+// Сбросить второй фактор можно только пользователю, роль которого в пределах разрешений actor.
+func (s *MFAService) Reset(ctx context.Context, userID int, actor *jwt_token.Claims) error {
+	return s.clear(ctx, userID, actor)
+}
+
+// clear удаляет секрет и коды восстановления. Если задан actor, второй фактор сбрасывает
+// администратор, и роль пользователя должна быть в пределах его разрешений.
+func (s *MFAService) clear(ctx context.Context, userID int, actor *jwt_token.Claims) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("Failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var role string
+	err = tx.QueryRow(ctx, `SELECT role FROM users WHERE id = $1 FOR UPDATE`, userID).Scan(&role)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrUserNotFound
+		}
+		return fmt.Errorf("не удалось получить пользователя: %w", err)
+	}
+	if actor != nil {
+		if err := roles.Grantable(ctx, tx, actor, role); err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE users SET totp_secret = NULL, totp_enabled = false, totp_last_step = NULL WHERE id = $1`, userID)
+	if err != nil {
+		return fmt.Errorf("не удалось отключить двухфакторную аутентификацию: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("не удалось удалить коды восстановления: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("Failed to commit MFA reset: %w", err)
+	}
+	return nil
+}
+
+// NewChallenge выдает промежуточный токен входа для пользователя, прошедшего проверку пароля
+func (s *MFAService) NewChallenge(ctx context.Context, userID int) (string, time.Time, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", time.Time{}, fmt.Errorf("не удалось создать промежуточный токен: %w", err)
+	}
+	token := hex.EncodeToString(buf)
+
+	var expiresAt time.Time
+	err := s.db.QueryRow(ctx, `
+		INSERT INTO mfa_challenges (token_hash, user_id, expires_at)
+		VALUES ($1, $2, NOW() + $3 * interval '1 second')
+		RETURNING expires_at
+	`, hashSecret(token), userID, challengeTTL.Seconds()).Scan(&expiresAt)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("не удалось сохранить промежуточный токен: %w", err)
+	}
+	return token, expiresAt, nil
+}
+
+// Challenge возвращает пользователя промежуточного токена. С consumeAttempt списывается
+// одна попытка ввода кода; после исчерпания попыток токен перестает приниматься.
+func (s *MFAService) Challenge(ctx context.Context, token string, consumeAttempt bool) (*models.User, error) {
+	var user models.User
+	err := s.db.QueryRow(ctx, `
+		WITH challenge AS (
+			UPDATE mfa_challenges
+			SET attempts = attempts + CASE WHEN $3 THEN 1 ELSE 0 END
+			WHERE token_hash = $1 AND expires_at > NOW() AND attempts < $2
+			RETURNING user_id
+		)
+		SELECT u.id, u.username, u.role, COALESCE(u.email, ''), u.must_change_password, u.password_changed_at, u.totp_enabled
+		FROM challenge c
+		JOIN users u ON u.id = c.user_id
+		WHERE u.is_active
+	`, hashSecret(token), challengeAttempts, consumeAttempt).Scan(&user.ID, &user.Username, &user.Role, &user.Email,
+		&user.MustChangePassword, &user.PasswordChangedAt, &user.TOTPEnabled)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrInvalidChallenge
+		}
+		return nil, fmt.Errorf("не удалось проверить промежуточный токен: %w", err)
+	}
+	return &user, nil
+}
+
+// CompleteChallenge удаляет промежуточный токен после успешного ввода кода
+func (s *MFAService) CompleteChallenge(ctx context.Context, token string) error {
+	if _, err := s.db.Exec(ctx, `DELETE FROM mfa_challenges WHERE token_hash = $1`, hashSecret(token)); err != nil {
+		return fmt.Errorf("не удалось удалить промежуточный токен: %w", err)
+	}
+	return nil
+}
+
+// StartCleanup периодически удаляет истекшие промежуточные токены, пока не отменен контекст
+func (s *MFAService) StartCleanup(ctx context.Context, interval time.Duration, log logger.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if _, err := s.db.Exec(ctx, `DELETE FROM mfa_challenges WHERE expires_at < NOW()`); err != nil {
+			log.Error("Не удалось удалить истекшие промежуточные токены: ", err)
+		}
+	}
+}
+
+// replaceRecoveryCodes удаляет прежние коды восстановления и создает новые
+func replaceRecoveryCodes(ctx context.Context, q audience.Querier, userID int) ([]string, error) {
+	if _, err := q.Exec(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return nil, fmt.Errorf("не удалось удалить коды восстановления: %w", err)
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		buf := make([]byte, 5)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, fmt.Errorf("не удалось создать код восстановления: %w", err)
+		}
+		raw := strings.ToLower(base32.StdEncoding.EncodeToString(buf))
+		code := raw[:4] + "-" + raw[4:]
+
+		_, err := q.Exec(ctx, `INSERT INTO mfa_recovery_codes (user_id, code_hash) VALUES ($1, $2)`, userID, hashSecret(raw))
+		if err != nil {
+			return nil, fmt.Errorf("не удалось сохранить код восстановления: %w", err)
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// normalizeRecoveryCode убирает дефисы и пробелы, которые пользователь мог ввести вместе с кодом
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+func hashSecret(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
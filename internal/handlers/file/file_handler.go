@@ -65,7 +65,7 @@ func (h *FileHandler) UploadFileHandler(w http.ResponseWriter, r *http.Request)
 
 // DownloadFileHandler обрабатывает запрос на скачивание файла с сервера.
 // @Summary Скачать файл
-// @Description Позволяет скачать файл, загруженный на сервер по его имени.
+// @Description Позволяет скачать файл, загруженный на сервер по его имени. Вложения сообщений и ответов на задачи этим маршрутом не отдаются.
 // @Tags файлы
 // @Param filename path string true "Имя файла для скачивания"
 // @Produce octet-stream
@@ -86,6 +86,17 @@ func (h *FileHandler) DownloadFileHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	private, err := h.service.IsPrivate(r.Context(), filePath)
+	if err != nil {
+		h.log.Error("Не удалось проверить файл", err)
+		http.Error(w, "Ошибка сервера", http.StatusInternalServerError)
+		return
+	}
+	if private {
+		http.Error(w, "Файл не найден", http.StatusNotFound)
+		return
+	}
+
 	file, err := os.Open(filePath)
 	if err != nil {
 		h.log.Error("Не удалось открыть файл", err)
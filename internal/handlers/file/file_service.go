@@ -3,6 +3,7 @@ package file
 import (
 	"fmt"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"golang.org/x/net/context"
 	"io"
 	"os"
 	"path/filepath"
@@ -11,6 +12,7 @@ import (
 
 type FileInterface interface {
 	SaveFile(file io.Reader, filename string) (string, error)
+	RemoveFile(filePath string) error
 }
 
 type FileService struct {
@@ -27,7 +29,7 @@ func NewFileService(uploadDir string, db *pgxpool.Pool) *FileService {
 
 func (s *FileService) SaveFile(file io.Reader, filename string) (string, error) {
 	ext := filepath.Ext(filename)
-	timestamp := time.Now().Unix()
+	timestamp := time.Now().UnixNano()
 	newFilename := fmt.Sprintf("%d%s", timestamp, ext)
 	filePath := filepath.Join(s.uploadDir, newFilename)
 
@@ -38,12 +40,32 @@ func (s *FileService) SaveFile(file io.Reader, filename string) (string, error)
 	defer dst.Close()
 
 	if _, err := io.Copy(dst, file); err != nil {
+		os.Remove(filePath)
 		return "", err
 	}
 
 	return filePath, nil
 }
 
+// RemoveFile удаляет сохраненный файл, например если запись о нем не попала в базу
+func (s *FileService) RemoveFile(filePath string) error {
+	if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// IsPrivate сообщает, что файл - вложение личного сообщения или ответа на задачу. Такие файлы
+// отдаются только через маршруты сообщения и ответа с проверкой доступа.
+func (s *FileService) IsPrivate(ctx context.Context, filePath string) (bool, error) {
+	var exists bool
+	err := s.db.QueryRow(ctx, `
+		SELECT EXISTS (SELECT 1 FROM message_attachments WHERE file_path = $1)
+		    OR EXISTS (SELECT 1 FROM task_response_files WHERE file_path = $1)
+	`, filePath).Scan(&exists)
+	return exists, err
+}
+
 func (s *FileService) GetFilePath(filename string) (string, error) {
 	filePath := filepath.Join(s.uploadDir, filename)
 
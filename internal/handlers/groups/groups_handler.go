@@ -0,0 +1,271 @@
+package groups
+
+import (
+	"ROOmail/internal/models"
+	"ROOmail/pkg/logger"
+	"ROOmail/pkg/utils"
+	"ROOmail/pkg/utils/jwt_token"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"golang.org/x/net/context"
+	"net/http"
+	"strconv"
+)
+
+type GroupHandler struct {
+	service *GroupService
+	log     logger.Logger
+}
+
+func NewGroupHandler(service *GroupService, log logger.Logger) *GroupHandler {
+	return &GroupHandler{service: service,
+		log: log,
+	}
+}
+
+// CreateGroupHandler создает группу пользователей
+// @Summary Создать группу
+// @Description Создает именованную группу пользователей (например, «Все детские сады»). Участников можно передать сразу в user_ids.
+// @Tags Группы
+// @Accept json
+// @Produce json
+// @Param group body models.UserGroupRequest true "Группа"
+// @Success 201 {object} map[string]interface{} "Группа создана"
+// @Failure 400 {string} string "Некорректный запрос"
+// @Failure 401 {string} string "Неавторизованный доступ"
+// @Failure 409 {string} string "Группа с таким названием уже существует"
+// @Failure 500 {string} string "Ошибка сервера"
+// @Router /admin/groups/create [post]
+func (h *GroupHandler) CreateGroupHandler(w http.ResponseWriter, r *http.Request) {
+	h.log.Info("Получен запрос на создание группы пользователей")
+
+	var req models.UserGroupRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.log.Error("Предоставлен некорректный JSON", err)
+		http.Error(w, "Некорректный JSON", http.StatusBadRequest)
+		return
+	}
+
+	userClaims, ok := r.Context().Value("user").(*jwt_token.Claims)
+	if !ok {
+		h.log.Error("Попытка неавторизованного доступа")
+		http.Error(w, "Неавторизованный доступ", http.StatusUnauthorized)
+		return
+	}
+
+	groupID, err := h.service.Create(r.Context(), req, userClaims.UserID)
+	if err != nil {
+		h.writeError(w, "Не удалось создать группу", err)
+		return
+	}
+
+	h.log.Info("Группа пользователей создана", " groupID: ", groupID, " createdBy: ", userClaims.UserID)
+
+	w.WriteHeader(http.StatusCreated)
+	w.Write([]byte(fmt.Sprintf(`{"message": "Группа создана", "group_id": %d}`, groupID)))
+}
+
+// ListGroupsHandler возвращает все группы пользователей
+// @Summary Список групп
+// @Tags Группы
+// @Produce json
+// @Success 200 {array} models.UserGroup "Группы с количеством участников"
+// @Failure 500 {string} string "Ошибка сервера"
+// @Router /admin/groups/list [get]
+func (h *GroupHandler) ListGroupsHandler(w http.ResponseWriter, r *http.Request) {
+	groups, err := h.service.List(r.Context())
+	if err != nil {
+		h.log.Error("Не удалось получить группы: ", err)
+		http.Error(w, "Не удалось получить группы", http.StatusInternalServerError)
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusOK, groups)
+}
+
+// GetGroupHandler возвращает группу с участниками
+// @Summary Получить группу
+// @Tags Группы
+// @Produce json
+// @Param id path int true "ID группы"
+// @Success 200 {object} models.UserGroup "Группа с участниками"
+// @Failure 400 {string} string "Некорректный идентификатор группы"
+// @Failure 404 {string} string "Группа не найдена"
+// @Failure 500 {string} string "Ошибка сервера"
+// @Router /admin/groups/get/{id} [get]
+func (h *GroupHandler) GetGroupHandler(w http.ResponseWriter, r *http.Request) {
+	groupID, ok := h.groupID(w, r)
+	if !ok {
+		return
+	}
+
+	group, err := h.service.Get(r.Context(), groupID)
+	if err != nil {
+		h.writeError(w, "Не удалось получить группу", err)
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusOK, group)
+}
+
+// UpdateGroupHandler меняет название или описание группы
+// @Summary Обновить группу
+// @Description Меняет название и/или описание группы. Пустые поля не изменяются; user_ids игнорируется - для состава используйте /admin/groups/members.
+// @Tags Группы
+// @Accept json
+// @Produce json
+// @Param id path int true "ID группы"
+// @Param group body models.UserGroupRequest true "Новые данные группы"
+// @Success 200 {object} map[string]string "Группа обновлена"
+// @Failure 400 {string} string "Некорректный запрос"
+// @Failure 404 {string} string "Группа не найдена"
+// @Failure 409 {string} string "Группа с таким названием уже существует"
+// @Failure 500 {string} string "Ошибка сервера"
+// @Router /admin/groups/update/{id} [patch]
+func (h *GroupHandler) UpdateGroupHandler(w http.ResponseWriter, r *http.Request) {
+	groupID, ok := h.groupID(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.UserGroupRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.log.Error("Предоставлен некорректный JSON", err)
+		http.Error(w, "Некорректный JSON", http.StatusBadRequest)
+		return
+	}
+
+	var name, description *string
+	if req.Name != "" {
+		name = &req.Name
+	}
+	if req.Description != "" {
+		description = &req.Description
+	}
+
+	if err := h.service.Update(r.Context(), groupID, name, description); err != nil {
+		h.writeError(w, "Не удалось обновить группу", err)
+		return
+	}
+
+	h.log.Info("Группа пользователей обновлена", " groupID: ", groupID)
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"message": "Группа обновлена"}`))
+}
+
+// DeleteGroupHandler удаляет группу
+// @Summary Удалить группу
+// @Description Удаляет группу. Задачи и объявления, назначенные через группу, у пользователей остаются.
+// @Tags Группы
+// @Produce json
+// @Param id path int true "ID группы"
+// @Success 200 {object} map[string]string "Группа удалена"
+// @Failure 400 {string} string "Некорректный идентификатор группы"
+// @Failure 404 {string} string "Группа не найдена"
+// @Failure 500 {string} string "Ошибка сервера"
+// @Router /admin/groups/delete/{id} [delete]
+func (h *GroupHandler) DeleteGroupHandler(w http.ResponseWriter, r *http.Request) {
+	groupID, ok := h.groupID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.service.Delete(r.Context(), groupID); err != nil {
+		h.writeError(w, "Не удалось удалить группу", err)
+		return
+	}
+
+	h.log.Info("Группа пользователей удалена", " groupID: ", groupID)
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"message": "Группа удалена"}`))
+}
+
+// AddMembersHandler добавляет пользователей в группу
+// @Summary Добавить участников группы
+// @Tags Группы
+// @Accept json
+// @Produce json
+// @Param id path int true "ID группы"
+// @Param members body models.GroupMembersRequest true "Пользователи"
+// @Success 200 {object} map[string]string "Участники добавлены"
+// @Failure 400 {string} string "Некорректный запрос"
+// @Failure 404 {string} string "Группа не найдена"
+// @Failure 500 {string} string "Ошибка сервера"
+// @Router /admin/groups/members/add/{id} [post]
+func (h *GroupHandler) AddMembersHandler(w http.ResponseWriter, r *http.Request) {
+	h.changeMembers(w, r, h.service.AddMembers, "Участники добавлены")
+}
+
+// RemoveMembersHandler исключает пользователей из группы
+// @Summary Исключить участников группы
+// @Description Исключает пользователей из группы. Ранее назначенные через группу задачи не отзываются.
+// @Tags Группы
+// @Accept json
+// @Produce json
+// @Param id path int true "ID группы"
+// @Param members body models.GroupMembersRequest true "Пользователи"
+// @Success 200 {object} map[string]string "Участники исключены"
+// @Failure 400 {string} string "Некорректный запрос"
+// @Failure 404 {string} string "Группа не найдена"
+// @Failure 500 {string} string "Ошибка сервера"
+// @Router /admin/groups/members/remove/{id} [post]
+func (h *GroupHandler) RemoveMembersHandler(w http.ResponseWriter, r *http.Request) {
+	h.changeMembers(w, r, h.service.RemoveMembers, "Участники исключены")
+}
+
+func (h *GroupHandler) changeMembers(w http.ResponseWriter, r *http.Request, change func(ctx context.Context, groupID int, userIDs []int) error, done string) {
+	groupID, ok := h.groupID(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.GroupMembersRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.log.Error("Предоставлен некорректный JSON", err)
+		http.Error(w, "Некорректный JSON", http.StatusBadRequest)
+		return
+	}
+	if len(req.UserIDs) == 0 {
+		http.Error(w, "Список пользователей пуст", http.StatusBadRequest)
+		return
+	}
+
+	if err := change(r.Context(), groupID, req.UserIDs); err != nil {
+		h.writeError(w, "Не удалось изменить состав группы", err)
+		return
+	}
+
+	h.log.Info("Состав группы изменен", " groupID: ", groupID, " userIDs: ", req.UserIDs)
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(fmt.Sprintf(`{"message": "%s"}`, done)))
+}
+
+func (h *GroupHandler) groupID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	groupID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		h.log.Error("Некорректный идентификатор группы", err)
+		http.Error(w, "Некорректный идентификатор группы", http.StatusBadRequest)
+		return 0, false
+	}
+	return groupID, true
+}
+
+// writeError переводит ошибки сервиса групп в HTTP-статусы
+func (h *GroupHandler) writeError(w http.ResponseWriter, message string, err error) {
+	h.log.Error(message+": ", err)
+	switch {
+	case errors.Is(err, ErrGroupNameEmpty), errors.Is(err, ErrUnknownGroupUser):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, ErrGroupNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, ErrGroupExists):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, message, http.StatusInternalServerError)
+	}
+}
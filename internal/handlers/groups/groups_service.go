@@ -0,0 +1,257 @@
+package groups
+
+import (
+	"ROOmail/internal/models"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"golang.org/x/net/context"
+	"strings"
+)
+
+var (
+	ErrGroupNotFound    = errors.New("Группа пользователей не найдена")
+	ErrGroupNameEmpty   = errors.New("Название группы обязательно")
+	ErrGroupExists      = errors.New("Группа с таким названием уже существует")
+	ErrUnknownGroupUser = errors.New("Пользователь не найден")
+)
+
+// uniqueViolation - код ошибки PostgreSQL при нарушении уникальности
+const uniqueViolation = "23505"
+
+type GroupService struct {
+	db *pgxpool.Pool
+}
+
+func NewGroupService(db *pgxpool.Pool) *GroupService {
+	return &GroupService{db: db}
+}
+
+// Create создает группу и сразу добавляет в нее переданных пользователей
+func (s *GroupService) Create(ctx context.Context, req models.UserGroupRequest, createdBy int) (int, error) {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return 0, ErrGroupNameEmpty
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var groupID int
+	err = tx.QueryRow(ctx, `INSERT INTO user_groups (name, description, created_by) VALUES ($1, $2, $3) RETURNING id`, req.Name, req.Description, createdBy).Scan(&groupID)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return 0, ErrGroupExists
+		}
+		return 0, fmt.Errorf("Не удалось создать группу: %w", err)
+	}
+
+	if err = addMembers(ctx, tx, groupID, req.UserIDs); err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("Не удалось создать группу: %w", err)
+	}
+	return groupID, nil
+}
+
+// List возвращает все группы с количеством участников
+func (s *GroupService) List(ctx context.Context) ([]models.UserGroup, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT g.id, g.name, g.description, g.created_by, g.created_at, COUNT(gm.user_id)::int
+		FROM user_groups g
+		LEFT JOIN user_group_members gm ON gm.group_id = g.id
+		GROUP BY g.id
+		ORDER BY g.name
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("Не удалось получить группы: %w", err)
+	}
+	defer rows.Close()
+
+	groups := []models.UserGroup{}
+	for rows.Next() {
+		var g models.UserGroup
+		if err := rows.Scan(&g.ID, &g.Name, &g.Description, &g.CreatedBy, &g.CreatedAt, &g.MembersCount); err != nil {
+			return nil, fmt.Errorf("Не удалось прочитать группу: %w", err)
+		}
+		groups = append(groups, g)
+	}
+	return groups, rows.Err()
+}
+
+// Get возвращает группу со списком участников
+func (s *GroupService) Get(ctx context.Context, groupID int) (*models.UserGroup, error) {
+	var g models.UserGroup
+	err := s.db.QueryRow(ctx, `SELECT id, name, description, created_by, created_at FROM user_groups WHERE id = $1`, groupID).
+		Scan(&g.ID, &g.Name, &g.Description, &g.CreatedBy, &g.CreatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrGroupNotFound
+		}
+		return nil, fmt.Errorf("Не удалось получить группу: %w", err)
+	}
+
+	rows, err := s.db.Query(ctx, `
+		SELECT u.id, u.username
+		FROM user_group_members gm
+		JOIN users u ON u.id = gm.user_id
+		WHERE gm.group_id = $1
+		ORDER BY u.username
+	`, groupID)
+	if err != nil {
+		return nil, fmt.Errorf("Не удалось получить участников группы: %w", err)
+	}
+	defer rows.Close()
+
+	g.Members = []models.UsersList{}
+	for rows.Next() {
+		var member models.UsersList
+		if err := rows.Scan(&member.ID, &member.Username); err != nil {
+			return nil, fmt.Errorf("Не удалось прочитать участника группы: %w", err)
+		}
+		g.Members = append(g.Members, member)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("Не удалось получить участников группы: %w", err)
+	}
+	g.MembersCount = len(g.Members)
+	return &g, nil
+}
+
+// Update меняет название и/или описание группы
+func (s *GroupService) Update(ctx context.Context, groupID int, name, description *string) error {
+	if name != nil {
+		trimmed := strings.TrimSpace(*name)
+		if trimmed == "" {
+			return ErrGroupNameEmpty
+		}
+		name = &trimmed
+	}
+
+	tag, err := s.db.Exec(ctx, `
+		UPDATE user_groups
+		SET name = COALESCE($2, name), description = COALESCE($3, description)
+		WHERE id = $1
+	`, groupID, name, description)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return ErrGroupExists
+		}
+		return fmt.Errorf("Не удалось обновить группу: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrGroupNotFound
+	}
+	return nil
+}
+
+// Delete удаляет группу. Уже сделанные назначения сохраняются, но теряют ссылку на группу.
+func (s *GroupService) Delete(ctx context.Context, groupID int) error {
+	tag, err := s.db.Exec(ctx, `DELETE FROM user_groups WHERE id = $1`, groupID)
+	if err != nil {
+		return fmt.Errorf("Не удалось удалить группу: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrGroupNotFound
+	}
+	return nil
+}
+
+// AddMembers добавляет пользователей в группу; уже состоящие в ней пропускаются
+func (s *GroupService) AddMembers(ctx context.Context, groupID int, userIDs []int) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("Failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err = lockGroup(ctx, tx, groupID); err != nil {
+		return err
+	}
+	if err = addMembers(ctx, tx, groupID, userIDs); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("Не удалось добавить участников группы: %w", err)
+	}
+	return nil
+}
+
+// RemoveMembers исключает пользователей из группы. Назначения, сделанные ранее через
+// группу, не отзываются.
+func (s *GroupService) RemoveMembers(ctx context.Context, groupID int, userIDs []int) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("Failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err = lockGroup(ctx, tx, groupID); err != nil {
+		return err
+	}
+	if _, err = tx.Exec(ctx, `DELETE FROM user_group_members WHERE group_id = $1 AND user_id = ANY($2)`, groupID, userIDs); err != nil {
+		return fmt.Errorf("Не удалось исключить участников группы: %w", err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("Не удалось исключить участников группы: %w", err)
+	}
+	return nil
+}
+
+func lockGroup(ctx context.Context, tx pgx.Tx, groupID int) error {
+	var id int
+	err := tx.QueryRow(ctx, `SELECT id FROM user_groups WHERE id = $1 FOR UPDATE`, groupID).Scan(&id)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrGroupNotFound
+		}
+		return fmt.Errorf("Не удалось получить группу: %w", err)
+	}
+	return nil
+}
+
+func addMembers(ctx context.Context, tx pgx.Tx, groupID int, userIDs []int) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+
+	var existing int
+	if err := tx.QueryRow(ctx, `SELECT COUNT(DISTINCT id) FROM users WHERE id = ANY($1)`, userIDs).Scan(&existing); err != nil {
+		return fmt.Errorf("Не удалось проверить пользователей: %w", err)
+	}
+	if existing != countDistinct(userIDs) {
+		return ErrUnknownGroupUser
+	}
+
+	_, err := tx.Exec(ctx, `
+		INSERT INTO user_group_members (group_id, user_id)
+		SELECT $1, unnest($2::integer[])
+		ON CONFLICT DO NOTHING
+	`, groupID, userIDs)
+	if err != nil {
+		return fmt.Errorf("Не удалось добавить участников группы: %w", err)
+	}
+	return nil
+}
+
+func countDistinct(ids []int) int {
+	seen := make(map[int]struct{}, len(ids))
+	for _, id := range ids {
+		seen[id] = struct{}{}
+	}
+	return len(seen)
+}
+
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == uniqueViolation
+}
@@ -0,0 +1,71 @@
+package groups_test
+
+import (
+	"ROOmail/internal/handlers/groups"
+	"ROOmail/internal/models"
+	"ROOmail/pkg/testdb"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGroupLifecycle(t *testing.T) {
+	pool := testdb.New(t)
+	ctx := context.Background()
+	adminID := testdb.CreateUser(t, pool, "admin", models.RoleAdmin)
+	first := testdb.CreateUser(t, pool, "school1", "users")
+	second := testdb.CreateUser(t, pool, "school2", "users")
+	service := groups.NewGroupService(pool)
+
+	id, err := service.Create(ctx, models.UserGroupRequest{Name: " Школы ", UserIDs: []int{first, first}}, adminID)
+	require.NoError(t, err)
+
+	_, err = service.Create(ctx, models.UserGroupRequest{Name: "Школы"}, adminID)
+	assert.ErrorIs(t, err, groups.ErrGroupExists)
+	_, err = service.Create(ctx, models.UserGroupRequest{Name: "  "}, adminID)
+	assert.ErrorIs(t, err, groups.ErrGroupNameEmpty)
+
+	require.NoError(t, service.AddMembers(ctx, id, []int{first, second}))
+	assert.ErrorIs(t, service.AddMembers(ctx, id, []int{second + 100}), groups.ErrUnknownGroupUser)
+	assert.ErrorIs(t, service.AddMembers(ctx, id+100, []int{first}), groups.ErrGroupNotFound)
+
+	g, err := service.Get(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, "Школы", g.Name)
+	assert.Equal(t, 2, g.MembersCount)
+
+	require.NoError(t, service.RemoveMembers(ctx, id, []int{first}))
+	g, err = service.Get(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, 1, g.MembersCount)
+
+	name := "Детские сады"
+	require.NoError(t, service.Update(ctx, id, &name, nil))
+	empty := " "
+	assert.ErrorIs(t, service.Update(ctx, id, &empty, nil), groups.ErrGroupNameEmpty)
+	assert.ErrorIs(t, service.Update(ctx, id+100, &name, nil), groups.ErrGroupNotFound)
+
+	list, err := service.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, name, list[0].Name)
+
+	require.NoError(t, service.Delete(ctx, id))
+	assert.ErrorIs(t, service.Delete(ctx, id), groups.ErrGroupNotFound)
+}
+
+func TestCreateWithUnknownUserRollsBack(t *testing.T) {
+	pool := testdb.New(t)
+	ctx := context.Background()
+	adminID := testdb.CreateUser(t, pool, "admin", models.RoleAdmin)
+	service := groups.NewGroupService(pool)
+
+	_, err := service.Create(ctx, models.UserGroupRequest{Name: "Школы", UserIDs: []int{adminID + 100}}, adminID)
+	assert.ErrorIs(t, err, groups.ErrUnknownGroupUser)
+
+	list, err := service.List(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, list)
+}
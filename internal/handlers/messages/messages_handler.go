@@ -0,0 +1,322 @@
+package messages
+
+import (
+	"ROOmail/internal/models"
+	"ROOmail/pkg/logger"
+	"ROOmail/pkg/utils"
+	"ROOmail/pkg/utils/jwt_token"
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"golang.org/x/net/context"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+type MessageHandler struct {
+	service *MessageService
+	log     logger.Logger
+}
+
+func NewMessageHandler(service *MessageService, log logger.Logger) *MessageHandler {
+	return &MessageHandler{service: service,
+		log: log,
+	}
+}
+
+// SendMessageHandler отправляет сообщение одному или нескольким пользователям
+// @Summary Отправить сообщение
+// @Description Отправляет сообщение с темой, текстом и вложениями. Получатели передаются в поле to (через запятую или несколькими полями). Для ответа укажите reply_to.
+// @Tags Сообщения
+// @Accept multipart/form-data
+// @Produce json
+// @Param to formData string true "ID получателей через запятую"
+// @Param subject formData string false "Тема"
+// @Param body formData string false "Текст сообщения"
+// @Param reply_to formData int false "ID сообщения, на которое дается ответ"
+// @Param files formData file false "Вложения (можно несколько)"
+// @Success 201 {object} map[string]interface{} "Сообщение отправлено"
+// @Failure 400 {string} string "Некорректный запрос"
+// @Failure 401 {string} string "Неавторизованный доступ"
+// @Failure 404 {string} string "Исходное сообщение не найдено"
+// @Failure 500 {string} string "Ошибка сервера"
+// @Router /messages/send [post]
+func (h *MessageHandler) SendMessageHandler(w http.ResponseWriter, r *http.Request) {
+	h.log.Info("Получен запрос на отправку сообщения")
+
+	userClaims, ok := r.Context().Value("user").(*jwt_token.Claims)
+	if !ok {
+		h.log.Error("Попытка неавторизованного доступа")
+		http.Error(w, "Неавторизованный доступ", http.StatusUnauthorized)
+		return
+	}
+
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		h.log.Error("Ошибка разбора формы", err)
+		http.Error(w, "Ошибка разбора формы", http.StatusBadRequest)
+		return
+	}
+
+	req := SendRequest{
+		SenderID: userClaims.UserID,
+		Subject:  r.FormValue("subject"),
+		Body:     r.FormValue("body"),
+		Files:    r.MultipartForm.File["files"],
+	}
+
+	for _, value := range r.MultipartForm.Value["to"] {
+		for _, part := range strings.Split(value, ",") {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				continue
+			}
+			id, err := strconv.Atoi(part)
+			if err != nil {
+				http.Error(w, "Некорректный идентификатор получателя", http.StatusBadRequest)
+				return
+			}
+			req.RecipientIDs = append(req.RecipientIDs, id)
+		}
+	}
+
+	if raw := r.FormValue("reply_to"); raw != "" {
+		replyTo, err := strconv.Atoi(raw)
+		if err != nil {
+			http.Error(w, "Некорректный идентификатор исходного сообщения", http.StatusBadRequest)
+			return
+		}
+		req.ReplyToID = &replyTo
+	}
+
+	messageID, err := h.service.Send(r.Context(), req)
+	if err != nil {
+		h.log.Error("Не удалось отправить сообщение: ", err)
+		switch {
+		case errors.Is(err, ErrNoRecipients), errors.Is(err, ErrUnknownRecipient), errors.Is(err, ErrEmptyMessage):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, ErrMessageNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		default:
+			http.Error(w, "Не удалось отправить сообщение", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	h.log.Info("Сообщение отправлено", " messageID: ", messageID, " senderID: ", userClaims.UserID)
+
+	w.WriteHeader(http.StatusCreated)
+	w.Write([]byte(fmt.Sprintf(`{"message": "Сообщение отправлено", "message_id": %d}`, messageID)))
+}
+
+// InboxHandler возвращает входящие сообщения
+// @Summary Входящие сообщения
+// @Tags Сообщения
+// @Produce json
+// @Param limit query int false "Размер страницы (по умолчанию 30, не более 100)"
+// @Param before_id query int false "Вернуть сообщения старше указанного ID"
+// @Success 200 {object} models.MessagePage "Страница входящих"
+// @Failure 400 {string} string "Некорректные параметры запроса"
+// @Failure 401 {string} string "Неавторизованный доступ"
+// @Failure 500 {string} string "Ошибка сервера"
+// @Router /messages/inbox [get]
+func (h *MessageHandler) InboxHandler(w http.ResponseWriter, r *http.Request) {
+	h.listFolder(w, r, h.service.Inbox)
+}
+
+// SentHandler возвращает отправленные сообщения с отметками о прочтении
+// @Summary Отправленные сообщения
+// @Tags Сообщения
+// @Produce json
+// @Param limit query int false "Размер страницы (по умолчанию 30, не более 100)"
+// @Param before_id query int false "Вернуть сообщения старше указанного ID"
+// @Success 200 {object} models.MessagePage "Страница отправленных"
+// @Failure 400 {string} string "Некорректные параметры запроса"
+// @Failure 401 {string} string "Неавторизованный доступ"
+// @Failure 500 {string} string "Ошибка сервера"
+// @Router /messages/sent [get]
+func (h *MessageHandler) SentHandler(w http.ResponseWriter, r *http.Request) {
+	h.listFolder(w, r, h.service.Sent)
+}
+
+func (h *MessageHandler) listFolder(w http.ResponseWriter, r *http.Request, list func(ctx context.Context, userID, beforeID, limit int) (*models.MessagePage, error)) {
+	userClaims, ok := r.Context().Value("user").(*jwt_token.Claims)
+	if !ok {
+		h.log.Error("Попытка неавторизованного доступа")
+		http.Error(w, "Неавторизованный доступ", http.StatusUnauthorized)
+		return
+	}
+
+	q := r.URL.Query()
+	var limit, beforeID int
+	var err error
+	if raw := q.Get("limit"); raw != "" {
+		if limit, err = strconv.Atoi(raw); err != nil {
+			http.Error(w, "Некорректное значение параметра limit", http.StatusBadRequest)
+			return
+		}
+	}
+	if raw := q.Get("before_id"); raw != "" {
+		if beforeID, err = strconv.Atoi(raw); err != nil {
+			http.Error(w, "Некорректное значение параметра before_id", http.StatusBadRequest)
+			return
+		}
+	}
+
+	page, err := list(r.Context(), userClaims.UserID, beforeID, limit)
+	if err != nil {
+		h.log.Error("Не удалось получить сообщения: ", err)
+		http.Error(w, "Не удалось получить сообщения", http.StatusInternalServerError)
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusOK, page)
+}
+
+// GetMessageHandler возвращает сообщение и отмечает его прочитанным
+// @Summary Получить сообщение
+// @Description Возвращает сообщение с получателями, отметками о прочтении и вложениями. Для получателя сообщение отмечается прочитанным.
+// @Tags Сообщения
+// @Produce json
+// @Param id path int true "ID сообщения"
+// @Success 200 {object} models.Message "Сообщение"
+// @Failure 400 {string} string "Некорректный идентификатор сообщения"
+// @Failure 401 {string} string "Неавторизованный доступ"
+// @Failure 404 {string} string "Сообщение не найдено"
+// @Failure 500 {string} string "Ошибка сервера"
+// @Router /messages/get/{id} [get]
+func (h *MessageHandler) GetMessageHandler(w http.ResponseWriter, r *http.Request) {
+	userClaims, ok := r.Context().Value("user").(*jwt_token.Claims)
+	if !ok {
+		h.log.Error("Попытка неавторизованного доступа")
+		http.Error(w, "Неавторизованный доступ", http.StatusUnauthorized)
+		return
+	}
+
+	messageID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		h.log.Error("Некорректный идентификатор сообщения", err)
+		http.Error(w, "Некорректный идентификатор сообщения", http.StatusBadRequest)
+		return
+	}
+
+	message, err := h.service.Get(r.Context(), messageID, userClaims.UserID)
+	if err != nil {
+		if errors.Is(err, ErrMessageNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		h.log.Error("Не удалось получить сообщение: ", err)
+		http.Error(w, "Не удалось получить сообщение", http.StatusInternalServerError)
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusOK, message)
+}
+
+// ThreadHandler возвращает ветку переписки, к которой относится сообщение
+// @Summary Ветка переписки
+// @Tags Сообщения
+// @Produce json
+// @Param id path int true "ID любого сообщения ветки"
+// @Success 200 {array} models.Message "Сообщения ветки"
+// @Failure 400 {string} string "Некорректный идентификатор сообщения"
+// @Failure 401 {string} string "Неавторизованный доступ"
+// @Failure 404 {string} string "Сообщение не найдено"
+// @Failure 500 {string} string "Ошибка сервера"
+// @Router /messages/thread/{id} [get]
+func (h *MessageHandler) ThreadHandler(w http.ResponseWriter, r *http.Request) {
+	userClaims, ok := r.Context().Value("user").(*jwt_token.Claims)
+	if !ok {
+		h.log.Error("Попытка неавторизованного доступа")
+		http.Error(w, "Неавторизованный доступ", http.StatusUnauthorized)
+		return
+	}
+
+	messageID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		h.log.Error("Некорректный идентификатор сообщения", err)
+		http.Error(w, "Некорректный идентификатор сообщения", http.StatusBadRequest)
+		return
+	}
+
+	thread, err := h.service.Thread(r.Context(), messageID, userClaims.UserID)
+	if err != nil {
+		if errors.Is(err, ErrMessageNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		h.log.Error("Не удалось получить ветку сообщений: ", err)
+		http.Error(w, "Не удалось получить ветку сообщений", http.StatusInternalServerError)
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusOK, thread)
+}
+
+// AttachmentHandler отдает вложение сообщения его отправителю или получателю
+// @Summary Скачать вложение сообщения
+// @Tags Сообщения
+// @Produce octet-stream
+// @Param id path int true "ID сообщения"
+// @Param attachment_id path int true "ID вложения"
+// @Success 200 {file} file "Файл вложения"
+// @Failure 400 {string} string "Некорректный идентификатор"
+// @Failure 401 {string} string "Неавторизованный доступ"
+// @Failure 404 {string} string "Вложение не найдено"
+// @Failure 500 {string} string "Ошибка сервера"
+// @Router /messages/attachments/{id}/{attachment_id} [get]
+func (h *MessageHandler) AttachmentHandler(w http.ResponseWriter, r *http.Request) {
+	userClaims, ok := r.Context().Value("user").(*jwt_token.Claims)
+	if !ok {
+		h.log.Error("Попытка неавторизованного доступа")
+		http.Error(w, "Неавторизованный доступ", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	messageID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Некорректный идентификатор сообщения", http.StatusBadRequest)
+		return
+	}
+	attachmentID, err := strconv.Atoi(vars["attachment_id"])
+	if err != nil {
+		http.Error(w, "Некорректный идентификатор вложения", http.StatusBadRequest)
+		return
+	}
+
+	attachment, err := h.service.Attachment(r.Context(), messageID, attachmentID, userClaims.UserID)
+	if err != nil {
+		if errors.Is(err, ErrAttachmentNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		h.log.Error("Не удалось получить вложение: ", err)
+		http.Error(w, "Не удалось получить вложение", http.StatusInternalServerError)
+		return
+	}
+
+	f, err := os.Open(attachment.FilePath)
+	if err != nil {
+		h.log.Error("Не удалось открыть файл вложения: ", err)
+		http.Error(w, "Вложение не найдено", http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+
+	mimeType := mime.TypeByExtension(filepath.Ext(attachment.FileName))
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": attachment.FileName}))
+	w.Header().Set("Content-Type", mimeType)
+
+	if _, err := io.Copy(w, f); err != nil {
+		h.log.Error("Ошибка при отправке вложения: ", err)
+	}
+}
@@ -0,0 +1,421 @@
+package messages
+
+import (
+	"ROOmail/internal/eventbus"
+	"ROOmail/internal/handlers/file"
+	"ROOmail/internal/models"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"golang.org/x/net/context"
+	"mime/multipart"
+	"strings"
+)
+
+const (
+	defaultPageSize = 30
+	maxPageSize     = 100
+)
+
+var (
+	ErrMessageNotFound    = errors.New("Сообщение не найдено")
+	ErrNoRecipients       = errors.New("Укажите хотя бы одного получателя")
+	ErrUnknownRecipient   = errors.New("Получатель не найден")
+	ErrEmptyMessage       = errors.New("Сообщение должно содержать тему, текст или вложения")
+	ErrAttachmentNotFound = errors.New("Вложение не найдено")
+)
+
+// SendRequest - данные нового сообщения
+type SendRequest struct {
+	SenderID     int
+	RecipientIDs []int
+	Subject      string
+	Body         string
+	ReplyToID    *int
+	Files        []*multipart.FileHeader
+}
+
+type MessageService struct {
+	db    *pgxpool.Pool
+	files file.FileInterface
+	bus   *eventbus.Bus
+}
+
+func NewMessageService(db *pgxpool.Pool, files file.FileInterface, bus *eventbus.Bus) *MessageService {
+	return &MessageService{db: db, files: files, bus: bus}
+}
+
+// Send сохраняет сообщение, его получателей и вложения. Ответ попадает в ветку исходного сообщения.
+func (s *MessageService) Send(ctx context.Context, req SendRequest) (messageID int, err error) {
+	recipientIDs := uniqueIDs(req.RecipientIDs, req.SenderID)
+	if len(recipientIDs) == 0 {
+		return 0, ErrNoRecipients
+	}
+	req.Subject = strings.TrimSpace(req.Subject)
+	if req.Subject == "" && strings.TrimSpace(req.Body) == "" && len(req.Files) == 0 {
+		return 0, ErrEmptyMessage
+	}
+
+	var existing int
+	err = s.db.QueryRow(ctx, `SELECT COUNT(*) FROM users WHERE id = ANY($1)`, recipientIDs).Scan(&existing)
+	if err != nil {
+		return 0, fmt.Errorf("Не удалось проверить получателей: %w", err)
+	}
+	if existing != len(recipientIDs) {
+		return 0, ErrUnknownRecipient
+	}
+
+	var threadID *int
+	if req.ReplyToID != nil {
+		parent, err := s.getVisible(ctx, *req.ReplyToID, req.SenderID)
+		if err != nil {
+			return 0, err
+		}
+		threadID = &parent.ThreadID
+		if req.Subject == "" {
+			req.Subject = parent.Subject
+			if !strings.HasPrefix(req.Subject, "Re: ") {
+				req.Subject = "Re: " + req.Subject
+			}
+		}
+	}
+
+	// Файлы записываются до транзакции, поэтому при ошибке до коммита их нужно удалить
+	attachments := make([]models.MessageAttachment, 0, len(req.Files))
+	defer func() {
+		if err != nil {
+			if removeErr := s.removeFiles(attachments); removeErr != nil {
+				err = errors.Join(err, removeErr)
+			}
+		}
+	}()
+
+	for _, header := range req.Files {
+		f, err := header.Open()
+		if err != nil {
+			return 0, fmt.Errorf("Не удалось открыть файл %s: %w", header.Filename, err)
+		}
+		filePath, err := s.files.SaveFile(f, header.Filename)
+		f.Close()
+		if err != nil {
+			return 0, fmt.Errorf("Не удалось сохранить файл %s: %w", header.Filename, err)
+		}
+		attachments = append(attachments, models.MessageAttachment{FilePath: filePath, FileName: header.Filename})
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	err = tx.QueryRow(ctx, `
+		INSERT INTO messages (thread_id, reply_to_id, sender_id, subject, body)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id
+	`, threadID, req.ReplyToID, req.SenderID, req.Subject, req.Body).Scan(&messageID)
+	if err != nil {
+		return 0, fmt.Errorf("Не удалось сохранить сообщение: %w", err)
+	}
+
+	// Новое сообщение открывает собственную ветку
+	if threadID == nil {
+		if _, err = tx.Exec(ctx, `UPDATE messages SET thread_id = id WHERE id = $1`, messageID); err != nil {
+			return 0, fmt.Errorf("Не удалось создать ветку сообщения: %w", err)
+		}
+	}
+
+	if _, err = tx.Exec(ctx, `INSERT INTO message_recipients (message_id, user_id) SELECT $1, unnest($2::integer[])`, messageID, recipientIDs); err != nil {
+		return 0, fmt.Errorf("Не удалось сохранить получателей: %w", err)
+	}
+
+	for _, a := range attachments {
+		_, err = tx.Exec(ctx, `INSERT INTO message_attachments (message_id, file_path, file_name) VALUES ($1, $2, $3)`, messageID, a.FilePath, a.FileName)
+		if err != nil {
+			return 0, fmt.Errorf("Не удалось сохранить вложение: %w", err)
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("Не удалось сохранить сообщение: %w", err)
+	}
+
+	s.bus.Publish(eventbus.Event{
+		Type:    eventbus.MessageReceived,
+		UserIDs: recipientIDs,
+		Title:   req.Subject,
+		Message: "Новое сообщение: " + req.Subject,
+	})
+
+	return messageID, nil
+}
+
+// Inbox возвращает входящие сообщения пользователя от новых к старым
+func (s *MessageService) Inbox(ctx context.Context, userID, beforeID, limit int) (*models.MessagePage, error) {
+	query := `
+		SELECT m.id, m.thread_id, m.reply_to_id, m.sender_id, u.username, m.subject, m.created_at, mr.read_at
+		FROM message_recipients mr
+		JOIN messages m ON m.id = mr.message_id
+		JOIN users u ON u.id = m.sender_id
+		WHERE mr.user_id = $1 AND ($2 = 0 OR m.id < $2)
+		ORDER BY m.id DESC
+		LIMIT $3
+	`
+	return s.listFolder(ctx, query, userID, beforeID, limit)
+}
+
+// Sent возвращает отправленные пользователем сообщения с отметками о прочтении
+func (s *MessageService) Sent(ctx context.Context, userID, beforeID, limit int) (*models.MessagePage, error) {
+	query := `
+		SELECT m.id, m.thread_id, m.reply_to_id, m.sender_id, u.username, m.subject, m.created_at, NULL::timestamp
+		FROM messages m
+		JOIN users u ON u.id = m.sender_id
+		WHERE m.sender_id = $1 AND ($2 = 0 OR m.id < $2)
+		ORDER BY m.id DESC
+		LIMIT $3
+	`
+	page, err := s.listFolder(ctx, query, userID, beforeID, limit)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.fillRecipients(ctx, page.Messages); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+func (s *MessageService) listFolder(ctx context.Context, query string, userID, beforeID, limit int) (*models.MessagePage, error) {
+	if limit <= 0 {
+		limit = defaultPageSize
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+
+	rows, err := s.db.Query(ctx, query, userID, beforeID, limit+1)
+	if err != nil {
+		return nil, fmt.Errorf("Не удалось получить сообщения: %w", err)
+	}
+	defer rows.Close()
+
+	page := &models.MessagePage{Messages: []models.Message{}}
+	for rows.Next() {
+		var m models.Message
+		if err := rows.Scan(&m.ID, &m.ThreadID, &m.ReplyToID, &m.SenderID, &m.SenderName, &m.Subject, &m.CreatedAt, &m.ReadAt); err != nil {
+			return nil, fmt.Errorf("Не удалось прочитать сообщение: %w", err)
+		}
+		page.Messages = append(page.Messages, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("Не удалось получить сообщения: %w", err)
+	}
+
+	if len(page.Messages) > limit {
+		page.Messages = page.Messages[:limit]
+		page.NextBeforeID = page.Messages[limit-1].ID
+	}
+	return page, nil
+}
+
+// Get возвращает сообщение отправителю или получателю; для получателя оно отмечается прочитанным
+func (s *MessageService) Get(ctx context.Context, messageID, userID int) (*models.Message, error) {
+	if _, err := s.db.Exec(ctx, `UPDATE message_recipients SET read_at = NOW() WHERE message_id = $1 AND user_id = $2 AND read_at IS NULL`, messageID, userID); err != nil {
+		return nil, fmt.Errorf("Не удалось отметить сообщение прочитанным: %w", err)
+	}
+
+	m, err := s.getVisible(ctx, messageID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	messages := []models.Message{*m}
+	if err := s.fillRecipients(ctx, messages); err != nil {
+		return nil, err
+	}
+	if err := s.fillAttachments(ctx, messages); err != nil {
+		return nil, err
+	}
+	return &messages[0], nil
+}
+
+// Thread возвращает видимые пользователю сообщения ветки в хронологическом порядке
+// и отмечает прочитанными адресованные ему
+func (s *MessageService) Thread(ctx context.Context, messageID, userID int) ([]models.Message, error) {
+	root, err := s.getVisible(ctx, messageID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = s.db.Exec(ctx, `
+		UPDATE message_recipients mr SET read_at = NOW()
+		FROM messages m
+		WHERE m.id = mr.message_id AND m.thread_id = $1 AND mr.user_id = $2 AND mr.read_at IS NULL
+	`, root.ThreadID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("Не удалось отметить сообщения прочитанными: %w", err)
+	}
+
+	rows, err := s.db.Query(ctx, `
+		SELECT m.id, m.thread_id, m.reply_to_id, m.sender_id, u.username, m.subject, m.body, m.created_at, mr.read_at
+		FROM messages m
+		JOIN users u ON u.id = m.sender_id
+		LEFT JOIN message_recipients mr ON mr.message_id = m.id AND mr.user_id = $2
+		WHERE m.thread_id = $1 AND (m.sender_id = $2 OR mr.user_id IS NOT NULL)
+		ORDER BY m.id
+	`, root.ThreadID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("Не удалось получить ветку сообщений: %w", err)
+	}
+	defer rows.Close()
+
+	thread := []models.Message{}
+	for rows.Next() {
+		var m models.Message
+		if err := rows.Scan(&m.ID, &m.ThreadID, &m.ReplyToID, &m.SenderID, &m.SenderName, &m.Subject, &m.Body, &m.CreatedAt, &m.ReadAt); err != nil {
+			return nil, fmt.Errorf("Не удалось прочитать сообщение: %w", err)
+		}
+		thread = append(thread, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("Не удалось получить ветку сообщений: %w", err)
+	}
+
+	if err := s.fillRecipients(ctx, thread); err != nil {
+		return nil, err
+	}
+	if err := s.fillAttachments(ctx, thread); err != nil {
+		return nil, err
+	}
+	return thread, nil
+}
+
+// Attachment возвращает вложение сообщения, если пользователь отправитель или получатель сообщения
+func (s *MessageService) Attachment(ctx context.Context, messageID, attachmentID, userID int) (*models.MessageAttachment, error) {
+	var a models.MessageAttachment
+	err := s.db.QueryRow(ctx, `
+		SELECT a.id, a.file_path, a.file_name
+		FROM message_attachments a
+		JOIN messages m ON m.id = a.message_id
+		WHERE a.id = $2 AND a.message_id = $1
+		  AND (m.sender_id = $3 OR EXISTS (SELECT 1 FROM message_recipients mr WHERE mr.message_id = m.id AND mr.user_id = $3))
+	`, messageID, attachmentID, userID).Scan(&a.ID, &a.FilePath, &a.FileName)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrAttachmentNotFound
+		}
+		return nil, fmt.Errorf("Не удалось получить вложение: %w", err)
+	}
+	return &a, nil
+}
+
+// removeFiles удаляет файлы вложений сообщения, которое не удалось сохранить
+func (s *MessageService) removeFiles(attachments []models.MessageAttachment) error {
+	var errs []error
+	for _, a := range attachments {
+		if err := s.files.RemoveFile(a.FilePath); err != nil {
+			errs = append(errs, fmt.Errorf("Не удалось удалить файл %s: %w", a.FilePath, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// getVisible загружает сообщение, если пользователь его отправитель или получатель
+func (s *MessageService) getVisible(ctx context.Context, messageID, userID int) (*models.Message, error) {
+	var m models.Message
+	err := s.db.QueryRow(ctx, `
+		SELECT m.id, m.thread_id, m.reply_to_id, m.sender_id, u.username, m.subject, m.body, m.created_at, mr.read_at
+		FROM messages m
+		JOIN users u ON u.id = m.sender_id
+		LEFT JOIN message_recipients mr ON mr.message_id = m.id AND mr.user_id = $2
+		WHERE m.id = $1 AND (m.sender_id = $2 OR mr.user_id IS NOT NULL)
+	`, messageID, userID).Scan(&m.ID, &m.ThreadID, &m.ReplyToID, &m.SenderID, &m.SenderName, &m.Subject, &m.Body, &m.CreatedAt, &m.ReadAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrMessageNotFound
+		}
+		return nil, fmt.Errorf("Не удалось получить сообщение: %w", err)
+	}
+	return &m, nil
+}
+
+func (s *MessageService) fillRecipients(ctx context.Context, messages []models.Message) error {
+	if len(messages) == 0 {
+		return nil
+	}
+	ids, index := messageIndex(messages)
+
+	rows, err := s.db.Query(ctx, `
+		SELECT mr.message_id, mr.user_id, u.username, mr.read_at
+		FROM message_recipients mr
+		JOIN users u ON u.id = mr.user_id
+		WHERE mr.message_id = ANY($1)
+		ORDER BY u.username
+	`, ids)
+	if err != nil {
+		return fmt.Errorf("Не удалось получить получателей: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var messageID int
+		var r models.MessageRecipient
+		if err := rows.Scan(&messageID, &r.UserID, &r.Username, &r.ReadAt); err != nil {
+			return fmt.Errorf("Не удалось прочитать получателя: %w", err)
+		}
+		i := index[messageID]
+		messages[i].Recipients = append(messages[i].Recipients, r)
+	}
+	return rows.Err()
+}
+
+func (s *MessageService) fillAttachments(ctx context.Context, messages []models.Message) error {
+	if len(messages) == 0 {
+		return nil
+	}
+	ids, index := messageIndex(messages)
+
+	rows, err := s.db.Query(ctx, `SELECT id, message_id, file_path, file_name FROM message_attachments WHERE message_id = ANY($1) ORDER BY id`, ids)
+	if err != nil {
+		return fmt.Errorf("Не удалось получить вложения: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var messageID int
+		var a models.MessageAttachment
+		if err := rows.Scan(&a.ID, &messageID, &a.FilePath, &a.FileName); err != nil {
+			return fmt.Errorf("Не удалось прочитать вложение: %w", err)
+		}
+		i := index[messageID]
+		messages[i].Attachments = append(messages[i].Attachments, a)
+	}
+	return rows.Err()
+}
+
+func messageIndex(messages []models.Message) ([]int, map[int]int) {
+	ids := make([]int, 0, len(messages))
+	index := make(map[int]int, len(messages))
+	for i, m := range messages {
+		ids = append(ids, m.ID)
+		index[m.ID] = i
+	}
+	return ids, index
+}
+
+// uniqueIDs убирает повторы и самого отправителя из списка получателей
+func uniqueIDs(ids []int, exclude int) []int {
+	seen := make(map[int]struct{}, len(ids))
+	result := make([]int, 0, len(ids))
+	for _, id := range ids {
+		if id == exclude {
+			continue
+		}
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+		result = append(result, id)
+	}
+	return result
+}
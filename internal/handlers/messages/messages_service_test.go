@@ -0,0 +1,96 @@
+package messages_test
+
+import (
+	"ROOmail/internal/handlers/file"
+	"ROOmail/internal/handlers/messages"
+	"ROOmail/pkg/testdb"
+	"bytes"
+	"context"
+	"mime/multipart"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func attachment(t *testing.T, name, content string) []*multipart.FileHeader {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	part, err := w.CreateFormFile("files", name)
+	require.NoError(t, err)
+	_, err = part.Write([]byte(content))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	form, err := multipart.NewReader(&body, w.Boundary()).ReadForm(1 << 20)
+	require.NoError(t, err)
+	t.Cleanup(func() { form.RemoveAll() })
+	return form.File["files"]
+}
+
+func TestAttachmentAccess(t *testing.T) {
+	pool := testdb.New(t)
+	ctx := context.Background()
+	sender := testdb.CreateUser(t, pool, "sender", "users")
+	recipient := testdb.CreateUser(t, pool, "recipient", "users")
+	outsider := testdb.CreateUser(t, pool, "outsider", "users")
+
+	dir := t.TempDir()
+	files := file.NewFileService(dir, pool)
+	service := messages.NewMessageService(pool, files, nil)
+
+	messageID, err := service.Send(ctx, messages.SendRequest{
+		SenderID:     sender,
+		RecipientIDs: []int{recipient},
+		Subject:      "Отчет",
+		Files:        attachment(t, "report.pdf", "содержимое"),
+	})
+	require.NoError(t, err)
+
+	m, err := service.Get(ctx, messageID, recipient)
+	require.NoError(t, err)
+	require.Len(t, m.Attachments, 1)
+	attachmentID := m.Attachments[0].ID
+
+	for _, userID := range []int{sender, recipient} {
+		a, err := service.Attachment(ctx, messageID, attachmentID, userID)
+		require.NoError(t, err)
+		assert.Equal(t, "report.pdf", a.FileName)
+		data, err := os.ReadFile(a.FilePath)
+		require.NoError(t, err)
+		assert.Equal(t, "содержимое", string(data))
+
+		// Вложение сообщения не отдается общим маршрутом файлов
+		private, err := files.IsPrivate(ctx, a.FilePath)
+		require.NoError(t, err)
+		assert.True(t, private)
+	}
+
+	_, err = service.Attachment(ctx, messageID, attachmentID, outsider)
+	assert.ErrorIs(t, err, messages.ErrAttachmentNotFound)
+	_, err = service.Attachment(ctx, messageID+1, attachmentID, sender)
+	assert.ErrorIs(t, err, messages.ErrAttachmentNotFound)
+}
+
+func TestSendRemovesFilesOnError(t *testing.T) {
+	pool := testdb.New(t)
+	sender := testdb.CreateUser(t, pool, "sender", "users")
+	recipient := testdb.CreateUser(t, pool, "recipient", "users")
+	dir := t.TempDir()
+	service := messages.NewMessageService(pool, file.NewFileService(dir, pool), nil)
+
+	// Имя вложения длиннее столбца file_name: файл уже записан, а вставка в базу откатывается
+	longName := string(bytes.Repeat([]byte("a"), 300)) + ".txt"
+	_, err := service.Send(context.Background(), messages.SendRequest{
+		SenderID:     sender,
+		RecipientIDs: []int{recipient},
+		Subject:      "Отчет",
+		Files:        attachment(t, longName, "содержимое"),
+	})
+	require.Error(t, err)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
@@ -0,0 +1,286 @@
+package notifications
+
+import (
+	"ROOmail/internal/eventbus"
+	"ROOmail/pkg/logger"
+	"ROOmail/pkg/utils"
+	"ROOmail/pkg/utils/jwt_token"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// heartbeatInterval - как часто отправлять комментарий-пинг, чтобы прокси не закрывали соединение
+const heartbeatInterval = 25 * time.Second
+
+type NotificationHandler struct {
+	service *NotificationService
+	bus     *eventbus.Bus
+	log     logger.Logger
+}
+
+func NewNotificationHandler(service *NotificationService, bus *eventbus.Bus, log logger.Logger) *NotificationHandler {
+	return &NotificationHandler{service: service,
+		bus: bus,
+		log: log,
+	}
+}
+
+// ListNotificationsHandler возвращает входящие уведомления текущего пользователя
+// @Summary Входящие уведомления
+// @Description Возвращает уведомления пользователя от новых к старым. Для следующей страницы передайте next_before_id в параметре before_id.
+// @Tags Уведомления
+// @Produce json
+// @Param limit query int false "Размер страницы (по умолчанию 30, не более 100)"
+// @Param before_id query int false "Вернуть уведомления старше указанного ID"
+// @Param unread query bool false "Только непрочитанные"
+// @Success 200 {object} models.NotificationPage "Страница уведомлений"
+// @Failure 400 {string} string "Некорректные параметры запроса"
+// @Failure 401 {string} string "Неавторизованный доступ"
+// @Failure 500 {string} string "Ошибка сервера"
+// @Router /user/notifications [get]
+func (h *NotificationHandler) ListNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	userClaims, ok := r.Context().Value("user").(*jwt_token.Claims)
+	if !ok {
+		h.log.Error("Попытка неавторизованного доступа")
+		http.Error(w, "Неавторизованный доступ", http.StatusUnauthorized)
+		return
+	}
+
+	q := r.URL.Query()
+	var limit, beforeID int
+	var unread bool
+	var err error
+	if raw := q.Get("limit"); raw != "" {
+		if limit, err = strconv.Atoi(raw); err != nil {
+			http.Error(w, "Некорректное значение параметра limit", http.StatusBadRequest)
+			return
+		}
+	}
+	if raw := q.Get("before_id"); raw != "" {
+		if beforeID, err = strconv.Atoi(raw); err != nil {
+			http.Error(w, "Некорректное значение параметра before_id", http.StatusBadRequest)
+			return
+		}
+	}
+	if raw := q.Get("unread"); raw != "" {
+		if unread, err = strconv.ParseBool(raw); err != nil {
+			http.Error(w, "Некорректное значение параметра unread", http.StatusBadRequest)
+			return
+		}
+	}
+
+	page, err := h.service.List(r.Context(), userClaims.UserID, beforeID, limit, unread)
+	if err != nil {
+		h.log.Error("Не удалось получить уведомления: ", err)
+		http.Error(w, "Не удалось получить уведомления", http.StatusInternalServerError)
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusOK, page)
+}
+
+// UnreadCountHandler возвращает количество непрочитанных уведомлений
+// @Summary Количество непрочитанных уведомлений
+// @Tags Уведомления
+// @Produce json
+// @Success 200 {object} map[string]int "Количество непрочитанных"
+// @Failure 401 {string} string "Неавторизованный доступ"
+// @Failure 500 {string} string "Ошибка сервера"
+// @Router /user/notifications/unread_count [get]
+func (h *NotificationHandler) UnreadCountHandler(w http.ResponseWriter, r *http.Request) {
+	userClaims, ok := r.Context().Value("user").(*jwt_token.Claims)
+	if !ok {
+		h.log.Error("Попытка неавторизованного доступа")
+		http.Error(w, "Неавторизованный доступ", http.StatusUnauthorized)
+		return
+	}
+
+	count, err := h.service.UnreadCount(r.Context(), userClaims.UserID)
+	if err != nil {
+		h.log.Error("Не удалось посчитать непрочитанные уведомления: ", err)
+		http.Error(w, "Не удалось посчитать непрочитанные уведомления", http.StatusInternalServerError)
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusOK, map[string]int{"unread": count})
+}
+
+// MarkReadHandler отмечает уведомление прочитанным
+// @Summary Отметить уведомление прочитанным
+// @Tags Уведомления
+// @Produce json
+// @Param id path int true "ID уведомления"
+// @Success 200 {object} map[string]string "Уведомление прочитано"
+// @Failure 400 {string} string "Некорректный идентификатор уведомления"
+// @Failure 401 {string} string "Неавторизованный доступ"
+// @Failure 404 {string} string "Уведомление не найдено"
+// @Failure 500 {string} string "Ошибка сервера"
+// @Router /user/notifications/read/{id} [post]
+func (h *NotificationHandler) MarkReadHandler(w http.ResponseWriter, r *http.Request) {
+	userClaims, ok := r.Context().Value("user").(*jwt_token.Claims)
+	if !ok {
+		h.log.Error("Попытка неавторизованного доступа")
+		http.Error(w, "Неавторизованный доступ", http.StatusUnauthorized)
+		return
+	}
+
+	notificationID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		h.log.Error("Некорректный идентификатор уведомления", err)
+		http.Error(w, "Некорректный идентификатор уведомления", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.MarkRead(r.Context(), userClaims.UserID, notificationID); err != nil {
+		if errors.Is(err, ErrNotificationNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		h.log.Error("Не удалось отметить уведомление прочитанным: ", err)
+		http.Error(w, "Не удалось отметить уведомление прочитанным", http.StatusInternalServerError)
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusOK, map[string]string{"message": "Уведомление отмечено прочитанным"})
+}
+
+// MarkAllReadHandler отмечает прочитанными все уведомления пользователя
+// @Summary Отметить все уведомления прочитанными
+// @Tags Уведомления
+// @Produce json
+// @Success 200 {object} map[string]int64 "Количество отмеченных уведомлений"
+// @Failure 401 {string} string "Неавторизованный доступ"
+// @Failure 500 {string} string "Ошибка сервера"
+// @Router /user/notifications/read_all [post]
+func (h *NotificationHandler) MarkAllReadHandler(w http.ResponseWriter, r *http.Request) {
+	userClaims, ok := r.Context().Value("user").(*jwt_token.Claims)
+	if !ok {
+		h.log.Error("Попытка неавторизованного доступа")
+		http.Error(w, "Неавторизованный доступ", http.StatusUnauthorized)
+		return
+	}
+
+	updated, err := h.service.MarkAllRead(r.Context(), userClaims.UserID)
+	if err != nil {
+		h.log.Error("Не удалось отметить уведомления прочитанными: ", err)
+		http.Error(w, "Не удалось отметить уведомления прочитанными", http.StatusInternalServerError)
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusOK, map[string]int64{"updated": updated})
+}
+
+// EventsTicketHandler выдает одноразовый билет для подключения к потоку событий
+// @Summary Билет на подключение к потоку событий
+// @Description Браузерный EventSource не передает заголовки, поэтому поток /events открывается с параметром ticket. Билет действует 30 секунд и погашается при подключении.
+// @Tags Уведомления
+// @Produce json
+// @Success 200 {object} map[string]interface{} "Билет и срок его действия в секундах"
+// @Failure 401 {string} string "Неавторизованный доступ"
+// @Failure 500 {string} string "Ошибка сервера"
+// @Router /user/events/ticket [post]
+func (h *NotificationHandler) EventsTicketHandler(w http.ResponseWriter, r *http.Request) {
+	userClaims, ok := r.Context().Value("user").(*jwt_token.Claims)
+	if !ok {
+		h.log.Error("Попытка неавторизованного доступа")
+		http.Error(w, "Неавторизованный доступ", http.StatusUnauthorized)
+		return
+	}
+
+	ticket, err := jwt_token.IssueStreamTicket(userClaims)
+	if err != nil {
+		h.log.Error("Не удалось выдать билет на поток событий: ", err)
+		http.Error(w, "Не удалось выдать билет", http.StatusInternalServerError)
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusOK, map[string]interface{}{
+		"ticket":     ticket,
+		"expires_in": int(jwt_token.StreamTicketTTL.Seconds()),
+	})
+}
+
+// EventsHandler передает события пользователя в реальном времени через Server-Sent Events
+// @Summary Поток событий
+// @Description Открывает поток Server-Sent Events с событиями task.assigned, task.updated, task.deleted, task.reminder, response.reviewed и user.updated; те же события сохраняются во входящих уведомлениях. Браузерный EventSource не передает заголовки, поэтому вместо токена передается одноразовый билет из /user/events/ticket. Поток закрывается, когда истекает токен, для которого выдан билет, или завершается сессия.
+// @Tags Уведомления
+// @Produce text/event-stream
+// @Param ticket query string false "Одноразовый билет, если не передан заголовок Authorization"
+// @Success 200 {object} eventbus.Event "Поток событий"
+// @Failure 401 {string} string "Неавторизованный доступ"
+// @Failure 500 {string} string "Потоковая передача не поддерживается"
+// @Router /events [get]
+func (h *NotificationHandler) EventsHandler(w http.ResponseWriter, r *http.Request) {
+	userClaims, ok := r.Context().Value("user").(*jwt_token.Claims)
+	if !ok {
+		h.log.Error("Попытка неавторизованного доступа")
+		http.Error(w, "Неавторизованный доступ", http.StatusUnauthorized)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		h.log.Error("ResponseWriter не поддерживает потоковую передачу")
+		http.Error(w, "Потоковая передача не поддерживается", http.StatusInternalServerError)
+		return
+	}
+
+	sub := h.bus.Subscribe(userClaims.UserID, 32)
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+
+	h.log.Info("Клиент подключился к потоку событий, userID: ", userClaims.UserID)
+	defer h.log.Info("Клиент отключился от потока событий, userID: ", userClaims.UserID)
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	// Поток не переживает токен, с которым открыт: клиент переподключится с новым билетом
+	var expired <-chan time.Time
+	if userClaims.ExpiresAt != nil {
+		expiry := time.NewTimer(time.Until(userClaims.ExpiresAt.Time))
+		defer expiry.Stop()
+		expired = expiry.C
+	}
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-expired:
+			h.log.Info("Срок действия токена истек, поток событий закрыт, userID: ", userClaims.UserID)
+			return
+		case <-heartbeat.C:
+			// Сессию и учетную запись могли отозвать после подключения
+			if err := jwt_token.CheckStream(r.Context(), userClaims); err != nil {
+				h.log.Info("Поток событий закрыт, userID: ", userClaims.UserID, ": ", err)
+				return
+			}
+			fmt.Fprint(w, ": ping\n\n")
+			flusher.Flush()
+		case event, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				h.log.Error("Ошибка маршализации события: ", err)
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+			flusher.Flush()
+		}
+	}
+}
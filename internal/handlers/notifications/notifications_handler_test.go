@@ -0,0 +1,39 @@
+package notifications_test
+
+import (
+	"ROOmail/internal/eventbus"
+	"ROOmail/internal/handlers/notifications"
+	"ROOmail/pkg/logger"
+	"ROOmail/pkg/utils/jwt_token"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventsHandlerClosesExpiredStream(t *testing.T) {
+	handler := notifications.NewNotificationHandler(nil, eventbus.NewBus(), logger.NewZapLogger())
+
+	claims := &jwt_token.Claims{UserID: 7}
+	claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(2 * time.Second))
+	req := httptest.NewRequest(http.MethodGet, "/events", nil)
+	req = req.WithContext(context.WithValue(req.Context(), "user", claims))
+	rec := httptest.NewRecorder()
+
+	done := make(chan struct{})
+	go func() {
+		handler.EventsHandler(rec, req)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("поток событий не закрылся после истечения токена")
+	}
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
@@ -0,0 +1,118 @@
+package notifications
+
+import (
+	"ROOmail/internal/eventbus"
+	"ROOmail/internal/models"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"golang.org/x/net/context"
+)
+
+const (
+	defaultPageSize = 30
+	maxPageSize     = 100
+)
+
+var ErrNotificationNotFound = errors.New("Уведомление не найдено")
+
+type NotificationService struct {
+	db *pgxpool.Pool
+}
+
+func NewNotificationService(db *pgxpool.Pool) *NotificationService {
+	return &NotificationService{db: db}
+}
+
+// Record сохраняет событие шины во входящие уведомления каждого адресата
+func (s *NotificationService) Record(ctx context.Context, e eventbus.Event) error {
+	var taskID *int
+	if e.TaskID != 0 {
+		taskID = &e.TaskID
+	}
+
+	_, err := s.db.Exec(ctx, `
+		INSERT INTO notifications (user_id, type, task_id, title, message, created_at)
+		SELECT u.id, $2, $3, $4, $5, $6
+		FROM users u
+		WHERE u.id = ANY($1)
+	`, e.UserIDs, e.Type, taskID, e.Title, e.Message, e.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("Не удалось сохранить уведомление %s для пользователей %v: %w", e.Type, e.UserIDs, err)
+	}
+	return nil
+}
+
+// List возвращает уведомления пользователя от новых к старым; beforeID - курсор предыдущей страницы
+func (s *NotificationService) List(ctx context.Context, userID, beforeID, limit int, unreadOnly bool) (*models.NotificationPage, error) {
+	if limit <= 0 {
+		limit = defaultPageSize
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+
+	query := `
+		SELECT id, type, task_id, title, message, read_at, created_at
+		FROM notifications
+		WHERE user_id = $1
+		  AND ($2 = 0 OR id < $2)
+		  AND (NOT $3 OR read_at IS NULL)
+		ORDER BY id DESC
+		LIMIT $4
+	`
+	rows, err := s.db.Query(ctx, query, userID, beforeID, unreadOnly, limit+1)
+	if err != nil {
+		return nil, fmt.Errorf("Не удалось получить уведомления: %w", err)
+	}
+	defer rows.Close()
+
+	page := &models.NotificationPage{Notifications: []models.Notification{}}
+	for rows.Next() {
+		var n models.Notification
+		if err := rows.Scan(&n.ID, &n.Type, &n.TaskID, &n.Title, &n.Message, &n.ReadAt, &n.CreatedAt); err != nil {
+			return nil, fmt.Errorf("Не удалось прочитать уведомление: %w", err)
+		}
+		page.Notifications = append(page.Notifications, n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("Не удалось получить уведомления: %w", err)
+	}
+
+	if len(page.Notifications) > limit {
+		page.Notifications = page.Notifications[:limit]
+		page.NextBeforeID = page.Notifications[limit-1].ID
+	}
+
+	return page, nil
+}
+
+func (s *NotificationService) UnreadCount(ctx context.Context, userID int) (int, error) {
+	var count int
+	err := s.db.QueryRow(ctx, `SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND read_at IS NULL`, userID).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("Не удалось посчитать непрочитанные уведомления: %w", err)
+	}
+	return count, nil
+}
+
+// MarkRead отмечает уведомление прочитанным; чужие уведомления считаются несуществующими
+func (s *NotificationService) MarkRead(ctx context.Context, userID, notificationID int) error {
+	tag, err := s.db.Exec(ctx, `UPDATE notifications SET read_at = COALESCE(read_at, NOW()) WHERE id = $1 AND user_id = $2`, notificationID, userID)
+	if err != nil {
+		return fmt.Errorf("Не удалось отметить уведомление прочитанным: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotificationNotFound
+	}
+	return nil
+}
+
+// MarkAllRead отмечает прочитанными все уведомления пользователя и возвращает их количество
+func (s *NotificationService) MarkAllRead(ctx context.Context, userID int) (int64, error) {
+	tag, err := s.db.Exec(ctx, `UPDATE notifications SET read_at = NOW() WHERE user_id = $1 AND read_at IS NULL`, userID)
+	if err != nil {
+		return 0, fmt.Errorf("Не удалось отметить уведомления прочитанными: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,56 @@
+package notifications_test
+
+import (
+	"ROOmail/internal/eventbus"
+	"ROOmail/internal/handlers/notifications"
+	"ROOmail/pkg/testdb"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordAndList(t *testing.T) {
+	pool := testdb.New(t)
+	ctx := context.Background()
+	userID := testdb.CreateUser(t, pool, "worker", "users")
+	service := notifications.NewNotificationService(pool)
+
+	// Заголовок события не ограничен длиной столбца
+	title := strings.Repeat("Очень длинная тема ", 30)
+	require.NoError(t, service.Record(ctx, eventbus.Event{
+		Type:      eventbus.MessageReceived,
+		UserIDs:   []int{userID},
+		Title:     title,
+		Message:   "Новое сообщение",
+		CreatedAt: time.Now(),
+	}))
+
+	page, err := service.List(ctx, userID, 0, 0, true)
+	require.NoError(t, err)
+	require.Len(t, page.Notifications, 1)
+	assert.Equal(t, title, page.Notifications[0].Title)
+
+	count, err := service.UnreadCount(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	require.NoError(t, service.MarkRead(ctx, userID, page.Notifications[0].ID))
+	assert.ErrorIs(t, service.MarkRead(ctx, userID+1, page.Notifications[0].ID), notifications.ErrNotificationNotFound)
+}
+
+func TestRecordReturnsError(t *testing.T) {
+	pool := testdb.New(t)
+	service := notifications.NewNotificationService(pool)
+
+	// Тип длиннее столбца: ошибка возвращается вызывающему, а не теряется
+	err := service.Record(context.Background(), eventbus.Event{
+		Type:      strings.Repeat("t", 100),
+		UserIDs:   []int{testdb.CreateUser(t, pool, "worker", "users")},
+		CreatedAt: time.Now(),
+	})
+	assert.Error(t, err)
+}
@@ -0,0 +1,289 @@
+package organizations
+
+import (
+	"ROOmail/internal/models"
+	"ROOmail/pkg/logger"
+	"ROOmail/pkg/utils"
+	"ROOmail/pkg/utils/jwt_token"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"golang.org/x/net/context"
+	"net/http"
+	"strconv"
+)
+
+type OrganizationHandler struct {
+	service *OrganizationService
+	log     logger.Logger
+}
+
+func NewOrganizationHandler(service *OrganizationService, log logger.Logger) *OrganizationHandler {
+	return &OrganizationHandler{service: service,
+		log: log,
+	}
+}
+
+// CreateOrganizationHandler создает организацию
+// @Summary Создать организацию
+// @Description Создает организацию верхнего уровня (управление образования) или дочернюю (школа), если указан parent_id
+// @Tags Организации
+// @Accept json
+// @Produce json
+// @Param organization body models.OrganizationRequest true "Организация"
+// @Success 201 {object} map[string]interface{} "Организация создана"
+// @Failure 400 {string} string "Некорректный запрос"
+// @Failure 409 {string} string "Организация с таким названием уже существует"
+// @Failure 500 {string} string "Ошибка сервера"
+// @Router /admin/organizations/create [post]
+func (h *OrganizationHandler) CreateOrganizationHandler(w http.ResponseWriter, r *http.Request) {
+	h.log.Info("Получен запрос на создание организации")
+
+	var req models.OrganizationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.log.Error("Предоставлен некорректный JSON", err)
+		http.Error(w, "Некорректный JSON", http.StatusBadRequest)
+		return
+	}
+
+	organizationID, err := h.service.Create(r.Context(), req)
+	if err != nil {
+		h.writeError(w, "Не удалось создать организацию", err)
+		return
+	}
+
+	h.log.Info("Организация создана", " organizationID: ", organizationID)
+
+	w.WriteHeader(http.StatusCreated)
+	w.Write([]byte(fmt.Sprintf(`{"message": "Организация создана", "organization_id": %d}`, organizationID)))
+}
+
+// ListOrganizationsHandler возвращает дерево организаций
+// @Summary Дерево организаций
+// @Tags Организации
+// @Produce json
+// @Success 200 {array} models.Organization "Корневые организации с вложенными дочерними"
+// @Failure 500 {string} string "Ошибка сервера"
+// @Router /admin/organizations/list [get]
+func (h *OrganizationHandler) ListOrganizationsHandler(w http.ResponseWriter, r *http.Request) {
+	tree, err := h.service.Tree(r.Context())
+	if err != nil {
+		h.log.Error("Не удалось получить организации: ", err)
+		http.Error(w, "Не удалось получить организации", http.StatusInternalServerError)
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusOK, tree)
+}
+
+// GetOrganizationHandler возвращает организацию с дочерними и сотрудниками
+// @Summary Получить организацию
+// @Tags Организации
+// @Produce json
+// @Param id path int true "ID организации"
+// @Success 200 {object} models.Organization "Организация"
+// @Failure 400 {string} string "Некорректный идентификатор организации"
+// @Failure 404 {string} string "Организация не найдена"
+// @Failure 500 {string} string "Ошибка сервера"
+// @Router /admin/organizations/get/{id} [get]
+func (h *OrganizationHandler) GetOrganizationHandler(w http.ResponseWriter, r *http.Request) {
+	organizationID, ok := h.organizationID(w, r)
+	if !ok {
+		return
+	}
+
+	organization, err := h.service.Get(r.Context(), organizationID)
+	if err != nil {
+		h.writeError(w, "Не удалось получить организацию", err)
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusOK, organization)
+}
+
+// UpdateOrganizationHandler переименовывает или переносит организацию
+// @Summary Обновить организацию
+// @Description Меняет название и/или родительскую организацию. Для переноса на верхний уровень передайте move_to_root.
+// @Tags Организации
+// @Accept json
+// @Produce json
+// @Param id path int true "ID организации"
+// @Param organization body models.OrganizationRequest true "Новые данные"
+// @Success 200 {object} map[string]string "Организация обновлена"
+// @Failure 400 {string} string "Некорректный запрос"
+// @Failure 404 {string} string "Организация не найдена"
+// @Failure 409 {string} string "Организация с таким названием уже существует"
+// @Failure 500 {string} string "Ошибка сервера"
+// @Router /admin/organizations/update/{id} [patch]
+func (h *OrganizationHandler) UpdateOrganizationHandler(w http.ResponseWriter, r *http.Request) {
+	organizationID, ok := h.organizationID(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.OrganizationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.log.Error("Предоставлен некорректный JSON", err)
+		http.Error(w, "Некорректный JSON", http.StatusBadRequest)
+		return
+	}
+
+	var name *string
+	if req.Name != "" {
+		name = &req.Name
+	}
+
+	if err := h.service.Update(r.Context(), organizationID, name, req.ParentID, req.MoveToRoot); err != nil {
+		h.writeError(w, "Не удалось обновить организацию", err)
+		return
+	}
+
+	h.log.Info("Организация обновлена", " organizationID: ", organizationID)
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"message": "Организация обновлена"}`))
+}
+
+// DeleteOrganizationHandler удаляет организацию
+// @Summary Удалить организацию
+// @Description Удаляет организацию без дочерних. Сотрудники открепляются, назначенные организации задачи снимаются.
+// @Tags Организации
+// @Produce json
+// @Param id path int true "ID организации"
+// @Success 200 {object} map[string]string "Организация удалена"
+// @Failure 400 {string} string "Некорректный идентификатор организации"
+// @Failure 404 {string} string "Организация не найдена"
+// @Failure 409 {string} string "У организации есть дочерние организации"
+// @Failure 500 {string} string "Ошибка сервера"
+// @Router /admin/organizations/delete/{id} [delete]
+func (h *OrganizationHandler) DeleteOrganizationHandler(w http.ResponseWriter, r *http.Request) {
+	organizationID, ok := h.organizationID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.service.Delete(r.Context(), organizationID); err != nil {
+		h.writeError(w, "Не удалось удалить организацию", err)
+		return
+	}
+
+	h.log.Info("Организация удалена", " organizationID: ", organizationID)
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"message": "Организация удалена"}`))
+}
+
+// AddMembersHandler прикрепляет пользователей к организации
+// @Summary Прикрепить сотрудников
+// @Description Прикрепляет пользователей к организации. Пользователь состоит в одной организации, поэтому открепляется от прежней.
+// @Tags Организации
+// @Accept json
+// @Produce json
+// @Param id path int true "ID организации"
+// @Param members body models.OrganizationMembersRequest true "Пользователи"
+// @Success 200 {object} map[string]string "Сотрудники прикреплены"
+// @Failure 400 {string} string "Некорректный запрос"
+// @Failure 404 {string} string "Организация не найдена"
+// @Failure 500 {string} string "Ошибка сервера"
+// @Router /admin/organizations/members/add/{id} [post]
+func (h *OrganizationHandler) AddMembersHandler(w http.ResponseWriter, r *http.Request) {
+	h.changeMembers(w, r, h.service.AddMembers, "Сотрудники прикреплены")
+}
+
+// RemoveMembersHandler открепляет пользователей от организации
+// @Summary Открепить сотрудников
+// @Tags Организации
+// @Accept json
+// @Produce json
+// @Param id path int true "ID организации"
+// @Param members body models.OrganizationMembersRequest true "Пользователи"
+// @Success 200 {object} map[string]string "Сотрудники откреплены"
+// @Failure 400 {string} string "Некорректный запрос"
+// @Failure 404 {string} string "Организация не найдена"
+// @Failure 500 {string} string "Ошибка сервера"
+// @Router /admin/organizations/members/remove/{id} [post]
+func (h *OrganizationHandler) RemoveMembersHandler(w http.ResponseWriter, r *http.Request) {
+	h.changeMembers(w, r, h.service.RemoveMembers, "Сотрудники откреплены")
+}
+
+// MyOrganizationHandler возвращает организацию текущего пользователя
+// @Summary Моя организация
+// @Description Возвращает организацию пользователя с путем от корня иерархии, дочерними организациями и коллегами
+// @Tags Организации
+// @Produce json
+// @Success 200 {object} models.Organization "Организация"
+// @Failure 401 {string} string "Неавторизованный доступ"
+// @Failure 404 {string} string "Пользователь не прикреплен к организации"
+// @Failure 500 {string} string "Ошибка сервера"
+// @Router /user/organization [get]
+func (h *OrganizationHandler) MyOrganizationHandler(w http.ResponseWriter, r *http.Request) {
+	userClaims, ok := r.Context().Value("user").(*jwt_token.Claims)
+	if !ok {
+		h.log.Error("Попытка неавторизованного доступа")
+		http.Error(w, "Неавторизованный доступ", http.StatusUnauthorized)
+		return
+	}
+
+	organization, err := h.service.ForUser(r.Context(), userClaims.UserID)
+	if err != nil {
+		h.writeError(w, "Не удалось получить организацию", err)
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusOK, organization)
+}
+
+func (h *OrganizationHandler) changeMembers(w http.ResponseWriter, r *http.Request, change func(ctx context.Context, organizationID int, userIDs []int) error, done string) {
+	organizationID, ok := h.organizationID(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.OrganizationMembersRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.log.Error("Предоставлен некорректный JSON", err)
+		http.Error(w, "Некорректный JSON", http.StatusBadRequest)
+		return
+	}
+	if len(req.UserIDs) == 0 {
+		http.Error(w, "Список пользователей пуст", http.StatusBadRequest)
+		return
+	}
+
+	if err := change(r.Context(), organizationID, req.UserIDs); err != nil {
+		h.writeError(w, "Не удалось изменить состав организации", err)
+		return
+	}
+
+	h.log.Info("Состав организации изменен", " organizationID: ", organizationID, " userIDs: ", req.UserIDs)
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(fmt.Sprintf(`{"message": "%s"}`, done)))
+}
+
+func (h *OrganizationHandler) organizationID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	organizationID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		h.log.Error("Некорректный идентификатор организации", err)
+		http.Error(w, "Некорректный идентификатор организации", http.StatusBadRequest)
+		return 0, false
+	}
+	return organizationID, true
+}
+
+// writeError переводит ошибки сервиса организаций в HTTP-статусы
+func (h *OrganizationHandler) writeError(w http.ResponseWriter, message string, err error) {
+	h.log.Error(message+": ", err)
+	switch {
+	case errors.Is(err, ErrOrganizationName), errors.Is(err, ErrParentNotFound),
+		errors.Is(err, ErrOrganizationCycle), errors.Is(err, ErrUnknownMember):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, ErrOrganizationNotFound), errors.Is(err, ErrNoOrganization):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, ErrOrganizationExists), errors.Is(err, ErrOrganizationInUse):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, message, http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,370 @@
+package organizations
+
+import (
+	"ROOmail/internal/models"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"golang.org/x/net/context"
+	"strings"
+)
+
+var (
+	ErrOrganizationNotFound = errors.New("Организация не найдена")
+	ErrOrganizationName     = errors.New("Название организации обязательно")
+	ErrOrganizationExists   = errors.New("Организация с таким названием уже есть на этом уровне")
+	ErrParentNotFound       = errors.New("Родительская организация не найдена")
+	ErrOrganizationCycle    = errors.New("Организация не может быть вложена в саму себя или в дочернюю")
+	ErrOrganizationInUse    = errors.New("У организации есть дочерние организации")
+	ErrUnknownMember        = errors.New("Пользователь не найден")
+	ErrNoOrganization       = errors.New("Пользователь не прикреплен к организации")
+)
+
+// Коды ошибок PostgreSQL
+const (
+	uniqueViolation     = "23505"
+	foreignKeyViolation = "23503"
+)
+
+type OrganizationService struct {
+	db *pgxpool.Pool
+}
+
+func NewOrganizationService(db *pgxpool.Pool) *OrganizationService {
+	return &OrganizationService{db: db}
+}
+
+func (s *OrganizationService) Create(ctx context.Context, req models.OrganizationRequest) (int, error) {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return 0, ErrOrganizationName
+	}
+
+	var organizationID int
+	err := s.db.QueryRow(ctx, `INSERT INTO organizations (name, parent_id) VALUES ($1, $2) RETURNING id`, req.Name, req.ParentID).Scan(&organizationID)
+	if err != nil {
+		return 0, translateError(err)
+	}
+	return organizationID, nil
+}
+
+// Tree возвращает все организации в виде дерева, начиная с корневых
+func (s *OrganizationService) Tree(ctx context.Context) ([]models.Organization, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT o.id, o.name, o.parent_id, o.created_at, COUNT(u.id)::int
+		FROM organizations o
+		LEFT JOIN users u ON u.organization_id = o.id
+		GROUP BY o.id
+		ORDER BY o.name
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("Не удалось получить организации: %w", err)
+	}
+	defer rows.Close()
+
+	var all []models.Organization
+	for rows.Next() {
+		var o models.Organization
+		if err := rows.Scan(&o.ID, &o.Name, &o.ParentID, &o.CreatedAt, &o.MembersCount); err != nil {
+			return nil, fmt.Errorf("Не удалось прочитать организацию: %w", err)
+		}
+		all = append(all, o)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("Не удалось получить организации: %w", err)
+	}
+
+	return buildTree(all), nil
+}
+
+// buildTree раскладывает плоский список организаций по родителям, сохраняя порядок
+func buildTree(all []models.Organization) []models.Organization {
+	children := make(map[int][]models.Organization)
+	var roots []models.Organization
+	for _, o := range all {
+		if o.ParentID == nil {
+			roots = append(roots, o)
+			continue
+		}
+		children[*o.ParentID] = append(children[*o.ParentID], o)
+	}
+
+	var attach func(nodes []models.Organization) []models.Organization
+	attach = func(nodes []models.Organization) []models.Organization {
+		for i := range nodes {
+			nodes[i].Children = attach(children[nodes[i].ID])
+		}
+		return nodes
+	}
+
+	roots = attach(roots)
+	if roots == nil {
+		roots = []models.Organization{}
+	}
+	return roots
+}
+
+// Get возвращает организацию с путем от корня, дочерними организациями и сотрудниками
+func (s *OrganizationService) Get(ctx context.Context, organizationID int) (*models.Organization, error) {
+	var o models.Organization
+	err := s.db.QueryRow(ctx, `SELECT id, name, parent_id, created_at FROM organizations WHERE id = $1`, organizationID).
+		Scan(&o.ID, &o.Name, &o.ParentID, &o.CreatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrOrganizationNotFound
+		}
+		return nil, fmt.Errorf("Не удалось получить организацию: %w", err)
+	}
+
+	if o.Path, err = s.path(ctx, organizationID); err != nil {
+		return nil, err
+	}
+
+	childRows, err := s.db.Query(ctx, `
+		SELECT o.id, o.name, o.parent_id, o.created_at, COUNT(u.id)::int
+		FROM organizations o
+		LEFT JOIN users u ON u.organization_id = o.id
+		WHERE o.parent_id = $1
+		GROUP BY o.id
+		ORDER BY o.name
+	`, organizationID)
+	if err != nil {
+		return nil, fmt.Errorf("Не удалось получить дочерние организации: %w", err)
+	}
+	defer childRows.Close()
+
+	o.Children = []models.Organization{}
+	for childRows.Next() {
+		var child models.Organization
+		if err := childRows.Scan(&child.ID, &child.Name, &child.ParentID, &child.CreatedAt, &child.MembersCount); err != nil {
+			return nil, fmt.Errorf("Не удалось прочитать дочернюю организацию: %w", err)
+		}
+		o.Children = append(o.Children, child)
+	}
+	if err := childRows.Err(); err != nil {
+		return nil, fmt.Errorf("Не удалось получить дочерние организации: %w", err)
+	}
+
+	memberRows, err := s.db.Query(ctx, `SELECT id, username FROM users WHERE organization_id = $1 ORDER BY username`, organizationID)
+	if err != nil {
+		return nil, fmt.Errorf("Не удалось получить сотрудников организации: %w", err)
+	}
+	defer memberRows.Close()
+
+	o.Members = []models.UsersList{}
+	for memberRows.Next() {
+		var member models.UsersList
+		if err := memberRows.Scan(&member.ID, &member.Username); err != nil {
+			return nil, fmt.Errorf("Не удалось прочитать сотрудника организации: %w", err)
+		}
+		o.Members = append(o.Members, member)
+	}
+	if err := memberRows.Err(); err != nil {
+		return nil, fmt.Errorf("Не удалось получить сотрудников организации: %w", err)
+	}
+	o.MembersCount = len(o.Members)
+
+	return &o, nil
+}
+
+// ForUser возвращает организацию пользователя
+func (s *OrganizationService) ForUser(ctx context.Context, userID int) (*models.Organization, error) {
+	var organizationID *int
+	err := s.db.QueryRow(ctx, `SELECT organization_id FROM users WHERE id = $1`, userID).Scan(&organizationID)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("Не удалось получить организацию пользователя: %w", err)
+	}
+	if organizationID == nil {
+		return nil, ErrNoOrganization
+	}
+	return s.Get(ctx, *organizationID)
+}
+
+// Update переименовывает организацию и/или переносит ее под другого родителя.
+// moveToRoot переносит организацию на верхний уровень.
+func (s *OrganizationService) Update(ctx context.Context, organizationID int, name *string, parentID *int, moveToRoot bool) error {
+	if name != nil {
+		trimmed := strings.TrimSpace(*name)
+		if trimmed == "" {
+			return ErrOrganizationName
+		}
+		name = &trimmed
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("Failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if parentID != nil {
+		// Параллельные переносы блокируются до конца транзакции: иначе два встречных переноса
+		// пройдут проверку по старому дереву и вместе замкнут цикл
+		if _, err = tx.Exec(ctx, `LOCK TABLE organizations IN SHARE ROW EXCLUSIVE MODE`); err != nil {
+			return fmt.Errorf("Не удалось заблокировать организации: %w", err)
+		}
+
+		// Новый родитель не должен быть самой организацией или ее потомком
+		var cycle bool
+		err = tx.QueryRow(ctx, `
+			WITH RECURSIVE subtree AS (
+				SELECT id FROM organizations WHERE id = $1
+				UNION ALL
+				SELECT o.id FROM organizations o JOIN subtree st ON o.parent_id = st.id
+			)
+			SELECT EXISTS (SELECT 1 FROM subtree WHERE id = $2)
+		`, organizationID, *parentID).Scan(&cycle)
+		if err != nil {
+			return fmt.Errorf("Не удалось проверить иерархию организаций: %w", err)
+		}
+		if cycle {
+			return ErrOrganizationCycle
+		}
+	}
+
+	tag, err := tx.Exec(ctx, `
+		UPDATE organizations
+		SET name = COALESCE($2, name),
+		    parent_id = CASE WHEN $4 THEN NULL ELSE COALESCE($3, parent_id) END
+		WHERE id = $1
+	`, organizationID, name, parentID, moveToRoot)
+	if err != nil {
+		return translateError(err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrOrganizationNotFound
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("Не удалось обновить организацию: %w", err)
+	}
+	return nil
+}
+
+// Delete удаляет организацию без дочерних; сотрудники открепляются, назначения ей задачи удаляются
+func (s *OrganizationService) Delete(ctx context.Context, organizationID int) error {
+	tag, err := s.db.Exec(ctx, `DELETE FROM organizations WHERE id = $1`, organizationID)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == foreignKeyViolation {
+			return ErrOrganizationInUse
+		}
+		return fmt.Errorf("Не удалось удалить организацию: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrOrganizationNotFound
+	}
+	return nil
+}
+
+// AddMembers прикрепляет пользователей к организации. Пользователь состоит только в одной
+// организации, поэтому прикрепление переводит его из прежней.
+func (s *OrganizationService) AddMembers(ctx context.Context, organizationID int, userIDs []int) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("Failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err = lockOrganization(ctx, tx, organizationID); err != nil {
+		return err
+	}
+
+	tag, err := tx.Exec(ctx, `UPDATE users SET organization_id = $1 WHERE id = ANY($2)`, organizationID, userIDs)
+	if err != nil {
+		return fmt.Errorf("Не удалось прикрепить сотрудников: %w", err)
+	}
+	if int(tag.RowsAffected()) != countDistinct(userIDs) {
+		return ErrUnknownMember
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("Не удалось прикрепить сотрудников: %w", err)
+	}
+	return nil
+}
+
+// RemoveMembers открепляет пользователей от организации
+func (s *OrganizationService) RemoveMembers(ctx context.Context, organizationID int, userIDs []int) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("Failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err = lockOrganization(ctx, tx, organizationID); err != nil {
+		return err
+	}
+
+	if _, err = tx.Exec(ctx, `UPDATE users SET organization_id = NULL WHERE organization_id = $1 AND id = ANY($2)`, organizationID, userIDs); err != nil {
+		return fmt.Errorf("Не удалось открепить сотрудников: %w", err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("Не удалось открепить сотрудников: %w", err)
+	}
+	return nil
+}
+
+// path возвращает цепочку организаций от корня до указанной включительно
+func (s *OrganizationService) path(ctx context.Context, organizationID int) ([]models.OrganizationRef, error) {
+	rows, err := s.db.Query(ctx, `
+		WITH RECURSIVE chain AS (
+			SELECT id, name, parent_id, 0 AS depth FROM organizations WHERE id = $1
+			UNION ALL
+			SELECT o.id, o.name, o.parent_id, c.depth + 1
+			FROM organizations o JOIN chain c ON o.id = c.parent_id
+		)
+		SELECT id, name FROM chain ORDER BY depth DESC
+	`, organizationID)
+	if err != nil {
+		return nil, fmt.Errorf("Не удалось получить путь организации: %w", err)
+	}
+	defer rows.Close()
+
+	var path []models.OrganizationRef
+	for rows.Next() {
+		var ref models.OrganizationRef
+		if err := rows.Scan(&ref.ID, &ref.Name); err != nil {
+			return nil, fmt.Errorf("Не удалось прочитать путь организации: %w", err)
+		}
+		path = append(path, ref)
+	}
+	return path, rows.Err()
+}
+
+func lockOrganization(ctx context.Context, tx pgx.Tx, organizationID int) error {
+	var id int
+	err := tx.QueryRow(ctx, `SELECT id FROM organizations WHERE id = $1 FOR UPDATE`, organizationID).Scan(&id)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrOrganizationNotFound
+		}
+		return fmt.Errorf("Не удалось получить организацию: %w", err)
+	}
+	return nil
+}
+
+// translateError переводит ошибки ограничений таблицы organizations в ошибки сервиса
+func translateError(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case uniqueViolation:
+			return ErrOrganizationExists
+		case foreignKeyViolation:
+			return ErrParentNotFound
+		}
+	}
+	return fmt.Errorf("Не удалось сохранить организацию: %w", err)
+}
+
+func countDistinct(ids []int) int {
+	seen := make(map[int]struct{}, len(ids))
+	for _, id := range ids {
+		seen[id] = struct{}{}
+	}
+	return len(seen)
+}
@@ -0,0 +1,68 @@
+package organizations_test
+
+import (
+	"ROOmail/internal/handlers/organizations"
+	"ROOmail/internal/models"
+	"ROOmail/pkg/testdb"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdateHierarchy(t *testing.T) {
+	pool := testdb.New(t)
+	ctx := context.Background()
+	service := organizations.NewOrganizationService(pool)
+
+	districtID, err := service.Create(ctx, models.OrganizationRequest{Name: "Район"})
+	require.NoError(t, err)
+	schoolID, err := service.Create(ctx, models.OrganizationRequest{Name: "Школа", ParentID: &districtID})
+	require.NoError(t, err)
+	classID, err := service.Create(ctx, models.OrganizationRequest{Name: "Класс", ParentID: &schoolID})
+	require.NoError(t, err)
+
+	// Организацию нельзя вложить в саму себя или в потомка
+	assert.ErrorIs(t, service.Update(ctx, districtID, nil, &districtID, false), organizations.ErrOrganizationCycle)
+	assert.ErrorIs(t, service.Update(ctx, districtID, nil, &classID, false), organizations.ErrOrganizationCycle)
+	missing := classID + 100
+	assert.ErrorIs(t, service.Update(ctx, classID, nil, &missing, false), organizations.ErrParentNotFound)
+
+	require.NoError(t, service.Update(ctx, classID, nil, &districtID, false))
+	class, err := service.Get(ctx, classID)
+	require.NoError(t, err)
+	require.Len(t, class.Path, 2)
+	assert.Equal(t, districtID, class.Path[0].ID)
+
+	require.NoError(t, service.Update(ctx, schoolID, nil, nil, true))
+	school, err := service.Get(ctx, schoolID)
+	require.NoError(t, err)
+	assert.Nil(t, school.ParentID)
+
+	assert.ErrorIs(t, service.Delete(ctx, districtID), organizations.ErrOrganizationInUse)
+}
+
+func TestMembers(t *testing.T) {
+	pool := testdb.New(t)
+	ctx := context.Background()
+	service := organizations.NewOrganizationService(pool)
+	userID := testdb.CreateUser(t, pool, "teacher", "users")
+
+	schoolID, err := service.Create(ctx, models.OrganizationRequest{Name: "Школа"})
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, service.AddMembers(ctx, schoolID, []int{userID, userID + 100}), organizations.ErrUnknownMember)
+	_, err = service.ForUser(ctx, userID)
+	assert.ErrorIs(t, err, organizations.ErrNoOrganization)
+
+	require.NoError(t, service.AddMembers(ctx, schoolID, []int{userID}))
+	school, err := service.ForUser(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, schoolID, school.ID)
+	assert.Equal(t, 1, school.MembersCount)
+
+	require.NoError(t, service.RemoveMembers(ctx, schoolID, []int{userID}))
+	_, err = service.ForUser(ctx, userID)
+	assert.ErrorIs(t, err, organizations.ErrNoOrganization)
+}
@@ -0,0 +1,173 @@
+package roles
+
+import (
+	"ROOmail/internal/models"
+	"ROOmail/pkg/logger"
+	"ROOmail/pkg/utils"
+	"ROOmail/pkg/utils/jwt_token"
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"net/http"
+)
+
+type RoleHandler struct {
+	service *RoleService
+	log     logger.Logger
+}
+
+func NewRoleHandler(service *RoleService, log logger.Logger) *RoleHandler {
+	return &RoleHandler{service: service,
+		log: log,
+	}
+}
+
+// ListRolesHandler возвращает роли с их разрешениями
+// @Summary Список ролей
+// @Tags Роли
+// @Produce json
+// @Success 200 {array} models.Role "Роли с разрешениями и количеством пользователей"
+// @Failure 403 {string} string "Доступ запрещен"
+// @Failure 500 {string} string "Ошибка сервера"
+// @Router /admin/roles/list [get]
+func (h *RoleHandler) ListRolesHandler(w http.ResponseWriter, r *http.Request) {
+	roles, err := h.service.List(r.Context())
+	if err != nil {
+		h.writeError(w, "Не удалось получить роли", err)
+		return
+	}
+	utils.RespondJSON(w, http.StatusOK, roles)
+}
+
+// ListPermissionsHandler возвращает все разрешения, которые можно выдать роли
+// @Summary Список разрешений
+// @Tags Роли
+// @Produce json
+// @Success 200 {array} models.Permission "Разрешения"
+// @Failure 403 {string} string "Доступ запрещен"
+// @Failure 500 {string} string "Ошибка сервера"
+// @Router /admin/roles/permissions [get]
+func (h *RoleHandler) ListPermissionsHandler(w http.ResponseWriter, r *http.Request) {
+	permissions, err := h.service.Permissions(r.Context())
+	if err != nil {
+		h.writeError(w, "Не удалось получить разрешения", err)
+		return
+	}
+	utils.RespondJSON(w, http.StatusOK, permissions)
+}
+
+// CreateRoleHandler создает роль
+// @Summary Создать роль
+// @Description Создает роль с набором разрешений, например «методист» с tasks:read и tasks:create. Роль назначается пользователю полем role. Выдать роли можно только разрешения, которые есть у вас.
+// @Tags Роли
+// @Accept json
+// @Produce json
+// @Param role body models.RoleRequest true "Роль"
+// @Success 201 {object} map[string]string "Роль создана"
+// @Failure 400 {string} string "Некорректное название или неизвестное разрешение"
+// @Failure 403 {string} string "Доступ запрещен или разрешения нет у вас"
+// @Failure 409 {string} string "Роль с таким названием уже существует"
+// @Failure 500 {string} string "Ошибка сервера"
+// @Router /admin/roles/create [post]
+func (h *RoleHandler) CreateRoleHandler(w http.ResponseWriter, r *http.Request) {
+	userClaims, ok := r.Context().Value("user").(*jwt_token.Claims)
+	if !ok {
+		h.log.Error("Не удалось извлечь информацию о пользователе из контекста")
+		http.Error(w, "Ошибка авторизации", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.RoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.log.Error("Предоставлен некорректный JSON", err)
+		http.Error(w, "Некорректный JSON", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.Create(r.Context(), req, userClaims); err != nil {
+		h.writeError(w, "Не удалось создать роль", err)
+		return
+	}
+
+	h.log.Info("Роль создана", " role: ", req.Name, " permissions: ", req.Permissions)
+	utils.RespondJSON(w, http.StatusCreated, map[string]string{"message": "Роль создана"})
+}
+
+// UpdateRoleHandler меняет описание или разрешения роли
+// @Summary Обновить роль
+// @Description Меняет описание и/или заменяет набор разрешений целиком. Изменения действуют сразу, без повторного входа пользователей. Разрешения роли admin изменить нельзя. Изменить можно только роль, все разрешения которой есть у вас, и выдать ей только свои разрешения.
+// @Tags Роли
+// @Accept json
+// @Produce json
+// @Param name path string true "Название роли"
+// @Param role body models.RoleUpdate true "Новые данные роли"
+// @Success 200 {object} map[string]string "Роль обновлена"
+// @Failure 400 {string} string "Некорректный запрос или неизвестное разрешение"
+// @Failure 403 {string} string "Доступ запрещен, роль встроенная или сильнее вашей"
+// @Failure 404 {string} string "Роль не найдена"
+// @Failure 500 {string} string "Ошибка сервера"
+// @Router /admin/roles/update/{name} [patch]
+func (h *RoleHandler) UpdateRoleHandler(w http.ResponseWriter, r *http.Request) {
+	userClaims, ok := r.Context().Value("user").(*jwt_token.Claims)
+	if !ok {
+		h.log.Error("Не удалось извлечь информацию о пользователе из контекста")
+		http.Error(w, "Ошибка авторизации", http.StatusUnauthorized)
+		return
+	}
+	name := mux.Vars(r)["name"]
+
+	var upd models.RoleUpdate
+	if err := json.NewDecoder(r.Body).Decode(&upd); err != nil {
+		h.log.Error("Предоставлен некорректный JSON", err)
+		http.Error(w, "Некорректный JSON", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.Update(r.Context(), name, upd, userClaims); err != nil {
+		h.writeError(w, "Не удалось обновить роль", err)
+		return
+	}
+
+	h.log.Info("Роль обновлена", " role: ", name)
+	utils.RespondJSON(w, http.StatusOK, map[string]string{"message": "Роль обновлена"})
+}
+
+// DeleteRoleHandler удаляет роль
+// @Summary Удалить роль
+// @Description Удаляет роль, если она не встроенная и не назначена ни одному пользователю.
+// @Tags Роли
+// @Produce json
+// @Param name path string true "Название роли"
+// @Success 200 {object} map[string]string "Роль удалена"
+// @Failure 403 {string} string "Доступ запрещен или роль встроенная"
+// @Failure 404 {string} string "Роль не найдена"
+// @Failure 409 {string} string "Роль назначена пользователям"
+// @Failure 500 {string} string "Ошибка сервера"
+// @Router /admin/roles/delete/{name} [delete]
+func (h *RoleHandler) DeleteRoleHandler(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+
+	if err := h.service.Delete(r.Context(), name); err != nil {
+		h.writeError(w, "Не удалось удалить роль", err)
+		return
+	}
+
+	h.log.Info("Роль удалена", " role: ", name)
+	utils.RespondJSON(w, http.StatusOK, map[string]string{"message": "Роль удалена"})
+}
+
+func (h *RoleHandler) writeError(w http.ResponseWriter, message string, err error) {
+	h.log.Error(message+": ", err)
+	switch {
+	case errors.Is(err, ErrInvalidRoleName), errors.Is(err, ErrUnknownPermission):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, ErrBuiltinRole), errors.Is(err, ErrRoleNotAllowed), errors.Is(err, ErrPermissionDenied):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, ErrRoleNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, ErrRoleExists), errors.Is(err, ErrRoleInUse):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, message, http.StatusInternalServerError)
+	}
+}
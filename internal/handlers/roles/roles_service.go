@@ -0,0 +1,265 @@
+package roles
+
+import (
+	"ROOmail/internal/audience"
+	"ROOmail/internal/models"
+	"ROOmail/pkg/utils/jwt_token"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"golang.org/x/net/context"
+	"regexp"
+	"strings"
+)
+
+var (
+	ErrRoleNotFound      = errors.New("Роль не найдена")
+	ErrRoleExists        = errors.New("Роль с таким названием уже существует")
+	ErrInvalidRoleName   = errors.New("Название роли должно состоять из латинских букв, цифр, '_' или '-' (не более 50 символов)")
+	ErrUnknownPermission = errors.New("Неизвестное разрешение")
+	ErrBuiltinRole       = errors.New("Встроенную роль нельзя удалить, а разрешения администратора - изменить")
+	ErrRoleInUse         = errors.New("Роль назначена пользователям, сначала смените им роль")
+	ErrRoleNotAllowed    = errors.New("Нельзя назначить или изменить роль с разрешениями, которых нет у вас")
+	ErrPermissionDenied  = errors.New("Нельзя выдать роли разрешение, которого нет у вас")
+)
+
+// roleNamePattern - название роли хранится в users.role и передается в токене
+var roleNamePattern = regexp.MustCompile(`^[a-z0-9_-]{1,50}$`)
+
+type RoleService struct {
+	db *pgxpool.Pool
+}
+
+func NewRoleService(db *pgxpool.Pool) *RoleService {
+	return &RoleService{db: db}
+}
+
+// List возвращает роли с разрешениями и количеством пользователей
+func (s *RoleService) List(ctx context.Context) ([]models.Role, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT r.name, r.description, r.builtin, r.created_at,
+		       ARRAY(SELECT rp.permission FROM role_permissions rp WHERE rp.role = r.name ORDER BY rp.permission),
+		       (SELECT COUNT(*) FROM users u WHERE u.role = r.name)::int
+		FROM roles r
+		ORDER BY r.builtin DESC, r.name
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("Не удалось получить роли: %w", err)
+	}
+	defer rows.Close()
+
+	roles := []models.Role{}
+	for rows.Next() {
+		var role models.Role
+		if err := rows.Scan(&role.Name, &role.Description, &role.Builtin, &role.CreatedAt, &role.Permissions, &role.UsersCount); err != nil {
+			return nil, fmt.Errorf("Не удалось прочитать роль: %w", err)
+		}
+		roles = append(roles, role)
+	}
+	return roles, rows.Err()
+}
+
+// Permissions возвращает все известные разрешения
+func (s *RoleService) Permissions(ctx context.Context) ([]models.Permission, error) {
+	rows, err := s.db.Query(ctx, `SELECT code, description FROM permissions ORDER BY code`)
+	if err != nil {
+		return nil, fmt.Errorf("Не удалось получить разрешения: %w", err)
+	}
+	defer rows.Close()
+
+	permissions := []models.Permission{}
+	for rows.Next() {
+		var p models.Permission
+		if err := rows.Scan(&p.Code, &p.Description); err != nil {
+			return nil, fmt.Errorf("Не удалось прочитать разрешение: %w", err)
+		}
+		permissions = append(permissions, p)
+	}
+	return permissions, rows.Err()
+}
+
+// Create создает роль с набором разрешений. Выдать роли можно только разрешения,
+// которые есть у самого actor.
+func (s *RoleService) Create(ctx context.Context, req models.RoleRequest, actor *jwt_token.Claims) error {
+	req.Name = strings.TrimSpace(req.Name)
+	if !roleNamePattern.MatchString(req.Name) {
+		return ErrInvalidRoleName
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("Failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `INSERT INTO roles (name, description) VALUES ($1, $2)`, req.Name, strings.TrimSpace(req.Description))
+	if err != nil {
+		if pgErrorCode(err) == "23505" {
+			return ErrRoleExists
+		}
+		return fmt.Errorf("Не удалось создать роль: %w", err)
+	}
+
+	if err = setPermissions(ctx, tx, req.Name, req.Permissions); err != nil {
+		return err
+	}
+	if err = checkPermissions(actor, req.Permissions); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("Не удалось создать роль: %w", err)
+	}
+	return nil
+}
+
+// Update меняет описание и/или заменяет набор разрешений роли. Изменения действуют
+// со следующего запроса пользователей с этой ролью. Менять можно только роль,
+// все разрешения которой есть у actor, и только в пределах его разрешений.
+func (s *RoleService) Update(ctx context.Context, name string, upd models.RoleUpdate, actor *jwt_token.Claims) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("Failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err = tx.Exec(ctx, `SELECT 1 FROM roles WHERE name = $1 FOR UPDATE`, name); err != nil {
+		return fmt.Errorf("Не удалось получить роль: %w", err)
+	}
+	if err = Grantable(ctx, tx, actor, name); err != nil {
+		return err
+	}
+
+	var description *string
+	if upd.Description != nil {
+		trimmed := strings.TrimSpace(*upd.Description)
+		description = &trimmed
+	}
+
+	tag, err := tx.Exec(ctx, `UPDATE roles SET description = COALESCE($2, description) WHERE name = $1`, name, description)
+	if err != nil {
+		return fmt.Errorf("Не удалось обновить роль: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrRoleNotFound
+	}
+
+	if upd.Permissions != nil {
+		// Администратор всегда имеет все разрешения, иначе можно лишиться доступа к управлению ролями
+		if name == models.RoleAdmin {
+			return ErrBuiltinRole
+		}
+		if _, err = tx.Exec(ctx, `DELETE FROM role_permissions WHERE role = $1`, name); err != nil {
+			return fmt.Errorf("Не удалось обновить разрешения роли: %w", err)
+		}
+		if err = setPermissions(ctx, tx, name, *upd.Permissions); err != nil {
+			return err
+		}
+		if err = checkPermissions(actor, *upd.Permissions); err != nil {
+			return err
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("Не удалось обновить роль: %w", err)
+	}
+	return nil
+}
+
+// Delete удаляет роль, которая не встроена и не назначена ни одному пользователю
+func (s *RoleService) Delete(ctx context.Context, name string) error {
+	var builtin bool
+	err := s.db.QueryRow(ctx, `SELECT builtin FROM roles WHERE name = $1`, name).Scan(&builtin)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrRoleNotFound
+		}
+		return fmt.Errorf("Не удалось получить роль: %w", err)
+	}
+	if builtin {
+		return ErrBuiltinRole
+	}
+
+	if _, err = s.db.Exec(ctx, `DELETE FROM roles WHERE name = $1`, name); err != nil {
+		if pgErrorCode(err) == "23503" {
+			return ErrRoleInUse
+		}
+		return fmt.Errorf("Не удалось удалить роль: %w", err)
+	}
+	return nil
+}
+
+// Grantable проверяет, что роль существует и все ее разрешения есть у actor:
+// назначить пользователю или изменить можно только роль не сильнее собственной
+func Grantable(ctx context.Context, q audience.Querier, actor *jwt_token.Claims, role string) error {
+	var missing []string
+	err := q.QueryRow(ctx, `
+		SELECT ARRAY(SELECT rp.permission FROM role_permissions rp
+		             WHERE rp.role = r.name AND rp.permission <> ALL(COALESCE($2::text[], '{}'))
+		             ORDER BY rp.permission)
+		FROM roles r
+		WHERE r.name = $1
+	`, role, actor.Permissions).Scan(&missing)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrRoleNotFound
+		}
+		return fmt.Errorf("Не удалось проверить разрешения роли: %w", err)
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%w: %s", ErrRoleNotAllowed, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// checkPermissions проверяет, что actor может выдать роли все перечисленные разрешения
+func checkPermissions(actor *jwt_token.Claims, permissions []string) error {
+	for _, p := range permissions {
+		if !actor.HasPermission(p) {
+			return fmt.Errorf("%w: %s", ErrPermissionDenied, p)
+		}
+	}
+	return nil
+}
+
+// setPermissions выдает роли разрешения; повторы в списке не считаются ошибкой
+func setPermissions(ctx context.Context, tx pgx.Tx, role string, permissions []string) error {
+	if len(permissions) == 0 {
+		return nil
+	}
+
+	tag, err := tx.Exec(ctx, `
+		INSERT INTO role_permissions (role, permission)
+		SELECT $1, code FROM permissions WHERE code = ANY($2)
+		ON CONFLICT DO NOTHING
+	`, role, permissions)
+	if err != nil {
+		return fmt.Errorf("Не удалось выдать разрешения роли: %w", err)
+	}
+	if int(tag.RowsAffected()) != len(uniq(permissions)) {
+		return ErrUnknownPermission
+	}
+	return nil
+}
+
+func uniq(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	result := make([]string, 0, len(values))
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+func pgErrorCode(err error) string {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code
+	}
+	return ""
+}
@@ -0,0 +1,142 @@
+package roles_test
+
+import (
+	"ROOmail/internal/handlers/roles"
+	"ROOmail/internal/models"
+	"ROOmail/pkg/testdb"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateRole(t *testing.T) {
+	pool := testdb.New(t)
+	ctx := context.Background()
+	service := roles.NewRoleService(pool)
+	admin := testdb.Claims(t, pool, testdb.CreateUser(t, pool, "root", models.RoleAdmin))
+
+	cases := []struct {
+		name string
+		req  models.RoleRequest
+		err  error
+	}{
+		{"invalid name", models.RoleRequest{Name: "Методист"}, roles.ErrInvalidRoleName},
+		{"exists", models.RoleRequest{Name: "users"}, roles.ErrRoleExists},
+		{"unknown permission", models.RoleRequest{Name: "methodist", Permissions: []string{"tasks:fly"}}, roles.ErrUnknownPermission},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.ErrorIs(t, service.Create(ctx, tc.req, admin), tc.err)
+		})
+	}
+
+	require.NoError(t, service.Create(ctx, models.RoleRequest{
+		Name:        "methodist",
+		Description: " Методист ",
+		Permissions: []string{models.PermTasksRead, models.PermTasksCreate, models.PermTasksRead},
+	}, admin))
+
+	list, err := service.List(ctx)
+	require.NoError(t, err)
+	var methodist *models.Role
+	for i := range list {
+		if list[i].Name == "methodist" {
+			methodist = &list[i]
+		}
+	}
+	require.NotNil(t, methodist)
+	assert.Equal(t, "Методист", methodist.Description)
+	assert.Equal(t, []string{models.PermTasksCreate, models.PermTasksRead}, methodist.Permissions)
+	assert.False(t, methodist.Builtin)
+}
+
+func TestCreateRoleWithinOwnPermissions(t *testing.T) {
+	pool := testdb.New(t)
+	ctx := context.Background()
+	service := roles.NewRoleService(pool)
+	admin := testdb.Claims(t, pool, testdb.CreateUser(t, pool, "root", models.RoleAdmin))
+
+	require.NoError(t, service.Create(ctx, models.RoleRequest{
+		Name:        "roles",
+		Permissions: []string{models.PermRolesManage, models.PermTasksRead},
+	}, admin))
+	manager := testdb.Claims(t, pool, testdb.CreateUser(t, pool, "manager", "roles"))
+
+	err := service.Create(ctx, models.RoleRequest{Name: "security", Permissions: []string{models.PermSecurityManage}}, manager)
+	assert.ErrorIs(t, err, roles.ErrPermissionDenied)
+	assert.ErrorIs(t, roles.Grantable(ctx, pool, admin, "security"), roles.ErrRoleNotFound)
+
+	require.NoError(t, service.Create(ctx, models.RoleRequest{Name: "readers", Permissions: []string{models.PermTasksRead}}, manager))
+}
+
+func TestUpdateRole(t *testing.T) {
+	pool := testdb.New(t)
+	ctx := context.Background()
+	service := roles.NewRoleService(pool)
+	admin := testdb.Claims(t, pool, testdb.CreateUser(t, pool, "root", models.RoleAdmin))
+
+	require.NoError(t, service.Create(ctx, models.RoleRequest{
+		Name:        "roles",
+		Permissions: []string{models.PermRolesManage, models.PermTasksRead, models.PermTasksExecute},
+	}, admin))
+	manager := testdb.Claims(t, pool, testdb.CreateUser(t, pool, "manager", "roles"))
+
+	description := "Пользователи"
+	permissions := []string{models.PermTasksRead}
+	assert.ErrorIs(t, service.Update(ctx, "unknown", models.RoleUpdate{Description: &description}, admin), roles.ErrRoleNotFound)
+	assert.ErrorIs(t, service.Update(ctx, models.RoleAdmin, models.RoleUpdate{Permissions: &permissions}, admin), roles.ErrBuiltinRole)
+
+	// Роль сильнее собственной нельзя изменить, а выдать роли можно только свои разрешения
+	assert.ErrorIs(t, service.Update(ctx, models.RoleAdmin, models.RoleUpdate{Description: &description}, manager), roles.ErrRoleNotAllowed)
+	security := []string{models.PermTasksExecute, models.PermSecurityManage}
+	assert.ErrorIs(t, service.Update(ctx, "users", models.RoleUpdate{Permissions: &security}, manager), roles.ErrPermissionDenied)
+	assert.NoError(t, roles.Grantable(ctx, pool, manager, "users"))
+
+	require.NoError(t, service.Update(ctx, "users", models.RoleUpdate{Description: &description, Permissions: &permissions}, manager))
+	list, err := service.List(ctx)
+	require.NoError(t, err)
+	for _, role := range list {
+		if role.Name == "users" {
+			assert.Equal(t, description, role.Description)
+			assert.Equal(t, permissions, role.Permissions)
+		}
+	}
+}
+
+func TestDeleteRole(t *testing.T) {
+	pool := testdb.New(t)
+	ctx := context.Background()
+	service := roles.NewRoleService(pool)
+	admin := testdb.Claims(t, pool, testdb.CreateUser(t, pool, "root", models.RoleAdmin))
+
+	require.NoError(t, service.Create(ctx, models.RoleRequest{Name: "methodist", Permissions: []string{models.PermTasksRead}}, admin))
+	userID := testdb.CreateUser(t, pool, "teacher", "methodist")
+
+	assert.ErrorIs(t, service.Delete(ctx, models.RoleAdmin), roles.ErrBuiltinRole)
+	assert.ErrorIs(t, service.Delete(ctx, "unknown"), roles.ErrRoleNotFound)
+	assert.ErrorIs(t, service.Delete(ctx, "methodist"), roles.ErrRoleInUse)
+
+	_, err := pool.Exec(ctx, `UPDATE users SET role = 'users' WHERE id = $1`, userID)
+	require.NoError(t, err)
+	require.NoError(t, service.Delete(ctx, "methodist"))
+	assert.ErrorIs(t, service.Delete(ctx, "methodist"), roles.ErrRoleNotFound)
+}
+
+func TestGrantable(t *testing.T) {
+	pool := testdb.New(t)
+	ctx := context.Background()
+	admin := testdb.Claims(t, pool, testdb.CreateUser(t, pool, "root", models.RoleAdmin))
+	teacher := testdb.Claims(t, pool, testdb.CreateUser(t, pool, "teacher", "users"))
+
+	assert.NoError(t, roles.Grantable(ctx, pool, admin, models.RoleAdmin))
+	assert.NoError(t, roles.Grantable(ctx, pool, admin, "users"))
+	assert.NoError(t, roles.Grantable(ctx, pool, teacher, "users"))
+	assert.ErrorIs(t, roles.Grantable(ctx, pool, teacher, models.RoleAdmin), roles.ErrRoleNotAllowed)
+	assert.ErrorIs(t, roles.Grantable(ctx, pool, admin, "unknown"), roles.ErrRoleNotFound)
+
+	// Без разрешений можно назначить только роль без разрешений
+	teacher.Permissions = nil
+	assert.ErrorIs(t, roles.Grantable(ctx, pool, teacher, "users"), roles.ErrRoleNotAllowed)
+}
@@ -0,0 +1,220 @@
+package sessions
+
+import (
+	"ROOmail/internal/handlers/roles"
+	"ROOmail/internal/tokens"
+	"ROOmail/pkg/logger"
+	"ROOmail/pkg/utils"
+	"ROOmail/pkg/utils/jwt_token"
+	"errors"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+)
+
+type SessionHandler struct {
+	service *SessionService
+	log     logger.Logger
+}
+
+func NewSessionHandler(service *SessionService, log logger.Logger) *SessionHandler {
+	return &SessionHandler{service: service,
+		log: log,
+	}
+}
+
+// MySessionsHandler возвращает действующие сессии текущего пользователя
+// @Summary Мои сессии
+// @Description Возвращает устройства, с которых выполнен вход: IP, User-Agent, время входа и последней активности. Сессия текущего запроса отмечена флагом current.
+// @Tags Сессии
+// @Produce json
+// @Success 200 {array} models.Session "Сессии"
+// @Failure 401 {string} string "Неавторизованный доступ"
+// @Failure 500 {string} string "Ошибка сервера"
+// @Router /sessions [get]
+func (h *SessionHandler) MySessionsHandler(w http.ResponseWriter, r *http.Request) {
+	userClaims, ok := r.Context().Value("user").(*jwt_token.Claims)
+	if !ok {
+		h.log.Error("Попытка неавторизованного доступа")
+		http.Error(w, "Неавторизованный доступ", http.StatusUnauthorized)
+		return
+	}
+
+	sessions, err := h.service.List(r.Context(), &userClaims.UserID, userClaims.SessionID)
+	if err != nil {
+		h.log.Error("Не удалось получить сессии: ", err)
+		http.Error(w, "Не удалось получить сессии", http.StatusInternalServerError)
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusOK, sessions)
+}
+
+// RevokeMySessionHandler завершает одну из сессий текущего пользователя
+// @Summary Завершить сессию
+// @Description Завершает сессию на другом устройстве (или текущую): ее токены доступа и refresh-токены больше не принимаются.
+// @Tags Сессии
+// @Produce json
+// @Param id path string true "ID сессии"
+// @Success 200 {object} map[string]string "Сессия завершена"
+// @Failure 401 {string} string "Неавторизованный доступ"
+// @Failure 404 {string} string "Сессия не найдена"
+// @Failure 500 {string} string "Ошибка сервера"
+// @Router /sessions/{id} [delete]
+func (h *SessionHandler) RevokeMySessionHandler(w http.ResponseWriter, r *http.Request) {
+	userClaims, ok := r.Context().Value("user").(*jwt_token.Claims)
+	if !ok {
+		h.log.Error("Попытка неавторизованного доступа")
+		http.Error(w, "Неавторизованный доступ", http.StatusUnauthorized)
+		return
+	}
+
+	sessionID := mux.Vars(r)["id"]
+	if err := h.service.Revoke(r.Context(), sessionID, &userClaims.UserID); err != nil {
+		h.writeError(w, "Не удалось завершить сессию", err)
+		return
+	}
+
+	h.log.Info("Пользователь завершил сессию ", "userID: ", userClaims.UserID, " sessionID: ", sessionID)
+	utils.RespondJSON(w, http.StatusOK, map[string]string{"message": "Сессия завершена"})
+}
+
+// RevokeOtherSessionsHandler завершает все сессии текущего пользователя, кроме текущей
+// @Summary Завершить другие сессии
+// @Tags Сессии
+// @Produce json
+// @Success 200 {object} map[string]string "Остальные сессии завершены"
+// @Failure 401 {string} string "Неавторизованный доступ"
+// @Failure 500 {string} string "Ошибка сервера"
+// @Router /sessions/revoke-others [post]
+func (h *SessionHandler) RevokeOtherSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	userClaims, ok := r.Context().Value("user").(*jwt_token.Claims)
+	if !ok {
+		h.log.Error("Попытка неавторизованного доступа")
+		http.Error(w, "Неавторизованный доступ", http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.service.RevokeUser(r.Context(), userClaims.UserID, userClaims.SessionID); err != nil {
+		h.writeError(w, "Не удалось завершить сессии", err)
+		return
+	}
+
+	h.log.Info("Пользователь завершил остальные сессии ", "userID: ", userClaims.UserID)
+	utils.RespondJSON(w, http.StatusOK, map[string]string{"message": "Остальные сессии завершены"})
+}
+
+// ListSessionsHandler возвращает действующие сессии всех пользователей или одного пользователя
+// @Summary Активные сессии
+// @Tags Сессии
+// @Produce json
+// @Param user_id query int false "ID пользователя"
+// @Success 200 {array} models.Session "Сессии"
+// @Failure 400 {string} string "Некорректный идентификатор пользователя"
+// @Failure 500 {string} string "Ошибка сервера"
+// @Router /admin/sessions/list [get]
+func (h *SessionHandler) ListSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	var userID *int
+	if raw := r.URL.Query().Get("user_id"); raw != "" {
+		id, err := strconv.Atoi(raw)
+		if err != nil {
+			http.Error(w, "Некорректный идентификатор пользователя", http.StatusBadRequest)
+			return
+		}
+		userID = &id
+	}
+
+	var currentSessionID string
+	if userClaims, ok := r.Context().Value("user").(*jwt_token.Claims); ok {
+		currentSessionID = userClaims.SessionID
+	}
+
+	sessions, err := h.service.List(r.Context(), userID, currentSessionID)
+	if err != nil {
+		h.log.Error("Не удалось получить сессии: ", err)
+		http.Error(w, "Не удалось получить сессии", http.StatusInternalServerError)
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusOK, sessions)
+}
+
+// RevokeSessionHandler завершает любую сессию
+// @Summary Завершить сессию пользователя
+// @Tags Сессии
+// @Produce json
+// @Param id path string true "ID сессии"
+// @Success 200 {object} map[string]string "Сессия завершена"
+// @Failure 401 {string} string "Неавторизованный доступ"
+// @Failure 403 {string} string "Роль владельца сессии шире прав администратора"
+// @Failure 404 {string} string "Сессия не найдена"
+// @Failure 500 {string} string "Ошибка сервера"
+// @Router /admin/sessions/revoke/{id} [delete]
+func (h *SessionHandler) RevokeSessionHandler(w http.ResponseWriter, r *http.Request) {
+	userClaims, ok := r.Context().Value("user").(*jwt_token.Claims)
+	if !ok {
+		h.log.Error("Не удалось извлечь информацию о пользователе из контекста")
+		http.Error(w, "Ошибка авторизации", http.StatusUnauthorized)
+		return
+	}
+
+	sessionID := mux.Vars(r)["id"]
+	if err := h.service.RevokeByAdmin(r.Context(), sessionID, userClaims); err != nil {
+		h.writeError(w, "Не удалось завершить сессию", err)
+		return
+	}
+
+	h.log.Info("Администратор завершил сессию ", "sessionID: ", sessionID)
+	utils.RespondJSON(w, http.StatusOK, map[string]string{"message": "Сессия завершена"})
+}
+
+// RevokeUserSessionsHandler завершает все сессии пользователя (принудительный выход)
+// @Summary Завершить все сессии пользователя
+// @Description Принудительный выход на всех устройствах, например при компрометации учетной записи.
+// @Tags Сессии
+// @Produce json
+// @Param id path int true "ID пользователя"
+// @Success 200 {object} map[string]string "Сессии завершены"
+// @Failure 400 {string} string "Некорректный идентификатор пользователя"
+// @Failure 401 {string} string "Неавторизованный доступ"
+// @Failure 403 {string} string "Роль пользователя шире прав администратора"
+// @Failure 404 {string} string "Пользователь не найден"
+// @Failure 500 {string} string "Ошибка сервера"
+// @Router /admin/sessions/revoke-user/{id} [delete]
+func (h *SessionHandler) RevokeUserSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	userClaims, ok := r.Context().Value("user").(*jwt_token.Claims)
+	if !ok {
+		h.log.Error("Не удалось извлечь информацию о пользователе из контекста")
+		http.Error(w, "Ошибка авторизации", http.StatusUnauthorized)
+		return
+	}
+
+	userID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		h.log.Error("Некорректный идентификатор пользователя", err)
+		http.Error(w, "Некорректный идентификатор пользователя", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.RevokeUserByAdmin(r.Context(), userID, userClaims); err != nil {
+		h.writeError(w, "Не удалось завершить сессии", err)
+		return
+	}
+
+	h.log.Info("Администратор завершил все сессии пользователя ", "userID: ", userID)
+	utils.RespondJSON(w, http.StatusOK, map[string]string{"message": "Сессии пользователя завершены"})
+}
+
+func (h *SessionHandler) writeError(w http.ResponseWriter, fallback string, err error) {
+	switch {
+	case errors.Is(err, tokens.ErrSessionNotFound), errors.Is(err, ErrUserNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, roles.ErrRoleNotAllowed):
+		h.log.Warn(fallback+": ", err)
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	h.log.Error(fallback+": ", err)
+	http.Error(w, fallback, http.StatusInternalServerError)
+}
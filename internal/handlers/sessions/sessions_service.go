@@ -0,0 +1,113 @@
+package sessions
+
+import (
+	"ROOmail/internal/handlers/roles"
+	"ROOmail/internal/models"
+	"ROOmail/internal/tokens"
+	"ROOmail/pkg/utils/jwt_token"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"golang.org/x/net/context"
+)
+
+var ErrUserNotFound = errors.New("Пользователь не найден")
+
+// SessionService показывает сессии пользователей и завершает их через хранилище токенов
+type SessionService struct {
+	db     *pgxpool.Pool
+	tokens *tokens.Store
+}
+
+func NewSessionService(db *pgxpool.Pool, store *tokens.Store) *SessionService {
+	return &SessionService{db: db, tokens: store}
+}
+
+// List возвращает действующие сессии, начиная с последних активных.
+// Если userID равен nil, возвращаются сессии всех пользователей.
+// currentSessionID отмечает сессию, из которой выполнен запрос.
+func (s *SessionService) List(ctx context.Context, userID *int, currentSessionID string) ([]models.Session, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT s.id, s.user_id, u.username, COALESCE(s.ip, ''), COALESCE(s.user_agent, ''),
+		       s.created_at, s.last_seen_at, s.expires_at
+		FROM sessions s
+		JOIN users u ON u.id = s.user_id
+		WHERE s.revoked_at IS NULL AND s.expires_at > NOW()
+		  AND ($1::integer IS NULL OR s.user_id = $1)
+		ORDER BY s.last_seen_at DESC
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("Не удалось получить сессии: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := []models.Session{}
+	for rows.Next() {
+		var session models.Session
+		err := rows.Scan(&session.ID, &session.UserID, &session.Username, &session.IP, &session.UserAgent,
+			&session.CreatedAt, &session.LastSeenAt, &session.ExpiresAt)
+		if err != nil {
+			return nil, fmt.Errorf("Не удалось прочитать сессию: %w", err)
+		}
+		session.Current = session.ID == currentSessionID
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+// Revoke завершает сессию. Если userID не nil, сессия должна принадлежать этому пользователю.
+func (s *SessionService) Revoke(ctx context.Context, sessionID string, userID *int) error {
+	return s.tokens.RevokeSession(ctx, sessionID, userID)
+}
+
+// RevokeUser завершает все сессии пользователя, кроме exceptSessionID
+func (s *SessionService) RevokeUser(ctx context.Context, userID int, exceptSessionID string) error {
+	return s.tokens.RevokeUser(ctx, userID, exceptSessionID)
+}
+
+// RevokeByAdmin завершает сессию другого пользователя. Завершить можно только сессию
+// пользователя, роль которого в пределах разрешений actor.
+func (s *SessionService) RevokeByAdmin(ctx context.Context, sessionID string, actor *jwt_token.Claims) error {
+	var role string
+	err := s.db.QueryRow(ctx, `SELECT u.role FROM sessions s JOIN users u ON u.id = s.user_id WHERE s.id = $1`, sessionID).Scan(&role)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return tokens.ErrSessionNotFound
+		}
+		return fmt.Errorf("Не удалось получить сессию: %w", err)
+	}
+	if err := roles.Grantable(ctx, s.db, actor, role); err != nil {
+		return err
+	}
+	return s.tokens.RevokeSession(ctx, sessionID, nil)
+}
+
+// RevokeUserByAdmin завершает все сессии другого пользователя, если его роль в пределах разрешений actor
+func (s *SessionService) RevokeUserByAdmin(ctx context.Context, userID int, actor *jwt_token.Claims) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("Failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var role string
+	err = tx.QueryRow(ctx, `SELECT role FROM users WHERE id = $1 FOR UPDATE`, userID).Scan(&role)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrUserNotFound
+		}
+		return fmt.Errorf("Не удалось получить пользователя: %w", err)
+	}
+	if err := roles.Grantable(ctx, tx, actor, role); err != nil {
+		return err
+	}
+
+	if err := s.tokens.RevokeUserTx(ctx, tx, userID, ""); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("Failed to commit session revoke: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package sessions_test
+
+import (
+	"ROOmail/internal/handlers/roles"
+	"ROOmail/internal/handlers/sessions"
+	"ROOmail/internal/models"
+	"ROOmail/internal/tokens"
+	"ROOmail/pkg/testdb"
+	"ROOmail/pkg/utils/jwt_token"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func init() {
+	keys, err := jwt_token.NewSecretKeySet("sessions-test-secret")
+	if err != nil {
+		panic(err)
+	}
+	jwt_token.SetKeySet(keys)
+}
+
+func sessionID(t *testing.T, pair *tokens.Pair) string {
+	claims, err := jwt_token.ParseToken(pair.AccessToken)
+	require.NoError(t, err)
+	return claims.SessionID
+}
+
+func TestSessions(t *testing.T) {
+	pool := testdb.New(t)
+	ctx := context.Background()
+	store := tokens.NewStore(pool, time.Hour)
+	service := sessions.NewSessionService(pool, store)
+
+	teacherID := testdb.CreateUser(t, pool, "teacher", "users")
+	directorID := testdb.CreateUser(t, pool, "director", "users")
+	teacher := &models.User{ID: teacherID, Username: "teacher", Role: "users"}
+
+	laptop, err := store.Issue(ctx, teacher, models.SessionMeta{IP: "10.0.0.1", UserAgent: "laptop"})
+	require.NoError(t, err)
+	phone, err := store.Issue(ctx, teacher, models.SessionMeta{IP: "10.0.0.2", UserAgent: "phone"})
+	require.NoError(t, err)
+	tablet, err := store.Issue(ctx, teacher, models.SessionMeta{IP: "10.0.0.3", UserAgent: "tablet"})
+	require.NoError(t, err)
+	_, err = store.Issue(ctx, &models.User{ID: directorID, Username: "director", Role: "users"}, models.SessionMeta{})
+	require.NoError(t, err)
+
+	list, err := service.List(ctx, &teacherID, sessionID(t, laptop))
+	require.NoError(t, err)
+	require.Len(t, list, 3)
+	current := 0
+	for _, session := range list {
+		assert.Equal(t, teacherID, session.UserID)
+		if session.Current {
+			current++
+			assert.Equal(t, "laptop", session.UserAgent)
+		}
+	}
+	assert.Equal(t, 1, current)
+
+	all, err := service.List(ctx, nil, "")
+	require.NoError(t, err)
+	assert.Len(t, all, 4)
+
+	// Чужую сессию пользователь завершить не может
+	assert.ErrorIs(t, service.Revoke(ctx, sessionID(t, phone), &directorID), tokens.ErrSessionNotFound)
+	require.NoError(t, service.Revoke(ctx, sessionID(t, phone), &teacherID))
+	_, err = store.Rotate(ctx, phone.RefreshToken)
+	assert.ErrorIs(t, err, tokens.ErrInvalidRefreshToken)
+
+	// Завершение остальных сессий не трогает текущую и сессии других пользователей
+	require.NoError(t, service.RevokeUser(ctx, teacherID, sessionID(t, laptop)))
+	_, err = store.Rotate(ctx, tablet.RefreshToken)
+	assert.ErrorIs(t, err, tokens.ErrInvalidRefreshToken)
+	_, err = store.Rotate(ctx, laptop.RefreshToken)
+	assert.NoError(t, err)
+
+	list, err = service.List(ctx, &teacherID, "")
+	require.NoError(t, err)
+	assert.Len(t, list, 1)
+	all, err = service.List(ctx, nil, "")
+	require.NoError(t, err)
+	assert.Len(t, all, 2)
+}
+
+func TestRevokeWithinOwnPermissions(t *testing.T) {
+	pool := testdb.New(t)
+	ctx := context.Background()
+	store := tokens.NewStore(pool, time.Hour)
+	service := sessions.NewSessionService(pool, store)
+	admin := testdb.Claims(t, pool, testdb.CreateUser(t, pool, "root", models.RoleAdmin))
+	teacherID := testdb.CreateUser(t, pool, "teacher", "users")
+
+	require.NoError(t, roles.NewRoleService(pool).Create(ctx, models.RoleRequest{
+		Name:        "security",
+		Permissions: []string{models.PermSecurityManage, models.PermTasksExecute},
+	}, admin))
+	officer := testdb.Claims(t, pool, testdb.CreateUser(t, pool, "officer", "security"))
+
+	rootSession, err := store.Issue(ctx, &models.User{ID: admin.UserID, Username: "root", Role: models.RoleAdmin}, models.SessionMeta{})
+	require.NoError(t, err)
+	teacherSession, err := store.Issue(ctx, &models.User{ID: teacherID, Username: "teacher", Role: "users"}, models.SessionMeta{})
+	require.NoError(t, err)
+
+	// Сессии администратора не завершит пользователь с меньшими правами
+	assert.ErrorIs(t, service.RevokeByAdmin(ctx, sessionID(t, rootSession), officer), roles.ErrRoleNotAllowed)
+	assert.ErrorIs(t, service.RevokeUserByAdmin(ctx, admin.UserID, officer), roles.ErrRoleNotAllowed)
+	list, err := service.List(ctx, &admin.UserID, "")
+	require.NoError(t, err)
+	assert.Len(t, list, 1)
+
+	assert.ErrorIs(t, service.RevokeByAdmin(ctx, "unknown", officer), tokens.ErrSessionNotFound)
+	assert.ErrorIs(t, service.RevokeUserByAdmin(ctx, 1_000_000, officer), sessions.ErrUserNotFound)
+
+	require.NoError(t, service.RevokeByAdmin(ctx, sessionID(t, teacherSession), officer))
+	require.NoError(t, service.RevokeUserByAdmin(ctx, admin.UserID, admin))
+	list, err = service.List(ctx, nil, "")
+	require.NoError(t, err)
+	assert.Empty(t, list)
+}
@@ -0,0 +1,248 @@
+package tasks
+
+import (
+	"ROOmail/internal/models"
+	"ROOmail/pkg/logger"
+	"ROOmail/pkg/utils"
+	"ROOmail/pkg/utils/jwt_token"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+type ResponseHandler struct {
+	Service ResponseServiceInterface
+	Log     logger.Logger
+}
+
+func NewResponseHandler(service ResponseServiceInterface, log logger.Logger) *ResponseHandler {
+	return &ResponseHandler{Service: service,
+		Log: log,
+	}
+}
+
+// CreateResponseHandler принимает ответ исполнителя на задачу
+// @Summary Ответ на задачу
+// @Description Исполнитель отправляет ответ на задачу: текст и один или несколько файлов
+// @Tags Ответы
+// @Accept multipart/form-data
+// @Produce json
+// @Param id path int true "ID задачи"
+// @Param text formData string false "Текст ответа"
+// @Param files formData file false "Вложения (можно несколько)"
+// @Success 201 {object} map[string]interface{} "Ответ успешно отправлен"
+// @Failure 400 {string} string "Некорректный запрос"
+// @Failure 401 {string} string "Неавторизованный доступ"
+// @Failure 404 {string} string "Задача не назначена пользователю"
+// @Failure 500 {string} string "Ошибка сервера"
+// @Router /user/tasks/responses/{id} [post]
+func (h *ResponseHandler) CreateResponseHandler(w http.ResponseWriter, r *http.Request) {
+	h.Log.Info("Получен запрос на отправку ответа по задаче")
+
+	vars := mux.Vars(r)
+	taskID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		h.Log.Error("Некорректный идентификатор задачи", err)
+		http.Error(w, "Некорректный идентификатор задачи", http.StatusBadRequest)
+		return
+	}
+
+	userClaims, ok := r.Context().Value("user").(*jwt_token.Claims)
+	if !ok {
+		h.Log.Error("Попытка неавторизованного доступа")
+		http.Error(w, "Неавторизованный доступ", http.StatusUnauthorized)
+		return
+	}
+
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		h.Log.Error("Ошибка разбора формы", err)
+		http.Error(w, "Ошибка разбора формы", http.StatusBadRequest)
+		return
+	}
+
+	text := r.FormValue("text")
+	files := r.MultipartForm.File["files"]
+
+	responseID, err := h.Service.CreateResponse(r.Context(), taskID, userClaims.UserID, text, files)
+	if err != nil {
+		h.Log.Error("Не удалось сохранить ответ по задаче", err)
+		switch {
+		case errors.Is(err, ErrEmptyResponse):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, ErrTaskNotAssigned):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		default:
+			http.Error(w, "Не удалось сохранить ответ", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	h.Log.Info("Ответ по задаче сохранен", " taskID: ", taskID, " responseID: ", responseID, " userID: ", userClaims.UserID)
+
+	w.WriteHeader(http.StatusCreated)
+	w.Write([]byte(fmt.Sprintf(`{"message": "Ответ успешно отправлен", "response_id": %d}`, responseID)))
+}
+
+// GetTaskResponsesHandler возвращает все ответы исполнителей по задаче
+// @Summary Ответы по задаче
+// @Description Возвращает список ответов по задаче: автор, текст, вложения и время отправки
+// @Tags Ответы
+// @Produce json
+// @Param id path int true "ID задачи"
+// @Success 200 {array} models.TaskResponse "Список ответов"
+// @Failure 400 {string} string "Некорректный идентификатор задачи"
+// @Failure 500 {string} string "Ошибка сервера"
+// @Router /admin/tasks/responses/{id} [get]
+func (h *ResponseHandler) GetTaskResponsesHandler(w http.ResponseWriter, r *http.Request) {
+	h.Log.Info("Получен запрос на получение ответов по задаче")
+
+	vars := mux.Vars(r)
+	taskID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		h.Log.Error("Некорректный идентификатор задачи", err)
+		http.Error(w, "Некорректный идентификатор задачи", http.StatusBadRequest)
+		return
+	}
+
+	responses, err := h.Service.GetResponsesByTask(r.Context(), taskID)
+	if err != nil {
+		h.Log.Error("Не удалось получить ответы по задаче", err)
+		http.Error(w, "Не удалось получить ответы", http.StatusInternalServerError)
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusOK, responses)
+}
+
+// ReviewResponseHandler принимает ответ исполнителя или возвращает его на доработку
+// @Summary Проверка ответа
+// @Description Администратор принимает ответ (accepted) или возвращает его на доработку с комментарием (returned)
+// @Tags Ответы
+// @Accept json
+// @Produce json
+// @Param id path int true "ID ответа"
+// @Param review body models.ReviewRequest true "Решение по ответу"
+// @Success 200 {object} map[string]string "Решение сохранено"
+// @Failure 400 {string} string "Некорректный запрос"
+// @Failure 401 {string} string "Неавторизованный доступ"
+// @Failure 404 {string} string "Ответ не найден"
+// @Failure 409 {string} string "Ответ уже проверен или есть более новый ответ"
+// @Failure 500 {string} string "Ошибка сервера"
+// @Router /admin/tasks/responses/review/{id} [post]
+func (h *ResponseHandler) ReviewResponseHandler(w http.ResponseWriter, r *http.Request) {
+	h.Log.Info("Получен запрос на проверку ответа")
+
+	vars := mux.Vars(r)
+	responseID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		h.Log.Error("Некорректный идентификатор ответа", err)
+		http.Error(w, "Некорректный идентификатор ответа", http.StatusBadRequest)
+		return
+	}
+
+	var req models.ReviewRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.Log.Error("Предоставлен некорректный JSON", err)
+		http.Error(w, "Некорректный JSON", http.StatusBadRequest)
+		return
+	}
+
+	userClaims, ok := r.Context().Value("user").(*jwt_token.Claims)
+	if !ok {
+		h.Log.Error("Попытка неавторизованного доступа")
+		http.Error(w, "Неавторизованный доступ", http.StatusUnauthorized)
+		return
+	}
+
+	err = h.Service.ReviewResponse(r.Context(), responseID, userClaims.UserID, req.Status, req.Comment)
+	if err != nil {
+		h.Log.Error("Не удалось сохранить решение по ответу", err)
+		switch {
+		case errors.Is(err, ErrInvalidReviewStatus), errors.Is(err, ErrReviewCommentRequired):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, ErrResponseNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, ErrResponseAlreadyReviewed), errors.Is(err, ErrResponseSuperseded):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			http.Error(w, "Не удалось сохранить решение", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	h.Log.Info("Ответ проверен", " responseID: ", responseID, " status: ", req.Status, " reviewer: ", userClaims.UserID)
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"message": "Решение по ответу сохранено"}`))
+}
+
+// ResponseFileHandler отдает вложение ответа
+// @Summary Скачать вложение ответа
+// @Description Файл доступен автору задачи, проверяющим с разрешением tasks:read, автору ответа и сотрудникам организации, от имени которой дан ответ
+// @Tags Ответы
+// @Produce octet-stream
+// @Param id path int true "ID ответа"
+// @Param file_id path int true "ID файла"
+// @Success 200 {file} file "Файл ответа"
+// @Failure 400 {string} string "Некорректный идентификатор"
+// @Failure 401 {string} string "Неавторизованный доступ"
+// @Failure 404 {string} string "Файл ответа не найден"
+// @Failure 500 {string} string "Ошибка сервера"
+// @Router /user/tasks/responses/{id}/files/{file_id} [get]
+func (h *ResponseHandler) ResponseFileHandler(w http.ResponseWriter, r *http.Request) {
+	userClaims, ok := r.Context().Value("user").(*jwt_token.Claims)
+	if !ok {
+		h.Log.Error("Попытка неавторизованного доступа")
+		http.Error(w, "Неавторизованный доступ", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	responseID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Некорректный идентификатор ответа", http.StatusBadRequest)
+		return
+	}
+	fileID, err := strconv.Atoi(vars["file_id"])
+	if err != nil {
+		http.Error(w, "Некорректный идентификатор файла", http.StatusBadRequest)
+		return
+	}
+
+	f, err := h.Service.ResponseFile(r.Context(), responseID, fileID, userClaims.UserID, userClaims.HasPermission(models.PermTasksRead))
+	if err != nil {
+		if errors.Is(err, ErrResponseFileNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		h.Log.Error("Не удалось получить файл ответа: ", err)
+		http.Error(w, "Не удалось получить файл ответа", http.StatusInternalServerError)
+		return
+	}
+
+	file, err := os.Open(f.FilePath)
+	if err != nil {
+		h.Log.Error("Не удалось открыть файл ответа: ", err)
+		http.Error(w, ErrResponseFileNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	defer file.Close()
+
+	mimeType := mime.TypeByExtension(filepath.Ext(f.FileName))
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": f.FileName}))
+	w.Header().Set("Content-Type", mimeType)
+
+	if _, err := io.Copy(w, file); err != nil {
+		h.Log.Error("Ошибка при отправке файла ответа: ", err)
+	}
+}
@@ -0,0 +1,290 @@
+package tasks
+
+import (
+	"ROOmail/internal/eventbus"
+	"ROOmail/internal/handlers/file"
+	"ROOmail/internal/models"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"golang.org/x/net/context"
+	"mime/multipart"
+)
+
+type ResponseServiceInterface interface {
+	CreateResponse(ctx context.Context, taskID, userID int, text string, files []*multipart.FileHeader) (int, error)
+	GetResponsesByTask(ctx context.Context, taskID int) ([]models.TaskResponse, error)
+	ReviewResponse(ctx context.Context, responseID, reviewerID int, status, comment string) error
+	ResponseFile(ctx context.Context, responseID, fileID, userID int, canReadAll bool) (*models.TaskResponseFile, error)
+}
+
+var (
+	ErrEmptyResponse           = errors.New("Ответ должен содержать текст или файлы")
+	ErrResponseNotFound        = errors.New("Ответ не найден")
+	ErrInvalidReviewStatus     = errors.New("Некорректное решение по ответу")
+	ErrReviewCommentRequired   = errors.New("При возврате на доработку нужен комментарий")
+	ErrResponseAlreadyReviewed = errors.New("Ответ уже проверен")
+	ErrResponseFileNotFound    = errors.New("Файл ответа не найден")
+	ErrResponseSuperseded      = errors.New("Исполнитель уже прислал более новый ответ")
+)
+
+type ResponseService struct {
+	db    *pgxpool.Pool
+	files file.FileInterface
+	bus   *eventbus.Bus
+}
+
+func NewResponseService(db *pgxpool.Pool, files file.FileInterface, bus *eventbus.Bus) *ResponseService {
+	return &ResponseService{db: db, files: files, bus: bus}
+}
+
+// CreateResponse сохраняет ответ исполнителя на задачу вместе с вложениями
+// и отмечает задачу исполнителя как выполненную. Если задача назначена организации,
+// ответ засчитывается всей организации.
+func (s *ResponseService) CreateResponse(ctx context.Context, taskID, userID int, text string, files []*multipart.FileHeader) (responseID int, err error) {
+	if text == "" && len(files) == 0 {
+		return 0, ErrEmptyResponse
+	}
+
+	a, err := findAssignment(ctx, s.db, taskID, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	// Файлы записываются до транзакции, поэтому при любой ошибке до коммита
+	// их нужно удалить, иначе в каталоге загрузок останутся файлы без записей
+	saved := make([]models.TaskResponseFile, 0, len(files))
+	defer func() {
+		if err != nil {
+			if removeErr := s.removeFiles(saved); removeErr != nil {
+				err = errors.Join(err, removeErr)
+			}
+		}
+	}()
+
+	for _, header := range files {
+		f, err := header.Open()
+		if err != nil {
+			return 0, fmt.Errorf("Не удалось открыть файл %s: %w", header.Filename, err)
+		}
+		filePath, err := s.files.SaveFile(f, header.Filename)
+		f.Close()
+		if err != nil {
+			return 0, fmt.Errorf("Не удалось сохранить файл %s: %w", header.Filename, err)
+		}
+		saved = append(saved, models.TaskResponseFile{FilePath: filePath, FileName: header.Filename})
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	err = tx.QueryRow(ctx, `INSERT INTO task_responses (task_id, user_id, text, organization_id) VALUES ($1, $2, $3, $4) RETURNING id`, taskID, userID, text, a.organizationID).Scan(&responseID)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to create response: %w", err)
+	}
+
+	for _, f := range saved {
+		_, err = tx.Exec(ctx, `INSERT INTO task_response_files (response_id, file_path, file_name) VALUES ($1, $2, $3)`, responseID, f.FilePath, f.FileName)
+		if err != nil {
+			return 0, fmt.Errorf("Failed to attach file to response: %w", err)
+		}
+	}
+
+	err = updateAssignment(ctx, tx, taskID, userID, a, `status = 'done',
+		seen_at = COALESCE(seen_at, NOW()),
+		started_at = COALESCE(started_at, NOW()),
+		completed_at = NOW()`)
+	if err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("Failed to commit response: %w", err)
+	}
+
+	return responseID, nil
+}
+
+// removeFiles удаляет файлы ответа, который не удалось сохранить
+func (s *ResponseService) removeFiles(saved []models.TaskResponseFile) error {
+	var errs []error
+	for _, f := range saved {
+		if err := s.files.RemoveFile(f.FilePath); err != nil {
+			errs = append(errs, fmt.Errorf("Не удалось удалить файл %s: %w", f.FilePath, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// GetResponsesByTask возвращает все ответы по задаче с авторами и вложениями
+func (s *ResponseService) GetResponsesByTask(ctx context.Context, taskID int) ([]models.TaskResponse, error) {
+	query := `
+		SELECT r.id, r.task_id, r.user_id, u.username, r.organization_id, r.text, r.created_at,
+		       r.review_status, r.reviewed_by, r.reviewed_at, r.review_comment
+		FROM task_responses r
+		JOIN users u ON u.id = r.user_id
+		WHERE r.task_id = $1
+		ORDER BY r.created_at ASC, r.id ASC
+	`
+	rows, err := s.db.Query(ctx, query, taskID)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to retrieve responses for task %d: %w", taskID, err)
+	}
+	defer rows.Close()
+
+	responses := []models.TaskResponse{}
+	index := make(map[int]int)
+	var responseIDs []int
+	for rows.Next() {
+		var resp models.TaskResponse
+		if err := rows.Scan(&resp.ID, &resp.TaskID, &resp.UserID, &resp.Username, &resp.OrganizationID, &resp.Text, &resp.CreatedAt,
+			&resp.ReviewStatus, &resp.ReviewedBy, &resp.ReviewedAt, &resp.ReviewComment); err != nil {
+			return nil, fmt.Errorf("Failed to scan response: %w", err)
+		}
+		resp.Files = []models.TaskResponseFile{}
+		index[resp.ID] = len(responses)
+		responseIDs = append(responseIDs, resp.ID)
+		responses = append(responses, resp)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("Failed to read responses: %w", err)
+	}
+
+	if len(responseIDs) == 0 {
+		return responses, nil
+	}
+
+	fileRows, err := s.db.Query(ctx, `SELECT id, response_id, file_path, file_name FROM task_response_files WHERE response_id = ANY($1) ORDER BY id`, responseIDs)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to retrieve response files: %w", err)
+	}
+	defer fileRows.Close()
+
+	for fileRows.Next() {
+		var f models.TaskResponseFile
+		var responseID int
+		if err := fileRows.Scan(&f.ID, &responseID, &f.FilePath, &f.FileName); err != nil {
+			return nil, fmt.Errorf("Failed to scan response file: %w", err)
+		}
+		i := index[responseID]
+		responses[i].Files = append(responses[i].Files, f)
+	}
+
+	return responses, fileRows.Err()
+}
+
+// ResponseFile возвращает вложение ответа автору задачи, проверяющему с правом чтения всех задач
+// (canReadAll), автору ответа и сотрудникам организации, от имени которой дан ответ
+func (s *ResponseService) ResponseFile(ctx context.Context, responseID, fileID, userID int, canReadAll bool) (*models.TaskResponseFile, error) {
+	var f models.TaskResponseFile
+	err := s.db.QueryRow(ctx, `
+		SELECT f.id, f.file_path, f.file_name
+		FROM task_response_files f
+		JOIN task_responses r ON r.id = f.response_id
+		JOIN tasks t ON t.id = r.task_id
+		WHERE f.id = $2 AND f.response_id = $1
+		  AND ($4 OR t.created_by = $3 OR r.user_id = $3
+		       OR EXISTS (SELECT 1 FROM organization_tree ot
+		                  JOIN users u ON u.organization_id = ot.organization_id
+		                  WHERE ot.root_id = r.organization_id AND u.id = $3))
+	`, responseID, fileID, userID, canReadAll).Scan(&f.ID, &f.FilePath, &f.FileName)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrResponseFileNotFound
+		}
+		return nil, fmt.Errorf("Failed to retrieve response file: %w", err)
+	}
+	return &f, nil
+}
+
+// ReviewResponse фиксирует решение администратора по ответу. Возврат на доработку
+// снова открывает задачу исполнителя. Проверить можно только последний ответ исполнителя
+// (или его организации), иначе решение по старому ответу перекрыло бы решение по новому.
+func (s *ResponseService) ReviewResponse(ctx context.Context, responseID, reviewerID int, status, comment string) error {
+	if status != models.ReviewStatusAccepted && status != models.ReviewStatusReturned {
+		return ErrInvalidReviewStatus
+	}
+	if status == models.ReviewStatusReturned && comment == "" {
+		return ErrReviewCommentRequired
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("Failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var taskID, userID int
+	var organizationID *int
+	var currentStatus, title string
+	err = tx.QueryRow(ctx, `
+		SELECT r.task_id, r.user_id, r.organization_id, r.review_status, t.title
+		FROM task_responses r
+		JOIN tasks t ON t.id = r.task_id
+		WHERE r.id = $1
+		FOR UPDATE OF r
+	`, responseID).Scan(&taskID, &userID, &organizationID, &currentStatus, &title)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrResponseNotFound
+		}
+		return fmt.Errorf("Failed to retrieve response: %w", err)
+	}
+	if currentStatus != models.ReviewStatusPending {
+		return ErrResponseAlreadyReviewed
+	}
+
+	var superseded bool
+	err = tx.QueryRow(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM task_responses
+			WHERE task_id = $1 AND id > $2
+			  AND organization_id IS NOT DISTINCT FROM $3::int
+			  AND ($3::int IS NOT NULL OR user_id = $4)
+		)
+	`, taskID, responseID, organizationID, userID).Scan(&superseded)
+	if err != nil {
+		return fmt.Errorf("Failed to check newer responses: %w", err)
+	}
+	if superseded {
+		return ErrResponseSuperseded
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE task_responses
+		SET review_status = $2, reviewed_by = $3, reviewed_at = NOW(), review_comment = $4
+		WHERE id = $1
+	`, responseID, status, reviewerID, comment)
+	if err != nil {
+		return fmt.Errorf("Failed to review response: %w", err)
+	}
+
+	if status == models.ReviewStatusReturned {
+		err = updateAssignment(ctx, tx, taskID, userID, &assignment{organizationID: organizationID}, `status = 'in_progress', completed_at = NULL`)
+		if err != nil {
+			return fmt.Errorf("Failed to reopen task for user %d: %w", userID, err)
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("Failed to commit review: %w", err)
+	}
+
+	message := fmt.Sprintf("Ответ по задаче «%s» принят", title)
+	if status == models.ReviewStatusReturned {
+		message = fmt.Sprintf("Ответ по задаче «%s» возвращен на доработку: %s", title, comment)
+	}
+	s.bus.Publish(eventbus.Event{
+		Type:    eventbus.ResponseReviewed,
+		UserIDs: []int{userID},
+		TaskID:  taskID,
+		Title:   title,
+		Message: message,
+	})
+
+	return nil
+}
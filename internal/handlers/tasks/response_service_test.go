@@ -0,0 +1,208 @@
+package tasks_test
+
+import (
+	"ROOmail/internal/handlers/file"
+	"ROOmail/internal/handlers/organizations"
+	"ROOmail/internal/handlers/tasks"
+	"ROOmail/internal/models"
+	"ROOmail/pkg/testdb"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"mime/multipart"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fileHeaders собирает multipart-форму с файлами и возвращает их заголовки
+func fileHeaders(t *testing.T, names ...string) []*multipart.FileHeader {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	for _, name := range names {
+		part, err := w.CreateFormFile("files", name)
+		require.NoError(t, err)
+		_, err = part.Write([]byte("содержимое " + name))
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+
+	form, err := multipart.NewReader(&body, w.Boundary()).ReadForm(1 << 20)
+	require.NoError(t, err)
+	t.Cleanup(func() { form.RemoveAll() })
+	return form.File["files"]
+}
+
+func uploadedFiles(t *testing.T, dir string) []string {
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	return names
+}
+
+// failingFiles сохраняет файлы во временный каталог и возвращает ошибку на заданном по счету файле
+type failingFiles struct {
+	*file.FileService
+	failOn int
+	saved  int
+}
+
+func (f *failingFiles) SaveFile(r io.Reader, filename string) (string, error) {
+	f.saved++
+	if f.saved == f.failOn {
+		return "", errors.New("диск заполнен")
+	}
+	return f.FileService.SaveFile(r, filename)
+}
+
+func TestCreateResponse(t *testing.T) {
+	pool, _, taskID, _, workerID := newTaskFixture(t)
+	dir := t.TempDir()
+	service := tasks.NewResponseService(pool, file.NewFileService(dir, pool), nil)
+
+	id, err := service.CreateResponse(context.Background(), taskID, workerID, "Готово", fileHeaders(t, "report.pdf"))
+	require.NoError(t, err)
+	assert.NotZero(t, id)
+	assert.Len(t, uploadedFiles(t, dir), 1)
+
+	status, completed := assignmentStatus(t, pool, taskID, workerID)
+	assert.Equal(t, models.TaskStatusDone, status)
+	assert.True(t, completed)
+}
+
+func TestCreateResponseRollbackRemovesFiles(t *testing.T) {
+	pool, _, taskID, _, workerID := newTaskFixture(t)
+	dir := t.TempDir()
+	service := tasks.NewResponseService(pool, file.NewFileService(dir, pool), nil)
+
+	// Имя файла длиннее столбца file_name: вставка вложения откатывает транзакцию
+	longName := strings.Repeat("а", 300) + ".txt"
+	_, err := service.CreateResponse(context.Background(), taskID, workerID, "Готово", fileHeaders(t, "report.pdf", longName))
+	require.Error(t, err)
+	assert.Empty(t, uploadedFiles(t, dir))
+
+	status, _ := assignmentStatus(t, pool, taskID, workerID)
+	assert.Equal(t, models.TaskStatusNew, status)
+}
+
+func TestCreateResponseSaveErrorRemovesFiles(t *testing.T) {
+	pool, _, taskID, _, workerID := newTaskFixture(t)
+	dir := t.TempDir()
+	files := &failingFiles{FileService: file.NewFileService(dir, pool), failOn: 2}
+	service := tasks.NewResponseService(pool, files, nil)
+
+	_, err := service.CreateResponse(context.Background(), taskID, workerID, "", fileHeaders(t, "a.txt", "b.txt"))
+	require.Error(t, err)
+	assert.Empty(t, uploadedFiles(t, dir))
+
+	var count int
+	require.NoError(t, pool.QueryRow(context.Background(), `SELECT COUNT(*) FROM task_responses WHERE task_id = $1`, taskID).Scan(&count))
+	assert.Zero(t, count)
+}
+
+func TestReviewResponse(t *testing.T) {
+	pool, _, taskID, authorID, workerID := newTaskFixture(t)
+	service := tasks.NewResponseService(pool, file.NewFileService(t.TempDir(), pool), nil)
+	ctx := context.Background()
+
+	id, err := service.CreateResponse(ctx, taskID, workerID, "Готово", nil)
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, service.ReviewResponse(ctx, id, authorID, "rejected", ""), tasks.ErrInvalidReviewStatus)
+	assert.ErrorIs(t, service.ReviewResponse(ctx, id, authorID, models.ReviewStatusReturned, ""), tasks.ErrReviewCommentRequired)
+	assert.ErrorIs(t, service.ReviewResponse(ctx, id+1, authorID, models.ReviewStatusAccepted, ""), tasks.ErrResponseNotFound)
+
+	// Возврат на доработку снова открывает задачу исполнителя
+	require.NoError(t, service.ReviewResponse(ctx, id, authorID, models.ReviewStatusReturned, "Добавьте таблицу"))
+	status, completed := assignmentStatus(t, pool, taskID, workerID)
+	assert.Equal(t, models.TaskStatusInProgress, status)
+	assert.False(t, completed)
+
+	assert.ErrorIs(t, service.ReviewResponse(ctx, id, authorID, models.ReviewStatusAccepted, ""), tasks.ErrResponseAlreadyReviewed)
+
+	responses, err := service.GetResponsesByTask(ctx, taskID)
+	require.NoError(t, err)
+	require.Len(t, responses, 1)
+	assert.Equal(t, models.ReviewStatusReturned, responses[0].ReviewStatus)
+}
+
+func TestReviewSupersededResponse(t *testing.T) {
+	pool, _, taskID, authorID, workerID := newTaskFixture(t)
+	service := tasks.NewResponseService(pool, file.NewFileService(t.TempDir(), pool), nil)
+	ctx := context.Background()
+
+	first, err := service.CreateResponse(ctx, taskID, workerID, "Черновик", nil)
+	require.NoError(t, err)
+	second, err := service.CreateResponse(ctx, taskID, workerID, "Готово", nil)
+	require.NoError(t, err)
+	require.NoError(t, service.ReviewResponse(ctx, second, authorID, models.ReviewStatusAccepted, ""))
+
+	// Возврат старого ответа не открывает задачу, по которой принят новый ответ
+	err = service.ReviewResponse(ctx, first, authorID, models.ReviewStatusReturned, "Добавьте таблицу")
+	assert.ErrorIs(t, err, tasks.ErrResponseSuperseded)
+	status, completed := assignmentStatus(t, pool, taskID, workerID)
+	assert.Equal(t, models.TaskStatusDone, status)
+	assert.True(t, completed)
+}
+
+func TestResponseFile(t *testing.T) {
+	pool := testdb.New(t)
+	ctx := context.Background()
+	authorID := testdb.CreateUser(t, pool, "author", "users")
+	teacherID := testdb.CreateUser(t, pool, "teacher", "users")
+	colleagueID := testdb.CreateUser(t, pool, "colleague", "users")
+	outsiderID := testdb.CreateUser(t, pool, "outsider", "users")
+
+	orgService := organizations.NewOrganizationService(pool)
+	districtID, err := orgService.Create(ctx, models.OrganizationRequest{Name: "Район"})
+	require.NoError(t, err)
+	schoolID, err := orgService.Create(ctx, models.OrganizationRequest{Name: "Школа", ParentID: &districtID})
+	require.NoError(t, err)
+	require.NoError(t, orgService.AddMembers(ctx, schoolID, []int{teacherID, colleagueID}))
+
+	id, err := tasks.NewTaskService(pool, nil, nil).CreateTask(ctx, "Отчет", "Описание", "2030-01-31", "High", nil, nil, []int{districtID}, "", authorID)
+	require.NoError(t, err)
+	taskID, err := strconv.Atoi(id)
+	require.NoError(t, err)
+
+	files := file.NewFileService(t.TempDir(), pool)
+	service := tasks.NewResponseService(pool, files, nil)
+	responseID, err := service.CreateResponse(ctx, taskID, teacherID, "", fileHeaders(t, "report.pdf"))
+	require.NoError(t, err)
+	responses, err := service.GetResponsesByTask(ctx, taskID)
+	require.NoError(t, err)
+	require.Len(t, responses, 1)
+	require.Len(t, responses[0].Files, 1)
+	fileID := responses[0].Files[0].ID
+
+	// Файл видят автор задачи, автор ответа, его организация и проверяющие с tasks:read
+	for _, userID := range []int{authorID, teacherID, colleagueID} {
+		f, err := service.ResponseFile(ctx, responseID, fileID, userID, false)
+		require.NoError(t, err)
+		assert.Equal(t, "report.pdf", f.FileName)
+
+		data, err := os.ReadFile(f.FilePath)
+		require.NoError(t, err)
+		assert.Equal(t, "содержимое report.pdf", string(data))
+
+		// Файл ответа не отдается общим маршрутом файлов
+		private, err := files.IsPrivate(ctx, f.FilePath)
+		require.NoError(t, err)
+		assert.True(t, private)
+	}
+	_, err = service.ResponseFile(ctx, responseID, fileID, outsiderID, true)
+	require.NoError(t, err)
+
+	_, err = service.ResponseFile(ctx, responseID, fileID, outsiderID, false)
+	assert.ErrorIs(t, err, tasks.ErrResponseFileNotFound)
+	_, err = service.ResponseFile(ctx, responseID+1, fileID, authorID, true)
+	assert.ErrorIs(t, err, tasks.ErrResponseFileNotFound)
+}
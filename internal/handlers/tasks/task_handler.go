@@ -1,14 +1,18 @@
 package tasks
 
 import (
+	"ROOmail/internal/audience"
 	"ROOmail/internal/models"
 	"ROOmail/pkg/logger"
+	"ROOmail/pkg/utils"
 	"ROOmail/pkg/utils/jwt_token"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/gorilla/mux"
 	"net/http"
 	"strconv"
+	"time"
 )
 
 type TaskHandler struct {
@@ -54,9 +58,14 @@ func (h *TaskHandler) CreateTaskHandler(w http.ResponseWriter, r *http.Request)
 	createdBy := userClaims.UserID
 	h.Log.Info("Создание задачи", " создано пользователем: ", createdBy)
 
-	taskID, err := h.Service.CreateTask(r.Context(), req.Title, req.Description, req.DueDate, req.Priority, req.UserIDs, req.FilePath, createdBy)
+	taskID, err := h.Service.CreateTask(r.Context(), req.Title, req.Description, req.DueDate, req.Priority, req.UserIDs, req.GroupIDs, req.OrganizationIDs, req.FilePath, createdBy)
 	if err != nil {
 		h.Log.Error("Не удалось создать задачу", err)
+		if errors.Is(err, audience.ErrUnknownGroup) || errors.Is(err, audience.ErrUnknownUser) || errors.Is(err, ErrUnknownOrganization) ||
+			errors.Is(err, ErrUnknownTaskField) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -103,20 +112,29 @@ func (h *TaskHandler) GetUserTasksHandler(w http.ResponseWriter, r *http.Request
 	}
 }
 
-// GetTasksHandler обрабатывает запрос на получение всех задач, назначенных конкретному пользователю.
-// @Summary Получить все задачи пользователя
-// @Description Получает список задач, назначенных аутентифицированному пользователю.
+// GetTaskHandler возвращает задачу по идентификатору
+// @Summary Получить задачу
+// @Description Возвращает задачу, вложения и исполнителей. Администратор видит всех исполнителей и их статусы, пользователь - только свой прогресс по назначенной ему задаче.
 // @Tags Задачи
-// @Accept  json
-// @Produce  json
-// @Param   Authorization header string true "Bearer токен"
-// @Success 200 {array} models.Task "Список задач, назначенных пользователю"
-// @Failure 400 {object} string "Неверный запрос"
-// @Failure 401 {object} string "Неавторизованный доступ"
-// @Failure 500 {object} string "Внутренняя ошибка сервера"
-// @Router /tasks/get/{id} [get]
-func (h *TaskHandler) GetTasksHandler(w http.ResponseWriter, r *http.Request) {
-	h.Log.Info("Получен запрос на получение задач пользователя")
+// @Produce json
+// @Param id path int true "ID задачи"
+// @Success 200 {object} models.TaskDetails "Карточка задачи"
+// @Failure 400 {string} string "Некорректный идентификатор задачи"
+// @Failure 401 {string} string "Неавторизованный доступ"
+// @Failure 404 {string} string "Задача не найдена"
+// @Failure 500 {string} string "Ошибка сервера"
+// @Router /user/tasks/get/{id} [get]
+// @Router /admin/tasks/get/{id} [get]
+func (h *TaskHandler) GetTaskHandler(w http.ResponseWriter, r *http.Request) {
+	h.Log.Info("Получен запрос на получение задачи")
+
+	vars := mux.Vars(r)
+	taskID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		h.Log.Error("Некорректный идентификатор задачи", err)
+		http.Error(w, "Некорректный идентификатор задачи", http.StatusBadRequest)
+		return
+	}
 
 	userClaims, ok := r.Context().Value("user").(*jwt_token.Claims)
 	if !ok {
@@ -125,21 +143,19 @@ func (h *TaskHandler) GetTasksHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userID := userClaims.UserID
-	h.Log.Info("Получение задач для пользователя", "userID: ", userID)
-
-	tasks, err := h.Service.GetTasks(r.Context(), userID)
+	task, err := h.Service.GetTaskDetails(r.Context(), taskID, userClaims.UserID, userClaims.HasPermission(models.PermTasksRead))
 	if err != nil {
-		h.Log.Error("Не удалось получить задачи", err)
-		http.Error(w, "Не удалось получить задачи", http.StatusInternalServerError)
+		if errors.Is(err, ErrTaskNotFound) {
+			h.Log.Warn("Задача не найдена или не назначена пользователю", " taskID: ", taskID, " userID: ", userClaims.UserID)
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		h.Log.Error("Не удалось получить задачу", err)
+		http.Error(w, "Не удалось получить задачу", http.StatusInternalServerError)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(tasks); err != nil {
-		h.Log.Error("Ошибка кодирования задач в JSON", err)
-		http.Error(w, "Ошибка сервера", http.StatusInternalServerError)
-	}
+	utils.RespondJSON(w, http.StatusOK, task)
 }
 
 // UpdateTaskHandler обновляет информацию о существующей задаче.
@@ -184,9 +200,14 @@ func (h *TaskHandler) UpdateTaskHandler(w http.ResponseWriter, r *http.Request)
 	h.Log.Info("Обновление задачи", " обновляется пользователем: ", userClaims.UserID)
 
 	currentUserID := userClaims.UserID
-	err = h.Service.UpdateTask(r.Context(), taskID, req.Title, req.Description, req.DueDate, req.Priority, req.UserIDs, currentUserID)
+	err = h.Service.UpdateTask(r.Context(), taskID, req.Title, req.Description, req.DueDate, req.Priority, req.UserIDs, req.GroupIDs, req.OrganizationIDs, currentUserID)
 	if err != nil {
 		h.Log.Error("Не удалось обновить задачу", err)
+		if errors.Is(err, audience.ErrUnknownGroup) || errors.Is(err, audience.ErrUnknownUser) || errors.Is(err, ErrUnknownOrganization) ||
+			errors.Is(err, ErrUnknownTaskField) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -199,14 +220,14 @@ func (h *TaskHandler) UpdateTaskHandler(w http.ResponseWriter, r *http.Request)
 
 // PatchTaskHandler обновляет отдельные поля задачи по её идентификатору
 // @Summary Частичное обновление задачи
-// @Description Обновление одного или нескольких полей задачи по её идентификатору
+// @Description Обновление одного или нескольких полей задачи по её идентификатору: title, description, due_date, priority. Поля user_ids и group_ids вместе задают новый состав исполнителей: группы раскрываются в участников на момент назначения. Поле organization_ids задает организации-исполнители.
 // @Tags Задачи
 // @Accept  json
 // @Produce  json
 // @Param id path int true "Идентификатор задачи"
 // @Param updates body object true "Обновляемые поля задачи"
 // @Success 200 {object} map[string]string "Задача успешно обновлена"
-// @Failure 400 {string} string "Некорректный идентификатор задачи или JSON"
+// @Failure 400 {string} string "Некорректный идентификатор задачи, JSON или поле, которое нельзя изменить"
 // @Failure 401 {string} string "Неавторизованный доступ"
 // @Failure 500 {string} string "Ошибка сервера"
 // @Router /admin/tasks/update/{id} [patch]
@@ -241,6 +262,11 @@ func (h *TaskHandler) PatchTaskHandler(w http.ResponseWriter, r *http.Request) {
 	err = h.Service.PatchTask(r.Context(), taskID, updates)
 	if err != nil {
 		h.Log.Error("Не удалось обновить задачу", err)
+		if errors.Is(err, audience.ErrUnknownGroup) || errors.Is(err, audience.ErrUnknownUser) || errors.Is(err, ErrUnknownOrganization) ||
+			errors.Is(err, ErrUnknownTaskField) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -296,3 +322,167 @@ func (h *TaskHandler) DeleteTaskHandler(w http.ResponseWriter, r *http.Request)
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte(`{"message": "Задача успешно удалена"}`))
 }
+
+// UpdateTaskStatusHandler переводит задачу текущего пользователя в новый статус
+// @Summary Обновить статус задачи исполнителя
+// @Description Переводит назначенную пользователю задачу в следующий статус: new → seen → in_progress → done
+// @Tags Задачи
+// @Accept json
+// @Produce json
+// @Param id path int true "ID задачи"
+// @Param status body models.TaskStatusUpdate true "Новый статус"
+// @Success 200 {object} map[string]string "Статус задачи обновлен"
+// @Failure 400 {string} string "Некорректный идентификатор задачи или статус"
+// @Failure 401 {string} string "Неавторизованный доступ"
+// @Failure 404 {string} string "Задача не назначена пользователю"
+// @Failure 409 {string} string "Статус задачи нельзя вернуть назад или он одновременно изменен"
+// @Failure 500 {string} string "Ошибка сервера"
+// @Router /user/tasks/status/{id} [patch]
+func (h *TaskHandler) UpdateTaskStatusHandler(w http.ResponseWriter, r *http.Request) {
+	h.Log.Info("Получен запрос на обновление статуса задачи")
+
+	vars := mux.Vars(r)
+	taskID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		h.Log.Error("Некорректный идентификатор задачи", err)
+		http.Error(w, "Некорректный идентификатор задачи", http.StatusBadRequest)
+		return
+	}
+
+	var req models.TaskStatusUpdate
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.Log.Error("Предоставлен некорректный JSON", err)
+		http.Error(w, "Некорректный JSON", http.StatusBadRequest)
+		return
+	}
+
+	userClaims, ok := r.Context().Value("user").(*jwt_token.Claims)
+	if !ok {
+		h.Log.Error("Попытка неавторизованного доступа")
+		http.Error(w, "Неавторизованный доступ", http.StatusUnauthorized)
+		return
+	}
+
+	err = h.Service.UpdateTaskStatus(r.Context(), taskID, userClaims.UserID, req.Status)
+	if err != nil {
+		h.Log.Error("Не удалось обновить статус задачи", err)
+		switch {
+		case errors.Is(err, ErrInvalidTaskStatus):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, ErrTaskNotAssigned):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, ErrStatusRollback), errors.Is(err, ErrStatusConflict):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			http.Error(w, "Не удалось обновить статус задачи", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	h.Log.Info("Статус задачи обновлен", " taskID: ", taskID, " userID: ", userClaims.UserID, " status: ", req.Status)
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"message": "Статус задачи обновлен"}`))
+}
+
+// ListTasksHandler возвращает список всех задач с фильтрацией, сортировкой и пагинацией
+// @Summary Список задач для администратора
+// @Description Возвращает задачи с фильтрами по автору, исполнителю, приоритету, сроку и выполнению. Для следующей страницы передайте next_cursor в параметре cursor.
+// @Tags Задачи
+// @Produce json
+// @Param created_by query int false "ID автора задачи"
+// @Param assignee_id query int false "ID исполнителя"
+// @Param priority query string false "Приоритет"
+// @Param due_from query string false "Срок выполнения с (YYYY-MM-DD)"
+// @Param due_to query string false "Срок выполнения по (YYYY-MM-DD)"
+// @Param completed query bool false "Выполнена всеми исполнителями"
+// @Param sort query string false "Поле сортировки: due_date, created_at, priority"
+// @Param order query string false "Направление сортировки: asc, desc"
+// @Param limit query int false "Размер страницы (по умолчанию 50, не более 200)"
+// @Param cursor query string false "Курсор следующей страницы"
+// @Success 200 {object} models.TaskPage "Страница задач"
+// @Failure 400 {string} string "Некорректные параметры запроса"
+// @Failure 500 {string} string "Ошибка сервера"
+// @Router /admin/tasks/list [get]
+func (h *TaskHandler) ListTasksHandler(w http.ResponseWriter, r *http.Request) {
+	h.Log.Info("Получен запрос на получение списка задач")
+
+	filter, err := parseTaskFilter(r)
+	if err != nil {
+		h.Log.Error("Некорректные параметры выборки задач", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page, err := h.Service.ListTasks(r.Context(), filter)
+	if err != nil {
+		h.Log.Error("Не удалось получить список задач", err)
+		if errors.Is(err, ErrInvalidTaskFilter) || errors.Is(err, ErrInvalidCursor) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, "Не удалось получить список задач", http.StatusInternalServerError)
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusOK, page)
+}
+
+// parseTaskFilter разбирает параметры запроса списка задач
+func parseTaskFilter(r *http.Request) (models.TaskFilter, error) {
+	q := r.URL.Query()
+	filter := models.TaskFilter{
+		Priority:  q.Get("priority"),
+		DueFrom:   q.Get("due_from"),
+		DueTo:     q.Get("due_to"),
+		SortBy:    q.Get("sort"),
+		SortOrder: q.Get("order"),
+		Cursor:    q.Get("cursor"),
+	}
+
+	parseInt := func(name string) (*int, error) {
+		raw := q.Get(name)
+		if raw == "" {
+			return nil, nil
+		}
+		value, err := strconv.Atoi(raw)
+		if err != nil {
+			return nil, fmt.Errorf("Некорректное значение параметра %s", name)
+		}
+		return &value, nil
+	}
+
+	var err error
+	if filter.CreatedBy, err = parseInt("created_by"); err != nil {
+		return filter, err
+	}
+	if filter.AssigneeID, err = parseInt("assignee_id"); err != nil {
+		return filter, err
+	}
+	limit, err := parseInt("limit")
+	if err != nil {
+		return filter, err
+	}
+	if limit != nil {
+		filter.Limit = *limit
+	}
+
+	for name, value := range map[string]string{"due_from": filter.DueFrom, "due_to": filter.DueTo} {
+		if value == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", value); err != nil {
+			return filter, fmt.Errorf("Некорректное значение параметра %s", name)
+		}
+	}
+
+	if raw := q.Get("completed"); raw != "" {
+		completed, err := strconv.ParseBool(raw)
+		if err != nil {
+			return filter, fmt.Errorf("Некорректное значение параметра completed")
+		}
+		filter.Completed = &completed
+	}
+
+	return filter, nil
+}
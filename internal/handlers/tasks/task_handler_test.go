@@ -1,6 +1,7 @@
 package tasks_test
 
 import (
+	"ROOmail/internal/audience"
 	"ROOmail/pkg/logger"
 	"bytes"
 	"context"
@@ -13,16 +14,25 @@ import (
 	"ROOmail/internal/handlers/tasks"
 	"ROOmail/internal/models"
 	"ROOmail/pkg/utils/jwt_token"
+	"github.com/gorilla/mux"
 	"github.com/stretchr/testify/assert"
 )
 
-type TaskService struct{}
+// TaskService - заглушка сервиса задач. Проверки данных выполняет настоящий сервис
+// (task_service_test.go), заглушка возвращает заданную тестом ошибку.
+type TaskService struct {
+	createErr error
+	statusErr error
+}
 
-func (s *TaskService) CreateTask(ctx context.Context, title, description, dueDateStr, priority string, userIDs []int, filePath string, createdBy int) (string, error) {
+func (s *TaskService) CreateTask(ctx context.Context, title, description, dueDateStr, priority string, userIDs, groupIDs, organizationIDs []int, filePath string, createdBy int) (string, error) {
+	if s.createErr != nil {
+		return "", s.createErr
+	}
 	return "1", nil
 }
 
-func (s *TaskService) UpdateTask(ctx context.Context, taskID int, title, description, dueDateStr, priority string, UserIDs []int, currentUserID int) error {
+func (s *TaskService) UpdateTask(ctx context.Context, taskID int, title, description, dueDateStr, priority string, UserIDs, groupIDs, organizationIDs []int, currentUserID int) error {
 	return nil
 }
 
@@ -46,6 +56,22 @@ func (s *TaskService) DeleteTask(ctx context.Context, taskID int) error {
 	return nil
 }
 
+func (s *TaskService) UpdateTaskStatus(ctx context.Context, taskID, userID int, status string) error {
+	return s.statusErr
+}
+
+func (s *TaskService) ListTasks(ctx context.Context, filter models.TaskFilter) (*models.TaskPage, error) {
+	return &models.TaskPage{Tasks: []models.Task{{ID: 1, Title: "Test Task"}}}, nil
+}
+
+func (s *TaskService) GetTaskDetails(ctx context.Context, taskID, viewerID int, isAdmin bool) (*models.TaskDetails, error) {
+	// Пользователю 2 назначена только задача 1
+	if !isAdmin && (viewerID != 2 || taskID != 1) {
+		return nil, tasks.ErrTaskNotFound
+	}
+	return &models.TaskDetails{Task: models.Task{ID: taskID, Title: "Test Task"}, Attachments: []string{}}, nil
+}
+
 func TestCreateTaskHandler(t *testing.T) {
 
 	logger := logger.NewZapLogger()
@@ -90,3 +116,131 @@ func TestCreateTaskHandler(t *testing.T) {
 	expectedResponse := fmt.Sprintf(`{"message": "Задача успешно создана", "task_id": "1"}`)
 	assert.JSONEq(t, expectedResponse, rr.Body.String())
 }
+
+func TestCreateTaskHandlerGroups(t *testing.T) {
+	cases := []struct {
+		name       string
+		serviceErr error
+		wantCode   int
+	}{
+		{"исполнители найдены", nil, http.StatusCreated},
+		{"неизвестная группа", audience.ErrUnknownGroup, http.StatusBadRequest},
+		{"неизвестный пользователь", audience.ErrUnknownUser, http.StatusBadRequest},
+		{"неизвестная организация", tasks.ErrUnknownOrganization, http.StatusBadRequest},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			handler := &tasks.TaskHandler{
+				Service: &TaskService{createErr: tc.serviceErr},
+				Log:     logger.NewZapLogger(),
+			}
+
+			body, _ := json.Marshal(models.Task{Title: "Test Task", Description: "desc", UserIDs: []int{2}, GroupIDs: []int{1}, OrganizationIDs: []int{1}})
+			req := httptest.NewRequest("POST", "/admin/tasks/create", bytes.NewBuffer(body))
+			req = req.WithContext(context.WithValue(req.Context(), "user", &jwt_token.Claims{UserID: 1}))
+
+			rr := httptest.NewRecorder()
+			handler.CreateTaskHandler(rr, req)
+
+			assert.Equal(t, tc.wantCode, rr.Code)
+		})
+	}
+}
+
+func TestUpdateTaskStatusHandler(t *testing.T) {
+	cases := []struct {
+		name       string
+		taskID     string
+		body       string
+		serviceErr error
+		expected   int
+	}{
+		{"valid status", "1", `{"status": "in_progress"}`, nil, http.StatusOK},
+		{"invalid status", "1", `{"status": "archived"}`, tasks.ErrInvalidTaskStatus, http.StatusBadRequest},
+		{"not assigned", "1", `{"status": "done"}`, tasks.ErrTaskNotAssigned, http.StatusNotFound},
+		{"rollback", "1", `{"status": "seen"}`, tasks.ErrStatusRollback, http.StatusConflict},
+		{"concurrent update", "1", `{"status": "done"}`, tasks.ErrStatusConflict, http.StatusConflict},
+		{"invalid task id", "abc", `{"status": "done"}`, nil, http.StatusBadRequest},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			handler := &tasks.TaskHandler{
+				Service: &TaskService{statusErr: tc.serviceErr},
+				Log:     logger.NewZapLogger(),
+			}
+
+			req := httptest.NewRequest("PATCH", "/user/tasks/status/"+tc.taskID, bytes.NewBufferString(tc.body))
+			req = mux.SetURLVars(req, map[string]string{"id": tc.taskID})
+			req = req.WithContext(context.WithValue(req.Context(), "user", &jwt_token.Claims{UserID: 2}))
+
+			rr := httptest.NewRecorder()
+			handler.UpdateTaskStatusHandler(rr, req)
+
+			assert.Equal(t, tc.expected, rr.Code)
+		})
+	}
+}
+
+func TestListTasksHandler(t *testing.T) {
+	handler := &tasks.TaskHandler{
+		Service: &TaskService{},
+		Log:     logger.NewZapLogger(),
+	}
+
+	cases := []struct {
+		name     string
+		query    string
+		expected int
+	}{
+		{"no filters", "", http.StatusOK},
+		{"all filters", "?created_by=1&assignee_id=2&priority=High&due_from=2024-12-01&due_to=2024-12-31&completed=false&sort=priority&order=desc&limit=10", http.StatusOK},
+		{"invalid assignee", "?assignee_id=abc", http.StatusBadRequest},
+		{"invalid due date", "?due_from=01.12.2024", http.StatusBadRequest},
+		{"invalid completed", "?completed=maybe", http.StatusBadRequest},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/admin/tasks/list"+tc.query, nil)
+			rr := httptest.NewRecorder()
+
+			handler.ListTasksHandler(rr, req)
+
+			assert.Equal(t, tc.expected, rr.Code)
+		})
+	}
+}
+
+func TestGetTaskHandler(t *testing.T) {
+	handler := &tasks.TaskHandler{
+		Service: &TaskService{},
+		Log:     logger.NewZapLogger(),
+	}
+
+	cases := []struct {
+		name     string
+		taskID   string
+		claims   *jwt_token.Claims
+		expected int
+	}{
+		{"assigned user", "1", &jwt_token.Claims{UserID: 2, Role: "users"}, http.StatusOK},
+		{"not assigned user", "5", &jwt_token.Claims{UserID: 2, Role: "users"}, http.StatusNotFound},
+		{"admin", "5", &jwt_token.Claims{UserID: 1, Role: "admin", Permissions: []string{models.PermTasksRead}}, http.StatusOK},
+		{"invalid task id", "abc", &jwt_token.Claims{UserID: 2, Role: "users"}, http.StatusBadRequest},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/tasks/get/"+tc.taskID, nil)
+			req = mux.SetURLVars(req, map[string]string{"id": tc.taskID})
+			req = req.WithContext(context.WithValue(req.Context(), "user", tc.claims))
+
+			rr := httptest.NewRecorder()
+			handler.GetTaskHandler(rr, req)
+
+			assert.Equal(t, tc.expected, rr.Code)
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package tasks
+
+import (
+	"ROOmail/internal/audience"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"golang.org/x/net/context"
+)
+
+var ErrUnknownOrganization = errors.New("Организация не найдена")
+
+// assignment - назначение задачи пользователю: лично (organizationID == nil)
+// или через организацию, сотрудником которой он является
+type assignment struct {
+	organizationID *int
+	status         string
+}
+
+// findAssignment находит назначение задачи пользователю. Личное назначение имеет
+// приоритет перед назначением организации, а из организаций выбирается ближайшая
+// к пользователю: его собственная, затем вышестоящие.
+func findAssignment(ctx context.Context, q audience.Querier, taskID, userID int) (*assignment, error) {
+	var a assignment
+	err := q.QueryRow(ctx, `
+		SELECT a.organization_id, a.status
+		FROM (
+			SELECT 0 AS rank, 0 AS depth, NULL::integer AS organization_id, tu.status
+			FROM tasks_users tu
+			WHERE tu.task_id = $1 AND tu.user_id = $2
+			UNION ALL
+			SELECT 1, ot.depth, tor.organization_id, tor.status
+			FROM tasks_organizations tor
+			JOIN organization_tree ot ON ot.root_id = tor.organization_id
+			JOIN users u ON u.organization_id = ot.organization_id
+			WHERE tor.task_id = $1 AND u.id = $2
+		) a
+		ORDER BY a.rank, a.depth
+		LIMIT 1
+	`, taskID, userID).Scan(&a.organizationID, &a.status)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrTaskNotAssigned
+		}
+		return nil, fmt.Errorf("Failed to retrieve task assignment: %w", err)
+	}
+	return &a, nil
+}
+
+// updateAssignment применяет set к строке назначения: личной или организации.
+// В set параметры нумеруются с $3; $1 - задача, $2 - пользователь или организация.
+func updateAssignment(ctx context.Context, q audience.Querier, taskID, userID int, a *assignment, set string, args ...interface{}) error {
+	_, err := execAssignmentUpdate(ctx, q, taskID, userID, a, set, "", args...)
+	return err
+}
+
+// updateAssignmentStatus применяет set, только если статус назначения не изменился с момента
+// чтения a. Возвращает false, если назначение успели изменить параллельно.
+func updateAssignmentStatus(ctx context.Context, q audience.Querier, taskID, userID int, a *assignment, set string, args ...interface{}) (bool, error) {
+	condition := fmt.Sprintf(` AND status = $%d`, len(args)+3)
+	updated, err := execAssignmentUpdate(ctx, q, taskID, userID, a, set, condition, append(args, a.status)...)
+	return updated > 0, err
+}
+
+func execAssignmentUpdate(ctx context.Context, q audience.Querier, taskID, userID int, a *assignment, set, condition string, args ...interface{}) (int64, error) {
+	query := `UPDATE tasks_users SET ` + set + ` WHERE task_id = $1 AND user_id = $2` + condition
+	params := append([]interface{}{taskID, userID}, args...)
+	if a.organizationID != nil {
+		query = `UPDATE tasks_organizations SET ` + set + ` WHERE task_id = $1 AND organization_id = $2` + condition
+		params[1] = *a.organizationID
+	}
+
+	tag, err := q.Exec(ctx, query, params...)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to update task assignment: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// checkOrganizations проверяет, что все организации существуют
+func checkOrganizations(ctx context.Context, q audience.Querier, organizationIDs []int) error {
+	if len(organizationIDs) == 0 {
+		return nil
+	}
+
+	var found int
+	err := q.QueryRow(ctx, `SELECT COUNT(*) FROM organizations WHERE id = ANY($1)`, organizationIDs).Scan(&found)
+	if err != nil {
+		return fmt.Errorf("Failed to check organizations: %w", err)
+	}
+	if found != len(uniqueInts(organizationIDs)) {
+		return ErrUnknownOrganization
+	}
+	return nil
+}
+
+// assignOrganizations назначает задачу организациям и возвращает организации, получившие ее впервые
+func assignOrganizations(ctx context.Context, q audience.Querier, taskID int, organizationIDs []int, sentBy int) ([]int, error) {
+	if len(organizationIDs) == 0 {
+		return nil, nil
+	}
+
+	rows, err := q.Query(ctx, `
+		INSERT INTO tasks_organizations (task_id, organization_id, sent_by)
+		SELECT $1, unnest($2::integer[]), $3
+		ON CONFLICT DO NOTHING
+		RETURNING organization_id
+	`, taskID, organizationIDs, sentBy)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to assign task to organizations: %w", err)
+	}
+	defer rows.Close()
+
+	var added []int
+	for rows.Next() {
+		var organizationID int
+		if err := rows.Scan(&organizationID); err != nil {
+			return nil, fmt.Errorf("Failed to scan assigned organization: %w", err)
+		}
+		added = append(added, organizationID)
+	}
+	return added, rows.Err()
+}
+
+// replaceOrganizations приводит набор организаций-исполнителей к переданному списку,
+// сохраняя прогресс оставшихся
+func replaceOrganizations(ctx context.Context, q audience.Querier, taskID int, organizationIDs []int, sentBy int) ([]int, error) {
+	if err := checkOrganizations(ctx, q, organizationIDs); err != nil {
+		return nil, err
+	}
+
+	keep := uniqueInts(organizationIDs)
+	if _, err := q.Exec(ctx, `DELETE FROM tasks_organizations WHERE task_id = $1 AND NOT (organization_id = ANY($2))`, taskID, keep); err != nil {
+		return nil, fmt.Errorf("Failed to remove organizations from task: %w", err)
+	}
+
+	return assignOrganizations(ctx, q, taskID, keep, sentBy)
+}
+
+func uniqueInts(ids []int) []int {
+	seen := make(map[int]struct{}, len(ids))
+	result := make([]int, 0, len(ids))
+	for _, id := range ids {
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+		result = append(result, id)
+	}
+	return result
+}
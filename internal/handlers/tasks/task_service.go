@@ -1,35 +1,71 @@
 package tasks
 
 import (
+	"ROOmail/internal/audience"
+	"ROOmail/internal/eventbus"
 	"ROOmail/internal/models"
+	"ROOmail/internal/notify"
 	"ROOmail/pkg/utils/jwt_token"
 	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"golang.org/x/net/context"
 	"strconv"
+	"strings"
 	"time"
 )
 
 type TaskServiceInterface interface {
-	CreateTask(ctx context.Context, title, description, dueDateStr, priority string, userIDs []int, filePath string, createdBy int) (string, error)
-	UpdateTask(ctx context.Context, taskID int, title, description, dueDateStr, priority string, UserIDs []int, currentUserID int) error
+	CreateTask(ctx context.Context, title, description, dueDateStr, priority string, userIDs, groupIDs, organizationIDs []int, filePath string, createdBy int) (string, error)
+	UpdateTask(ctx context.Context, taskID int, title, description, dueDateStr, priority string, UserIDs, groupIDs, organizationIDs []int, currentUserID int) error
 	GetTaskByID(ctx context.Context, taskID int) (*models.Task, error)
 	GetTasks(ctx context.Context, userID int) ([]models.Task, error)
 	GetTasksByUser(ctx context.Context, userID int) ([]models.Task, error)
 	PatchTask(ctx context.Context, taskID int, updates map[string]interface{}) error
 	DeleteTask(ctx context.Context, taskID int) error
+	UpdateTaskStatus(ctx context.Context, taskID, userID int, status string) error
+	ListTasks(ctx context.Context, filter models.TaskFilter) (*models.TaskPage, error)
+	GetTaskDetails(ctx context.Context, taskID, viewerID int, canReadAll bool) (*models.TaskDetails, error)
+}
+
+var (
+	ErrTaskNotFound      = errors.New("Задача не найдена")
+	ErrTaskNotAssigned   = errors.New("Задача не назначена пользователю")
+	ErrInvalidTaskStatus = errors.New("Некорректный статус задачи")
+	ErrStatusRollback    = errors.New("Статус задачи нельзя вернуть назад")
+	ErrInvalidTaskFilter = errors.New("Некорректные параметры выборки задач")
+	ErrInvalidCursor     = errors.New("Некорректный курсор")
+	ErrStatusConflict    = errors.New("Статус задачи одновременно изменен другим запросом, повторите попытку")
+	ErrUnknownTaskField  = errors.New("Поле задачи нельзя изменить")
+)
+
+// statusUpdateAttempts - сколько раз UpdateTaskStatus перечитывает статус, если его меняют параллельно
+const statusUpdateAttempts = 3
+
+// statusOrder задает порядок статусов: исполнитель может двигать статус только вперед
+var statusOrder = map[string]int{
+	models.TaskStatusNew:        0,
+	models.TaskStatusSeen:       1,
+	models.TaskStatusInProgress: 2,
+	models.TaskStatusDone:       3,
 }
 
 type TaskService struct {
-	db *pgxpool.Pool
+	db     *pgxpool.Pool
+	mailer *notify.TaskMailer
+	bus    *eventbus.Bus
 }
 
-func NewTaskService(db *pgxpool.Pool) *TaskService {
-	return &TaskService{db: db}
+// NewTaskService создает сервис задач; mailer может быть nil, если почта не настроена
+func NewTaskService(db *pgxpool.Pool, mailer *notify.TaskMailer, bus *eventbus.Bus) *TaskService {
+	return &TaskService{db: db, mailer: mailer, bus: bus}
 }
 
-func (s *TaskService) CreateTask(ctx context.Context, title, description, dueDateStr, priority string, userIDs []int, filePath string, createdBy int) (string, error) {
+func (s *TaskService) CreateTask(ctx context.Context, title, description, dueDateStr, priority string, userIDs, groupIDs, organizationIDs []int, filePath string, createdBy int) (string, error) {
 	if title == "" || description == "" {
 		return "", fmt.Errorf("Title and description are required")
 	}
@@ -43,26 +79,50 @@ func (s *TaskService) CreateTask(ctx context.Context, title, description, dueDat
 		dueDate = &parsedDueDate
 	}
 
+	// Задача без исполнителей не должна остаться, если назначение не удалось
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return "", fmt.Errorf("Failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	assignees, err := resolveAssignees(ctx, tx, userIDs, groupIDs)
+	if err != nil {
+		return "", err
+	}
+	if err = checkOrganizations(ctx, tx, organizationIDs); err != nil {
+		return "", err
+	}
+
 	var taskID int
 	query := `INSERT INTO tasks (title, description, due_date, priority, file_path, created_by) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`
-	err := s.db.QueryRow(ctx, query, title, description, dueDate, priority, filePath, createdBy).Scan(&taskID)
+	err = tx.QueryRow(ctx, query, title, description, dueDate, priority, filePath, createdBy).Scan(&taskID)
 	if err != nil {
 		return "", fmt.Errorf("Failed to create task: %w", err)
 	}
 
-	for _, userID := range userIDs {
-		_, err = s.db.Exec(ctx, `INSERT INTO tasks_users (task_id, user_id, sent_by) VALUES ($1, $2, $3)`, taskID, userID, createdBy)
-		if err != nil {
-			return "", fmt.Errorf("Failed to assign task to users: %w", err)
-		}
+	added, err := audience.FanOut(ctx, tx, "tasks_users", "task_id", taskID, assignees, createdBy)
+	if err != nil {
+		return "", fmt.Errorf("Failed to assign task to users: %w", err)
 	}
 
+	addedOrganizations, err := assignOrganizations(ctx, tx, taskID, uniqueInts(organizationIDs), createdBy)
+	if err != nil {
+		return "", err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return "", fmt.Errorf("Failed to commit task: %w", err)
+	}
+
+	s.notifyAssignees(ctx, taskID, added, addedOrganizations, false)
+
 	return strconv.Itoa(taskID), nil
 }
 
 func (s *TaskService) GetTaskByID(ctx context.Context, taskID int) (*models.Task, error) {
 	query := `
-		SELECT id, title, description, due_date, priority, file_path, created_by
+		SELECT id, title, description, due_date, COALESCE(priority, ''), COALESCE(file_path, ''), COALESCE(created_by, 0), created_at
 		FROM tasks
 		WHERE id = $1
 	`
@@ -70,10 +130,10 @@ func (s *TaskService) GetTaskByID(ctx context.Context, taskID int) (*models.Task
 	var task models.Task
 	var dueDate sql.NullTime
 
-	err := s.db.QueryRow(ctx, query, taskID).Scan(&task.ID, &task.Title, &task.Description, &dueDate, &task.Priority, &task.FilePath, &task.CreatedBy)
+	err := s.db.QueryRow(ctx, query, taskID).Scan(&task.ID, &task.Title, &task.Description, &dueDate, &task.Priority, &task.FilePath, &task.CreatedBy, &task.CreatedAt)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("Task not found")
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrTaskNotFound
 		}
 		return nil, fmt.Errorf("Failed to retrieve task: %w", err)
 	}
@@ -101,39 +161,186 @@ func (s *TaskService) GetTaskByID(ctx context.Context, taskID int) (*models.Task
 	}
 	task.UserIDs = userIDs
 
+	err = s.db.QueryRow(ctx, `SELECT COALESCE(array_agg(organization_id ORDER BY organization_id), '{}') FROM tasks_organizations WHERE task_id = $1`, task.ID).Scan(&task.OrganizationIDs)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to retrieve organizations for task %d: %w", task.ID, err)
+	}
+
 	return &task, nil
 }
 
-func (s *TaskService) GetTasksByUser(ctx context.Context, userID int) ([]models.Task, error) {
+// GetTaskDetails возвращает карточку задачи. С разрешением на просмотр всех задач видны все исполнители,
+// иначе - только свой прогресс; для неназначенного пользователя задача не существует.
+func (s *TaskService) GetTaskDetails(ctx context.Context, taskID, viewerID int, canReadAll bool) (*models.TaskDetails, error) {
+	task, err := s.GetTaskByID(ctx, taskID)
+	if err != nil {
+		return nil, err
+	}
+
+	details := &models.TaskDetails{Task: *task, Attachments: []string{}}
+	if task.FilePath != "" {
+		details.Attachments = append(details.Attachments, task.FilePath)
+	}
+
+	if !canReadAll {
+		if err := s.fillViewerProgress(ctx, &details.Task, viewerID); err != nil {
+			return nil, err
+		}
+		details.UserIDs = []int{viewerID}
+		details.OrganizationIDs = nil
+		return details, nil
+	}
+
 	query := `
-		SELECT t.id, t.title, t.description, t.due_date, t.priority, t.file_path, t.created_by
-		FROM tasks t
-		JOIN tasks_users tu ON t.id = tu.task_id
-		WHERE tu.user_id = $1
-		ORDER BY t.due_date ASC
+		SELECT tu.user_id, u.username, tu.status, tu.assigned_at, tu.sent_by, tu.group_id, g.name, tu.seen_at, tu.started_at, tu.completed_at
+		FROM tasks_users tu
+		JOIN users u ON u.id = tu.user_id
+		LEFT JOIN user_groups g ON g.id = tu.group_id
+		WHERE tu.task_id = $1
+		ORDER BY u.username
 	`
-
-	rows, err := s.db.Query(ctx, query, userID)
+	rows, err := s.db.Query(ctx, query, taskID)
 	if err != nil {
-		return nil, fmt.Errorf("Не удалось получить задачи для пользователя %d: %w", userID, err)
+		return nil, fmt.Errorf("Failed to retrieve assignees for task %d: %w", taskID, err)
 	}
 	defer rows.Close()
 
-	var tasks []models.Task
+	details.Assignees = []models.TaskAssignee{}
 	for rows.Next() {
-		var task models.Task
-		var dueDate sql.NullTime
+		var a models.TaskAssignee
+		if err := rows.Scan(&a.UserID, &a.Username, &a.Status, &a.AssignedAt, &a.SentBy, &a.GroupID, &a.GroupName, &a.SeenAt, &a.StartedAt, &a.CompletedAt); err != nil {
+			return nil, fmt.Errorf("Failed to scan assignee for task %d: %w", taskID, err)
+		}
+		details.Assignees = append(details.Assignees, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("Failed to read assignees for task %d: %w", taskID, err)
+	}
 
-		if err := rows.Scan(&task.ID, &task.Title, &task.Description, &dueDate, &task.Priority, &task.FilePath, &task.CreatedBy); err != nil {
-			return nil, fmt.Errorf("Не удалось отсканировать данные задачи: %w", err)
+	orgRows, err := s.db.Query(ctx, `
+		SELECT tor.organization_id, o.name, tor.status, tor.assigned_at, tor.sent_by, tor.seen_at, tor.started_at, tor.completed_at
+		FROM tasks_organizations tor
+		JOIN organizations o ON o.id = tor.organization_id
+		WHERE tor.task_id = $1
+		ORDER BY o.name
+	`, taskID)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to retrieve organizations for task %d: %w", taskID, err)
+	}
+	defer orgRows.Close()
+
+	details.Organizations = []models.TaskOrganization{}
+	for orgRows.Next() {
+		var o models.TaskOrganization
+		if err := orgRows.Scan(&o.OrganizationID, &o.Name, &o.Status, &o.AssignedAt, &o.SentBy, &o.SeenAt, &o.StartedAt, &o.CompletedAt); err != nil {
+			return nil, fmt.Errorf("Failed to scan organization for task %d: %w", taskID, err)
 		}
+		details.Organizations = append(details.Organizations, o)
+	}
+	if err := orgRows.Err(); err != nil {
+		return nil, fmt.Errorf("Failed to read organizations for task %d: %w", taskID, err)
+	}
 
-		if dueDate.Valid {
-			task.DueDate = dueDate.Time.Format("2006-01-02")
-		} else {
-			task.DueDate = ""
+	return details, nil
+}
+
+// viewerProgressQuery - прогресс задачи для исполнителя: по личному назначению, а если его нет -
+// по назначению ближайшей из организаций пользователя и вышестоящих над ней. Результат проверки
+// берется из последнего ответа самого исполнителя либо, для организации, любого ее сотрудника.
+const viewerProgressQuery = `
+	SELECT t.id, t.title, t.description, t.due_date, t.priority, t.file_path, t.created_by,
+	       a.organization_id, a.status, a.seen_at, a.started_at, a.completed_at,
+	       lr.id, lr.review_status, lr.review_comment, lr.reviewed_at
+	FROM (
+		SELECT tu.task_id, NULL::integer AS organization_id, tu.status, tu.seen_at, tu.started_at, tu.completed_at
+		FROM tasks_users tu
+		WHERE tu.user_id = $1
+		UNION ALL
+		(SELECT DISTINCT ON (tor.task_id)
+		        tor.task_id, tor.organization_id, tor.status, tor.seen_at, tor.started_at, tor.completed_at
+		FROM tasks_organizations tor
+		JOIN organization_tree ot ON ot.root_id = tor.organization_id
+		JOIN users u ON u.organization_id = ot.organization_id AND u.id = $1
+		WHERE NOT EXISTS (SELECT 1 FROM tasks_users tu WHERE tu.task_id = tor.task_id AND tu.user_id = $1)
+		ORDER BY tor.task_id, ot.depth)
+	) a
+	JOIN tasks t ON t.id = a.task_id
+	LEFT JOIN LATERAL (
+		SELECT r.id, r.review_status, r.review_comment, r.reviewed_at
+		FROM task_responses r
+		WHERE r.task_id = a.task_id
+		  AND ((a.organization_id IS NULL AND r.user_id = $1) OR r.organization_id = a.organization_id)
+		ORDER BY r.created_at DESC, r.id DESC
+		LIMIT 1
+	) lr ON true
+`
+
+// scanViewerTask читает строку viewerProgressQuery
+func scanViewerTask(row pgx.Row) (models.Task, error) {
+	var task models.Task
+	var dueDate sql.NullTime
+	var responseID *int
+	var reviewStatus, reviewComment *string
+	var reviewedAt *time.Time
+
+	if err := row.Scan(&task.ID, &task.Title, &task.Description, &dueDate, &task.Priority, &task.FilePath, &task.CreatedBy,
+		&task.OrganizationID, &task.Status, &task.SeenAt, &task.StartedAt, &task.CompletedAt,
+		&responseID, &reviewStatus, &reviewComment, &reviewedAt); err != nil {
+		return task, err
+	}
+
+	if responseID != nil {
+		task.Review = &models.TaskReview{
+			ResponseID: *responseID,
+			Status:     *reviewStatus,
+			Comment:    *reviewComment,
+			ReviewedAt: reviewedAt,
 		}
+	}
 
+	if dueDate.Valid {
+		task.DueDate = dueDate.Time.Format("2006-01-02")
+	} else {
+		task.DueDate = ""
+	}
+
+	return task, nil
+}
+
+// fillViewerProgress дополняет задачу статусом и результатом проверки для исполнителя
+func (s *TaskService) fillViewerProgress(ctx context.Context, task *models.Task, userID int) error {
+	progress, err := scanViewerTask(s.db.QueryRow(ctx, viewerProgressQuery+` WHERE a.task_id = $2`, userID, task.ID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrTaskNotFound
+		}
+		return fmt.Errorf("Failed to retrieve task progress: %w", err)
+	}
+
+	task.OrganizationID = progress.OrganizationID
+	task.Status = progress.Status
+	task.SeenAt = progress.SeenAt
+	task.StartedAt = progress.StartedAt
+	task.CompletedAt = progress.CompletedAt
+	task.Review = progress.Review
+
+	return nil
+}
+
+// GetTasksByUser возвращает задачи, назначенные пользователю лично или его организации
+func (s *TaskService) GetTasksByUser(ctx context.Context, userID int) ([]models.Task, error) {
+	rows, err := s.db.Query(ctx, viewerProgressQuery+` ORDER BY t.due_date ASC`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("Не удалось получить задачи для пользователя %d: %w", userID, err)
+	}
+	defer rows.Close()
+
+	var tasks []models.Task
+	for rows.Next() {
+		task, err := scanViewerTask(rows)
+		if err != nil {
+			return nil, fmt.Errorf("Не удалось отсканировать данные задачи: %w", err)
+		}
 		tasks = append(tasks, task)
 	}
 
@@ -197,7 +404,7 @@ func (s *TaskService) GetTasks(ctx context.Context, userID int) ([]models.Task,
 	return tasks, nil
 }
 
-func (s *TaskService) UpdateTask(ctx context.Context, taskID int, title, description, dueDateStr, priority string, UserIDs []int, currentUserID int) error {
+func (s *TaskService) UpdateTask(ctx context.Context, taskID int, title, description, dueDateStr, priority string, UserIDs, groupIDs, organizationIDs []int, currentUserID int) error {
 	if title == "" || description == "" {
 		return fmt.Errorf("Title and description are required")
 	}
@@ -215,13 +422,7 @@ func (s *TaskService) UpdateTask(ctx context.Context, taskID int, title, descrip
 	if err != nil {
 		return fmt.Errorf("Failed to begin transaction: %w", err)
 	}
-	defer func() {
-		if err != nil {
-			tx.Rollback(ctx)
-		} else {
-			tx.Commit(ctx)
-		}
-	}()
+	defer tx.Rollback(ctx)
 
 	query := `UPDATE tasks SET title = $1, description = $2, due_date = $3, priority = $4 WHERE id = $5`
 	_, err = tx.Exec(ctx, query, title, description, dueDate, priority, taskID)
@@ -249,11 +450,14 @@ func (s *TaskService) UpdateTask(ctx context.Context, taskID int, title, descrip
 
 	fmt.Printf("Current users found: %v\n", currentUserIDs)
 
-	toRemove := difference(currentUserIDs, UserIDs)
-	toAdd := difference(UserIDs, currentUserIDs)
+	assignees, err := resolveAssignees(ctx, tx, UserIDs, groupIDs)
+	if err != nil {
+		return err
+	}
+
+	toRemove := difference(currentUserIDs, audience.UserIDs(assignees))
 
 	fmt.Printf("Users to remove: %v\n", toRemove)
-	fmt.Printf("Users to add: %v\n", toAdd)
 
 	for _, userID := range toRemove {
 		fmt.Printf("Removing user %d from task %d\n", userID, taskID) // Логируем удаление пользователя
@@ -264,15 +468,23 @@ func (s *TaskService) UpdateTask(ctx context.Context, taskID int, title, descrip
 		}
 	}
 
-	for _, userID := range toAdd {
-		fmt.Printf("Adding new user %d to task %d\n", userID, taskID) // Логируем добавление пользователя
-		_, err = tx.Exec(ctx, `INSERT INTO tasks_users (task_id, user_id, assigned_at, sent_by) VALUES ($1, $2, NOW(), $3)`, taskID, userID, currentUserID)
-		if err != nil {
-			fmt.Printf("Error while adding user %d: %v\n", userID, err)
-			return fmt.Errorf("Failed to assign task to user %d: %w", userID, err)
-		}
+	toAdd, err := audience.FanOut(ctx, tx, "tasks_users", "task_id", taskID, assignees, currentUserID)
+	if err != nil {
+		fmt.Printf("Error while adding users to task %d: %v\n", taskID, err)
+		return err
+	}
+
+	addedOrganizations, err := replaceOrganizations(ctx, tx, taskID, organizationIDs, currentUserID)
+	if err != nil {
+		return err
 	}
 
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("Failed to commit task update: %w", err)
+	}
+
+	s.notifyAssignees(ctx, taskID, toAdd, addedOrganizations, true)
+
 	return nil
 }
 
@@ -290,114 +502,594 @@ func difference(a, b []int) []int {
 	return diff
 }
 
+// patchColumns - поля, которые можно изменить PATCH-запросом, и соответствующие им столбцы.
+// Ключи JSON не попадают в запрос напрямую: иначе через них можно изменить любой столбец
+// или внедрить SQL.
+var patchColumns = map[string]string{
+	"title":       "title",
+	"description": "description",
+	"due_date":    "due_date",
+	"priority":    "priority",
+}
+
 func (s *TaskService) PatchTask(ctx context.Context, taskID int, updates map[string]interface{}) error {
 	query := "UPDATE tasks SET "
 
+	for key := range updates {
+		if _, ok := patchColumns[key]; !ok && key != "user_ids" && key != "group_ids" && key != "organization_ids" {
+			return fmt.Errorf("%w: %s", ErrUnknownTaskField, key)
+		}
+	}
+
 	var params []interface{}
+	var addedUserIDs, addedOrganizations []int
 	paramCounter := 1
 	hasFieldsToUpdate := false
 
-	for key, value := range updates {
-		if key == "user_ids" {
-			var userIDs []int
-			switch v := value.(type) {
-			case []int:
-				userIDs = v
-			case []interface{}:
-				for _, id := range v {
-					userID, ok := id.(float64)
-					if !ok {
-						return fmt.Errorf("Invalid user_ids format")
-					}
-					userIDs = append(userIDs, int(userID))
-				}
-			default:
-				return fmt.Errorf("Invalid user_ids format")
-			}
-
-			rows, err := s.db.Query(ctx, `SELECT user_id, sent_by FROM tasks_users WHERE task_id = $1`, taskID)
-			if err != nil {
-				return fmt.Errorf("Failed to retrieve current users for task: %w", err)
-			}
-			defer rows.Close()
-
-			currentSentBy := make(map[int]int)
-			for rows.Next() {
-				var userID, sentBy int
-				if err := rows.Scan(&userID, &sentBy); err != nil {
-					return fmt.Errorf("Failed to scan user_id and sent_by: %w", err)
-				}
-				currentSentBy[userID] = sentBy
-			}
+	// user_ids и group_ids вместе задают новый состав исполнителей
+	_, hasUserIDs := updates["user_ids"]
+	_, hasGroupIDs := updates["group_ids"]
+	userIDs, err := parseIDs(updates["user_ids"], "user_ids")
+	if err != nil {
+		return err
+	}
+	groupIDs, err := parseIDs(updates["group_ids"], "group_ids")
+	if err != nil {
+		return err
+	}
+	_, hasOrganizationIDs := updates["organization_ids"]
+	organizationIDs, err := parseIDs(updates["organization_ids"], "organization_ids")
+	if err != nil {
+		return err
+	}
 
-			_, err = s.db.Exec(ctx, `DELETE FROM tasks_users WHERE task_id = $1`, taskID)
-			if err != nil {
-				return fmt.Errorf("Failed to remove current users for task: %w", err)
-			}
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("Failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
 
-			for _, userID := range userIDs {
-				sentBy, exists := currentSentBy[userID]
-				if !exists {
-					userClaims, ok := ctx.Value("user").(*jwt_token.Claims)
-					if !ok {
-						return fmt.Errorf("Failed to retrieve user claims from context")
-					}
-					sentBy = userClaims.UserID
-				}
-				_, err = s.db.Exec(ctx, `INSERT INTO tasks_users (task_id, user_id, assigned_at, sent_by) VALUES ($1, $2, NOW(), $3)`, taskID, userID, sentBy)
-				if err != nil {
-					return fmt.Errorf("Failed to assign task to user %d: %w", userID, err)
-				}
-			}
+	for key, value := range updates {
+		if key == "user_ids" || key == "group_ids" || key == "organization_ids" {
 			continue
 		}
 
 		if paramCounter > 1 {
 			query += ", "
 		}
-		query += fmt.Sprintf("%s = $%d", key, paramCounter)
+		query += fmt.Sprintf("%s = $%d", patchColumns[key], paramCounter)
 		params = append(params, value)
 		paramCounter++
 		hasFieldsToUpdate = true
 	}
 
+	if hasUserIDs || hasGroupIDs {
+		assignees, err := resolveAssignees(ctx, tx, userIDs, groupIDs)
+		if err != nil {
+			return err
+		}
+
+		// Удаляем только снятых исполнителей, чтобы сохранить статусы остальных
+		_, err = tx.Exec(ctx, `DELETE FROM tasks_users WHERE task_id = $1 AND NOT (user_id = ANY($2))`, taskID, audience.UserIDs(assignees))
+		if err != nil {
+			return fmt.Errorf("Failed to remove current users for task: %w", err)
+		}
+
+		if len(assignees) > 0 {
+			userClaims, ok := ctx.Value("user").(*jwt_token.Claims)
+			if !ok {
+				return fmt.Errorf("Failed to retrieve user claims from context")
+			}
+			addedUserIDs, err = audience.FanOut(ctx, tx, "tasks_users", "task_id", taskID, assignees, userClaims.UserID)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if hasOrganizationIDs {
+		userClaims, ok := ctx.Value("user").(*jwt_token.Claims)
+		if !ok {
+			return fmt.Errorf("Failed to retrieve user claims from context")
+		}
+		addedOrganizations, err = replaceOrganizations(ctx, tx, taskID, organizationIDs, userClaims.UserID)
+		if err != nil {
+			return err
+		}
+	}
+
 	if hasFieldsToUpdate {
 		query += fmt.Sprintf(" WHERE id = $%d", paramCounter)
 		params = append(params, taskID)
 
-		_, err := s.db.Exec(ctx, query, params...)
+		_, err := tx.Exec(ctx, query, params...)
 		if err != nil {
 			return fmt.Errorf("Failed to patch task: %w", err)
 		}
 	} else {
-		fmt.Println("No fields to update in tasks, only user_ids updated")
+		fmt.Println("No fields to update in tasks, only assignees updated")
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("Failed to commit task patch: %w", err)
 	}
 
+	s.notifyAssignees(ctx, taskID, addedUserIDs, addedOrganizations, hasFieldsToUpdate)
+
 	return nil
 }
 
+// parseIDs разбирает список идентификаторов из JSON-тела PATCH-запроса
+func parseIDs(value interface{}, field string) ([]int, error) {
+	ids := []int{}
+	switch v := value.(type) {
+	case nil:
+	case []int:
+		ids = v
+	case []interface{}:
+		for _, id := range v {
+			number, ok := id.(float64)
+			if !ok {
+				return nil, fmt.Errorf("Invalid %s format", field)
+			}
+			ids = append(ids, int(number))
+		}
+	default:
+		return nil, fmt.Errorf("Invalid %s format", field)
+	}
+	return ids, nil
+}
+
+// resolveAssignees раскрывает группы в исполнителей, запоминая группу-источник.
+// Без групп исполнители - ровно переданные пользователи; неизвестные пользователи отклоняются.
+func resolveAssignees(ctx context.Context, q audience.Querier, userIDs, groupIDs []int) ([]audience.Recipient, error) {
+	if len(groupIDs) == 0 {
+		if err := audience.CheckUsers(ctx, q, userIDs); err != nil {
+			return nil, err
+		}
+		return audience.Direct(userIDs), nil
+	}
+
+	assignees, err := audience.Resolve(ctx, q, models.Audience{UserIDs: userIDs, GroupIDs: groupIDs})
+	if errors.Is(err, audience.ErrNoRecipients) {
+		return nil, nil
+	}
+	return assignees, err
+}
+
+// notifyAssignees сообщает исполнителям задачи о назначении (новым пользователям и
+// сотрудникам новых организаций) и об изменении (остальным, если notifyOthers):
+// публикует события и ставит в очередь письма. Ошибки уведомлений не прерывают операцию.
+func (s *TaskService) notifyAssignees(ctx context.Context, taskID int, added, addedOrganizations []int, notifyOthers bool) {
+	if len(added) == 0 && len(addedOrganizations) == 0 && !notifyOthers {
+		return
+	}
+
+	task := notify.TaskInfo{ID: taskID}
+	if err := s.db.QueryRow(ctx, `SELECT title, due_date FROM tasks WHERE id = $1`, taskID).Scan(&task.Title, &task.DueDate); err != nil {
+		fmt.Printf("Failed to load task %d for notification: %v\n", taskID, err)
+		return
+	}
+
+	// Сотрудник организации может быть назначен и лично - письмо он получает одно
+	rows, err := s.db.Query(ctx, `
+		SELECT u.id, u.username, COALESCE(u.email, ''), bool_or(a.via_new_organization) AND NOT bool_or(a.personal)
+		FROM (
+			SELECT tu.user_id, TRUE AS personal, FALSE AS via_new_organization
+			FROM tasks_users tu
+			WHERE tu.task_id = $1
+			UNION ALL
+			SELECT m.id, FALSE, tor.organization_id = ANY($2)
+			FROM tasks_organizations tor
+			JOIN organization_tree ot ON ot.root_id = tor.organization_id
+			JOIN users m ON m.organization_id = ot.organization_id
+			WHERE tor.task_id = $1
+		) a
+		JOIN users u ON u.id = a.user_id
+		GROUP BY u.id
+	`, taskID, uniqueInts(addedOrganizations))
+	if err != nil {
+		fmt.Printf("Failed to load recipients for task %d: %v\n", taskID, err)
+		return
+	}
+	defer rows.Close()
+
+	isAdded := make(map[int]bool, len(added))
+	for _, userID := range added {
+		isAdded[userID] = true
+	}
+
+	var assignedIDs, updatedIDs []int
+	for rows.Next() {
+		var recipient notify.Recipient
+		var viaNewOrganization bool
+		if err := rows.Scan(&recipient.UserID, &recipient.Username, &recipient.Email, &viaNewOrganization); err != nil {
+			fmt.Printf("Failed to scan recipient for task %d: %v\n", taskID, err)
+			return
+		}
+		if viaNewOrganization {
+			isAdded[recipient.UserID] = true
+		}
+
+		switch {
+		case isAdded[recipient.UserID]:
+			assignedIDs = append(assignedIDs, recipient.UserID)
+			if s.mailer != nil {
+				err = s.mailer.TaskAssigned(ctx, recipient, task)
+			}
+		case notifyOthers:
+			updatedIDs = append(updatedIDs, recipient.UserID)
+			if s.mailer != nil {
+				err = s.mailer.TaskUpdated(ctx, recipient, task)
+			}
+		default:
+			continue
+		}
+		if err != nil {
+			fmt.Printf("Failed to queue email for user %d: %v\n", recipient.UserID, err)
+		}
+	}
+
+	s.bus.Publish(eventbus.Event{
+		Type:    eventbus.TaskAssigned,
+		UserIDs: assignedIDs,
+		TaskID:  taskID,
+		Title:   task.Title,
+		Message: fmt.Sprintf("Вам назначена задача «%s»", task.Title),
+	})
+	s.bus.Publish(eventbus.Event{
+		Type:    eventbus.TaskUpdated,
+		UserIDs: updatedIDs,
+		TaskID:  taskID,
+		Title:   task.Title,
+		Message: fmt.Sprintf("Задача «%s» изменена", task.Title),
+	})
+}
+
+// UpdateTaskStatus переводит задачу исполнителя в следующий статус и проставляет отметки времени.
+// Повторная установка текущего статуса не является ошибкой. Статус меняется, только если он
+// не изменился после чтения; при параллельном изменении проверка повторяется с новым статусом.
+func (s *TaskService) UpdateTaskStatus(ctx context.Context, taskID, userID int, status string) error {
+	newRank, ok := statusOrder[status]
+	if !ok {
+		return ErrInvalidTaskStatus
+	}
+
+	set := `status = $3,
+		seen_at = COALESCE(seen_at, NOW()),
+		started_at = CASE WHEN $3 IN ('in_progress', 'done') THEN COALESCE(started_at, NOW()) ELSE started_at END,
+		completed_at = CASE WHEN $3 = 'done' THEN NOW() ELSE completed_at END`
+
+	for attempt := 0; attempt < statusUpdateAttempts; attempt++ {
+		a, err := findAssignment(ctx, s.db, taskID, userID)
+		if err != nil {
+			return err
+		}
+
+		currentRank := statusOrder[a.status]
+		if newRank == currentRank {
+			return nil
+		}
+		if newRank < currentRank {
+			return ErrStatusRollback
+		}
+
+		updated, err := updateAssignmentStatus(ctx, s.db, taskID, userID, a, set, status)
+		if err != nil || updated {
+			return err
+		}
+	}
+	return ErrStatusConflict
+}
+
 func (s *TaskService) DeleteTask(ctx context.Context, taskID int) error {
 	tx, err := s.db.Begin(ctx)
 	if err != nil {
 		return fmt.Errorf("Failed to begin transaction: %w", err)
 	}
-	defer func() {
-		if err != nil {
-			tx.Rollback(ctx)
-		} else {
-			tx.Commit(ctx)
-		}
-	}()
+	defer tx.Rollback(ctx)
+
+	// Запоминаем исполнителей до удаления, чтобы сообщить им об удалении задачи
+	var title string
+	var assigneeIDs []int
+	err = tx.QueryRow(ctx, `
+		SELECT t.title, COALESCE(array_agg(DISTINCT a.user_id) FILTER (WHERE a.user_id IS NOT NULL), '{}')
+		FROM tasks t
+		LEFT JOIN (
+			SELECT tu.task_id, tu.user_id FROM tasks_users tu
+			UNION ALL
+			SELECT tor.task_id, u.id
+			FROM tasks_organizations tor
+			JOIN organization_tree ot ON ot.root_id = tor.organization_id
+			JOIN users u ON u.organization_id = ot.organization_id
+		) a ON a.task_id = t.id
+		WHERE t.id = $1
+		GROUP BY t.id
+	`, taskID).Scan(&title, &assigneeIDs)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("Failed to retrieve task assignees: %w", err)
+	}
 
 	_, err = tx.Exec(ctx, `DELETE FROM tasks_users WHERE task_id = $1`, taskID)
 	if err != nil {
 		return fmt.Errorf("Failed to delete task-user associations: %w", err)
 	}
 
+	_, err = tx.Exec(ctx, `DELETE FROM tasks_organizations WHERE task_id = $1`, taskID)
+	if err != nil {
+		return fmt.Errorf("Failed to delete task-organization associations: %w", err)
+	}
+
 	_, err = tx.Exec(ctx, `DELETE FROM tasks WHERE id = $1`, taskID)
 	if err != nil {
 		return fmt.Errorf("Failed to delete task: %w", err)
 	}
 
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("Failed to commit task deletion: %w", err)
+	}
+
+	s.bus.Publish(eventbus.Event{
+		Type:    eventbus.TaskDeleted,
+		UserIDs: assigneeIDs,
+		TaskID:  taskID,
+		Title:   title,
+		Message: fmt.Sprintf("Задача «%s» удалена", title),
+	})
+
 	return nil
 }
+
+const (
+	defaultTaskPageSize = 50
+	maxTaskPageSize     = 200
+)
+
+// taskSortKeys - выражения сортировки и тип, к которому приводится значение курсора.
+// Пустые даты уходят в конец при сортировке по возрастанию.
+var taskSortKeys = map[string]struct {
+	expr     string
+	castType string
+}{
+	"due_date":   {expr: `COALESCE(t.due_date, 'infinity'::date)`, castType: "date"},
+	"created_at": {expr: `COALESCE(t.created_at, '-infinity'::timestamp)`, castType: "timestamp"},
+	"priority": {expr: `CASE lower(t.priority)
+		WHEN 'high' THEN 3 WHEN 'высокий' THEN 3
+		WHEN 'medium' THEN 2 WHEN 'средний' THEN 2
+		WHEN 'low' THEN 1 WHEN 'низкий' THEN 1
+		ELSE 0 END`, castType: "integer"},
+}
+
+// taskCursor - позиция последней выданной задачи в выбранной сортировке
+type taskCursor struct {
+	SortBy    string `json:"s"`
+	SortOrder string `json:"o"`
+	Value     string `json:"v"`
+	ID        int    `json:"id"`
+}
+
+func encodeTaskCursor(c taskCursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeTaskCursor(raw string) (taskCursor, error) {
+	var c taskCursor
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+	if err := json.Unmarshal(data, &c); err != nil {
+		return c, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// validCursorValue проверяет, что значение курсора приводится к типу ключа сортировки,
+// иначе приведение в запросе завершится ошибкой базы данных
+func validCursorValue(castType, value string) bool {
+	var err error
+	switch castType {
+	case "date", "timestamp":
+		if value == "infinity" || value == "-infinity" {
+			return true
+		}
+		layout := "2006-01-02"
+		if castType == "timestamp" {
+			layout = "2006-01-02 15:04:05.999999999"
+		}
+		_, err = time.Parse(layout, value)
+	case "integer":
+		_, err = strconv.ParseInt(value, 10, 32)
+	default:
+		return false
+	}
+	return err == nil
+}
+
+// ListTasks возвращает задачи по фильтру с сортировкой и постраничной выдачей по курсору
+func (s *TaskService) ListTasks(ctx context.Context, filter models.TaskFilter) (*models.TaskPage, error) {
+	if filter.SortBy == "" {
+		filter.SortBy = "due_date"
+	}
+	if filter.SortOrder == "" {
+		filter.SortOrder = "asc"
+	}
+	sortKey, ok := taskSortKeys[filter.SortBy]
+	if !ok || (filter.SortOrder != "asc" && filter.SortOrder != "desc") {
+		return nil, ErrInvalidTaskFilter
+	}
+	if filter.Limit <= 0 {
+		filter.Limit = defaultTaskPageSize
+	}
+	if filter.Limit > maxTaskPageSize {
+		filter.Limit = maxTaskPageSize
+	}
+
+	var conditions []string
+	var params []interface{}
+	addParam := func(value interface{}) string {
+		params = append(params, value)
+		return fmt.Sprintf("$%d", len(params))
+	}
+
+	if filter.CreatedBy != nil {
+		conditions = append(conditions, "t.created_by = "+addParam(*filter.CreatedBy))
+	}
+	if filter.AssigneeID != nil {
+		assignee := addParam(*filter.AssigneeID)
+		conditions = append(conditions, "(EXISTS (SELECT 1 FROM tasks_users tu WHERE tu.task_id = t.id AND tu.user_id = "+assignee+")"+
+			" OR EXISTS (SELECT 1 FROM tasks_organizations tor JOIN organization_tree ot ON ot.root_id = tor.organization_id"+
+			" JOIN users u ON u.organization_id = ot.organization_id WHERE tor.task_id = t.id AND u.id = "+assignee+"))")
+	}
+	if filter.Priority != "" {
+		conditions = append(conditions, "t.priority = "+addParam(filter.Priority))
+	}
+	for _, bound := range []struct {
+		value string
+		op    string
+	}{{filter.DueFrom, ">="}, {filter.DueTo, "<="}} {
+		if bound.value == "" {
+			continue
+		}
+		dueDate, err := time.Parse("2006-01-02", bound.value)
+		if err != nil {
+			return nil, ErrInvalidTaskFilter
+		}
+		conditions = append(conditions, "t.due_date "+bound.op+" "+addParam(dueDate))
+	}
+	if filter.Completed != nil {
+		completed := `((EXISTS (SELECT 1 FROM tasks_users tu WHERE tu.task_id = t.id)
+				OR EXISTS (SELECT 1 FROM tasks_organizations tor WHERE tor.task_id = t.id))
+			AND NOT EXISTS (SELECT 1 FROM tasks_users tu WHERE tu.task_id = t.id AND tu.status <> 'done')
+			AND NOT EXISTS (SELECT 1 FROM tasks_organizations tor WHERE tor.task_id = t.id AND tor.status <> 'done'))`
+		if *filter.Completed {
+			conditions = append(conditions, completed)
+		} else {
+			conditions = append(conditions, "NOT "+completed)
+		}
+	}
+
+	comparison := ">"
+	direction := "ASC"
+	if filter.SortOrder == "desc" {
+		comparison = "<"
+		direction = "DESC"
+	}
+
+	if filter.Cursor != "" {
+		cursor, err := decodeTaskCursor(filter.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		if cursor.SortBy != filter.SortBy || cursor.SortOrder != filter.SortOrder || !validCursorValue(sortKey.castType, cursor.Value) {
+			return nil, ErrInvalidCursor
+		}
+		conditions = append(conditions, fmt.Sprintf("(%s, t.id) %s (%s::text::%s, %s)",
+			sortKey.expr, comparison, addParam(cursor.Value), sortKey.castType, addParam(cursor.ID)))
+	}
+
+	query := fmt.Sprintf(`
+		SELECT t.id, t.title, t.description, t.due_date, COALESCE(t.priority, ''), COALESCE(t.file_path, ''), t.created_by, t.created_at,
+		       (%s)::text
+		FROM tasks t`, sortKey.expr)
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += fmt.Sprintf(" ORDER BY %s %s, t.id %s LIMIT %s", sortKey.expr, direction, direction, addParam(filter.Limit+1))
+
+	rows, err := s.db.Query(ctx, query, params...)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list tasks: %w", err)
+	}
+	defer rows.Close()
+
+	page := &models.TaskPage{Tasks: []models.Task{}}
+	var sortValues []string
+	for rows.Next() {
+		var task models.Task
+		var dueDate sql.NullTime
+		var createdBy sql.NullInt32
+		var sortValue string
+
+		if err := rows.Scan(&task.ID, &task.Title, &task.Description, &dueDate, &task.Priority, &task.FilePath, &createdBy, &task.CreatedAt, &sortValue); err != nil {
+			return nil, fmt.Errorf("Failed to scan task: %w", err)
+		}
+		if dueDate.Valid {
+			task.DueDate = dueDate.Time.Format("2006-01-02")
+		}
+		task.CreatedBy = int(createdBy.Int32)
+
+		page.Tasks = append(page.Tasks, task)
+		sortValues = append(sortValues, sortValue)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("Failed to read tasks: %w", err)
+	}
+
+	if len(page.Tasks) > filter.Limit {
+		page.Tasks = page.Tasks[:filter.Limit]
+		last := page.Tasks[filter.Limit-1]
+		page.NextCursor = encodeTaskCursor(taskCursor{
+			SortBy:    filter.SortBy,
+			SortOrder: filter.SortOrder,
+			Value:     sortValues[filter.Limit-1],
+			ID:        last.ID,
+		})
+	}
+
+	if err := s.fillAssignees(ctx, page.Tasks); err != nil {
+		return nil, err
+	}
+
+	return page, nil
+}
+
+// fillAssignees загружает исполнителей и организации для набора задач
+func (s *TaskService) fillAssignees(ctx context.Context, tasks []models.Task) error {
+	if len(tasks) == 0 {
+		return nil
+	}
+
+	taskIDs := make([]int, 0, len(tasks))
+	index := make(map[int]int, len(tasks))
+	for i, task := range tasks {
+		taskIDs = append(taskIDs, task.ID)
+		index[task.ID] = i
+	}
+
+	rows, err := s.db.Query(ctx, `SELECT task_id, user_id FROM tasks_users WHERE task_id = ANY($1) ORDER BY user_id`, taskIDs)
+	if err != nil {
+		return fmt.Errorf("Failed to retrieve task assignees: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var taskID, userID int
+		if err := rows.Scan(&taskID, &userID); err != nil {
+			return fmt.Errorf("Failed to scan task assignee: %w", err)
+		}
+		i := index[taskID]
+		tasks[i].UserIDs = append(tasks[i].UserIDs, userID)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("Failed to read task assignees: %w", err)
+	}
+
+	orgRows, err := s.db.Query(ctx, `SELECT task_id, organization_id FROM tasks_organizations WHERE task_id = ANY($1) ORDER BY organization_id`, taskIDs)
+	if err != nil {
+		return fmt.Errorf("Failed to retrieve task organizations: %w", err)
+	}
+	defer orgRows.Close()
+
+	for orgRows.Next() {
+		var taskID, organizationID int
+		if err := orgRows.Scan(&taskID, &organizationID); err != nil {
+			return fmt.Errorf("Failed to scan task organization: %w", err)
+		}
+		i := index[taskID]
+		tasks[i].OrganizationIDs = append(tasks[i].OrganizationIDs, organizationID)
+	}
+
+	return orgRows.Err()
+}
@@ -0,0 +1,262 @@
+package tasks_test
+
+import (
+	"ROOmail/internal/audience"
+	"ROOmail/internal/handlers/groups"
+	"ROOmail/internal/handlers/organizations"
+	"ROOmail/internal/handlers/tasks"
+	"ROOmail/internal/models"
+	"ROOmail/pkg/testdb"
+	"context"
+	"encoding/base64"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTaskFixture создает базу с автором и исполнителем и задачу, назначенную исполнителю
+func newTaskFixture(t *testing.T) (pool *pgxpool.Pool, service *tasks.TaskService, taskID, authorID, workerID int) {
+	pool = testdb.New(t)
+	authorID = testdb.CreateUser(t, pool, "author", models.RoleAdmin)
+	workerID = testdb.CreateUser(t, pool, "worker", "users")
+	service = tasks.NewTaskService(pool, nil, nil)
+
+	id, err := service.CreateTask(context.Background(), "Отчет", "Подготовить отчет", "2030-01-31", "High", []int{workerID}, nil, nil, "", authorID)
+	require.NoError(t, err)
+	taskID, err = strconv.Atoi(id)
+	require.NoError(t, err)
+	return pool, service, taskID, authorID, workerID
+}
+
+func assignmentStatus(t *testing.T, pool *pgxpool.Pool, taskID, userID int) (status string, completed bool) {
+	err := pool.QueryRow(context.Background(),
+		`SELECT status, completed_at IS NOT NULL FROM tasks_users WHERE task_id = $1 AND user_id = $2`,
+		taskID, userID).Scan(&status, &completed)
+	require.NoError(t, err)
+	return status, completed
+}
+
+func TestUpdateTaskStatus(t *testing.T) {
+	pool, service, taskID, authorID, workerID := newTaskFixture(t)
+	ctx := context.Background()
+
+	assert.ErrorIs(t, service.UpdateTaskStatus(ctx, taskID, workerID, "archived"), tasks.ErrInvalidTaskStatus)
+	assert.ErrorIs(t, service.UpdateTaskStatus(ctx, taskID, authorID, models.TaskStatusSeen), tasks.ErrTaskNotAssigned)
+
+	require.NoError(t, service.UpdateTaskStatus(ctx, taskID, workerID, models.TaskStatusInProgress))
+	// Повторная установка того же статуса не ошибка
+	require.NoError(t, service.UpdateTaskStatus(ctx, taskID, workerID, models.TaskStatusInProgress))
+	assert.ErrorIs(t, service.UpdateTaskStatus(ctx, taskID, workerID, models.TaskStatusSeen), tasks.ErrStatusRollback)
+
+	require.NoError(t, service.UpdateTaskStatus(ctx, taskID, workerID, models.TaskStatusDone))
+	status, completed := assignmentStatus(t, pool, taskID, workerID)
+	assert.Equal(t, models.TaskStatusDone, status)
+	assert.True(t, completed)
+}
+
+func TestUpdateTaskStatusConcurrent(t *testing.T) {
+	pool, service, taskID, _, workerID := newTaskFixture(t)
+
+	// Параллельные запросы не должны вернуть статус назад: «seen», прочитавший статус «new»,
+	// не может перезаписать уже установленный «done»
+	statuses := []string{models.TaskStatusSeen, models.TaskStatusInProgress, models.TaskStatusDone}
+	var wg sync.WaitGroup
+	for i := 0; i < 30; i++ {
+		wg.Add(1)
+		go func(status string) {
+			defer wg.Done()
+			err := service.UpdateTaskStatus(context.Background(), taskID, workerID, status)
+			if err != nil {
+				assert.ErrorIs(t, err, tasks.ErrStatusRollback)
+			}
+		}(statuses[i%len(statuses)])
+	}
+	wg.Wait()
+
+	status, completed := assignmentStatus(t, pool, taskID, workerID)
+	assert.Equal(t, models.TaskStatusDone, status)
+	assert.True(t, completed)
+}
+
+func TestListTasksInvalidCursor(t *testing.T) {
+	// Некорректный курсор отклоняется до обращения к базе данных
+	service := tasks.NewTaskService(nil, nil, nil)
+	cursor := func(raw string) string { return base64.RawURLEncoding.EncodeToString([]byte(raw)) }
+
+	cases := []struct {
+		name   string
+		filter models.TaskFilter
+	}{
+		{"not base64", models.TaskFilter{Cursor: "!!!"}},
+		{"not json", models.TaskFilter{Cursor: cursor("abc")}},
+		{"other sort", models.TaskFilter{Cursor: cursor(`{"s":"priority","o":"asc","v":"1","id":1}`)}},
+		{"bad date", models.TaskFilter{Cursor: cursor(`{"s":"due_date","o":"asc","v":"abc","id":1}`)}},
+		{"bad timestamp", models.TaskFilter{SortBy: "created_at", Cursor: cursor(`{"s":"created_at","o":"asc","v":"2024-13-01 00:00:00","id":1}`)}},
+		{"bad priority", models.TaskFilter{SortBy: "priority", SortOrder: "desc", Cursor: cursor(`{"s":"priority","o":"desc","v":"high","id":1}`)}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := service.ListTasks(context.Background(), tc.filter)
+			assert.ErrorIs(t, err, tasks.ErrInvalidCursor)
+		})
+	}
+}
+
+func TestPatchTaskUnknownField(t *testing.T) {
+	// Поля вне списка разрешенных отклоняются до обращения к базе данных
+	service := tasks.NewTaskService(nil, nil, nil)
+	for _, key := range []string{"created_by", "id", "title = 'x', created_by"} {
+		err := service.PatchTask(context.Background(), 1, map[string]interface{}{"title": "Отчет", key: 1})
+		assert.ErrorIs(t, err, tasks.ErrUnknownTaskField)
+	}
+}
+
+func TestPatchTask(t *testing.T) {
+	pool, service, taskID, _, _ := newTaskFixture(t)
+	ctx := context.Background()
+
+	require.NoError(t, service.PatchTask(ctx, taskID, map[string]interface{}{"title": "Новый отчет", "priority": "Low"}))
+	var title, priority string
+	require.NoError(t, pool.QueryRow(ctx, `SELECT title, priority FROM tasks WHERE id = $1`, taskID).Scan(&title, &priority))
+	assert.Equal(t, "Новый отчет", title)
+	assert.Equal(t, "Low", priority)
+}
+
+func TestListTasksPagination(t *testing.T) {
+	_, service, _, authorID, workerID := newTaskFixture(t)
+	ctx := context.Background()
+	for _, due := range []string{"2030-02-01", ""} {
+		_, err := service.CreateTask(ctx, "Задача", "Описание", due, "Low", []int{workerID}, nil, nil, "", authorID)
+		require.NoError(t, err)
+	}
+
+	// Курсоры, выданные сервисом, принимаются для каждой сортировки
+	for _, sortBy := range []string{"due_date", "created_at", "priority"} {
+		t.Run(sortBy, func(t *testing.T) {
+			filter := models.TaskFilter{SortBy: sortBy, SortOrder: "desc", Limit: 1}
+			seen := map[int]bool{}
+			for {
+				page, err := service.ListTasks(ctx, filter)
+				require.NoError(t, err)
+				for _, task := range page.Tasks {
+					assert.False(t, seen[task.ID], "задача %d выдана дважды", task.ID)
+					seen[task.ID] = true
+				}
+				if page.NextCursor == "" {
+					break
+				}
+				filter.Cursor = page.NextCursor
+			}
+			assert.Len(t, seen, 3)
+		})
+	}
+}
+
+func TestCreateTaskAssignees(t *testing.T) {
+	pool := testdb.New(t)
+	ctx := context.Background()
+	authorID := testdb.CreateUser(t, pool, "author", models.RoleAdmin)
+	school := testdb.CreateUser(t, pool, "school", "users")
+	kindergarten := testdb.CreateUser(t, pool, "kindergarten", "users")
+	service := tasks.NewTaskService(pool, nil, nil)
+
+	groupID, err := groups.NewGroupService(pool).Create(ctx, models.UserGroupRequest{Name: "Сады", UserIDs: []int{kindergarten}}, authorID)
+	require.NoError(t, err)
+
+	// Неизвестные исполнители отклоняются и с группами, и без них; задача не создается
+	cases := []struct {
+		name            string
+		userIDs         []int
+		groupIDs        []int
+		organizationIDs []int
+		err             error
+	}{
+		{"unknown user", []int{school, 1000}, nil, nil, audience.ErrUnknownUser},
+		{"unknown user with group", []int{1000}, []int{groupID}, nil, audience.ErrUnknownUser},
+		{"unknown group", []int{school}, []int{groupID + 1}, nil, audience.ErrUnknownGroup},
+		{"unknown organization", []int{school}, nil, []int{1000}, tasks.ErrUnknownOrganization},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := service.CreateTask(ctx, "Отчет", "Описание", "", "High", tc.userIDs, tc.groupIDs, tc.organizationIDs, "", authorID)
+			assert.ErrorIs(t, err, tc.err)
+		})
+	}
+	var count int
+	require.NoError(t, pool.QueryRow(ctx, `SELECT COUNT(*) FROM tasks`).Scan(&count))
+	assert.Zero(t, count)
+
+	id, err := service.CreateTask(ctx, "Отчет", "Описание", "", "High", []int{school}, []int{groupID}, nil, "", authorID)
+	require.NoError(t, err)
+	taskID, err := strconv.Atoi(id)
+	require.NoError(t, err)
+
+	var viaGroup *int
+	require.NoError(t, pool.QueryRow(ctx, `SELECT group_id FROM tasks_users WHERE task_id = $1 AND user_id = $2`, taskID, kindergarten).Scan(&viaGroup))
+	require.NotNil(t, viaGroup)
+	assert.Equal(t, groupID, *viaGroup)
+	require.NoError(t, pool.QueryRow(ctx, `SELECT group_id FROM tasks_users WHERE task_id = $1 AND user_id = $2`, taskID, school).Scan(&viaGroup))
+	assert.Nil(t, viaGroup)
+}
+
+func TestOrganizationHierarchyTasks(t *testing.T) {
+	pool := testdb.New(t)
+	ctx := context.Background()
+	authorID := testdb.CreateUser(t, pool, "author", models.RoleAdmin)
+	teacherID := testdb.CreateUser(t, pool, "teacher", "users")
+	outsiderID := testdb.CreateUser(t, pool, "outsider", "users")
+
+	orgService := organizations.NewOrganizationService(pool)
+	districtID, err := orgService.Create(ctx, models.OrganizationRequest{Name: "Район"})
+	require.NoError(t, err)
+	schoolID, err := orgService.Create(ctx, models.OrganizationRequest{Name: "Школа", ParentID: &districtID})
+	require.NoError(t, err)
+	require.NoError(t, orgService.AddMembers(ctx, schoolID, []int{teacherID}))
+
+	// Задача району достается сотрудникам его школ
+	service := tasks.NewTaskService(pool, nil, nil)
+	id, err := service.CreateTask(ctx, "Отчет", "Описание", "2030-01-31", "High", nil, nil, []int{districtID}, "", authorID)
+	require.NoError(t, err)
+	taskID, err := strconv.Atoi(id)
+	require.NoError(t, err)
+
+	teacherTasks, err := service.GetTasksByUser(ctx, teacherID)
+	require.NoError(t, err)
+	require.Len(t, teacherTasks, 1)
+	require.NotNil(t, teacherTasks[0].OrganizationID)
+	assert.Equal(t, districtID, *teacherTasks[0].OrganizationID)
+
+	outsiderTasks, err := service.GetTasksByUser(ctx, outsiderID)
+	require.NoError(t, err)
+	assert.Empty(t, outsiderTasks)
+	assert.ErrorIs(t, service.UpdateTaskStatus(ctx, taskID, outsiderID, models.TaskStatusSeen), tasks.ErrTaskNotAssigned)
+
+	page, err := service.ListTasks(ctx, models.TaskFilter{AssigneeID: &teacherID})
+	require.NoError(t, err)
+	require.Len(t, page.Tasks, 1)
+	assert.Equal(t, taskID, page.Tasks[0].ID)
+
+	require.NoError(t, service.UpdateTaskStatus(ctx, taskID, teacherID, models.TaskStatusDone))
+	var status string
+	require.NoError(t, pool.QueryRow(ctx, `SELECT status FROM tasks_organizations WHERE task_id = $1 AND organization_id = $2`, taskID, districtID).Scan(&status))
+	assert.Equal(t, models.TaskStatusDone, status)
+
+	// Если задача назначена и району, и школе, сотрудник школы работает по назначению школы
+	id, err = service.CreateTask(ctx, "Сводка", "Описание", "2030-01-31", "High", nil, nil, []int{districtID, schoolID}, "", authorID)
+	require.NoError(t, err)
+	taskID, err = strconv.Atoi(id)
+	require.NoError(t, err)
+
+	teacherTasks, err = service.GetTasksByUser(ctx, teacherID)
+	require.NoError(t, err)
+	require.Len(t, teacherTasks, 2)
+	require.NoError(t, service.UpdateTaskStatus(ctx, taskID, teacherID, models.TaskStatusInProgress))
+	require.NoError(t, pool.QueryRow(ctx, `SELECT status FROM tasks_organizations WHERE task_id = $1 AND organization_id = $2`, taskID, schoolID).Scan(&status))
+	assert.Equal(t, models.TaskStatusInProgress, status)
+	require.NoError(t, pool.QueryRow(ctx, `SELECT status FROM tasks_organizations WHERE task_id = $1 AND organization_id = $2`, taskID, districtID).Scan(&status))
+	assert.Equal(t, models.TaskStatusNew, status)
+}
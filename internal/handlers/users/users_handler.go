@@ -1,12 +1,15 @@
 package users
 
 import (
+	"ROOmail/internal/handlers/roles"
 	"ROOmail/internal/models"
 	_ "ROOmail/internal/models"
+	"ROOmail/internal/passwords"
 	"ROOmail/pkg/logger"
 	"ROOmail/pkg/utils"
 	"ROOmail/pkg/utils/jwt_token"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/gorilla/mux"
 	"net/http"
@@ -26,17 +29,25 @@ func NewUsersHandler(service *UserService, log logger.Logger) *UserHandler {
 
 // AddUserHandler обрабатывает запрос на добавление нового пользователя в базу данных.
 // @Summary Добавить нового пользователя
-// @Description Добавляет нового пользователя в базу данных с заданными именем, паролем и ролью.
+// @Description Добавляет нового пользователя в базу данных с заданными именем, паролем, ролью, адресом почты и данными профиля (ФИО, должность, телефон, организация). Пароль проверяется по политике паролей; must_change_password требует сменить его при первом входе.
 // @Tags users
 // @Accept json
 // @Produce json
 // @Param user body models.User true "Данные пользователя"
 // @Success 201 {object} map[string]interface{} "Сообщение об успешном добавлении и ID нового пользователя"
 // @Failure 400 {object} string "Некорректные данные"
+// @Failure 403 {object} string "Нет разрешения roles:manage или у роли есть разрешения, которых нет у вас"
+// @Failure 409 {object} string "Имя пользователя уже занято"
 // @Failure 500 {object} string "Внутренняя ошибка сервера"
 // @Router /admin/users/add [post]
 func (h *UserHandler) AddUserHandler(w http.ResponseWriter, r *http.Request) {
 	h.log.Info("Получен запрос на добавление нового пользователя")
+	userClaims, ok := r.Context().Value("user").(*jwt_token.Claims)
+	if !ok {
+		h.log.Error("Не удалось извлечь информацию о пользователе из контекста")
+		http.Error(w, "Ошибка авторизации", http.StatusUnauthorized)
+		return
+	}
 
 	var req models.User
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -51,17 +62,17 @@ func (h *UserHandler) AddUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userID, err := h.service.AddUser(r.Context(), req.Username, req.Password, req.Role)
+	userID, err := h.service.AddUser(r.Context(), req, userClaims)
 	if err != nil {
 		h.log.Error("Не удалось добавить пользователя в базу данных", err)
-		http.Error(w, "Не удалось добавить пользователя", http.StatusInternalServerError)
+		h.writeError(w, err, "Не удалось добавить пользователя")
 		return
 	}
 
 	h.log.Info("Пользователь успешно добавлен ", "userID: ", userID)
 
 	w.WriteHeader(http.StatusCreated)
-	w.Write([]byte(fmt.Sprintf(`{"Пользователь успешно добавлен ", "user_id": %d}`, userID)))
+	w.Write([]byte(fmt.Sprintf(`{"message": "Пользователь успешно добавлен", "user_id": %d}`, userID)))
 }
 
 // DeleteUserHandler обрабатывает запрос на удаление пользователя по его ID.
@@ -71,11 +82,18 @@ func (h *UserHandler) AddUserHandler(w http.ResponseWriter, r *http.Request) {
 // @Param id path int true "ID пользователя"
 // @Success 204 "Пользователь успешно удалён"
 // @Failure 400 {object} string "Некорректный запрос"
+// @Failure 403 {object} string "У роли пользователя есть разрешения, которых нет у вас"
 // @Failure 404 {object} string "Пользователь не найден"
 // @Failure 500 {object} string "Внутренняя ошибка сервера"
 // @Router /admin/users/delete/{id} [delete]
 func (h *UserHandler) DeleteUserHandler(w http.ResponseWriter, r *http.Request) {
 	h.log.Info("Получен запрос на удаление пользователя")
+	userClaims, ok := r.Context().Value("user").(*jwt_token.Claims)
+	if !ok {
+		h.log.Error("Не удалось извлечь информацию о пользователе из контекста")
+		http.Error(w, "Ошибка авторизации", http.StatusUnauthorized)
+		return
+	}
 
 	vars := mux.Vars(r)
 	userIDStr := vars["id"]
@@ -86,10 +104,10 @@ func (h *UserHandler) DeleteUserHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	err = h.service.DeleteUser(r.Context(), userID)
+	err = h.service.DeleteUser(r.Context(), userID, userClaims)
 	if err != nil {
 		h.log.Error("Не удалось удалить пользователя", err)
-		http.Error(w, fmt.Sprintf("Не удалось удалить пользователя с ID %d", userID), http.StatusInternalServerError)
+		h.writeError(w, err, fmt.Sprintf("Не удалось удалить пользователя с ID %d", userID))
 		return
 	}
 
@@ -102,19 +120,27 @@ func (h *UserHandler) DeleteUserHandler(w http.ResponseWriter, r *http.Request)
 
 // UpdateUserHandler обрабатывает запрос на обновление данных пользователя.
 // @Summary Обновить пользователя
-// @Description Обновляет данные пользователя, такие как имя пользователя, пароль и роль.
+// @Description Обновляет переданные поля учетной записи: имя пользователя, пароль, роль, ФИО, должность, почту, телефон, организацию и признак активности. Пустая строка очищает необязательное поле, organization_id = 0 открепляет от организации. Неактивный пользователь не может войти в систему. Новый пароль проверяется по политике паролей; после сброса пароля пользователь должен сменить его, прежде чем работать в системе. Изменить можно только пользователя, все разрешения роли которого есть у вас; роль меняется с разрешением roles:manage и только на роль не сильнее вашей.
 // @Tags users
 // @Accept json
 // @Produce json
 // @Param id path int true "ID пользователя для обновления"
-// @Param user body models.User true "Данные пользователя для обновления"
+// @Param user body models.UserUpdate true "Изменяемые поля"
 // @Success 200 {object} string "Пользователь успешно обновлён"
 // @Failure 400 {object} string "Некорректные данные"
+// @Failure 403 {object} string "Нет разрешения roles:manage для смены роли или у роли пользователя есть разрешения, которых нет у вас"
 // @Failure 404 {object} string "Пользователь не найден"
+// @Failure 409 {object} string "Имя пользователя уже занято"
 // @Failure 500 {object} string "Внутренняя ошибка сервера"
-// @Router /users/{id} [patch]
+// @Router /admin/users/update/{id} [patch]
 func (h *UserHandler) UpdateUserHandler(w http.ResponseWriter, r *http.Request) {
 	h.log.Info("Запрос на обновление данных пользователя")
+	userClaims, ok := r.Context().Value("user").(*jwt_token.Claims)
+	if !ok {
+		h.log.Error("Не удалось извлечь информацию о пользователе из контекста")
+		http.Error(w, "Ошибка авторизации", http.StatusUnauthorized)
+		return
+	}
 
 	vars := mux.Vars(r)
 	userIDStr := vars["id"]
@@ -125,28 +151,17 @@ func (h *UserHandler) UpdateUserHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	var req models.User
+	var req models.UserUpdate
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		h.log.Error("Некорректный JSON при обновлении пользователя", err)
 		http.Error(w, "Некорректные данные", http.StatusBadRequest)
 		return
 	}
 
-	var username, password, role *string
-	if req.Username != "" {
-		username = &req.Username
-	}
-	if req.Password != "" {
-		password = &req.Password
-	}
-	if req.Role != "" {
-		role = &req.Role
-	}
-
-	err = h.service.UpdateUser(r.Context(), userID, username, password, role)
+	err = h.service.UpdateUser(r.Context(), userID, req, userClaims)
 	if err != nil {
 		h.log.Error("Не удалось обновить пользователя", err)
-		http.Error(w, "Не удалось обновить пользователя", http.StatusInternalServerError)
+		h.writeError(w, err, "Не удалось обновить пользователя")
 		return
 	}
 
@@ -159,11 +174,12 @@ func (h *UserHandler) UpdateUserHandler(w http.ResponseWriter, r *http.Request)
 
 // UsersSelectHandler
 // @Summary      Получить список пользователей
-// @Description  Возвращает список пользователей с возможностью фильтрации по имени пользователя.
+// @Description  Возвращает активных пользователей для выбора получателей с поиском по подстроке имени пользователя или ФИО.
 // @Tags         users
 // @Accept       json
 // @Produce      json
-// @Param        username query string false "Фильтр по имени пользователя (поддерживает подстроку)"
+// @Param        q query string false "Поиск по имени пользователя или ФИО"
+// @Param        username query string false "Устаревший синоним q"
 // @Success      200 {array} models.UsersList
 // @Failure      401 {object} map[string]string "Ошибка авторизации"
 // @Failure      500 {object} map[string]string "Ошибка получения пользователей"
@@ -176,10 +192,13 @@ func (h *UserHandler) UsersSelectHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	usernameFilter := r.URL.Query().Get("username")
-	h.log.Info("Запрос списка пользователей. Фильтр по имени пользователя: ", usernameFilter)
+	search := r.URL.Query().Get("q")
+	if search == "" {
+		search = r.URL.Query().Get("username")
+	}
+	h.log.Info("Запрос списка пользователей. Поиск: ", search)
 
-	users, err := h.service.GetUsers(usernameFilter)
+	users, err := h.service.GetUsers(r.Context(), search)
 	if err != nil {
 		h.log.Error("Ошибка получения пользователей: ", err)
 		http.Error(w, "Ошибка получения пользователей", http.StatusInternalServerError)
@@ -189,3 +208,231 @@ func (h *UserHandler) UsersSelectHandler(w http.ResponseWriter, r *http.Request)
 	h.log.Infof("Список пользователей успешно получен пользователем: %s", userClaims.Username)
 	utils.RespondJSON(w, http.StatusOK, users)
 }
+
+// GetUserHandler возвращает карточку пользователя
+// @Summary Карточка пользователя
+// @Tags users
+// @Produce json
+// @Param id path int true "ID пользователя"
+// @Success 200 {object} models.UserProfile "Карточка пользователя"
+// @Failure 400 {object} string "Некорректный идентификатор пользователя"
+// @Failure 404 {object} string "Пользователь не найден"
+// @Failure 500 {object} string "Внутренняя ошибка сервера"
+// @Router /admin/users/get/{id} [get]
+func (h *UserHandler) GetUserHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		h.log.Error("Некорректный идентификатор пользователя", err)
+		http.Error(w, "Некорректный запрос: некорректный идентификатор пользователя", http.StatusBadRequest)
+		return
+	}
+
+	profile, err := h.service.GetProfile(r.Context(), userID)
+	if err != nil {
+		h.log.Error("Не удалось получить пользователя: ", err)
+		h.writeError(w, err, "Не удалось получить пользователя")
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusOK, profile)
+}
+
+// DirectoryHandler ищет пользователей в справочнике
+// @Summary Справочник пользователей
+// @Description Поиск по подстроке в имени пользователя, ФИО, должности, почте и названии организации с фильтрами по роли, организации и активности. Сортировка по ФИО.
+// @Tags users
+// @Produce json
+// @Param q query string false "Строка поиска"
+// @Param role query string false "Роль"
+// @Param organization_id query int false "ID организации"
+// @Param active query bool false "Только активные (true) или только отключенные (false)"
+// @Param limit query int false "Размер страницы (по умолчанию 50, не более 200)"
+// @Param offset query int false "Смещение"
+// @Success 200 {object} models.UserDirectoryPage "Страница справочника"
+// @Failure 400 {object} string "Некорректные параметры запроса"
+// @Failure 500 {object} string "Внутренняя ошибка сервера"
+// @Router /admin/users/directory [get]
+func (h *UserHandler) DirectoryHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter := models.UserDirectoryFilter{
+		Query: q.Get("q"),
+		Role:  q.Get("role"),
+	}
+
+	var err error
+	if raw := q.Get("organization_id"); raw != "" {
+		organizationID, err := strconv.Atoi(raw)
+		if err != nil {
+			http.Error(w, "Некорректное значение параметра organization_id", http.StatusBadRequest)
+			return
+		}
+		filter.OrganizationID = &organizationID
+	}
+	if raw := q.Get("active"); raw != "" {
+		active, err := strconv.ParseBool(raw)
+		if err != nil {
+			http.Error(w, "Некорректное значение параметра active", http.StatusBadRequest)
+			return
+		}
+		filter.Active = &active
+	}
+	if raw := q.Get("limit"); raw != "" {
+		if filter.Limit, err = strconv.Atoi(raw); err != nil {
+			http.Error(w, "Некорректное значение параметра limit", http.StatusBadRequest)
+			return
+		}
+	}
+	if raw := q.Get("offset"); raw != "" {
+		if filter.Offset, err = strconv.Atoi(raw); err != nil {
+			http.Error(w, "Некорректное значение параметра offset", http.StatusBadRequest)
+			return
+		}
+	}
+
+	page, err := h.service.Directory(r.Context(), filter)
+	if err != nil {
+		h.log.Error("Ошибка поиска по справочнику пользователей: ", err)
+		http.Error(w, "Ошибка получения пользователей", http.StatusInternalServerError)
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusOK, page)
+}
+
+// MeHandler возвращает профиль текущего пользователя
+// @Summary Мой профиль
+// @Tags users
+// @Produce json
+// @Success 200 {object} models.UserProfile "Профиль"
+// @Failure 401 {object} string "Неавторизованный доступ"
+// @Failure 404 {object} string "Пользователь не найден"
+// @Failure 500 {object} string "Внутренняя ошибка сервера"
+// @Router /user/me [get]
+func (h *UserHandler) MeHandler(w http.ResponseWriter, r *http.Request) {
+	userClaims, ok := r.Context().Value("user").(*jwt_token.Claims)
+	if !ok {
+		h.log.Error("Попытка неавторизованного доступа")
+		http.Error(w, "Неавторизованный доступ", http.StatusUnauthorized)
+		return
+	}
+
+	profile, err := h.service.GetProfile(r.Context(), userClaims.UserID)
+	if err != nil {
+		h.log.Error("Не удалось получить профиль: ", err)
+		h.writeError(w, err, "Не удалось получить профиль")
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusOK, profile)
+}
+
+// UpdateMeHandler обновляет профиль текущего пользователя
+// @Summary Изменить мой профиль
+// @Description Пользователь может изменить ФИО, должность, почту и телефон. Пустая строка очищает поле.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param profile body models.ProfileUpdate true "Изменяемые поля"
+// @Success 200 {object} models.UserProfile "Обновленный профиль"
+// @Failure 400 {object} string "Некорректные данные"
+// @Failure 401 {object} string "Неавторизованный доступ"
+// @Failure 500 {object} string "Внутренняя ошибка сервера"
+// @Router /user/me [patch]
+func (h *UserHandler) UpdateMeHandler(w http.ResponseWriter, r *http.Request) {
+	userClaims, ok := r.Context().Value("user").(*jwt_token.Claims)
+	if !ok {
+		h.log.Error("Попытка неавторизованного доступа")
+		http.Error(w, "Неавторизованный доступ", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.ProfileUpdate
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.log.Error("Некорректный JSON при обновлении профиля", err)
+		http.Error(w, "Некорректные данные", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.UpdateProfile(r.Context(), userClaims.UserID, req); err != nil {
+		h.log.Error("Не удалось обновить профиль: ", err)
+		h.writeError(w, err, "Не удалось обновить профиль")
+		return
+	}
+
+	profile, err := h.service.GetProfile(r.Context(), userClaims.UserID)
+	if err != nil {
+		h.log.Error("Не удалось получить профиль: ", err)
+		h.writeError(w, err, "Не удалось получить профиль")
+		return
+	}
+
+	h.log.Info("Пользователь обновил профиль ", "userID: ", userClaims.UserID)
+	utils.RespondJSON(w, http.StatusOK, profile)
+}
+
+// ChangePasswordHandler меняет пароль текущего пользователя
+// @Summary Сменить пароль
+// @Description Меняет пароль после проверки текущего и по политике паролей, снимает требование смены пароля. Все остальные сессии пользователя завершаются, refresh-токены отзываются; в ответе возвращается новая пара токенов для текущей сессии.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param request body models.PasswordChangeRequest true "Текущий и новый пароль"
+// @Success 200 {object} map[string]string "Пароль изменен, новый токен"
+// @Failure 400 {object} string "Некорректные данные или неверный текущий пароль"
+// @Failure 401 {object} string "Неавторизованный доступ"
+// @Failure 500 {object} string "Внутренняя ошибка сервера"
+// @Router /user/password [post]
+func (h *UserHandler) ChangePasswordHandler(w http.ResponseWriter, r *http.Request) {
+	userClaims, ok := r.Context().Value("user").(*jwt_token.Claims)
+	if !ok {
+		h.log.Error("Попытка неавторизованного доступа")
+		http.Error(w, "Неавторизованный доступ", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.PasswordChangeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.log.Error("Некорректный JSON при смене пароля", err)
+		http.Error(w, "Некорректные данные", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.ChangePassword(r.Context(), userClaims.UserID, req.CurrentPassword, req.NewPassword); err != nil {
+		h.log.Error("Не удалось сменить пароль: ", err)
+		h.writeError(w, err, "Не удалось сменить пароль")
+		return
+	}
+
+	// Старые токены, включая текущий, больше не принимаются - выдаем новые
+	user := &models.User{ID: userClaims.UserID, Username: userClaims.Username, Role: userClaims.Role}
+	pair, err := h.service.IssueTokens(r.Context(), user, models.SessionMeta{IP: utils.ClientIP(r), UserAgent: r.UserAgent()})
+	if err != nil {
+		h.log.Error("Ошибка генерации токена после смены пароля: ", err)
+		http.Error(w, "Пароль изменен, но не удалось выдать новый токен, войдите заново", http.StatusInternalServerError)
+		return
+	}
+
+	h.log.Info("Пользователь сменил пароль ", "userID: ", userClaims.UserID)
+	utils.RespondJSON(w, http.StatusOK, map[string]string{
+		"message":       "Пароль изменен",
+		"token":         pair.AccessToken,
+		"refresh_token": pair.RefreshToken,
+	})
+}
+
+func (h *UserHandler) writeError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, ErrUserNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, ErrUsernameTaken):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, ErrRoleChangeDenied), errors.Is(err, ErrUserNotAllowed), errors.Is(err, roles.ErrRoleNotAllowed):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, ErrUnknownOrganization), errors.Is(err, ErrUnknownRole), errors.Is(err, ErrNothingToUpdate), errors.Is(err, ErrInvalidUserData),
+		errors.Is(err, ErrEmptyPassword), errors.Is(err, ErrWrongPassword), errors.Is(err, ErrSamePassword),
+		errors.Is(err, ErrExternalPassword), errors.Is(err, passwords.ErrWeakPassword):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, fallback, http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,132 @@
+package users_test
+
+import (
+	"ROOmail/internal/handlers/users"
+	"ROOmail/internal/models"
+	"ROOmail/internal/passwords"
+	"ROOmail/internal/tokens"
+	"ROOmail/pkg/logger"
+	"ROOmail/pkg/testdb"
+	"ROOmail/pkg/utils/jwt_token"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newUserService создает сервис пользователей поверх тестовой базы
+func newUserService(pool *pgxpool.Pool) *users.UserService {
+	return users.NewUsersService(pool, nil, passwords.NewPolicy(8, 3, 0, nil), tokens.NewStore(pool, time.Hour))
+}
+
+// asUser добавляет в запрос данные токена пользователя
+func asUser(req *http.Request, userID int) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), "user", &jwt_token.Claims{UserID: userID}))
+}
+
+func TestProfileHandlers(t *testing.T) {
+	pool := testdb.New(t)
+	userID := testdb.CreateUser(t, pool, "teacher", "users")
+	handler := users.NewUsersHandler(newUserService(pool), logger.NewZapLogger())
+
+	rr := httptest.NewRecorder()
+	handler.MeHandler(rr, httptest.NewRequest(http.MethodGet, "/user/me", nil))
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	body := `{"full_name": " Иванова Анна Петровна ", "position": "Учитель", "phone": "+7 900 000-00-00"}`
+	rr = httptest.NewRecorder()
+	handler.UpdateMeHandler(rr, asUser(httptest.NewRequest(http.MethodPatch, "/user/me", bytes.NewBufferString(body)), userID))
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	var profile models.UserProfile
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &profile))
+	assert.Equal(t, "Иванова Анна Петровна", profile.FullName)
+	assert.Equal(t, "Учитель", profile.Position)
+
+	// Пустая строка очищает поле, остальные поля не меняются
+	rr = httptest.NewRecorder()
+	handler.UpdateMeHandler(rr, asUser(httptest.NewRequest(http.MethodPatch, "/user/me", bytes.NewBufferString(`{"position": ""}`)), userID))
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	rr = httptest.NewRecorder()
+	handler.MeHandler(rr, asUser(httptest.NewRequest(http.MethodGet, "/user/me", nil), userID))
+	require.Equal(t, http.StatusOK, rr.Code)
+	profile = models.UserProfile{}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &profile))
+	assert.Empty(t, profile.Position)
+	assert.Equal(t, "Иванова Анна Петровна", profile.FullName)
+	assert.True(t, profile.IsActive)
+
+	rr = httptest.NewRecorder()
+	handler.UpdateMeHandler(rr, asUser(httptest.NewRequest(http.MethodPatch, "/user/me", bytes.NewBufferString(`{}`)), userID))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	for id, code := range map[string]int{strconv.Itoa(userID): http.StatusOK, strconv.Itoa(userID + 100): http.StatusNotFound, "abc": http.StatusBadRequest} {
+		req := mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/admin/users/get/"+id, nil), map[string]string{"id": id})
+		rr = httptest.NewRecorder()
+		handler.GetUserHandler(rr, req)
+		assert.Equal(t, code, rr.Code, id)
+	}
+}
+
+func TestDirectoryHandler(t *testing.T) {
+	pool := testdb.New(t)
+	ctx := context.Background()
+	service := newUserService(pool)
+	handler := users.NewUsersHandler(service, logger.NewZapLogger())
+
+	anna := testdb.CreateUser(t, pool, "anna", "users")
+	boris := testdb.CreateUser(t, pool, "boris", "users")
+	admin := testdb.Claims(t, pool, testdb.CreateUser(t, pool, "root", models.RoleAdmin))
+	fullName := "Иванова Анна"
+	require.NoError(t, service.UpdateProfile(ctx, anna, models.ProfileUpdate{FullName: &fullName}))
+	inactive := false
+	require.NoError(t, service.UpdateUser(ctx, boris, models.UserUpdate{IsActive: &inactive}, admin))
+
+	cases := []struct {
+		query string
+		code  int
+		total int
+	}{
+		{"", http.StatusOK, 3},
+		{"q=иванова", http.StatusOK, 1},
+		// Спецсимволы LIKE ищутся буквально
+		{"q=%25", http.StatusOK, 0},
+		{"role=" + models.RoleAdmin, http.StatusOK, 1},
+		{"active=false", http.StatusOK, 1},
+		{"limit=1", http.StatusOK, 3},
+		{"active=maybe", http.StatusBadRequest, 0},
+		{"organization_id=x", http.StatusBadRequest, 0},
+	}
+	for _, tc := range cases {
+		t.Run(tc.query, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			handler.DirectoryHandler(rr, httptest.NewRequest(http.MethodGet, "/admin/users/directory?"+tc.query, nil))
+			require.Equal(t, tc.code, rr.Code, rr.Body.String())
+			if tc.code != http.StatusOK {
+				return
+			}
+			var page models.UserDirectoryPage
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &page))
+			assert.Equal(t, tc.total, page.Total)
+			assert.LessOrEqual(t, len(page.Users), tc.total)
+		})
+	}
+
+	rr := httptest.NewRecorder()
+	handler.DirectoryHandler(rr, httptest.NewRequest(http.MethodGet, "/admin/users/directory?q=Анна", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+	var page models.UserDirectoryPage
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &page))
+	require.Len(t, page.Users, 1)
+	assert.Equal(t, anna, page.Users[0].ID)
+}
@@ -0,0 +1,112 @@
+package users
+
+import (
+	"ROOmail/internal/audience"
+	"ROOmail/internal/models"
+	"ROOmail/pkg/utils"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"golang.org/x/net/context"
+	"strings"
+)
+
+// profileQuery - карточка пользователя вместе с названием организации
+const profileQuery = `
+	SELECT u.id, u.username, u.role, COALESCE(u.full_name, ''), COALESCE(u.position, ''),
+	       COALESCE(u.email, ''), COALESCE(u.phone, ''), u.organization_id, COALESCE(o.name, ''), u.is_active, u.must_change_password,
+	       lf.locked_until
+	FROM users u
+	LEFT JOIN organizations o ON o.id = u.organization_id
+	LEFT JOIN login_failures lf ON lf.kind = 'username' AND lf.key = u.username AND lf.locked_until > NOW()
+`
+
+func scanProfile(row pgx.Row) (models.UserProfile, error) {
+	var p models.UserProfile
+	err := row.Scan(&p.ID, &p.Username, &p.Role, &p.FullName, &p.Position,
+		&p.Email, &p.Phone, &p.OrganizationID, &p.OrganizationName, &p.IsActive, &p.MustChangePassword, &p.LockedUntil)
+	return p, err
+}
+
+// userUpdate собирает SET-часть запроса обновления пользователя
+type userUpdate struct {
+	sets   []string
+	params []interface{}
+}
+
+// set добавляет присваивание; expr содержит %d на месте номера параметра
+func (u *userUpdate) set(column, expr string, value interface{}) {
+	u.params = append(u.params, value)
+	u.sets = append(u.sets, column+" = "+fmt.Sprintf(expr, len(u.params)))
+}
+
+// setPassword хеширует новый пароль и отмечает время смены:
+// токены, выданные раньше, перестают приниматься
+func (u *userUpdate) setPassword(password string) error {
+	hashedPassword, err := utils.HashPassword(password)
+	if err != nil {
+		return fmt.Errorf("Не удалось хешировать пароль: %w", err)
+	}
+	u.set("password_hash", "$%d", hashedPassword)
+	u.sets = append(u.sets, "password_changed_at = NOW()")
+	return nil
+}
+
+// setProfile добавляет поля профиля; пустая строка очищает поле
+func (u *userUpdate) setProfile(upd models.ProfileUpdate) {
+	for _, field := range []struct {
+		column string
+		value  *string
+	}{
+		{"full_name", upd.FullName},
+		{"position", upd.Position},
+		{"email", upd.Email},
+		{"phone", upd.Phone},
+	} {
+		if field.value != nil {
+			u.set(field.column, "NULLIF($%d, '')", strings.TrimSpace(*field.value))
+		}
+	}
+}
+
+// applyUpdate выполняет обновление в q: в пуле или в транзакции вызывающего
+func applyUpdate(ctx context.Context, q audience.Querier, userID int, u *userUpdate) error {
+	if len(u.sets) == 0 {
+		return ErrNothingToUpdate
+	}
+
+	params := append(u.params, userID)
+	query := fmt.Sprintf(`UPDATE users SET %s WHERE id = $%d`, strings.Join(u.sets, ", "), len(params))
+	tag, err := q.Exec(ctx, query, params...)
+	if err != nil {
+		return translateError(fmt.Errorf("Не удалось обновить пользователя с ID %d: %w", userID, err))
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// translateError превращает нарушения ограничений таблицы users в понятные ошибки
+func translateError(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case "23505":
+			return ErrUsernameTaken
+		case "23503":
+			if pgErr.ConstraintName == "users_role_fkey" {
+				return ErrUnknownRole
+			}
+			return ErrUnknownOrganization
+		}
+	}
+	return err
+}
+
+// likePattern экранирует спецсимволы LIKE и ищет подстроку
+func likePattern(search string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return "%" + replacer.Replace(strings.TrimSpace(search)) + "%"
+}
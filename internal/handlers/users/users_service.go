@@ -1,106 +1,408 @@
 package users
 
 import (
+	"ROOmail/internal/audience"
+	"ROOmail/internal/eventbus"
+	"ROOmail/internal/handlers/roles"
 	"ROOmail/internal/models"
+	"ROOmail/internal/passwords"
+	"ROOmail/internal/tokens"
 	"ROOmail/pkg/utils"
+	"ROOmail/pkg/utils/jwt_token"
+	"errors"
 	"fmt"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"golang.org/x/net/context"
+	"strings"
+)
+
+var (
+	ErrUserNotFound        = errors.New("Пользователь не найден")
+	ErrUsernameTaken       = errors.New("Имя пользователя уже занято")
+	ErrUnknownOrganization = errors.New("Организация не найдена")
+	ErrUnknownRole         = errors.New("Роль не найдена")
+	ErrNothingToUpdate     = errors.New("Нет данных для обновления")
+	ErrInvalidUserData     = errors.New("Имя пользователя, пароль и роль не могут быть пустыми")
+	ErrEmptyPassword       = errors.New("Новый пароль не может быть пустым")
+	ErrWrongPassword       = errors.New("Неверный текущий пароль")
+	ErrSamePassword        = errors.New("Новый пароль совпадает с текущим")
+	ErrExternalPassword    = errors.New("Пароль учетной записи из каталога меняется в каталоге")
+	ErrRoleChangeDenied    = errors.New("Назначать роли можно только с разрешением roles:manage")
+	ErrUserNotAllowed      = errors.New("Нельзя изменить пользователя, у роли которого есть разрешения, которых нет у вас")
+)
+
+const (
+	defaultDirectoryPageSize = 50
+	maxDirectoryPageSize     = 200
 )
 
 type UserService struct {
-	db *pgxpool.Pool
+	db     *pgxpool.Pool
+	bus    *eventbus.Bus
+	policy *passwords.Policy
+	tokens *tokens.Store
 }
 
-func NewUsersService(db *pgxpool.Pool) *UserService {
-	return &UserService{db: db}
+func NewUsersService(db *pgxpool.Pool, bus *eventbus.Bus, policy *passwords.Policy, store *tokens.Store) *UserService {
+	return &UserService{db: db, bus: bus, policy: policy, tokens: store}
 }
 
-func (s *UserService) AddUser(ctx context.Context, username, password, role string) (int, error) {
+// AddUser создает учетную запись. Роль назначает actor: для этого нужно разрешение
+// roles:manage, а все разрешения роли должны быть и у него самого.
+func (s *UserService) AddUser(ctx context.Context, user models.User, actor *jwt_token.Claims) (int, error) {
+	if err := s.policy.Validate(user.Password, user.Username); err != nil {
+		return 0, err
+	}
+	if err := checkRole(ctx, s.db, actor, user.Role); err != nil {
+		return 0, err
+	}
+
 	// Хешируем пароль перед сохранением в базу
-	passwordHash, err := utils.HashPassword(password)
+	passwordHash, err := utils.HashPassword(user.Password)
 	if err != nil {
 		return 0, fmt.Errorf("Failed to hash password: %w", err)
 	}
 
 	// SQL-запрос для добавления пользователя
-	query := `INSERT INTO users (username, password_hash, role) VALUES ($1, $2, $3) RETURNING id`
+	query := `
+		INSERT INTO users (username, password_hash, role, email, full_name, position, phone, organization_id,
+		                   must_change_password, password_changed_at)
+		VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, ''), NULLIF($6, ''), NULLIF($7, ''), $8, $9, NOW())
+		RETURNING id
+	`
 	var userID int
-	err = s.db.QueryRow(ctx, query, username, passwordHash, role).Scan(&userID)
+	err = s.db.QueryRow(ctx, query, user.Username, passwordHash, user.Role, user.Email,
+		user.FullName, user.Position, user.Phone, user.OrganizationID, user.MustChangePassword).Scan(&userID)
 	if err != nil {
-		return 0, fmt.Errorf("Failed to add user to the database: %w", err)
+		return 0, translateError(fmt.Errorf("Failed to add user to the database: %w", err))
 	}
 
 	return userID, nil
 }
 
-func (s *UserService) DeleteUser(ctx context.Context, userID int) error {
-	query := `DELETE FROM users WHERE id = $1`
-	_, err := s.db.Exec(ctx, query, userID)
+// DeleteUser удаляет учетную запись, которой actor может управлять
+func (s *UserService) DeleteUser(ctx context.Context, userID int, actor *jwt_token.Claims) error {
+	tx, err := s.db.Begin(ctx)
 	if err != nil {
+		return fmt.Errorf("Failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := lockManaged(ctx, tx, actor, userID); err != nil {
+		return err
+	}
+
+	query := `DELETE FROM users WHERE id = $1`
+	if _, err = tx.Exec(ctx, query, userID); err != nil {
+		return fmt.Errorf("Не удалось удалить пользователя с id %d: %w", userID, err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
 		return fmt.Errorf("Не удалось удалить пользователя с id %d: %w", userID, err)
 	}
 	return nil
 }
 
-func (s *UserService) UpdateUser(ctx context.Context, userID int, username, password, role *string) error {
-	query := `UPDATE users SET `
-	params := []interface{}{}
-	paramIndex := 1
-
-	if username != nil {
-		query += fmt.Sprintf("username = $%d, ", paramIndex)
-		params = append(params, *username)
-		paramIndex++
+// UpdateUser применяет изменения администратора (actor) к учетной записи. Управлять можно
+// только пользователем, все разрешения роли которого есть у actor; сменить роль можно
+// с разрешением roles:manage и только на роль не сильнее собственной.
+func (s *UserService) UpdateUser(ctx context.Context, userID int, upd models.UserUpdate, actor *jwt_token.Claims) error {
+	var u userUpdate
+	for _, field := range []*string{upd.Username, upd.Password, upd.Role} {
+		if field != nil && *field == "" {
+			return ErrInvalidUserData
+		}
+	}
+	if upd.Role != nil && !actor.HasPermission(models.PermRolesManage) {
+		return ErrRoleChangeDenied
 	}
 
-	if password != nil {
-		hashedPassword, err := utils.HashPassword(*password)
+	if upd.Username != nil {
+		u.set("username", "$%d", *upd.Username)
+	}
+	if upd.Password != nil {
+		username, err := s.usernameFor(ctx, userID, upd.Username)
 		if err != nil {
-			return fmt.Errorf("Не удалось хешировать пароль: %w", err)
+			return err
+		}
+		if err := s.policy.Validate(*upd.Password, username); err != nil {
+			return err
 		}
-		query += fmt.Sprintf("password_hash = $%d, ", paramIndex)
-		params = append(params, hashedPassword)
-		paramIndex++
+		if err := u.setPassword(*upd.Password); err != nil {
+			return err
+		}
+	}
+	if upd.Role != nil {
+		u.set("role", "$%d", *upd.Role)
+	}
+	u.setProfile(models.ProfileUpdate{FullName: upd.FullName, Position: upd.Position, Email: upd.Email, Phone: upd.Phone})
+	if upd.OrganizationID != nil {
+		u.set("organization_id", "NULLIF($%d, 0)", *upd.OrganizationID)
+	}
+	if upd.IsActive != nil {
+		u.set("is_active", "$%d", *upd.IsActive)
+	}
+	if upd.Password != nil {
+		// Пароль, назначенный администратором, знает не только пользователь: при входе его нужно сменить
+		u.set("must_change_password", "$%d", true)
+	} else if upd.MustChangePassword != nil {
+		u.set("must_change_password", "$%d", *upd.MustChangePassword)
 	}
 
-	if role != nil {
-		query += fmt.Sprintf("role = $%d, ", paramIndex)
-		params = append(params, *role)
-		paramIndex++
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("Failed to begin transaction: %w", err)
 	}
+	defer tx.Rollback(ctx)
 
-	query = query[:len(query)-2]
-	query += fmt.Sprintf(" WHERE id = $%d", paramIndex)
-	params = append(params, userID)
+	if err := lockManaged(ctx, tx, actor, userID); err != nil {
+		return err
+	}
+	if upd.Role != nil {
+		if err := checkRole(ctx, tx, actor, *upd.Role); err != nil {
+			return err
+		}
+	}
 
-	_, err := s.db.Exec(ctx, query, params...)
-	if err != nil {
+	if err := applyUpdate(ctx, tx, userID, &u); err != nil {
+		return err
+	}
+
+	// После сброса пароля или отключения учетной записи сессии нельзя продлить.
+	// Сессии завершаются в той же транзакции: новый пароль не вступает в силу без отзыва сессий.
+	if upd.Password != nil || (upd.IsActive != nil && !*upd.IsActive) {
+		if err := s.tokens.RevokeUserTx(ctx, tx, userID, ""); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
 		return fmt.Errorf("Не удалось обновить пользователя с ID %d: %w", userID, err)
 	}
 
+	s.bus.Publish(eventbus.Event{
+		Type:    eventbus.UserUpdated,
+		UserIDs: []int{userID},
+		Message: "Данные вашей учетной записи изменены администратором",
+	})
+
 	return nil
 }
 
-func (s *UserService) GetUsers(username string) ([]models.UsersList, error) {
-	query := "SELECT id, username FROM users"
+// checkRole проверяет, что actor может назначить пользователю роль
+func checkRole(ctx context.Context, q audience.Querier, actor *jwt_token.Claims, role string) error {
+	if !actor.HasPermission(models.PermRolesManage) {
+		return ErrRoleChangeDenied
+	}
+	err := roles.Grantable(ctx, q, actor, role)
+	if errors.Is(err, roles.ErrRoleNotFound) {
+		return ErrUnknownRole
+	}
+	return err
+}
+
+// lockManaged блокирует учетную запись до конца транзакции и проверяет, что actor может ею
+// управлять. Иначе пользователь с users:manage мог бы сбросить пароль администратора или
+// отключить его.
+func lockManaged(ctx context.Context, tx pgx.Tx, actor *jwt_token.Claims, userID int) error {
+	var role string
+	err := tx.QueryRow(ctx, `SELECT role FROM users WHERE id = $1 FOR UPDATE`, userID).Scan(&role)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrUserNotFound
+		}
+		return fmt.Errorf("Не удалось получить пользователя с ID %d: %w", userID, err)
+	}
+	if err = roles.Grantable(ctx, tx, actor, role); errors.Is(err, roles.ErrRoleNotAllowed) {
+		return fmt.Errorf("%w (роль %s)", ErrUserNotAllowed, role)
+	}
+	return err
+}
+
+// UpdateProfile меняет поля профиля, доступные самому пользователю
+func (s *UserService) UpdateProfile(ctx context.Context, userID int, upd models.ProfileUpdate) error {
+	var u userUpdate
+	u.setProfile(upd)
+	return applyUpdate(ctx, s.db, userID, &u)
+}
+
+// ChangePassword меняет пароль пользователя после проверки текущего и снимает требование смены пароля.
+// Все ранее выданные токены пользователя перестают действовать.
+func (s *UserService) ChangePassword(ctx context.Context, userID int, currentPassword, newPassword string) error {
+	if newPassword == "" {
+		return ErrEmptyPassword
+	}
+
+	var username, passwordHash, authSource string
+	err := s.db.QueryRow(ctx, `SELECT username, password_hash, auth_source FROM users WHERE id = $1`, userID).Scan(&username, &passwordHash, &authSource)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrUserNotFound
+		}
+		return fmt.Errorf("Не удалось получить пользователя с ID %d: %w", userID, err)
+	}
+	if authSource != models.AuthSourceLocal {
+		return ErrExternalPassword
+	}
+
+	if !utils.CheckPassword(currentPassword, passwordHash) {
+		return ErrWrongPassword
+	}
+	if currentPassword == newPassword {
+		return ErrSamePassword
+	}
+	if err := s.policy.Validate(newPassword, username); err != nil {
+		return err
+	}
+
+	var u userUpdate
+	if err := u.setPassword(newPassword); err != nil {
+		return err
+	}
+	u.set("must_change_password", "$%d", false)
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("Failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := applyUpdate(ctx, tx, userID, &u); err != nil {
+		return err
+	}
+	if err := s.tokens.RevokeUserTx(ctx, tx, userID, ""); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("Не удалось сменить пароль пользователя с ID %d: %w", userID, err)
+	}
+	return nil
+}
+
+// IssueTokens открывает новую сессию, например взамен завершенных при смене пароля
+func (s *UserService) IssueTokens(ctx context.Context, user *models.User, meta models.SessionMeta) (*tokens.Pair, error) {
+	return s.tokens.Issue(ctx, user, meta)
+}
+
+// usernameFor возвращает имя пользователя с учетом переименования в том же запросе
+func (s *UserService) usernameFor(ctx context.Context, userID int, newUsername *string) (string, error) {
+	if newUsername != nil {
+		return *newUsername, nil
+	}
+
+	var username string
+	err := s.db.QueryRow(ctx, `SELECT username FROM users WHERE id = $1`, userID).Scan(&username)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", ErrUserNotFound
+		}
+		return "", fmt.Errorf("Не удалось получить пользователя с ID %d: %w", userID, err)
+	}
+	return username, nil
+}
+
+// GetProfile возвращает карточку пользователя
+func (s *UserService) GetProfile(ctx context.Context, userID int) (*models.UserProfile, error) {
+	p, err := scanProfile(s.db.QueryRow(ctx, profileQuery+` WHERE u.id = $1`, userID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("Не удалось получить пользователя с ID %d: %w", userID, err)
+	}
+	return &p, nil
+}
+
+// Directory ищет пользователей по имени, ФИО, должности, почте и организации
+func (s *UserService) Directory(ctx context.Context, filter models.UserDirectoryFilter) (*models.UserDirectoryPage, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = defaultDirectoryPageSize
+	}
+	if filter.Limit > maxDirectoryPageSize {
+		filter.Limit = maxDirectoryPageSize
+	}
+	if filter.Offset < 0 {
+		filter.Offset = 0
+	}
+
+	var conditions []string
+	var params []interface{}
+	addParam := func(value interface{}) string {
+		params = append(params, value)
+		return fmt.Sprintf("$%d", len(params))
+	}
+
+	if filter.Query != "" {
+		pattern := addParam(likePattern(filter.Query))
+		conditions = append(conditions, "(u.username ILIKE "+pattern+" OR u.full_name ILIKE "+pattern+
+			" OR u.position ILIKE "+pattern+" OR u.email ILIKE "+pattern+" OR o.name ILIKE "+pattern+")")
+	}
+	if filter.Role != "" {
+		conditions = append(conditions, "u.role = "+addParam(filter.Role))
+	}
+	if filter.OrganizationID != nil {
+		conditions = append(conditions, "u.organization_id = "+addParam(*filter.OrganizationID))
+	}
+	if filter.Active != nil {
+		conditions = append(conditions, "u.is_active = "+addParam(*filter.Active))
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	page := &models.UserDirectoryPage{Users: []models.UserProfile{}}
+	err := s.db.QueryRow(ctx, `SELECT COUNT(*) FROM users u LEFT JOIN organizations o ON o.id = u.organization_id`+where, params...).Scan(&page.Total)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка подсчета пользователей: %w", err)
+	}
+
+	query := profileQuery + where + fmt.Sprintf(` ORDER BY COALESCE(NULLIF(u.full_name, ''), u.username), u.id LIMIT %s OFFSET %s`,
+		addParam(filter.Limit), addParam(filter.Offset))
+	rows, err := s.db.Query(ctx, query, params...)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка выполнения запроса: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		p, err := scanProfile(rows)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка сканирования строки: %w", err)
+		}
+		page.Users = append(page.Users, p)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка чтения строк: %w", err)
+	}
+
+	return page, nil
+}
+
+// GetUsers возвращает активных пользователей для выбора получателей.
+// Поиск идет по подстроке имени пользователя или ФИО без учета регистра.
+func (s *UserService) GetUsers(ctx context.Context, search string) ([]models.UsersList, error) {
+	query := "SELECT id, username, COALESCE(full_name, '') FROM users WHERE is_active"
 	var args []interface{}
 
-	if username != "" {
-		query += " WHERE username LIKE ?"
-		args = append(args, "%"+username+"%")
+	if search != "" {
+		query += " AND (username ILIKE $1 OR full_name ILIKE $1)"
+		args = append(args, likePattern(search))
 	}
+	query += " ORDER BY COALESCE(NULLIF(full_name, ''), username), id"
 
-	rows, err := s.db.Query(context.Background(), query, args...)
+	rows, err := s.db.Query(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("ошибка выполнения запроса: %w", err)
 	}
 	defer rows.Close()
 
-	var users []models.UsersList
+	users := []models.UsersList{}
 	for rows.Next() {
 		var user models.UsersList
-		if err := rows.Scan(&user.ID, &user.Username); err != nil {
+		if err := rows.Scan(&user.ID, &user.Username, &user.FullName); err != nil {
 			return nil, fmt.Errorf("ошибка сканирования строки: %w", err)
 		}
 		users = append(users, user)
@@ -0,0 +1,224 @@
+package users_test
+
+import (
+	"ROOmail/internal/handlers/roles"
+	"ROOmail/internal/handlers/users"
+	"ROOmail/internal/models"
+	"ROOmail/internal/passwords"
+	"ROOmail/internal/tokens"
+	"ROOmail/pkg/testdb"
+	"ROOmail/pkg/utils/jwt_token"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func init() {
+	keys, err := jwt_token.NewSecretKeySet("users-test-secret")
+	if err != nil {
+		panic(err)
+	}
+	jwt_token.SetKeySet(keys)
+}
+
+func TestChangePassword(t *testing.T) {
+	pool := testdb.New(t)
+	ctx := context.Background()
+	service := newUserService(pool)
+	store := tokens.NewStore(pool, time.Hour)
+	userID := testdb.CreateUser(t, pool, "teacher", "users")
+	user := &models.User{ID: userID, Username: "teacher", Role: "users"}
+
+	old, err := store.Issue(ctx, user, models.SessionMeta{})
+	require.NoError(t, err)
+
+	cases := []struct {
+		name            string
+		current, newPwd string
+		err             error
+	}{
+		{"empty", testdb.Password, "", users.ErrEmptyPassword},
+		{"wrong current", "wrong", "Other-passw0rd", users.ErrWrongPassword},
+		{"same", testdb.Password, testdb.Password, users.ErrSamePassword},
+		{"weak", testdb.Password, "short", passwords.ErrWeakPassword},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.ErrorIs(t, service.ChangePassword(ctx, userID, tc.current, tc.newPwd), tc.err)
+		})
+	}
+
+	// Неудачные попытки не трогают сессии
+	old, err = store.Rotate(ctx, old.RefreshToken)
+	require.NoError(t, err)
+
+	require.NoError(t, service.ChangePassword(ctx, userID, testdb.Password, "Other-passw0rd"))
+	assert.ErrorIs(t, service.ChangePassword(ctx, userID, testdb.Password, "Third-passw0rd"), users.ErrWrongPassword)
+
+	var mustChange bool
+	require.NoError(t, pool.QueryRow(ctx, `SELECT must_change_password FROM users WHERE id = $1`, userID).Scan(&mustChange))
+	assert.False(t, mustChange)
+
+	// Сессия, открытая до смены пароля, больше не продлевается, новая - продлевается
+	_, err = store.Rotate(ctx, old.RefreshToken)
+	assert.ErrorIs(t, err, tokens.ErrInvalidRefreshToken)
+
+	fresh, err := service.IssueTokens(ctx, user, models.SessionMeta{})
+	require.NoError(t, err)
+	_, err = store.Rotate(ctx, fresh.RefreshToken)
+	assert.NoError(t, err)
+}
+
+func TestChangePasswordSupersedesConcurrentSession(t *testing.T) {
+	pool := testdb.New(t)
+	ctx := context.Background()
+	service := newUserService(pool)
+	store := tokens.NewStore(pool, time.Hour)
+	userID := testdb.CreateUser(t, pool, "teacher", "users")
+
+	pair, err := store.Issue(ctx, &models.User{ID: userID, Username: "teacher", Role: "users"}, models.SessionMeta{})
+	require.NoError(t, err)
+	require.NoError(t, service.ChangePassword(ctx, userID, testdb.Password, "Other-passw0rd"))
+
+	// Сессия, открытая в ту же секунду до смены пароля и не попавшая под отзыв
+	// (вход, завершившийся параллельно со сменой), все равно не продлевается
+	_, err = pool.Exec(ctx, `UPDATE sessions SET revoked_at = NULL, created_at = date_trunc('second', created_at) WHERE user_id = $1`, userID)
+	require.NoError(t, err)
+	_, err = pool.Exec(ctx, `UPDATE refresh_tokens SET revoked_at = NULL WHERE user_id = $1`, userID)
+	require.NoError(t, err)
+	_, err = pool.Exec(ctx, `UPDATE users SET password_changed_at = (SELECT created_at FROM sessions WHERE user_id = $1) + interval '1 millisecond' WHERE id = $1`, userID)
+	require.NoError(t, err)
+
+	_, err = store.Rotate(ctx, pair.RefreshToken)
+	assert.ErrorIs(t, err, tokens.ErrInvalidRefreshToken)
+}
+
+func TestUpdateUserPasswordReset(t *testing.T) {
+	pool := testdb.New(t)
+	ctx := context.Background()
+	service := newUserService(pool)
+	admin := testdb.Claims(t, pool, testdb.CreateUser(t, pool, "root", models.RoleAdmin))
+	userID := testdb.CreateUser(t, pool, "teacher", "users")
+
+	mustChange := func() bool {
+		var value bool
+		require.NoError(t, pool.QueryRow(ctx, `SELECT must_change_password FROM users WHERE id = $1`, userID).Scan(&value))
+		return value
+	}
+
+	// Пароль, назначенный администратором, нужно сменить, даже если явно передано обратное
+	password, keep := "Admin-passw0rd", false
+	require.NoError(t, service.UpdateUser(ctx, userID, models.UserUpdate{Password: &password, MustChangePassword: &keep}, admin))
+	assert.True(t, mustChange())
+
+	require.NoError(t, service.ChangePassword(ctx, userID, password, "Own-passw0rd"))
+	assert.False(t, mustChange())
+
+	require.NoError(t, service.UpdateUser(ctx, userID, models.UserUpdate{MustChangePassword: &keep}, admin))
+	assert.False(t, mustChange())
+}
+
+func TestUpdateUserRevokesSessions(t *testing.T) {
+	pool := testdb.New(t)
+	ctx := context.Background()
+	service := newUserService(pool)
+	store := tokens.NewStore(pool, time.Hour)
+	admin := testdb.Claims(t, pool, testdb.CreateUser(t, pool, "root", models.RoleAdmin))
+	userID := testdb.CreateUser(t, pool, "teacher", "users")
+	user := &models.User{ID: userID, Username: "teacher", Role: "users"}
+
+	activeSessions := func() int {
+		var count int
+		require.NoError(t, pool.QueryRow(ctx, `SELECT COUNT(*) FROM sessions WHERE user_id = $1 AND revoked_at IS NULL`, userID).Scan(&count))
+		return count
+	}
+
+	_, err := store.Issue(ctx, user, models.SessionMeta{})
+	require.NoError(t, err)
+
+	// Изменение профиля сессии не завершает
+	position := "Учитель"
+	require.NoError(t, service.UpdateUser(ctx, userID, models.UserUpdate{Position: &position}, admin))
+	assert.Equal(t, 1, activeSessions())
+
+	password := "Admin-passw0rd"
+	require.NoError(t, service.UpdateUser(ctx, userID, models.UserUpdate{Password: &password}, admin))
+	assert.Zero(t, activeSessions())
+
+	// Неудачное обновление не завершает сессии
+	pair, err := store.Issue(ctx, user, models.SessionMeta{})
+	require.NoError(t, err)
+	unknownRole := "unknown"
+	assert.ErrorIs(t, service.UpdateUser(ctx, userID, models.UserUpdate{Password: &password, Role: &unknownRole}, admin), users.ErrUnknownRole)
+	assert.Equal(t, 1, activeSessions())
+
+	inactive := false
+	require.NoError(t, service.UpdateUser(ctx, userID, models.UserUpdate{IsActive: &inactive}, admin))
+	_, err = store.Rotate(ctx, pair.RefreshToken)
+	assert.ErrorIs(t, err, tokens.ErrInvalidRefreshToken)
+}
+
+func TestManageUsersWithinOwnPermissions(t *testing.T) {
+	pool := testdb.New(t)
+	ctx := context.Background()
+	service := newUserService(pool)
+	roleService := roles.NewRoleService(pool)
+	rootID := testdb.CreateUser(t, pool, "root", models.RoleAdmin)
+	admin := testdb.Claims(t, pool, rootID)
+
+	require.NoError(t, roleService.Create(ctx, models.RoleRequest{
+		Name:        "manager",
+		Permissions: []string{models.PermUsersManage, models.PermTasksExecute},
+	}, admin))
+	require.NoError(t, roleService.Create(ctx, models.RoleRequest{
+		Name:        "personnel",
+		Permissions: []string{models.PermUsersManage, models.PermRolesManage, models.PermTasksExecute},
+	}, admin))
+	managerID := testdb.CreateUser(t, pool, "manager", "manager")
+	manager := testdb.Claims(t, pool, managerID)
+	personnelID := testdb.CreateUser(t, pool, "personnel", "personnel")
+	personnel := testdb.Claims(t, pool, personnelID)
+	teacherID := testdb.CreateUser(t, pool, "teacher", "users")
+
+	role := func(userID int) string {
+		var value string
+		require.NoError(t, pool.QueryRow(ctx, `SELECT role FROM users WHERE id = $1`, userID).Scan(&value))
+		return value
+	}
+
+	// Без roles:manage роль не назначить ни другому, ни себе
+	adminRole, usersRole := models.RoleAdmin, "users"
+	assert.ErrorIs(t, service.UpdateUser(ctx, managerID, models.UserUpdate{Role: &adminRole}, manager), users.ErrRoleChangeDenied)
+	assert.ErrorIs(t, service.UpdateUser(ctx, teacherID, models.UserUpdate{Role: &usersRole}, manager), users.ErrRoleChangeDenied)
+	_, err := service.AddUser(ctx, models.User{Username: "pupil", Password: testdb.Password, Role: "users"}, manager)
+	assert.ErrorIs(t, err, users.ErrRoleChangeDenied)
+	assert.Equal(t, "manager", role(managerID))
+
+	// Пользователем со своими разрешениями управлять можно
+	position := "Учитель"
+	require.NoError(t, service.UpdateUser(ctx, teacherID, models.UserUpdate{Position: &position}, manager))
+
+	// Администратора нельзя ни изменить, ни отключить, ни удалить
+	password, inactive := "Admin-passw0rd", false
+	assert.ErrorIs(t, service.UpdateUser(ctx, rootID, models.UserUpdate{Password: &password}, manager), users.ErrUserNotAllowed)
+	assert.ErrorIs(t, service.UpdateUser(ctx, rootID, models.UserUpdate{IsActive: &inactive}, personnel), users.ErrUserNotAllowed)
+	assert.ErrorIs(t, service.DeleteUser(ctx, rootID, personnel), users.ErrUserNotAllowed)
+
+	// С roles:manage можно назначить только роль не сильнее собственной
+	assert.ErrorIs(t, service.UpdateUser(ctx, personnelID, models.UserUpdate{Role: &adminRole}, personnel), roles.ErrRoleNotAllowed)
+	assert.ErrorIs(t, service.UpdateUser(ctx, teacherID, models.UserUpdate{Role: &adminRole}, personnel), roles.ErrRoleNotAllowed)
+	_, err = service.AddUser(ctx, models.User{Username: "root2", Password: testdb.Password, Role: models.RoleAdmin}, personnel)
+	assert.ErrorIs(t, err, roles.ErrRoleNotAllowed)
+	assert.Equal(t, "users", role(teacherID))
+
+	managerRole := "manager"
+	require.NoError(t, service.UpdateUser(ctx, teacherID, models.UserUpdate{Role: &managerRole}, personnel))
+	assert.Equal(t, "manager", role(teacherID))
+	pupilID, err := service.AddUser(ctx, models.User{Username: "pupil", Password: testdb.Password, Role: "users"}, personnel)
+	require.NoError(t, err)
+	require.NoError(t, service.DeleteUser(ctx, pupilID, manager))
+	assert.ErrorIs(t, service.DeleteUser(ctx, pupilID, manager), users.ErrUserNotFound)
+}
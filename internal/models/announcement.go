@@ -0,0 +1,62 @@
+package models
+
+import "time"
+
+// Audience - кому адресована рассылка: всем, роли, группам и/или отдельным пользователям.
+// Условия объединяются.
+type Audience struct {
+	All      bool   `json:"all,omitempty"`
+	Role     string `json:"role,omitempty"`
+	GroupIDs []int  `json:"group_ids,omitempty"`
+	UserIDs  []int  `json:"user_ids,omitempty"`
+}
+
+type Announcement struct {
+	ID          int       `json:"id"`
+	Title       string    `json:"title"`
+	Body        string    `json:"body"`
+	RequiresAck bool      `json:"requires_ack"`
+	Audience    Audience  `json:"audience"`
+	CreatedBy   int       `json:"created_by"`
+	CreatedAt   time.Time `json:"created_at"`
+
+	// Заполняется для получателя
+	ReadAt         *time.Time `json:"read_at,omitempty"`
+	AcknowledgedAt *time.Time `json:"acknowledged_at,omitempty"`
+
+	// Заполняется для администратора
+	RecipientsCount   *int `json:"recipients_count,omitempty"`
+	AcknowledgedCount *int `json:"acknowledged_count,omitempty"`
+}
+
+type AnnouncementRequest struct {
+	Title       string   `json:"title"`
+	Body        string   `json:"body"`
+	RequiresAck bool     `json:"requires_ack"`
+	Audience    Audience `json:"audience"`
+}
+
+// AnnouncementPage - страница объявлений; NextBeforeID передается в before_id для следующей страницы
+type AnnouncementPage struct {
+	Announcements []Announcement `json:"announcements"`
+	NextBeforeID  int            `json:"next_before_id,omitempty"`
+}
+
+// AnnouncementRecipient - состояние объявления у конкретного получателя
+type AnnouncementRecipient struct {
+	UserID         int        `json:"user_id"`
+	Username       string     `json:"username"`
+	ReadAt         *time.Time `json:"read_at,omitempty"`
+	AcknowledgedAt *time.Time `json:"acknowledged_at,omitempty"`
+}
+
+// AnnouncementReport - отчет об ознакомлении с объявлением
+type AnnouncementReport struct {
+	AnnouncementID int                     `json:"announcement_id"`
+	Title          string                  `json:"title"`
+	RequiresAck    bool                    `json:"requires_ack"`
+	Total          int                     `json:"total"`
+	Read           int                     `json:"read"`
+	Acknowledged   int                     `json:"acknowledged"`
+	Recipients     []AnnouncementRecipient `json:"recipients"`
+}
@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// APIKey - ключ для интеграций, действующий от имени пользователя в пределах разрешений Scopes
+type APIKey struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+	// Prefix - начало ключа, по которому его можно узнать в списке
+	Prefix     string     `json:"prefix"`
+	UserID     int        `json:"user_id"`
+	Username   string     `json:"username"`
+	Scopes     []string   `json:"scopes"`
+	CreatedBy  *int       `json:"created_by,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// APIKeyRequest - выпуск ключа. Без ExpiresAt ключ действует до отзыва.
+type APIKeyRequest struct {
+	Name      string     `json:"name"`
+	UserID    int        `json:"user_id"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// APIKeyCreated - выпущенный ключ. Значение Key показывается только один раз.
+type APIKeyCreated struct {
+	APIKey
+	Key string `json:"key"`
+}
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// UserGroup - именованная группа пользователей для массовых назначений и рассылок
+type UserGroup struct {
+	ID           int         `json:"id"`
+	Name         string      `json:"name"`
+	Description  string      `json:"description"`
+	CreatedBy    *int        `json:"created_by,omitempty"`
+	CreatedAt    time.Time   `json:"created_at"`
+	MembersCount int         `json:"members_count"`
+	Members      []UsersList `json:"members,omitempty"`
+}
+
+type UserGroupRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	UserIDs     []int  `json:"user_ids,omitempty"`
+}
+
+// GroupMembersRequest - список пользователей для добавления в группу или исключения из нее
+type GroupMembersRequest struct {
+	UserIDs []int `json:"user_ids"`
+}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+const (
+	LockoutKindUsername = "username"
+	LockoutKindIP       = "ip"
+)
+
+// LoginLockout - счетчик неудачных попыток входа по имени пользователя или IP-адресу
+type LoginLockout struct {
+	Kind         string     `json:"kind"`
+	Key          string     `json:"key"`
+	FailedCount  int        `json:"failed_count"`
+	LastFailedAt time.Time  `json:"last_failed_at"`
+	LockedUntil  *time.Time `json:"locked_until,omitempty"`
+}
+
+// UnlockRequest - снятие блокировки входа: по имени пользователя, IP-адресу или обоим
+type UnlockRequest struct {
+	Username string `json:"username,omitempty"`
+	IP       string `json:"ip,omitempty"`
+}
@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+type Message struct {
+	ID          int                 `json:"id"`
+	ThreadID    int                 `json:"thread_id"`
+	ReplyToID   *int                `json:"reply_to_id,omitempty"`
+	SenderID    int                 `json:"sender_id"`
+	SenderName  string              `json:"sender_name"`
+	Subject     string              `json:"subject"`
+	Body        string              `json:"body,omitempty"`
+	CreatedAt   time.Time           `json:"created_at"`
+	ReadAt      *time.Time          `json:"read_at,omitempty"`
+	Recipients  []MessageRecipient  `json:"recipients,omitempty"`
+	Attachments []MessageAttachment `json:"attachments,omitempty"`
+}
+
+// MessageRecipient - получатель письма; ReadAt служит уведомлением о прочтении для отправителя
+type MessageRecipient struct {
+	UserID   int        `json:"user_id"`
+	Username string     `json:"username"`
+	ReadAt   *time.Time `json:"read_at,omitempty"`
+}
+
+// MessageAttachment - вложение сообщения. Файл скачивается через /messages/attachments/{id}/{attachment_id},
+// путь на сервере клиенту не передается.
+type MessageAttachment struct {
+	ID       int    `json:"id"`
+	FilePath string `json:"-"`
+	FileName string `json:"file_name"`
+}
+
+// MessagePage - страница папки сообщений; NextBeforeID передается в before_id для следующей страницы
+type MessagePage struct {
+	Messages     []Message `json:"messages"`
+	NextBeforeID int       `json:"next_before_id,omitempty"`
+}
@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+// MFAStatus - состояние двухфакторной аутентификации пользователя
+type MFAStatus struct {
+	Enabled bool `json:"enabled"`
+	// Required - для роли пользователя второй фактор обязателен, отключить его нельзя
+	Required          bool `json:"required"`
+	RecoveryCodesLeft int  `json:"recovery_codes_left"`
+}
+
+// MFASetup - секрет для приложения-аутентификатора. ProvisioningURI кодируется в QR-код.
+type MFASetup struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+// MFACodeRequest - код из приложения-аутентификатора или код восстановления
+type MFACodeRequest struct {
+	Code string `json:"code"`
+}
+
+// MFAChallengeRequest - промежуточный токен входа и, для подтверждения, код
+type MFAChallengeRequest struct {
+	MFAToken string `json:"mfa_token"`
+	Code     string `json:"code,omitempty"`
+}
+
+// MFAChallenge - ответ на вход по паролю, когда нужен второй фактор
+type MFAChallenge struct {
+	MFARequired bool `json:"mfa_required"`
+	// SetupRequired - второй фактор обязателен для роли, но еще не настроен:
+	// сначала нужно получить секрет через /auth/mfa/setup
+	SetupRequired bool      `json:"setup_required"`
+	MFAToken      string    `json:"mfa_token"`
+	ExpiresAt     time.Time `json:"expires_at"`
+}
+
+// RecoveryCodes - новые коды восстановления; показываются один раз
+type RecoveryCodes struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
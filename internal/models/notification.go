@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+type Notification struct {
+	ID        int        `json:"id"`
+	Type      string     `json:"type"`
+	TaskID    *int       `json:"task_id,omitempty"`
+	Title     string     `json:"title"`
+	Message   string     `json:"message"`
+	ReadAt    *time.Time `json:"read_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// NotificationPage - страница входящих уведомлений; NextBeforeID передается в before_id для следующей страницы
+type NotificationPage struct {
+	Notifications []Notification `json:"notifications"`
+	NextBeforeID  int            `json:"next_before_id,omitempty"`
+}
@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// Organization - узел иерархии организаций (управление образования → школа).
+// Сотрудники организации - пользователи с соответствующим organization_id.
+type Organization struct {
+	ID           int            `json:"id"`
+	Name         string         `json:"name"`
+	ParentID     *int           `json:"parent_id,omitempty"`
+	CreatedAt    time.Time      `json:"created_at"`
+	MembersCount int            `json:"members_count"`
+	Children     []Organization `json:"children,omitempty"`
+	Members      []UsersList    `json:"members,omitempty"`
+	// Path - цепочка от корня до организации включительно
+	Path []OrganizationRef `json:"path,omitempty"`
+}
+
+// OrganizationRef - краткая ссылка на организацию
+type OrganizationRef struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+type OrganizationRequest struct {
+	Name     string `json:"name"`
+	ParentID *int   `json:"parent_id,omitempty"`
+	// MoveToRoot - при обновлении перенести организацию на верхний уровень
+	MoveToRoot bool `json:"move_to_root,omitempty"`
+}
+
+// OrganizationMembersRequest - пользователи, которых нужно прикрепить к организации или открепить от нее
+type OrganizationMembersRequest struct {
+	UserIDs []int `json:"user_ids"`
+}
@@ -0,0 +1,47 @@
+package models
+
+import "time"
+
+// Решения администратора по ответу исполнителя
+const (
+	ReviewStatusPending  = "pending"
+	ReviewStatusAccepted = "accepted"
+	ReviewStatusReturned = "returned"
+)
+
+type TaskResponse struct {
+	ID       int    `json:"id"`
+	TaskID   int    `json:"task_id"`
+	UserID   int    `json:"user_id"`
+	Username string `json:"username"`
+	// OrganizationID - организация, от имени которой дан ответ
+	OrganizationID *int               `json:"organization_id,omitempty"`
+	Text           string             `json:"text"`
+	Files          []TaskResponseFile `json:"files"`
+	CreatedAt      time.Time          `json:"created_at"`
+	ReviewStatus   string             `json:"review_status"`
+	ReviewedBy     *int               `json:"reviewed_by,omitempty"`
+	ReviewedAt     *time.Time         `json:"reviewed_at,omitempty"`
+	ReviewComment  string             `json:"review_comment,omitempty"`
+}
+
+// TaskResponseFile - вложение ответа. Файл отдается маршрутом ответа с проверкой доступа,
+// поэтому путь в каталоге загрузок не передается.
+type TaskResponseFile struct {
+	ID       int    `json:"id"`
+	FilePath string `json:"-"`
+	FileName string `json:"file_name"`
+}
+
+// TaskReview - результат проверки последнего ответа исполнителя, показывается в его задаче
+type TaskReview struct {
+	ResponseID int        `json:"response_id"`
+	Status     string     `json:"status"`
+	Comment    string     `json:"comment,omitempty"`
+	ReviewedAt *time.Time `json:"reviewed_at,omitempty"`
+}
+
+type ReviewRequest struct {
+	Status  string `json:"status"`
+	Comment string `json:"comment"`
+}
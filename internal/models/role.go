@@ -0,0 +1,56 @@
+package models
+
+import "time"
+
+// Разрешения, которые проверяются в маршрутах. Список хранится в таблице permissions,
+// роли связываются с разрешениями в role_permissions.
+const (
+	PermTasksRead           = "tasks:read"
+	PermTasksCreate         = "tasks:create"
+	PermTasksUpdate         = "tasks:update"
+	PermTasksDelete         = "tasks:delete"
+	PermTasksReview         = "tasks:review"
+	PermTasksExecute        = "tasks:execute"
+	PermUsersRead           = "users:read"
+	PermUsersManage         = "users:manage"
+	PermGroupsManage        = "groups:manage"
+	PermOrganizationsManage = "organizations:manage"
+	PermAnnouncementsManage = "announcements:manage"
+	PermFilesUpload         = "files:upload"
+	PermLogsRead            = "logs:read"
+	PermSecurityManage      = "security:manage"
+	PermRolesManage         = "roles:manage"
+)
+
+// RoleAdmin - встроенная роль со всеми разрешениями
+const RoleAdmin = "admin"
+
+// Permission - разрешение на группу действий
+type Permission struct {
+	Code        string `json:"code"`
+	Description string `json:"description"`
+}
+
+// Role - именованный набор разрешений
+type Role struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Builtin     bool     `json:"builtin"`
+	Permissions []string `json:"permissions"`
+	// UsersCount - сколько пользователей имеют эту роль
+	UsersCount int       `json:"users_count"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// RoleRequest - создание роли
+type RoleRequest struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+// RoleUpdate - изменение роли; nil означает «не менять», Permissions заменяет весь набор
+type RoleUpdate struct {
+	Description *string   `json:"description,omitempty"`
+	Permissions *[]string `json:"permissions,omitempty"`
+}
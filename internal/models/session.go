@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// Session - вход пользователя с конкретного устройства
+type Session struct {
+	ID         string     `json:"id"`
+	UserID     int        `json:"user_id"`
+	Username   string     `json:"username,omitempty"`
+	IP         string     `json:"ip"`
+	UserAgent  string     `json:"user_agent"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	// Current - сессия, которой принадлежит токен запроса
+	Current bool `json:"current"`
+}
+
+// SessionMeta - сведения об устройстве, с которого выполнен вход
+type SessionMeta struct {
+	IP        string
+	UserAgent string
+}
@@ -1,5 +1,15 @@
 package models
 
+import "time"
+
+// Статусы выполнения задачи конкретным исполнителем
+const (
+	TaskStatusNew        = "new"
+	TaskStatusSeen       = "seen"
+	TaskStatusInProgress = "in_progress"
+	TaskStatusDone       = "done"
+)
+
 type Task struct {
 	ID          int    `json:"id"`
 	Title       string `json:"title"`
@@ -7,6 +17,75 @@ type Task struct {
 	DueDate     string `json:"due_date"`
 	Priority    string `json:"priority"`
 	UserIDs     []int  `json:"user_ids"`
-	FilePath    string `json:"file_path,omitempty"`
-	CreatedBy   int    `json:"created_by"`
+	GroupIDs    []int  `json:"group_ids,omitempty"`
+	// OrganizationIDs - организации-исполнители: задачу видит и может выполнить любой их сотрудник
+	OrganizationIDs []int `json:"organization_ids,omitempty"`
+	// OrganizationID - для исполнителя: организация, через которую ему доступна задача
+	OrganizationID *int        `json:"organization_id,omitempty"`
+	FilePath       string      `json:"file_path,omitempty"`
+	CreatedBy      int         `json:"created_by"`
+	CreatedAt      *time.Time  `json:"created_at,omitempty"`
+	Status         string      `json:"status,omitempty"`
+	SeenAt         *time.Time  `json:"seen_at,omitempty"`
+	StartedAt      *time.Time  `json:"started_at,omitempty"`
+	CompletedAt    *time.Time  `json:"completed_at,omitempty"`
+	Review         *TaskReview `json:"review,omitempty"`
+}
+
+// TaskAssignee - исполнитель задачи и его прогресс
+type TaskAssignee struct {
+	UserID      int        `json:"user_id"`
+	Username    string     `json:"username"`
+	Status      string     `json:"status"`
+	AssignedAt  *time.Time `json:"assigned_at,omitempty"`
+	SentBy      *int       `json:"sent_by,omitempty"`
+	GroupID     *int       `json:"group_id,omitempty"`
+	GroupName   *string    `json:"group_name,omitempty"`
+	SeenAt      *time.Time `json:"seen_at,omitempty"`
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
+
+// TaskOrganization - организация-исполнитель задачи и ее общий прогресс
+type TaskOrganization struct {
+	OrganizationID int        `json:"organization_id"`
+	Name           string     `json:"name"`
+	Status         string     `json:"status"`
+	AssignedAt     *time.Time `json:"assigned_at,omitempty"`
+	SentBy         *int       `json:"sent_by,omitempty"`
+	SeenAt         *time.Time `json:"seen_at,omitempty"`
+	StartedAt      *time.Time `json:"started_at,omitempty"`
+	CompletedAt    *time.Time `json:"completed_at,omitempty"`
+}
+
+// TaskDetails - полная карточка задачи; Assignees и Organizations заполняются только для администратора
+type TaskDetails struct {
+	Task
+	Assignees     []TaskAssignee     `json:"assignees,omitempty"`
+	Organizations []TaskOrganization `json:"organizations,omitempty"`
+	Attachments   []string           `json:"attachments"`
+}
+
+// TaskFilter - параметры выборки задач для администратора
+type TaskFilter struct {
+	CreatedBy  *int
+	AssigneeID *int
+	Priority   string
+	DueFrom    string
+	DueTo      string
+	Completed  *bool
+	SortBy     string
+	SortOrder  string
+	Limit      int
+	Cursor     string
+}
+
+// TaskPage - страница списка задач; NextCursor пуст, если страница последняя
+type TaskPage struct {
+	Tasks      []Task `json:"tasks"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+type TaskStatusUpdate struct {
+	Status string `json:"status"`
 }
@@ -1,13 +1,100 @@
 package models
 
+import "time"
+
 type User struct {
 	ID       int    `json:"id"`
 	Username string `json:"username"`
 	Password string `json:"password"`
 	Role     string `json:"role"`
+	Email    string `json:"email,omitempty"`
+	FullName string `json:"full_name,omitempty"`
+	Position string `json:"position,omitempty"`
+	Phone    string `json:"phone,omitempty"`
+	// OrganizationID - организация, сотрудником которой является пользователь
+	OrganizationID *int `json:"organization_id,omitempty"`
+	// MustChangePassword - пользователь должен сменить пароль при следующем входе
+	MustChangePassword bool       `json:"must_change_password"`
+	PasswordChangedAt  *time.Time `json:"-"`
+	// TOTPEnabled - вход требует код из приложения-аутентификатора
+	TOTPEnabled bool `json:"-"`
+	// AuthSource - где проверяется пароль: AuthSourceLocal или AuthSourceLDAP
+	AuthSource string `json:"-"`
 }
 
+// Источники учетных записей
+const (
+	AuthSourceLocal = "local"
+	AuthSourceLDAP  = "ldap"
+)
+
 type UsersList struct {
 	ID       int    `json:"id"`
 	Username string `json:"username"`
+	FullName string `json:"full_name,omitempty"`
+}
+
+// UserProfile - карточка пользователя в справочнике
+type UserProfile struct {
+	ID                 int    `json:"id"`
+	Username           string `json:"username"`
+	Role               string `json:"role"`
+	FullName           string `json:"full_name"`
+	Position           string `json:"position"`
+	Email              string `json:"email"`
+	Phone              string `json:"phone"`
+	OrganizationID     *int   `json:"organization_id,omitempty"`
+	OrganizationName   string `json:"organization_name"`
+	IsActive           bool   `json:"is_active"`
+	MustChangePassword bool   `json:"must_change_password"`
+	// LockedUntil - вход заблокирован после неудачных попыток до указанного времени
+	LockedUntil *time.Time `json:"locked_until,omitempty"`
+}
+
+// UserUpdate - изменения учетной записи администратором.
+// Отсутствующее поле не меняется, пустая строка очищает необязательное поле,
+// organization_id = 0 открепляет пользователя от организации.
+type UserUpdate struct {
+	Username       *string `json:"username,omitempty"`
+	Password       *string `json:"password,omitempty"`
+	Role           *string `json:"role,omitempty"`
+	FullName       *string `json:"full_name,omitempty"`
+	Position       *string `json:"position,omitempty"`
+	Email          *string `json:"email,omitempty"`
+	Phone          *string `json:"phone,omitempty"`
+	OrganizationID *int    `json:"organization_id,omitempty"`
+	IsActive       *bool   `json:"is_active,omitempty"`
+	// MustChangePassword - потребовать смену пароля при следующем входе.
+	// При сбросе пароля требование устанавливается всегда.
+	MustChangePassword *bool `json:"must_change_password,omitempty"`
+}
+
+// ProfileUpdate - поля профиля, которые пользователь может менять сам
+type ProfileUpdate struct {
+	FullName *string `json:"full_name,omitempty"`
+	Position *string `json:"position,omitempty"`
+	Email    *string `json:"email,omitempty"`
+	Phone    *string `json:"phone,omitempty"`
+}
+
+// PasswordChangeRequest - смена пароля самим пользователем
+type PasswordChangeRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+// UserDirectoryFilter - параметры поиска по справочнику пользователей
+type UserDirectoryFilter struct {
+	Query          string
+	Role           string
+	OrganizationID *int
+	Active         *bool
+	Limit          int
+	Offset         int
+}
+
+// UserDirectoryPage - страница справочника пользователей
+type UserDirectoryPage struct {
+	Users []UserProfile `json:"users"`
+	Total int           `json:"total"`
 }
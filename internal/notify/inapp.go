@@ -0,0 +1,32 @@
+package notify
+
+import (
+	"ROOmail/internal/eventbus"
+	"golang.org/x/net/context"
+)
+
+// InAppNotifier доставляет уведомления в приложение: публикует их в шину событий,
+// откуда они попадают во входящие уведомления пользователя и в поток SSE
+type InAppNotifier struct {
+	bus *eventbus.Bus
+}
+
+func NewInAppNotifier(bus *eventbus.Bus) *InAppNotifier {
+	return &InAppNotifier{bus: bus}
+}
+
+func (n *InAppNotifier) Name() string {
+	return "in_app"
+}
+
+func (n *InAppNotifier) Notify(ctx context.Context, notification Notification) error {
+	n.bus.Publish(eventbus.Event{
+		Type:      eventbus.TaskReminder,
+		UserIDs:   []int{notification.UserID},
+		TaskID:    notification.TaskID,
+		Title:     notification.Subject,
+		Message:   notification.Body,
+		CreatedAt: notification.CreatedAt,
+	})
+	return nil
+}
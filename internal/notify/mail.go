@@ -0,0 +1,102 @@
+package notify
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"golang.org/x/net/context"
+	htmltemplate "html/template"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+//go:embed templates/*
+var templateFS embed.FS
+
+var (
+	textTemplates = texttemplate.Must(texttemplate.ParseFS(templateFS, "templates/*.txt"))
+	htmlTemplates = htmltemplate.Must(htmltemplate.ParseFS(templateFS, "templates/*.html"))
+)
+
+// Виды писем о задачах
+const (
+	KindTaskAssigned = "task_assigned"
+	KindTaskUpdated  = "task_updated"
+)
+
+// Recipient - получатель письма
+type Recipient struct {
+	UserID   int
+	Username string
+	Email    string
+}
+
+// TaskInfo - данные задачи для письма
+type TaskInfo struct {
+	ID      int
+	Title   string
+	DueDate *time.Time
+}
+
+// TaskMailer формирует письма о задачах по шаблонам и передает их в канал доставки
+type TaskMailer struct {
+	notifier Notifier
+	appURL   string
+}
+
+func NewTaskMailer(notifier Notifier, appURL string) *TaskMailer {
+	return &TaskMailer{
+		notifier: notifier,
+		appURL:   strings.TrimRight(appURL, "/"),
+	}
+}
+
+// TaskAssigned сообщает получателю о назначенной ему задаче
+func (m *TaskMailer) TaskAssigned(ctx context.Context, recipient Recipient, task TaskInfo) error {
+	return m.send(ctx, KindTaskAssigned, fmt.Sprintf("Новая задача: %s", task.Title), recipient, task)
+}
+
+// TaskUpdated сообщает исполнителю об изменении задачи
+func (m *TaskMailer) TaskUpdated(ctx context.Context, recipient Recipient, task TaskInfo) error {
+	return m.send(ctx, KindTaskUpdated, fmt.Sprintf("Задача изменена: %s", task.Title), recipient, task)
+}
+
+func (m *TaskMailer) send(ctx context.Context, kind, subject string, recipient Recipient, task TaskInfo) error {
+	if recipient.Email == "" {
+		return nil
+	}
+
+	data := struct {
+		Username string
+		Title    string
+		DueDate  string
+		Link     string
+	}{
+		Username: recipient.Username,
+		Title:    task.Title,
+		Link:     fmt.Sprintf("%s/tasks/%d", m.appURL, task.ID),
+	}
+	if task.DueDate != nil {
+		data.DueDate = task.DueDate.Format("02.01.2006")
+	}
+
+	var text, html bytes.Buffer
+	if err := textTemplates.ExecuteTemplate(&text, kind+".txt", data); err != nil {
+		return fmt.Errorf("не удалось сформировать текст письма: %w", err)
+	}
+	if err := htmlTemplates.ExecuteTemplate(&html, kind+".html", data); err != nil {
+		return fmt.Errorf("не удалось сформировать HTML письма: %w", err)
+	}
+
+	return m.notifier.Notify(ctx, Notification{
+		UserID:    recipient.UserID,
+		Email:     recipient.Email,
+		Kind:      kind,
+		TaskID:    task.ID,
+		Subject:   subject,
+		Body:      text.String(),
+		HTMLBody:  html.String(),
+		CreatedAt: time.Now(),
+	})
+}
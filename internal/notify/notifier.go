@@ -0,0 +1,39 @@
+package notify
+
+import (
+	"golang.org/x/net/context"
+	"time"
+)
+
+// Notification - уведомление пользователю, независимое от канала доставки
+type Notification struct {
+	UserID    int       `json:"user_id"`
+	Email     string    `json:"-"`
+	Kind      string    `json:"kind"`
+	TaskID    int       `json:"task_id,omitempty"`
+	Subject   string    `json:"subject"`
+	Body      string    `json:"body"`
+	HTMLBody  string    `json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Notifier - канал доставки уведомлений (почта, webhook, уведомления в приложении)
+type Notifier interface {
+	Name() string
+	Notify(ctx context.Context, n Notification) error
+}
+
+// Deliverer - канал с отложенной доставкой (например, очередь), который может отправить
+// уведомление и сразу, вернув результат фактической отправки
+type Deliverer interface {
+	Deliver(ctx context.Context, n Notification) error
+}
+
+// Deliver отправляет уведомление и возвращает результат фактической отправки:
+// канал с очередью отправляет его в обход очереди
+func Deliver(ctx context.Context, notifier Notifier, n Notification) error {
+	if d, ok := notifier.(Deliverer); ok {
+		return d.Deliver(ctx, n)
+	}
+	return notifier.Notify(ctx, n)
+}
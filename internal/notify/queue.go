@@ -0,0 +1,72 @@
+package notify
+
+import (
+	"ROOmail/pkg/logger"
+	"errors"
+	"golang.org/x/net/context"
+	"sync"
+)
+
+var ErrQueueFull = errors.New("очередь уведомлений переполнена")
+
+// Queue доставляет уведомления в фоне, чтобы медленный канал (например, почтовый
+// сервер) не задерживал обработку HTTP-запросов.
+type Queue struct {
+	next Notifier
+	jobs chan Notification
+	log  logger.Logger
+	wg   sync.WaitGroup
+}
+
+func NewQueue(next Notifier, size int, log logger.Logger) *Queue {
+	return &Queue{
+		next: next,
+		jobs: make(chan Notification, size),
+		log:  log,
+	}
+}
+
+func (q *Queue) Name() string {
+	return q.next.Name()
+}
+
+// Notify ставит уведомление в очередь и сразу возвращает управление
+func (q *Queue) Notify(ctx context.Context, n Notification) error {
+	select {
+	case q.jobs <- n:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// Deliver отправляет уведомление сразу, минуя очередь, и возвращает результат отправки.
+// Нужен фоновым задачам, которые повторяют доставку после сбоя канала.
+func (q *Queue) Deliver(ctx context.Context, n Notification) error {
+	return q.next.Notify(ctx, n)
+}
+
+// Start запускает обработчиков очереди; они работают, пока не отменен контекст
+func (q *Queue) Start(ctx context.Context, workers int) {
+	for i := 0; i < workers; i++ {
+		q.wg.Add(1)
+		go func() {
+			defer q.wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case n := <-q.jobs:
+					if err := q.next.Notify(ctx, n); err != nil {
+						q.log.Error("Не удалось доставить уведомление через ", q.next.Name(), ": ", err)
+					}
+				}
+			}
+		}()
+	}
+}
+
+// Wait дожидается остановки обработчиков после отмены контекста
+func (q *Queue) Wait() {
+	q.wg.Wait()
+}
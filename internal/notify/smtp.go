@@ -0,0 +1,112 @@
+package notify
+
+import (
+	"bytes"
+	"fmt"
+	"golang.org/x/net/context"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+)
+
+// SMTPNotifier отправляет уведомления письмом на адрес пользователя
+type SMTPNotifier struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+func NewSMTPNotifier(host, port, username, password, from string) *SMTPNotifier {
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+	return &SMTPNotifier{
+		addr: net.JoinHostPort(host, port),
+		auth: auth,
+		from: from,
+	}
+}
+
+func (n *SMTPNotifier) Name() string {
+	return "email"
+}
+
+// Notify отправляет письмо; пользователи без адреса почты пропускаются
+func (n *SMTPNotifier) Notify(ctx context.Context, notification Notification) error {
+	if notification.Email == "" {
+		return nil
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	msg, err := n.buildMessage(notification)
+	if err != nil {
+		return fmt.Errorf("не удалось сформировать письмо: %w", err)
+	}
+
+	if err := smtp.SendMail(n.addr, n.auth, n.from, []string{notification.Email}, msg); err != nil {
+		return fmt.Errorf("не удалось отправить письмо на %s: %w", notification.Email, err)
+	}
+	return nil
+}
+
+// buildMessage собирает письмо: только текст или текст вместе с HTML-версией
+func (n *SMTPNotifier) buildMessage(notification Notification) ([]byte, error) {
+	var msg bytes.Buffer
+	msg.WriteString("From: " + n.from + "\r\n")
+	msg.WriteString("To: " + notification.Email + "\r\n")
+	msg.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", notification.Subject) + "\r\n")
+	msg.WriteString("MIME-Version: 1.0\r\n")
+
+	if notification.HTMLBody == "" {
+		msg.WriteString("Content-Type: text/plain; charset=\"utf-8\"\r\n")
+		msg.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+		if err := writeQuotedPrintable(&msg, notification.Body); err != nil {
+			return nil, err
+		}
+		return msg.Bytes(), nil
+	}
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	parts := []struct {
+		contentType string
+		content     string
+	}{
+		{"text/plain; charset=\"utf-8\"", notification.Body},
+		{"text/html; charset=\"utf-8\"", notification.HTMLBody},
+	}
+	for _, p := range parts {
+		part, err := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {p.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := writeQuotedPrintable(part, p.content); err != nil {
+			return nil, err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	msg.WriteString("Content-Type: multipart/alternative; boundary=\"" + writer.Boundary() + "\"\r\n\r\n")
+	msg.Write(body.Bytes())
+	return msg.Bytes(), nil
+}
+
+func writeQuotedPrintable(w io.Writer, content string) error {
+	qp := quotedprintable.NewWriter(w)
+	if _, err := qp.Write([]byte(content)); err != nil {
+		return err
+	}
+	return qp.Close()
+}
@@ -0,0 +1,115 @@
+package notify_test
+
+import (
+	"ROOmail/internal/notify"
+	"ROOmail/pkg/logger"
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startSMTPSink поднимает минимальный SMTP-сервер и возвращает полученные письма
+func startSMTPSink(t *testing.T) (host, port string, messages <-chan string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	out := make(chan string, 10)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveSMTP(conn, out)
+		}
+	}()
+
+	host, port, _ = net.SplitHostPort(listener.Addr().String())
+	return host, port, out
+}
+
+func serveSMTP(conn net.Conn, out chan<- string) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+	reply("220 sink ready")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			reply("250 sink")
+		case strings.HasPrefix(cmd, "DATA"):
+			reply("354 go ahead")
+			var data strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				data.WriteString(l)
+			}
+			out <- data.String()
+			reply("250 queued")
+		case strings.HasPrefix(cmd, "QUIT"):
+			reply("221 bye")
+			return
+		default:
+			reply("250 ok")
+		}
+	}
+}
+
+func TestTaskMailerSendsMultipartEmail(t *testing.T) {
+	host, port, messages := startSMTPSink(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	queue := notify.NewQueue(notify.NewSMTPNotifier(host, port, "", "", "noreply@roomail.local"), 10, logger.NewZapLogger())
+	queue.Start(ctx, 1)
+	mailer := notify.NewTaskMailer(queue, "https://roomail.example/")
+
+	due := time.Date(2024, 12, 31, 0, 0, 0, 0, time.UTC)
+	err := mailer.TaskAssigned(ctx, notify.Recipient{UserID: 5, Username: "school5", Email: "school5@example.com"}, notify.TaskInfo{ID: 42, Title: "Отчет", DueDate: &due})
+	require.NoError(t, err)
+
+	select {
+	case msg := <-messages:
+		assert.Contains(t, msg, "To: school5@example.com")
+		assert.Contains(t, msg, "multipart/alternative")
+		assert.Contains(t, msg, "text/plain")
+		assert.Contains(t, msg, "text/html")
+		assert.Contains(t, msg, "https://roomail.example/tasks/42")
+	case <-time.After(5 * time.Second):
+		t.Fatal("письмо не было доставлено")
+	}
+}
+
+func TestTaskMailerSkipsRecipientWithoutEmail(t *testing.T) {
+	host, port, messages := startSMTPSink(t)
+
+	mailer := notify.NewTaskMailer(notify.NewSMTPNotifier(host, port, "", "", "noreply@roomail.local"), "https://roomail.example")
+	err := mailer.TaskUpdated(context.Background(), notify.Recipient{UserID: 5}, notify.TaskInfo{ID: 1, Title: "Отчет"})
+
+	assert.NoError(t, err)
+	select {
+	case <-messages:
+		t.Fatal("письмо без адреса не должно отправляться")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
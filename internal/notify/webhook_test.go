@@ -0,0 +1,42 @@
+package notify_test
+
+import (
+	"ROOmail/internal/notify"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebhookNotifier(t *testing.T) {
+	var received notify.Notification
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	notifier := notify.NewWebhookNotifier(server.URL)
+	err := notifier.Notify(context.Background(), notify.Notification{UserID: 7, TaskID: 3, Kind: "task_reminder", Subject: "Срок задачи"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 7, received.UserID)
+	assert.Equal(t, 3, received.TaskID)
+	assert.Equal(t, "Срок задачи", received.Subject)
+}
+
+func TestWebhookNotifierErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	notifier := notify.NewWebhookNotifier(server.URL)
+	err := notifier.Notify(context.Background(), notify.Notification{UserID: 1})
+
+	assert.Error(t, err)
+}
@@ -0,0 +1,143 @@
+package passwords
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ErrWeakPassword оборачивает все нарушения политики паролей
+var ErrWeakPassword = errors.New("Пароль не соответствует требованиям")
+
+// commonPasswords - встроенный список самых распространенных паролей.
+// Дополняется файлом из PASSWORD_BLOCKLIST_FILE.
+var commonPasswords = []string{
+	"123456", "12345678", "123456789", "1234567890", "12345", "1234", "111111", "000000",
+	"123123", "654321", "666666", "121212", "7777777", "qwerty", "qwerty123", "qwertyuiop",
+	"1q2w3e4r", "1q2w3e4r5t", "1qaz2wsx", "zaq12wsx", "asdfgh", "password", "password1",
+	"password123", "passw0rd", "admin", "admin123", "administrator", "root", "welcome",
+	"letmein", "iloveyou", "monkey", "dragon", "football", "master", "login", "abc123",
+	"parol", "parol123", "privet", "roomail",
+}
+
+// Policy - требования к паролям пользователей
+type Policy struct {
+	// MinLength - минимальная длина в символах
+	MinLength int
+	// MinClasses - сколько классов символов из четырех (строчные, прописные, цифры, прочие) должно быть в пароле
+	MinClasses int
+	// MaxAge - срок действия пароля; 0 - без ограничения
+	MaxAge time.Duration
+
+	blocklist map[string]struct{}
+}
+
+func NewPolicy(minLength, minClasses int, maxAge time.Duration, blocklist []string) *Policy {
+	p := &Policy{
+		MinLength:  minLength,
+		MinClasses: minClasses,
+		MaxAge:     maxAge,
+		blocklist:  make(map[string]struct{}, len(commonPasswords)+len(blocklist)),
+	}
+	for _, list := range [][]string{commonPasswords, blocklist} {
+		for _, password := range list {
+			if password = strings.TrimSpace(password); password != "" {
+				p.blocklist[strings.ToLower(password)] = struct{}{}
+			}
+		}
+	}
+	return p
+}
+
+// LoadBlocklist читает файл с запрещенными паролями, по одному в строке.
+// Пустые строки и строки, начинающиеся с #, пропускаются.
+func LoadBlocklist(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось открыть список запрещенных паролей: %w", err)
+	}
+	defer f.Close()
+
+	var result []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		result = append(result, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("не удалось прочитать список запрещенных паролей: %w", err)
+	}
+	return result, nil
+}
+
+// Validate проверяет пароль на соответствие политике
+func (p *Policy) Validate(password, username string) error {
+	if utf8.RuneCountInString(password) < p.MinLength {
+		return violation("длина должна быть не менее %d символов", p.MinLength)
+	}
+
+	if classes := countClasses(password); classes < p.MinClasses {
+		return violation("нужны символы как минимум %d видов из четырех: строчные и прописные буквы, цифры, прочие символы", p.MinClasses)
+	}
+
+	lower := strings.ToLower(password)
+	if username != "" && lower == strings.ToLower(username) {
+		return violation("пароль не должен совпадать с именем пользователя")
+	}
+	if _, blocked := p.blocklist[lower]; blocked {
+		return violation("пароль входит в список распространенных")
+	}
+
+	return nil
+}
+
+// ExpiresAt возвращает момент истечения пароля или nil, если срок не ограничен либо неизвестен
+func (p *Policy) ExpiresAt(changedAt *time.Time) *time.Time {
+	if p.MaxAge <= 0 || changedAt == nil {
+		return nil
+	}
+	expiresAt := changedAt.Add(p.MaxAge)
+	return &expiresAt
+}
+
+// Expired сообщает, истек ли срок действия пароля
+func (p *Policy) Expired(changedAt *time.Time, now time.Time) bool {
+	expiresAt := p.ExpiresAt(changedAt)
+	return expiresAt != nil && !now.Before(*expiresAt)
+}
+
+func violation(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrWeakPassword, fmt.Sprintf(format, args...))
+}
+
+func countClasses(password string) int {
+	var lower, upper, digit, other bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			other = true
+		}
+	}
+
+	count := 0
+	for _, present := range []bool{lower, upper, digit, other} {
+		if present {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,48 @@
+package passwords_test
+
+import (
+	"ROOmail/internal/passwords"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolicyValidate(t *testing.T) {
+	policy := passwords.NewPolicy(8, 3, 0, []string{"School2024!"})
+
+	cases := []struct {
+		name     string
+		password string
+		username string
+		valid    bool
+	}{
+		{"подходящий пароль", "Tr0ub4dor&3", "ivanov", true},
+		{"кириллица считается буквами", "Пароль-2024", "ivanov", true},
+		{"слишком короткий", "Ab1!", "ivanov", false},
+		{"мало классов символов", "abcdefgh1", "ivanov", false},
+		{"совпадает с именем пользователя", "Ivanov.2024", "ivanov.2024", false},
+		{"встроенный список", "Password123", "ivanov", false},
+		{"список из конфигурации", "school2024!", "ivanov", false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := policy.Validate(tc.password, tc.username)
+			if tc.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, passwords.ErrWeakPassword)
+			}
+		})
+	}
+}
+
+func TestPolicyExpiry(t *testing.T) {
+	now := time.Now()
+	changedAt := now.Add(-91 * 24 * time.Hour)
+
+	assert.False(t, passwords.NewPolicy(8, 3, 0, nil).Expired(&changedAt, now))
+	assert.True(t, passwords.NewPolicy(8, 3, 90*24*time.Hour, nil).Expired(&changedAt, now))
+	assert.False(t, passwords.NewPolicy(8, 3, 90*24*time.Hour, nil).Expired(nil, now))
+}
@@ -2,94 +2,332 @@ package router
 
 import (
 	"ROOmail/config"
+	"ROOmail/internal/directory"
+	"ROOmail/internal/eventbus"
 	"ROOmail/internal/handlers"
+	"ROOmail/internal/handlers/announcements"
+	"ROOmail/internal/handlers/apikeys"
 	"ROOmail/internal/handlers/auth"
 	"ROOmail/internal/handlers/file"
+	"ROOmail/internal/handlers/groups"
+	"ROOmail/internal/handlers/messages"
+	"ROOmail/internal/handlers/notifications"
+	"ROOmail/internal/handlers/organizations"
+	"ROOmail/internal/handlers/roles"
+	"ROOmail/internal/handlers/sessions"
 	"ROOmail/internal/handlers/tasks"
 	"ROOmail/internal/handlers/users"
+	"ROOmail/internal/models"
+	"ROOmail/internal/notify"
+	"ROOmail/internal/passwords"
+	"ROOmail/internal/tokens"
 	"ROOmail/pkg/logger"
 	"ROOmail/pkg/utils/jwt_token"
+	"fmt"
 	"github.com/gorilla/mux"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/rs/cors"
 	httpSwagger "github.com/swaggo/http-swagger"
+	"golang.org/x/net/context"
 	"net/http"
+	"time"
 )
 
-func InitRouter(db *pgxpool.Pool, cfg config.Config) http.Handler {
+// InitRouter регистрирует маршруты. Фоновые задачи сервисов работают, пока не отменен ctx.
+// Ошибка означает, что конфигурация неверна и сервер запускать нельзя.
+func InitRouter(ctx context.Context, db *pgxpool.Pool, cfg config.Config, mailer *notify.TaskMailer, bus *eventbus.Bus) (http.Handler, error) {
 	r := mux.NewRouter()
 	log := logger.NewZapLogger()
+	passwordPolicy := newPasswordPolicy(cfg, log)
+	tokenStore := tokens.NewStore(db, cfg.RefreshTokenTTL)
 
 	// Регистрация маршрутов аутентификации
-	registerAuthRoutes(r, log)
+	if err := registerAuthRoutes(ctx, r, db, cfg, passwordPolicy, tokenStore, log); err != nil {
+		return nil, err
+	}
 
 	// Регистрация маршрутов задач
-	registerTaskRoutes(r, db, log)
+	registerTaskRoutes(r, db, mailer, bus, log)
 
 	// Регистрация маршрутов пользователей
-	registerUserRoutes(r, db, log)
+	registerUserRoutes(r, db, bus, passwordPolicy, tokenStore, log)
+	registerSessionRoutes(r, db, tokenStore, log)
+	registerGroupRoutes(r, db, log)
+	registerRoleRoutes(r, db, log)
+	registerAPIKeyRoutes(r, db, log)
+	registerOrganizationRoutes(r, db, log)
 
 	// Регистрация маршрутов работы с файлами
 	registerFIleRoutes(r, db, log)
 
+	// Регистрация маршрутов уведомлений
+	registerNotificationRoutes(r, db, bus, log)
+	registerMessageRoutes(r, db, bus, log)
+	registerAnnouncementRoutes(r, db, bus, log)
+
+	// Открытые ключи для проверки токенов другими сервисами
+	r.HandleFunc("/.well-known/jwks.json", jwt_token.JWKSHandler).Methods("GET")
+
 	// Swagger-документация
 	r.PathPrefix("/swagger/").Handler(httpSwagger.WrapHandler)
 
 	// CORS настройки
 	corsHandler := cors.New(cors.Options{
 		AllowedOrigins:   []string{"http://localhost:3000", "https://chechenmail.vercel.app"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Content-Type", "Authorization"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Content-Type", "Authorization", jwt_token.APIKeyHeader},
 		AllowCredentials: true,
 	})
 
-	return corsHandler.Handler(r)
+	return corsHandler.Handler(r), nil
+}
+
+// allow оборачивает обработчик проверкой разрешения. Маршрут должен быть подключен к JWTMiddleware.
+func allow(permission string, handler http.HandlerFunc) http.Handler {
+	return jwt_token.PermissionMiddleware(permission)(handler)
+}
+
+// allowSession как allow, но маршрут недоступен по API-ключу. Так подключаются маршруты,
+// которые меняют учетные данные и права: утекший ключ не должен позволять захватить учетные записи.
+func allowSession(permission string, handler http.HandlerFunc) http.Handler {
+	return jwt_token.SessionOnlyMiddleware(allow(permission, handler))
+}
+
+// newPasswordPolicy собирает политику паролей из конфигурации. Если файл со списком
+// запрещенных паролей не читается, используется только встроенный список.
+func newPasswordPolicy(cfg config.Config, log logger.Logger) *passwords.Policy {
+	var blocklist []string
+	if cfg.PasswordBlocklistFile != "" {
+		var err error
+		blocklist, err = passwords.LoadBlocklist(cfg.PasswordBlocklistFile)
+		if err != nil {
+			log.Error("Список запрещенных паролей не загружен: ", err)
+		}
+	}
+	return passwords.NewPolicy(cfg.PasswordMinLength, cfg.PasswordMinClasses, time.Duration(cfg.PasswordMaxAgeDays)*24*time.Hour, blocklist)
+}
+
+// newLDAPAuthenticator собирает вход через LDAP-каталог из конфигурации
+func newLDAPAuthenticator(ctx context.Context, cfg config.Config, db *pgxpool.Pool) (*auth.LDAPAuthenticator, error) {
+	groupRoles, err := directory.ParseGroupRoles(cfg.LDAPGroupRoles)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := directory.New(directory.Config{
+		URL:               cfg.LDAPURL,
+		BindDN:            cfg.LDAPBindDN,
+		BindPassword:      cfg.LDAPBindPassword,
+		BaseDN:            cfg.LDAPBaseDN,
+		UserFilter:        cfg.LDAPUserFilter,
+		UsernameAttribute: cfg.LDAPUsernameAttribute,
+		EmailAttribute:    cfg.LDAPEmailAttribute,
+		NameAttribute:     cfg.LDAPNameAttribute,
+		GroupAttribute:    cfg.LDAPGroupAttribute,
+		GroupRoles:        groupRoles,
+		DefaultRole:       cfg.LDAPDefaultRole,
+		StartTLS:          cfg.LDAPStartTLS,
+		AllowInsecure:     cfg.LDAPAllowInsecure,
+	})
+	if err != nil {
+		return nil, err
+	}
+	ldapAuth := auth.NewLDAPAuthenticator(dir, db)
+	if err := ldapAuth.CheckRoles(ctx); err != nil {
+		return nil, err
+	}
+	return ldapAuth, nil
 }
 
 // Регистрация маршрутов для аутентификации
-func registerAuthRoutes(r *mux.Router, log logger.Logger) {
+func registerAuthRoutes(ctx context.Context, r *mux.Router, db *pgxpool.Pool, cfg config.Config, policy *passwords.Policy, tokenStore *tokens.Store, log logger.Logger) error {
+	if cfg.LDAPURL != "" {
+		// Сервер без настроенного каталога не пустил бы пользователей каталога, поэтому не запускается
+		ldapAuth, err := newLDAPAuthenticator(ctx, cfg, db)
+		if err != nil {
+			return fmt.Errorf("вход через LDAP не настроен: %w", err)
+		}
+		auth.AuthServiceInstance().SetAuthenticators(auth.LocalAuthenticator{}, ldapAuth)
+	}
+
+	lockouts := auth.NewLockoutService(db, auth.LockoutPolicy{
+		MaxUserFailures: cfg.LoginMaxFailures,
+		MaxIPFailures:   cfg.LoginMaxFailuresPerIP,
+		Window:          cfg.LoginFailureWindow,
+		LockDuration:    cfg.LoginLockDuration,
+	}, log)
+	go lockouts.StartCleanup(ctx, time.Hour)
+	go auth.AuthServiceInstance().CleanupRevokedTokens(ctx, time.Hour, log)
+	go tokenStore.StartCleanup(ctx, time.Hour, log)
+	mfa := auth.NewMFAService(db, cfg.MFAIssuer, cfg.MFARequiredRoles)
+	go mfa.StartCleanup(ctx, time.Hour, log)
+
+	auth.SetPasswordPolicy(policy)
+	jwt_token.SetPasswordMaxAge(policy.MaxAge)
+	auth.SetLockoutService(lockouts)
+	auth.SetTokenStore(tokenStore)
+	auth.SetMFAService(mfa)
 	r.HandleFunc("/auth/login", auth.LoginHandler).Methods("POST")
+	r.HandleFunc("/auth/mfa/setup", auth.MFALoginSetupHandler).Methods("POST")
+	r.HandleFunc("/auth/mfa/verify", auth.MFAVerifyHandler).Methods("POST")
+	r.HandleFunc("/auth/refresh", auth.RefreshHandler).Methods("POST")
 	r.HandleFunc("/auth/logout", auth.LogoutHandler).Methods("POST")
 
+	// Второй фактор настраивает сам пользователь с любой ролью
+	meRouter := r.PathPrefix("/user").Subrouter()
+	meRouter.Use(jwt_token.JWTMiddleware)
+	meRouter.Use(jwt_token.SessionOnlyMiddleware)
+	meRouter.HandleFunc("/mfa", auth.MFAStatusHandler).Methods("GET")
+	meRouter.HandleFunc("/mfa/setup", auth.MFASetupHandler).Methods("POST")
+	meRouter.HandleFunc("/mfa/enable", auth.MFAEnableHandler).Methods("POST")
+	meRouter.HandleFunc("/mfa/disable", auth.MFADisableHandler).Methods("POST")
+	meRouter.HandleFunc("/mfa/recovery-codes", auth.MFARecoveryCodesHandler).Methods("POST")
+
 	adminRouter := r.PathPrefix("/admin").Subrouter()
 	adminRouter.Use(jwt_token.JWTMiddleware)
-	adminRouter.Use(jwt_token.RoleMiddleware("admin"))
-	adminRouter.HandleFunc("/logs/list", handlers.ListLogsHandler).Methods("GET")
-	adminRouter.HandleFunc("/logs/{filename}", handlers.LogsHandler).Methods("GET")
+	adminRouter.Handle("/auth/lockouts", allow(models.PermSecurityManage, auth.ListLockoutsHandler)).Methods("GET")
+	adminRouter.Handle("/auth/unlock", allowSession(models.PermSecurityManage, auth.UnlockHandler)).Methods("POST")
+	adminRouter.Handle("/auth/mfa/reset/{id}", allowSession(models.PermSecurityManage, auth.MFAResetHandler)).Methods("DELETE")
+	adminRouter.Handle("/logs/list", allow(models.PermLogsRead, handlers.ListLogsHandler)).Methods("GET")
+	adminRouter.Handle("/logs/{filename}", allow(models.PermLogsRead, handlers.LogsHandler)).Methods("GET")
+	return nil
 }
 
 // Регистрация маршрутов для задач
-func registerTaskRoutes(r *mux.Router, db *pgxpool.Pool, log logger.Logger) {
-	taskService := tasks.NewTaskService(db)
+func registerTaskRoutes(r *mux.Router, db *pgxpool.Pool, mailer *notify.TaskMailer, bus *eventbus.Bus, log logger.Logger) {
+	taskService := tasks.NewTaskService(db, mailer, bus)
 	taskHandler := tasks.NewTaskHandler(taskService, log)
+	responseService := tasks.NewResponseService(db, file.NewFileService("./uploads", db), bus)
+	responseHandler := tasks.NewResponseHandler(responseService, log)
 
 	adminRouter := r.PathPrefix("/admin").Subrouter()
 	adminRouter.Use(jwt_token.JWTMiddleware)
-	adminRouter.Use(jwt_token.RoleMiddleware("admin"))
-	adminRouter.HandleFunc("/tasks/create", taskHandler.CreateTaskHandler).Methods("POST") //1
-	adminRouter.HandleFunc("/tasks/update/{id}", taskHandler.UpdateTaskHandler).Methods("PUT")
-	adminRouter.HandleFunc("/tasks/update/{id}", taskHandler.PatchTaskHandler).Methods("PATCH")
-	adminRouter.HandleFunc("/tasks/delete/{id}", taskHandler.DeleteTaskHandler).Methods("DELETE")
+	adminRouter.Handle("/tasks/create", allow(models.PermTasksCreate, taskHandler.CreateTaskHandler)).Methods("POST") //1
+	adminRouter.Handle("/tasks/update/{id}", allow(models.PermTasksUpdate, taskHandler.UpdateTaskHandler)).Methods("PUT")
+	adminRouter.Handle("/tasks/update/{id}", allow(models.PermTasksUpdate, taskHandler.PatchTaskHandler)).Methods("PATCH")
+	adminRouter.Handle("/tasks/delete/{id}", allow(models.PermTasksDelete, taskHandler.DeleteTaskHandler)).Methods("DELETE")
+	adminRouter.Handle("/tasks/list", allow(models.PermTasksRead, taskHandler.ListTasksHandler)).Methods("GET")
+	adminRouter.Handle("/tasks/get/{id}", allow(models.PermTasksRead, taskHandler.GetTaskHandler)).Methods("GET")
+	adminRouter.Handle("/tasks/responses/{id}", allow(models.PermTasksRead, responseHandler.GetTaskResponsesHandler)).Methods("GET")
+	adminRouter.Handle("/tasks/responses/review/{id}", allow(models.PermTasksReview, responseHandler.ReviewResponseHandler)).Methods("POST")
 
 	userRouter := r.PathPrefix("/user").Subrouter()
 	userRouter.Use(jwt_token.JWTMiddleware)
-	userRouter.Use(jwt_token.RoleMiddleware("users"))
-	userRouter.HandleFunc("/tasks/all/get", taskHandler.GetUserTasksHandler).Methods("GET")
-	userRouter.HandleFunc("/tasks/get/{id}", taskHandler.GetTasksHandler).Methods("GET")
+	userRouter.Handle("/tasks/all/get", allow(models.PermTasksExecute, taskHandler.GetUserTasksHandler)).Methods("GET")
+	userRouter.Handle("/tasks/get/{id}", allow(models.PermTasksExecute, taskHandler.GetTaskHandler)).Methods("GET")
+	userRouter.Handle("/tasks/status/{id}", allow(models.PermTasksExecute, taskHandler.UpdateTaskStatusHandler)).Methods("PATCH")
+	userRouter.Handle("/tasks/responses/{id}", allow(models.PermTasksExecute, responseHandler.CreateResponseHandler)).Methods("POST")
+	// Доступ к файлу ответа проверяет сервис: автор задачи, проверяющий или исполнитель
+	userRouter.HandleFunc("/tasks/responses/{id}/files/{file_id}", responseHandler.ResponseFileHandler).Methods("GET")
 }
 
 // Регистрация маршрутов для пользователей
-func registerUserRoutes(r *mux.Router, db *pgxpool.Pool, log logger.Logger) {
-	usersService := users.NewUsersService(db)
+func registerUserRoutes(r *mux.Router, db *pgxpool.Pool, bus *eventbus.Bus, policy *passwords.Policy, tokenStore *tokens.Store, log logger.Logger) {
+	usersService := users.NewUsersService(db, bus, policy, tokenStore)
 	usersHandler := users.NewUsersHandler(usersService, log)
 
 	adminRouter := r.PathPrefix("/admin").Subrouter()
 	adminRouter.Use(jwt_token.JWTMiddleware)
-	adminRouter.Use(jwt_token.RoleMiddleware("admin"))
-	adminRouter.HandleFunc("/users_list", usersHandler.UsersSelectHandler).Methods("GET")
-	adminRouter.HandleFunc("/users/add", usersHandler.AddUserHandler).Methods("POST")
-	adminRouter.HandleFunc("/users/delete/{id}", usersHandler.DeleteUserHandler).Methods("DELETE")
-	adminRouter.HandleFunc("/users/update/{id}", usersHandler.UpdateUserHandler).Methods("PATCH")
+	adminRouter.Handle("/users_list", allow(models.PermUsersRead, usersHandler.UsersSelectHandler)).Methods("GET")
+	adminRouter.Handle("/users/add", allowSession(models.PermUsersManage, usersHandler.AddUserHandler)).Methods("POST")
+	adminRouter.Handle("/users/delete/{id}", allowSession(models.PermUsersManage, usersHandler.DeleteUserHandler)).Methods("DELETE")
+	adminRouter.Handle("/users/update/{id}", allowSession(models.PermUsersManage, usersHandler.UpdateUserHandler)).Methods("PATCH")
+	adminRouter.Handle("/users/get/{id}", allow(models.PermUsersRead, usersHandler.GetUserHandler)).Methods("GET")
+	adminRouter.Handle("/users/directory", allow(models.PermUsersRead, usersHandler.DirectoryHandler)).Methods("GET")
+
+	// Профиль доступен пользователю с любой ролью
+	meRouter := r.PathPrefix("/user").Subrouter()
+	meRouter.Use(jwt_token.JWTMiddleware)
+	meRouter.Use(jwt_token.SessionOnlyMiddleware)
+	meRouter.HandleFunc("/me", usersHandler.MeHandler).Methods("GET")
+	meRouter.HandleFunc("/me", usersHandler.UpdateMeHandler).Methods("PATCH")
+	meRouter.HandleFunc("/password", usersHandler.ChangePasswordHandler).Methods("POST")
+	// Пока пароль не сменен, доступна только его смена; выход не требует токена доступа
+	jwt_token.AllowWithPasswordChangeRequired("/user/password")
+}
+
+// Регистрация маршрутов для просмотра и завершения сессий
+func registerSessionRoutes(r *mux.Router, db *pgxpool.Pool, tokenStore *tokens.Store, log logger.Logger) {
+	sessionService := sessions.NewSessionService(db, tokenStore)
+	sessionHandler := sessions.NewSessionHandler(sessionService, log)
+
+	adminRouter := r.PathPrefix("/admin").Subrouter()
+	adminRouter.Use(jwt_token.JWTMiddleware)
+	adminRouter.Handle("/sessions/list", allow(models.PermSecurityManage, sessionHandler.ListSessionsHandler)).Methods("GET")
+	adminRouter.Handle("/sessions/revoke/{id}", allowSession(models.PermSecurityManage, sessionHandler.RevokeSessionHandler)).Methods("DELETE")
+	adminRouter.Handle("/sessions/revoke-user/{id}", allowSession(models.PermSecurityManage, sessionHandler.RevokeUserSessionsHandler)).Methods("DELETE")
+
+	// Свои сессии доступны пользователям с любой ролью
+	sessionsRouter := r.PathPrefix("/sessions").Subrouter()
+	sessionsRouter.Use(jwt_token.JWTMiddleware)
+	sessionsRouter.Use(jwt_token.SessionOnlyMiddleware)
+	sessionsRouter.HandleFunc("", sessionHandler.MySessionsHandler).Methods("GET")
+	sessionsRouter.HandleFunc("/revoke-others", sessionHandler.RevokeOtherSessionsHandler).Methods("POST")
+	sessionsRouter.HandleFunc("/{id}", sessionHandler.RevokeMySessionHandler).Methods("DELETE")
+}
+
+// Регистрация маршрутов для управления ролями и разрешениями
+func registerRoleRoutes(r *mux.Router, db *pgxpool.Pool, log logger.Logger) {
+	roleService := roles.NewRoleService(db)
+	roleHandler := roles.NewRoleHandler(roleService, log)
+
+	adminRouter := r.PathPrefix("/admin").Subrouter()
+	adminRouter.Use(jwt_token.JWTMiddleware)
+	adminRouter.Handle("/roles/list", allow(models.PermRolesManage, roleHandler.ListRolesHandler)).Methods("GET")
+	adminRouter.Handle("/roles/permissions", allow(models.PermRolesManage, roleHandler.ListPermissionsHandler)).Methods("GET")
+	adminRouter.Handle("/roles/create", allowSession(models.PermRolesManage, roleHandler.CreateRoleHandler)).Methods("POST")
+	adminRouter.Handle("/roles/update/{name}", allowSession(models.PermRolesManage, roleHandler.UpdateRoleHandler)).Methods("PATCH")
+	adminRouter.Handle("/roles/delete/{name}", allowSession(models.PermRolesManage, roleHandler.DeleteRoleHandler)).Methods("DELETE")
+}
+
+// Регистрация маршрутов для API-ключей интеграций. Выпускать и отзывать ключи можно
+// только из сессии пользователя, иначе утекший ключ позволял бы выпускать новые.
+func registerAPIKeyRoutes(r *mux.Router, db *pgxpool.Pool, log logger.Logger) {
+	apiKeyService := apikeys.NewAPIKeyService(db)
+	apiKeyHandler := apikeys.NewAPIKeyHandler(apiKeyService, log)
+
+	adminRouter := r.PathPrefix("/admin").Subrouter()
+	adminRouter.Use(jwt_token.JWTMiddleware)
+	adminRouter.Use(jwt_token.SessionOnlyMiddleware)
+	adminRouter.Handle("/api-keys/list", allow(models.PermSecurityManage, apiKeyHandler.ListAPIKeysHandler)).Methods("GET")
+	adminRouter.Handle("/api-keys/create", allow(models.PermSecurityManage, apiKeyHandler.CreateAPIKeyHandler)).Methods("POST")
+	adminRouter.Handle("/api-keys/revoke/{id}", allow(models.PermSecurityManage, apiKeyHandler.RevokeAPIKeyHandler)).Methods("DELETE")
+}
+
+// Регистрация маршрутов для групп пользователей
+func registerGroupRoutes(r *mux.Router, db *pgxpool.Pool, log logger.Logger) {
+	groupService := groups.NewGroupService(db)
+	groupHandler := groups.NewGroupHandler(groupService, log)
+
+	adminRouter := r.PathPrefix("/admin").Subrouter()
+	adminRouter.Use(jwt_token.JWTMiddleware)
+	adminRouter.Handle("/groups/create", allow(models.PermGroupsManage, groupHandler.CreateGroupHandler)).Methods("POST")
+	adminRouter.Handle("/groups/list", allow(models.PermGroupsManage, groupHandler.ListGroupsHandler)).Methods("GET")
+	adminRouter.Handle("/groups/get/{id}", allow(models.PermGroupsManage, groupHandler.GetGroupHandler)).Methods("GET")
+	adminRouter.Handle("/groups/update/{id}", allow(models.PermGroupsManage, groupHandler.UpdateGroupHandler)).Methods("PATCH")
+	adminRouter.Handle("/groups/delete/{id}", allow(models.PermGroupsManage, groupHandler.DeleteGroupHandler)).Methods("DELETE")
+	adminRouter.Handle("/groups/members/add/{id}", allow(models.PermGroupsManage, groupHandler.AddMembersHandler)).Methods("POST")
+	adminRouter.Handle("/groups/members/remove/{id}", allow(models.PermGroupsManage, groupHandler.RemoveMembersHandler)).Methods("POST")
+}
+
+func registerOrganizationRoutes(r *mux.Router, db *pgxpool.Pool, log logger.Logger) {
+	organizationService := organizations.NewOrganizationService(db)
+	organizationHandler := organizations.NewOrganizationHandler(organizationService, log)
+
+	adminRouter := r.PathPrefix("/admin").Subrouter()
+	adminRouter.Use(jwt_token.JWTMiddleware)
+	adminRouter.Handle("/organizations/create", allow(models.PermOrganizationsManage, organizationHandler.CreateOrganizationHandler)).Methods("POST")
+	adminRouter.Handle("/organizations/list", allow(models.PermOrganizationsManage, organizationHandler.ListOrganizationsHandler)).Methods("GET")
+	adminRouter.Handle("/organizations/get/{id}", allow(models.PermOrganizationsManage, organizationHandler.GetOrganizationHandler)).Methods("GET")
+	adminRouter.Handle("/organizations/update/{id}", allow(models.PermOrganizationsManage, organizationHandler.UpdateOrganizationHandler)).Methods("PATCH")
+	adminRouter.Handle("/organizations/delete/{id}", allow(models.PermOrganizationsManage, organizationHandler.DeleteOrganizationHandler)).Methods("DELETE")
+	adminRouter.Handle("/organizations/members/add/{id}", allow(models.PermOrganizationsManage, organizationHandler.AddMembersHandler)).Methods("POST")
+	adminRouter.Handle("/organizations/members/remove/{id}", allow(models.PermOrganizationsManage, organizationHandler.RemoveMembersHandler)).Methods("POST")
+
+	// Свою организацию видит пользователь с любой ролью
+	userRouter := r.PathPrefix("/user").Subrouter()
+	userRouter.Use(jwt_token.JWTMiddleware)
+	userRouter.Use(jwt_token.SessionOnlyMiddleware)
+	userRouter.HandleFunc("/organization", organizationHandler.MyOrganizationHandler).Methods("GET")
 }
 
 func registerFIleRoutes(r *mux.Router, db *pgxpool.Pool, log logger.Logger) {
@@ -98,11 +336,81 @@ func registerFIleRoutes(r *mux.Router, db *pgxpool.Pool, log logger.Logger) {
 
 	fileRouter := r.PathPrefix("/admin").Subrouter()
 	fileRouter.Use(jwt_token.JWTMiddleware)
-	fileRouter.Use(jwt_token.RoleMiddleware("admin"))
-	fileRouter.HandleFunc("/files/upload", fileHandler.UploadFileHandler).Methods("POST")
+	fileRouter.Handle("/files/upload", allow(models.PermFilesUpload, fileHandler.UploadFileHandler)).Methods("POST")
 
 	userFilesRouter := r.PathPrefix("/users").Subrouter()
 	userFilesRouter.Use(jwt_token.JWTMiddleware)
+	userFilesRouter.Use(jwt_token.SessionOnlyMiddleware)
 	userFilesRouter.HandleFunc("/files/{filename}", fileHandler.DownloadFileHandler).Methods("GET")
 
 }
+
+// Регистрация маршрутов для уведомлений
+func registerNotificationRoutes(r *mux.Router, db *pgxpool.Pool, bus *eventbus.Bus, log logger.Logger) {
+	notificationService := notifications.NewNotificationService(db)
+	notificationHandler := notifications.NewNotificationHandler(notificationService, bus, log)
+
+	// Все события шины сохраняются во входящих уведомлениях адресатов. Обработчик вызывается
+	// из шины без контекста запроса, поэтому использует собственный таймаут.
+	bus.AddHandler(func(e eventbus.Event) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := notificationService.Record(ctx, e); err != nil {
+			log.Error(err)
+		}
+	})
+
+	// Поток событий доступен всем авторизованным пользователям
+	eventsRouter := r.PathPrefix("/events").Subrouter()
+	eventsRouter.Use(jwt_token.StreamTicketMiddleware)
+	eventsRouter.Use(jwt_token.SessionOnlyMiddleware)
+	eventsRouter.HandleFunc("", notificationHandler.EventsHandler).Methods("GET")
+
+	// Уведомления личные и доступны пользователю с любой ролью
+	userRouter := r.PathPrefix("/user").Subrouter()
+	userRouter.Use(jwt_token.JWTMiddleware)
+	userRouter.Use(jwt_token.SessionOnlyMiddleware)
+	userRouter.HandleFunc("/notifications", notificationHandler.ListNotificationsHandler).Methods("GET")
+	userRouter.HandleFunc("/notifications/unread_count", notificationHandler.UnreadCountHandler).Methods("GET")
+	userRouter.HandleFunc("/notifications/read/{id}", notificationHandler.MarkReadHandler).Methods("POST")
+	userRouter.HandleFunc("/notifications/read_all", notificationHandler.MarkAllReadHandler).Methods("POST")
+	userRouter.HandleFunc("/events/ticket", notificationHandler.EventsTicketHandler).Methods("POST")
+}
+
+// Регистрация маршрутов для личных сообщений
+func registerMessageRoutes(r *mux.Router, db *pgxpool.Pool, bus *eventbus.Bus, log logger.Logger) {
+	messageService := messages.NewMessageService(db, file.NewFileService("./uploads", db), bus)
+	messageHandler := messages.NewMessageHandler(messageService, log)
+
+	// Переписка доступна всем авторизованным пользователям независимо от роли
+	messagesRouter := r.PathPrefix("/messages").Subrouter()
+	messagesRouter.Use(jwt_token.JWTMiddleware)
+	messagesRouter.Use(jwt_token.SessionOnlyMiddleware)
+	messagesRouter.HandleFunc("/send", messageHandler.SendMessageHandler).Methods("POST")
+	messagesRouter.HandleFunc("/inbox", messageHandler.InboxHandler).Methods("GET")
+	messagesRouter.HandleFunc("/sent", messageHandler.SentHandler).Methods("GET")
+	messagesRouter.HandleFunc("/get/{id}", messageHandler.GetMessageHandler).Methods("GET")
+	messagesRouter.HandleFunc("/thread/{id}", messageHandler.ThreadHandler).Methods("GET")
+	messagesRouter.HandleFunc("/attachments/{id}/{attachment_id}", messageHandler.AttachmentHandler).Methods("GET")
+}
+
+// Регистрация маршрутов для объявлений
+func registerAnnouncementRoutes(r *mux.Router, db *pgxpool.Pool, bus *eventbus.Bus, log logger.Logger) {
+	announcementService := announcements.NewAnnouncementService(db, bus)
+	announcementHandler := announcements.NewAnnouncementHandler(announcementService, log)
+
+	adminRouter := r.PathPrefix("/admin").Subrouter()
+	adminRouter.Use(jwt_token.JWTMiddleware)
+	adminRouter.Handle("/announcements/create", allow(models.PermAnnouncementsManage, announcementHandler.CreateAnnouncementHandler)).Methods("POST")
+	adminRouter.Handle("/announcements/list", allow(models.PermAnnouncementsManage, announcementHandler.ListAnnouncementsHandler)).Methods("GET")
+	adminRouter.Handle("/announcements/report/{id}", allow(models.PermAnnouncementsManage, announcementHandler.AnnouncementReportHandler)).Methods("GET")
+	adminRouter.Handle("/announcements/delete/{id}", allow(models.PermAnnouncementsManage, announcementHandler.DeleteAnnouncementHandler)).Methods("DELETE")
+
+	// Объявление может быть адресовано любой роли, поэтому чтение доступно всем авторизованным
+	announcementsRouter := r.PathPrefix("/announcements").Subrouter()
+	announcementsRouter.Use(jwt_token.JWTMiddleware)
+	announcementsRouter.Use(jwt_token.SessionOnlyMiddleware)
+	announcementsRouter.HandleFunc("", announcementHandler.MyAnnouncementsHandler).Methods("GET")
+	announcementsRouter.HandleFunc("/get/{id}", announcementHandler.GetAnnouncementHandler).Methods("GET")
+	announcementsRouter.HandleFunc("/ack/{id}", announcementHandler.AcknowledgeHandler).Methods("POST")
+}
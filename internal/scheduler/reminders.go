@@ -0,0 +1,185 @@
+package scheduler
+
+import (
+	"ROOmail/internal/notify"
+	"ROOmail/pkg/logger"
+	"fmt"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"golang.org/x/net/context"
+	"time"
+)
+
+const reminderKindOverdue = "overdue"
+
+// ReminderScheduler периодически ищет невыполненные задачи с подходящим или
+// просроченным сроком и рассылает напоминания исполнителям.
+type ReminderScheduler struct {
+	db         *pgxpool.Pool
+	notifiers  []notify.Notifier
+	daysBefore []int
+	interval   time.Duration
+	log        logger.Logger
+}
+
+// dueAssignment - назначение, по которому пора напомнить
+type dueAssignment struct {
+	taskID   int
+	userID   int
+	email    string
+	title    string
+	dueDate  time.Time
+	daysLeft int
+}
+
+func NewReminderScheduler(db *pgxpool.Pool, notifiers []notify.Notifier, daysBefore []int, interval time.Duration, log logger.Logger) *ReminderScheduler {
+	return &ReminderScheduler{
+		db:         db,
+		notifiers:  notifiers,
+		daysBefore: daysBefore,
+		interval:   interval,
+		log:        log,
+	}
+}
+
+// Start выполняет проверку сразу и затем с заданным интервалом, пока не отменен контекст
+func (s *ReminderScheduler) Start(ctx context.Context) {
+	s.log.Infof("Планировщик напоминаний запущен, интервал: %s, дни до срока: %v", s.interval, s.daysBefore)
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.RunOnce(ctx); err != nil {
+			s.log.Error("Ошибка рассылки напоминаний: ", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			s.log.Info("Планировщик напоминаний остановлен")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce рассылает все напоминания, которые еще не были отправлены
+func (s *ReminderScheduler) RunOnce(ctx context.Context) error {
+	assignments, err := s.findDueAssignments(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, a := range assignments {
+		kind := reminderKind(a.daysLeft)
+		n := buildReminder(a, kind)
+		for _, notifier := range s.notifiers {
+			if err := s.deliver(ctx, notifier, a, kind, n); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *ReminderScheduler) findDueAssignments(ctx context.Context) ([]dueAssignment, error) {
+	query := `
+		SELECT a.task_id, a.user_id, COALESCE(u.email, ''), t.title, t.due_date, t.due_date - CURRENT_DATE
+		FROM (
+			SELECT tu.task_id, tu.user_id
+			FROM tasks_users tu
+			WHERE tu.status <> 'done'
+			UNION
+			-- Сотрудникам организации и вложенных в нее напоминаем, если задача организации не выполнена
+			-- и у них нет личного назначения на эту же задачу. Из нескольких назначенных организаций
+			-- учитывается ближайшая к сотруднику.
+			SELECT o.task_id, o.user_id
+			FROM (
+				SELECT DISTINCT ON (tor.task_id, ou.id) tor.task_id, ou.id AS user_id, tor.status
+				FROM tasks_organizations tor
+				JOIN organization_tree ot ON ot.root_id = tor.organization_id
+				JOIN users ou ON ou.organization_id = ot.organization_id
+				WHERE NOT EXISTS (SELECT 1 FROM tasks_users tu WHERE tu.task_id = tor.task_id AND tu.user_id = ou.id)
+				ORDER BY tor.task_id, ou.id, ot.depth
+			) o
+			WHERE o.status <> 'done'
+		) a
+		JOIN tasks t ON t.id = a.task_id
+		JOIN users u ON u.id = a.user_id
+		WHERE t.due_date IS NOT NULL
+		  AND (t.due_date < CURRENT_DATE OR t.due_date - CURRENT_DATE = ANY($1))
+	`
+	rows, err := s.db.Query(ctx, query, s.daysBefore)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось получить задачи для напоминаний: %w", err)
+	}
+	defer rows.Close()
+
+	var result []dueAssignment
+	for rows.Next() {
+		var a dueAssignment
+		if err := rows.Scan(&a.taskID, &a.userID, &a.email, &a.title, &a.dueDate, &a.daysLeft); err != nil {
+			return nil, fmt.Errorf("не удалось прочитать задачу для напоминания: %w", err)
+		}
+		result = append(result, a)
+	}
+	return result, rows.Err()
+}
+
+// deliver отправляет напоминание через один канал. Отметка ведется по каналу и сроку задачи:
+// сбой одного канала не мешает повторить только его, а перенос срока дает новое напоминание.
+// Очередь писем здесь не используется: отметку можно оставить только после фактической отправки.
+func (s *ReminderScheduler) deliver(ctx context.Context, notifier notify.Notifier, a dueAssignment, kind string, n notify.Notification) error {
+	channel := notifier.Name()
+
+	// Сначала фиксируем напоминание: если запись уже есть, пользователь его получал
+	tag, err := s.db.Exec(ctx, `INSERT INTO task_reminders (task_id, user_id, kind, due_date, channel) VALUES ($1, $2, $3, $4, $5) ON CONFLICT DO NOTHING`,
+		a.taskID, a.userID, kind, a.dueDate, channel)
+	if err != nil {
+		return fmt.Errorf("не удалось сохранить напоминание: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return nil
+	}
+
+	if err := notify.Deliver(ctx, notifier, n); err != nil {
+		s.log.Error("Не удалось отправить напоминание через ", channel, ": ", err)
+		// Снимаем отметку канала, чтобы повторить в следующий раз
+		if _, err := s.db.Exec(ctx, `DELETE FROM task_reminders WHERE task_id = $1 AND user_id = $2 AND kind = $3 AND due_date = $4 AND channel = $5`,
+			a.taskID, a.userID, kind, a.dueDate, channel); err != nil {
+			return fmt.Errorf("не удалось снять отметку о напоминании: %w", err)
+		}
+	}
+	return nil
+}
+
+func reminderKind(daysLeft int) string {
+	if daysLeft < 0 {
+		return reminderKindOverdue
+	}
+	return fmt.Sprintf("due_in_%d", daysLeft)
+}
+
+func buildReminder(a dueAssignment, kind string) notify.Notification {
+	n := notify.Notification{
+		UserID:    a.userID,
+		Email:     a.email,
+		Kind:      "task_reminder",
+		TaskID:    a.taskID,
+		CreatedAt: time.Now(),
+	}
+
+	dueDate := a.dueDate.Format("02.01.2006")
+	switch {
+	case kind == reminderKindOverdue:
+		n.Subject = fmt.Sprintf("Просрочена задача «%s»", a.title)
+		n.Body = fmt.Sprintf("Срок выполнения задачи «%s» истек %s. Пожалуйста, выполните задачу и отправьте ответ.", a.title, dueDate)
+	case a.daysLeft == 0:
+		n.Subject = fmt.Sprintf("Сегодня срок задачи «%s»", a.title)
+		n.Body = fmt.Sprintf("Сегодня, %s, истекает срок выполнения задачи «%s».", dueDate, a.title)
+	default:
+		n.Subject = fmt.Sprintf("Срок задачи «%s» через %d дн.", a.title, a.daysLeft)
+		n.Body = fmt.Sprintf("Срок выполнения задачи «%s» истекает %s (через %d дн.).", a.title, dueDate, a.daysLeft)
+	}
+	return n
+}
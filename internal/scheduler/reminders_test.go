@@ -0,0 +1,109 @@
+package scheduler_test
+
+import (
+	"ROOmail/internal/notify"
+	"ROOmail/internal/scheduler"
+	"ROOmail/pkg/logger"
+	"ROOmail/pkg/testdb"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeNotifier запоминает отправленные напоминания и отказывает заданное число раз
+type fakeNotifier struct {
+	name  string
+	fails int
+	sent  []notify.Notification
+}
+
+func (f *fakeNotifier) Name() string {
+	return f.name
+}
+
+func (f *fakeNotifier) Notify(ctx context.Context, n notify.Notification) error {
+	if f.fails > 0 {
+		f.fails--
+		return errors.New("канал недоступен")
+	}
+	f.sent = append(f.sent, n)
+	return nil
+}
+
+func TestRunOnceRetriesFailedChannel(t *testing.T) {
+	pool := testdb.New(t)
+	ctx := context.Background()
+	userID := testdb.CreateUser(t, pool, "worker", "users")
+
+	var taskID int
+	require.NoError(t, pool.QueryRow(ctx, `INSERT INTO tasks (title, description, due_date) VALUES ('Отчет', 'Описание', CURRENT_DATE + 1) RETURNING id`).Scan(&taskID))
+	_, err := pool.Exec(ctx, `INSERT INTO tasks_users (task_id, user_id) VALUES ($1, $2)`, taskID, userID)
+	require.NoError(t, err)
+
+	inApp := &fakeNotifier{name: "in_app"}
+	email := &fakeNotifier{name: "email", fails: 1}
+	s := scheduler.NewReminderScheduler(pool, []notify.Notifier{inApp, email}, []int{1, 3}, time.Hour, logger.NewZapLogger())
+
+	// Первый проход: почта не отправлена, повторяется только она
+	require.NoError(t, s.RunOnce(ctx))
+	assert.Len(t, inApp.sent, 1)
+	assert.Empty(t, email.sent)
+
+	require.NoError(t, s.RunOnce(ctx))
+	assert.Len(t, inApp.sent, 1)
+	assert.Len(t, email.sent, 1)
+
+	require.NoError(t, s.RunOnce(ctx))
+	assert.Len(t, inApp.sent, 1)
+	assert.Len(t, email.sent, 1)
+
+	// Просроченная задача: перенос срока дает новое напоминание того же вида,
+	// повторный проход с тем же сроком - нет
+	for i, due := range []string{"CURRENT_DATE - 1", "CURRENT_DATE - 1", "CURRENT_DATE - 2"} {
+		_, err = pool.Exec(ctx, `UPDATE tasks SET due_date = `+due+` WHERE id = $1`, taskID)
+		require.NoError(t, err)
+		require.NoError(t, s.RunOnce(ctx))
+		want := []int{2, 2, 3}[i]
+		assert.Len(t, inApp.sent, want)
+		assert.Len(t, email.sent, want)
+	}
+}
+
+func TestRunOnceRetriesQueuedChannel(t *testing.T) {
+	pool := testdb.New(t)
+	ctx := context.Background()
+	userID := testdb.CreateUser(t, pool, "worker", "users")
+
+	var taskID int
+	require.NoError(t, pool.QueryRow(ctx, `INSERT INTO tasks (title, description, due_date) VALUES ('Отчет', 'Описание', CURRENT_DATE + 1) RETURNING id`).Scan(&taskID))
+	_, err := pool.Exec(ctx, `INSERT INTO tasks_users (task_id, user_id) VALUES ($1, $2)`, taskID, userID)
+	require.NoError(t, err)
+
+	// Почта уходит через очередь, как в приложении; отправка письма один раз не удается
+	email := &fakeNotifier{name: "email", fails: 1}
+	queue := notify.NewQueue(email, 10, logger.NewZapLogger())
+	queueCtx, cancel := context.WithCancel(ctx)
+	queue.Start(queueCtx, 1)
+	t.Cleanup(func() {
+		cancel()
+		queue.Wait()
+	})
+	s := scheduler.NewReminderScheduler(pool, []notify.Notifier{queue}, []int{1}, time.Hour, logger.NewZapLogger())
+
+	require.NoError(t, s.RunOnce(ctx))
+	assert.Empty(t, email.sent)
+
+	// Неотправленное письмо не отмечено и уходит при следующем проходе
+	var count int
+	require.NoError(t, pool.QueryRow(ctx, `SELECT COUNT(*) FROM task_reminders WHERE task_id = $1`, taskID).Scan(&count))
+	assert.Zero(t, count)
+
+	require.NoError(t, s.RunOnce(ctx))
+	assert.Len(t, email.sent, 1)
+	require.NoError(t, s.RunOnce(ctx))
+	assert.Len(t, email.sent, 1)
+}
@@ -0,0 +1,283 @@
+package tokens
+
+import (
+	"ROOmail/internal/audience"
+	"ROOmail/internal/models"
+	"ROOmail/pkg/logger"
+	"ROOmail/pkg/utils/jwt_token"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"golang.org/x/net/context"
+	"time"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("Недействительный refresh-токен")
+	ErrRefreshTokenReused  = errors.New("Refresh-токен уже использован, сессия завершена")
+	ErrSessionNotFound     = errors.New("Сессия не найдена")
+)
+
+// Pair - токен доступа и refresh-токен для его продления
+type Pair struct {
+	AccessToken      string
+	RefreshToken     string
+	RefreshExpiresAt time.Time
+}
+
+// Store выдает и ротирует refresh-токены. В базе хранится только хеш токена.
+// Каждый вход открывает сессию; токены одной сессии образуют цепочку ротаций.
+type Store struct {
+	db  *pgxpool.Pool
+	ttl time.Duration
+}
+
+func NewStore(db *pgxpool.Pool, ttl time.Duration) *Store {
+	return &Store{db: db, ttl: ttl}
+}
+
+// Issue открывает сессию для нового входа и выдает для нее пару токенов
+func (s *Store) Issue(ctx context.Context, user *models.User, meta models.SessionMeta) (*Pair, error) {
+	sessionID, err := randomHex(16)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось создать сессию: %w", err)
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO sessions (id, user_id, ip, user_agent, expires_at)
+		VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, ''), NOW() + $5 * interval '1 second')
+	`, sessionID, user.ID, meta.IP, meta.UserAgent, s.ttl.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("не удалось создать сессию: %w", err)
+	}
+
+	pair, err := s.issue(ctx, tx, user, sessionID, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("Failed to commit session: %w", err)
+	}
+	return pair, nil
+}
+
+// Rotate обменивает refresh-токен на новую пару. Предъявленный токен становится использованным;
+// повторное предъявление использованного токена означает его утечку, и вся цепочка отзывается.
+func (s *Store) Rotate(ctx context.Context, refreshToken string) (*Pair, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var tokenID int
+	var familyID string
+	var expired, active, superseded bool
+	var usedAt, revokedAt *time.Time
+	var user models.User
+	err = tx.QueryRow(ctx, `
+		SELECT rt.id, rt.family_id, rt.expires_at <= NOW(), rt.used_at, COALESCE(rt.revoked_at, s.revoked_at),
+		       u.id, u.username, u.role, u.is_active, (s.created_at < u.password_changed_at) IS TRUE
+		FROM refresh_tokens rt
+		JOIN sessions s ON s.id = rt.family_id
+		JOIN users u ON u.id = rt.user_id
+		WHERE rt.token_hash = $1
+		FOR UPDATE OF rt, s
+	`, hashToken(refreshToken)).Scan(&tokenID, &familyID, &expired, &usedAt, &revokedAt,
+		&user.ID, &user.Username, &user.Role, &active, &superseded)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, fmt.Errorf("не удалось получить refresh-токен: %w", err)
+	}
+
+	// Сессия, открытая до смены пароля, не продлевается, даже если ее не успели отозвать
+	if revokedAt != nil || expired || !active || superseded {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	if usedAt != nil {
+		if err := revokeFamily(ctx, tx, familyID); err != nil {
+			return nil, err
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return nil, fmt.Errorf("Failed to commit token family revocation: %w", err)
+		}
+		return nil, ErrRefreshTokenReused
+	}
+
+	if _, err := tx.Exec(ctx, `UPDATE refresh_tokens SET used_at = NOW() WHERE id = $1`, tokenID); err != nil {
+		return nil, fmt.Errorf("не удалось отметить refresh-токен использованным: %w", err)
+	}
+
+	pair, err := s.issue(ctx, tx, &user, familyID, &tokenID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Сессия продлевается вместе с refresh-токеном
+	_, err = tx.Exec(ctx, `UPDATE sessions SET expires_at = $2, last_seen_at = NOW() WHERE id = $1`, familyID, pair.RefreshExpiresAt)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось продлить сессию: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("Failed to commit token rotation: %w", err)
+	}
+	return pair, nil
+}
+
+// Revoke завершает сессию, к которой относится refresh-токен. Неизвестный токен не является ошибкой.
+func (s *Store) Revoke(ctx context.Context, refreshToken string) error {
+	var familyID string
+	err := s.db.QueryRow(ctx, `SELECT family_id FROM refresh_tokens WHERE token_hash = $1`, hashToken(refreshToken)).Scan(&familyID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+		return fmt.Errorf("не удалось отозвать refresh-токен: %w", err)
+	}
+	return revokeFamily(ctx, s.db, familyID)
+}
+
+// RevokeSession завершает сессию: ее токены доступа и refresh-токены перестают приниматься.
+// Если userID не nil, сессия должна принадлежать этому пользователю.
+func (s *Store) RevokeSession(ctx context.Context, sessionID string, userID *int) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("Failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `
+		UPDATE sessions SET revoked_at = COALESCE(revoked_at, NOW())
+		WHERE id = $1 AND ($2::integer IS NULL OR user_id = $2)
+	`, sessionID, userID)
+	if err != nil {
+		return fmt.Errorf("не удалось завершить сессию: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrSessionNotFound
+	}
+
+	if err := revokeFamily(ctx, tx, sessionID); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("Failed to commit session revocation: %w", err)
+	}
+	return nil
+}
+
+// RevokeUser завершает все сессии пользователя, кроме exceptSessionID (пустая строка - без исключений)
+func (s *Store) RevokeUser(ctx context.Context, userID int, exceptSessionID string) error {
+	return s.RevokeUserTx(ctx, s.db, userID, exceptSessionID)
+}
+
+// RevokeUserTx завершает сессии пользователя в транзакции вызывающего, например вместе со сменой пароля
+func (s *Store) RevokeUserTx(ctx context.Context, q audience.Querier, userID int, exceptSessionID string) error {
+	_, err := q.Exec(ctx, `
+		WITH revoked AS (
+			UPDATE sessions SET revoked_at = NOW()
+			WHERE user_id = $1 AND revoked_at IS NULL AND id <> $2
+			RETURNING id
+		)
+		UPDATE refresh_tokens SET revoked_at = NOW()
+		WHERE revoked_at IS NULL AND family_id IN (SELECT id FROM revoked)
+	`, userID, exceptSessionID)
+	if err != nil {
+		return fmt.Errorf("не удалось завершить сессии пользователя %d: %w", userID, err)
+	}
+	return nil
+}
+
+// StartCleanup периодически удаляет истекшие refresh-токены, пока не отменен контекст
+func (s *Store) StartCleanup(ctx context.Context, interval time.Duration, log logger.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if _, err := s.db.Exec(ctx, `DELETE FROM refresh_tokens WHERE expires_at < NOW()`); err != nil {
+			log.Error("Не удалось удалить истекшие refresh-токены: ", err)
+		}
+		// Токены доступа живут меньше сессии, поэтому истекшая сессия больше не нужна для их проверки
+		if _, err := s.db.Exec(ctx, `DELETE FROM sessions WHERE expires_at < NOW()`); err != nil {
+			log.Error("Не удалось удалить истекшие сессии: ", err)
+		}
+	}
+}
+
+// issue создает токен доступа и refresh-токен в цепочке familyID
+func (s *Store) issue(ctx context.Context, q audience.Querier, user *models.User, familyID string, parentID *int) (*Pair, error) {
+	accessToken, err := jwt_token.GenerateJWT(user.ID, user.Username, user.Role, familyID)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось создать токен доступа: %w", err)
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, fmt.Errorf("не удалось создать refresh-токен: %w", err)
+	}
+	refreshToken := base64.RawURLEncoding.EncodeToString(raw)
+
+	pair := &Pair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+	}
+	err = q.QueryRow(ctx, `
+		INSERT INTO refresh_tokens (user_id, family_id, parent_id, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4, NOW() + $5 * interval '1 second')
+		RETURNING expires_at
+	`, user.ID, familyID, parentID, hashToken(refreshToken), s.ttl.Seconds()).Scan(&pair.RefreshExpiresAt)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось сохранить refresh-токен: %w", err)
+	}
+
+	return pair, nil
+}
+
+// revokeFamily завершает сессию и отзывает все refresh-токены ее цепочки
+func revokeFamily(ctx context.Context, q audience.Querier, familyID string) error {
+	_, err := q.Exec(ctx, `UPDATE sessions SET revoked_at = NOW() WHERE id = $1 AND revoked_at IS NULL`, familyID)
+	if err != nil {
+		return fmt.Errorf("не удалось завершить сессию: %w", err)
+	}
+	_, err = q.Exec(ctx, `UPDATE refresh_tokens SET revoked_at = NOW() WHERE family_id = $1 AND revoked_at IS NULL`, familyID)
+	if err != nil {
+		return fmt.Errorf("не удалось отозвать цепочку refresh-токенов: %w", err)
+	}
+	return nil
+}
+
+// hashToken возвращает SHA-256 токена. Токен случайный и длинный, поэтому соль не нужна.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,104 @@
+package tokens_test
+
+import (
+	"ROOmail/internal/models"
+	"ROOmail/internal/tokens"
+	"ROOmail/pkg/testdb"
+	"ROOmail/pkg/utils/jwt_token"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func init() {
+	keys, err := jwt_token.NewSecretKeySet("tokens-test-secret")
+	if err != nil {
+		panic(err)
+	}
+	jwt_token.SetKeySet(keys)
+}
+
+// newSession создает пользователя и открывает для него сессию
+func newSession(t *testing.T) (*pgxpool.Pool, *tokens.Store, *tokens.Pair) {
+	pool := testdb.New(t)
+	userID := testdb.CreateUser(t, pool, "teacher", "users")
+	store := tokens.NewStore(pool, time.Hour)
+	pair, err := store.Issue(context.Background(), &models.User{ID: userID, Username: "teacher", Role: "users"}, models.SessionMeta{IP: "10.0.0.1"})
+	require.NoError(t, err)
+	return pool, store, pair
+}
+
+func sessionRevoked(t *testing.T, pool *pgxpool.Pool, accessToken string) bool {
+	claims, err := jwt_token.ParseToken(accessToken)
+	require.NoError(t, err)
+	var revoked bool
+	require.NoError(t, pool.QueryRow(context.Background(), `SELECT revoked_at IS NOT NULL FROM sessions WHERE id = $1`, claims.SessionID).Scan(&revoked))
+	return revoked
+}
+
+func TestRotate(t *testing.T) {
+	pool, store, first := newSession(t)
+	ctx := context.Background()
+
+	second, err := store.Rotate(ctx, first.RefreshToken)
+	require.NoError(t, err)
+	assert.NotEqual(t, first.RefreshToken, second.RefreshToken)
+	assert.NotEqual(t, first.AccessToken, second.AccessToken)
+
+	// Ротация остается в той же сессии
+	firstClaims, err := jwt_token.ParseToken(first.AccessToken)
+	require.NoError(t, err)
+	secondClaims, err := jwt_token.ParseToken(second.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, firstClaims.SessionID, secondClaims.SessionID)
+
+	third, err := store.Rotate(ctx, second.RefreshToken)
+	require.NoError(t, err)
+	assert.False(t, sessionRevoked(t, pool, third.AccessToken))
+
+	_, err = store.Rotate(ctx, "unknown")
+	assert.ErrorIs(t, err, tokens.ErrInvalidRefreshToken)
+}
+
+func TestRotateReuseRevokesFamily(t *testing.T) {
+	pool, store, first := newSession(t)
+	ctx := context.Background()
+
+	second, err := store.Rotate(ctx, first.RefreshToken)
+	require.NoError(t, err)
+
+	// Повторное предъявление использованного токена означает утечку: вся цепочка отзывается
+	_, err = store.Rotate(ctx, first.RefreshToken)
+	assert.ErrorIs(t, err, tokens.ErrRefreshTokenReused)
+	assert.True(t, sessionRevoked(t, pool, second.AccessToken))
+
+	_, err = store.Rotate(ctx, second.RefreshToken)
+	assert.ErrorIs(t, err, tokens.ErrInvalidRefreshToken)
+}
+
+func TestRotateExpired(t *testing.T) {
+	pool, store, pair := newSession(t)
+	ctx := context.Background()
+
+	_, err := pool.Exec(ctx, `UPDATE refresh_tokens SET expires_at = NOW() - interval '1 second'`)
+	require.NoError(t, err)
+	_, err = store.Rotate(ctx, pair.RefreshToken)
+	assert.ErrorIs(t, err, tokens.ErrInvalidRefreshToken)
+}
+
+func TestRevoke(t *testing.T) {
+	pool, store, pair := newSession(t)
+	ctx := context.Background()
+
+	require.NoError(t, store.Revoke(ctx, pair.RefreshToken))
+	assert.True(t, sessionRevoked(t, pool, pair.AccessToken))
+	_, err := store.Rotate(ctx, pair.RefreshToken)
+	assert.ErrorIs(t, err, tokens.ErrInvalidRefreshToken)
+
+	// Неизвестный токен не является ошибкой: выход идемпотентен
+	assert.NoError(t, store.Revoke(ctx, "unknown"))
+}
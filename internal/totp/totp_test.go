@@ -0,0 +1,69 @@
+package totp_test
+
+import (
+	"ROOmail/internal/totp"
+	"encoding/base32"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rfcSecret - ключ SHA1 из тестовых векторов RFC 6238, приложение B
+var rfcSecret = base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestCodeMatchesRFC6238(t *testing.T) {
+	cases := []struct {
+		unix int64
+		code string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+
+	for _, tc := range cases {
+		code, err := totp.Code(rfcSecret, totp.Step(time.Unix(tc.unix, 0)), 8)
+		require.NoError(t, err)
+		assert.Equal(t, tc.code, code, "время %d", tc.unix)
+	}
+}
+
+func TestValidateAcceptsAdjacentSteps(t *testing.T) {
+	secret, err := totp.GenerateSecret()
+	require.NoError(t, err)
+
+	now := time.Unix(1700000000, 0)
+	step := totp.Step(now)
+
+	previous, err := totp.Code(secret, step-1, totp.Digits)
+	require.NoError(t, err)
+	matched, ok := totp.Validate(secret, previous, now)
+	assert.True(t, ok)
+	assert.Equal(t, step-1, matched)
+
+	stale, err := totp.Code(secret, step-2, totp.Digits)
+	require.NoError(t, err)
+	_, ok = totp.Validate(secret, stale, now)
+	assert.False(t, ok)
+
+	_, ok = totp.Validate(secret, "12345", now)
+	assert.False(t, ok)
+}
+
+func TestProvisioningURI(t *testing.T) {
+	uri := totp.ProvisioningURI("ROOmail", "ivanov", "JBSWY3DPEHPK3PXP")
+
+	parsed, err := url.Parse(uri)
+	require.NoError(t, err)
+	assert.Equal(t, "otpauth", parsed.Scheme)
+	assert.Equal(t, "totp", parsed.Host)
+	assert.Equal(t, "/ROOmail:ivanov", parsed.Path)
+	assert.Equal(t, "JBSWY3DPEHPK3PXP", parsed.Query().Get("secret"))
+	assert.Equal(t, "ROOmail", parsed.Query().Get("issuer"))
+}
@@ -33,10 +33,13 @@ func CloseDB() {
 	}
 }
 
+// GetUserByUsername возвращает активного пользователя по имени; отключенные учетные записи не находятся
 func GetUserByUsername(ctx context.Context, username string) (*models.User, error) {
 	user := &models.User{}
-	query := "SELECT id, username, password_hash, role FROM users WHERE username=$1"
-	err := DB.QueryRow(ctx, query, username).Scan(&user.ID, &user.Username, &user.Password, &user.Role)
+	query := `SELECT id, username, password_hash, role, COALESCE(email, ''), must_change_password, password_changed_at, totp_enabled, auth_source
+		FROM users WHERE username=$1 AND is_active`
+	err := DB.QueryRow(ctx, query, username).Scan(&user.ID, &user.Username, &user.Password, &user.Role, &user.Email,
+		&user.MustChangePassword, &user.PasswordChangedAt, &user.TOTPEnabled, &user.AuthSource)
 	if err != nil {
 		return nil, fmt.Errorf("user not found: %v", err)
 	}
@@ -0,0 +1,18 @@
+-- +goose Up
+ALTER TABLE IF EXISTS public.tasks_users
+    ADD COLUMN IF NOT EXISTS status character varying(20) NOT NULL DEFAULT 'new',
+    ADD COLUMN IF NOT EXISTS seen_at timestamp,
+    ADD COLUMN IF NOT EXISTS started_at timestamp,
+    ADD COLUMN IF NOT EXISTS completed_at timestamp;
+
+ALTER TABLE IF EXISTS public.tasks_users
+    ADD CONSTRAINT tasks_users_status_check
+        CHECK (status IN ('new', 'seen', 'in_progress', 'done'));
+
+-- +goose Down
+ALTER TABLE IF EXISTS public.tasks_users
+    DROP CONSTRAINT IF EXISTS tasks_users_status_check,
+    DROP COLUMN IF EXISTS completed_at,
+    DROP COLUMN IF EXISTS started_at,
+    DROP COLUMN IF EXISTS seen_at,
+    DROP COLUMN IF EXISTS status;
@@ -0,0 +1,44 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS public.task_responses
+(
+    id serial NOT NULL,
+    task_id integer NOT NULL,
+    user_id integer NOT NULL,
+    text text NOT NULL DEFAULT '',
+    created_at timestamp without time zone DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT task_responses_pkey PRIMARY KEY (id),
+    CONSTRAINT task_responses_task_id_fkey FOREIGN KEY (task_id)
+        REFERENCES public.tasks (id)
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE,
+    CONSTRAINT task_responses_user_id_fkey FOREIGN KEY (user_id)
+        REFERENCES public.users (id)
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE
+)
+    TABLESPACE pg_default;
+
+CREATE INDEX IF NOT EXISTS task_responses_task_id_idx ON public.task_responses (task_id);
+
+CREATE TABLE IF NOT EXISTS public.task_response_files
+(
+    id serial NOT NULL,
+    response_id integer NOT NULL,
+    file_path character varying(255) NOT NULL,
+    file_name character varying(255) NOT NULL,
+    CONSTRAINT task_response_files_pkey PRIMARY KEY (id),
+    CONSTRAINT task_response_files_response_id_fkey FOREIGN KEY (response_id)
+        REFERENCES public.task_responses (id)
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE
+)
+    TABLESPACE pg_default;
+
+ALTER TABLE IF EXISTS public.task_responses
+    OWNER TO roo;
+ALTER TABLE IF EXISTS public.task_response_files
+    OWNER TO roo;
+
+-- +goose Down
+DROP TABLE IF EXISTS task_response_files;
+DROP TABLE IF EXISTS task_responses;
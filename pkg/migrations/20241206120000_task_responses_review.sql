@@ -0,0 +1,23 @@
+-- +goose Up
+ALTER TABLE IF EXISTS public.task_responses
+    ADD COLUMN IF NOT EXISTS review_status character varying(20) NOT NULL DEFAULT 'pending',
+    ADD COLUMN IF NOT EXISTS reviewed_by integer,
+    ADD COLUMN IF NOT EXISTS reviewed_at timestamp,
+    ADD COLUMN IF NOT EXISTS review_comment text NOT NULL DEFAULT '';
+
+ALTER TABLE IF EXISTS public.task_responses
+    ADD CONSTRAINT task_responses_review_status_check
+        CHECK (review_status IN ('pending', 'accepted', 'returned')),
+    ADD CONSTRAINT task_responses_reviewed_by_fkey FOREIGN KEY (reviewed_by)
+        REFERENCES public.users (id)
+        ON UPDATE NO ACTION
+        ON DELETE SET NULL;
+
+-- +goose Down
+ALTER TABLE IF EXISTS public.task_responses
+    DROP CONSTRAINT IF EXISTS task_responses_reviewed_by_fkey,
+    DROP CONSTRAINT IF EXISTS task_responses_review_status_check,
+    DROP COLUMN IF EXISTS review_comment,
+    DROP COLUMN IF EXISTS reviewed_at,
+    DROP COLUMN IF EXISTS reviewed_by,
+    DROP COLUMN IF EXISTS review_status;
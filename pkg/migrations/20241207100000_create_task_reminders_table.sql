@@ -0,0 +1,31 @@
+-- +goose Up
+ALTER TABLE IF EXISTS public.users
+    ADD COLUMN IF NOT EXISTS email character varying(255);
+
+CREATE TABLE IF NOT EXISTS public.task_reminders
+(
+    task_id integer NOT NULL,
+    user_id integer NOT NULL,
+    kind character varying(50) NOT NULL,
+    due_date date NOT NULL,
+    channel character varying(50) NOT NULL,
+    sent_at timestamp DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT task_reminders_pkey PRIMARY KEY (task_id, user_id, kind, due_date, channel),
+    CONSTRAINT task_reminders_task_id_fkey FOREIGN KEY (task_id)
+        REFERENCES public.tasks (id)
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE,
+    CONSTRAINT task_reminders_user_id_fkey FOREIGN KEY (user_id)
+        REFERENCES public.users (id)
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE
+)
+    TABLESPACE pg_default;
+
+ALTER TABLE IF EXISTS public.task_reminders
+    OWNER TO roo;
+
+-- +goose Down
+DROP TABLE IF EXISTS task_reminders;
+ALTER TABLE IF EXISTS public.users
+    DROP COLUMN IF EXISTS email;
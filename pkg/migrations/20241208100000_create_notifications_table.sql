@@ -0,0 +1,27 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS public.notifications
+(
+    id serial NOT NULL,
+    user_id integer NOT NULL,
+    type character varying(50) NOT NULL,
+    task_id integer,
+    title text NOT NULL DEFAULT '',
+    message text NOT NULL DEFAULT '',
+    read_at timestamp,
+    created_at timestamp without time zone DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT notifications_pkey PRIMARY KEY (id),
+    CONSTRAINT notifications_user_id_fkey FOREIGN KEY (user_id)
+        REFERENCES public.users (id)
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE
+)
+    TABLESPACE pg_default;
+
+CREATE INDEX IF NOT EXISTS notifications_user_id_idx ON public.notifications (user_id, id DESC);
+CREATE INDEX IF NOT EXISTS notifications_unread_idx ON public.notifications (user_id) WHERE read_at IS NULL;
+
+ALTER TABLE IF EXISTS public.notifications
+    OWNER TO roo;
+
+-- +goose Down
+DROP TABLE IF EXISTS notifications;
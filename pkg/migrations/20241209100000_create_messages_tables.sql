@@ -0,0 +1,69 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS public.messages
+(
+    id serial NOT NULL,
+    thread_id integer,
+    reply_to_id integer,
+    sender_id integer NOT NULL,
+    subject character varying(255) NOT NULL DEFAULT '',
+    body text NOT NULL DEFAULT '',
+    created_at timestamp without time zone DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT messages_pkey PRIMARY KEY (id),
+    CONSTRAINT messages_reply_to_id_fkey FOREIGN KEY (reply_to_id)
+        REFERENCES public.messages (id)
+        ON UPDATE NO ACTION
+        ON DELETE SET NULL,
+    CONSTRAINT messages_sender_id_fkey FOREIGN KEY (sender_id)
+        REFERENCES public.users (id)
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE
+)
+    TABLESPACE pg_default;
+
+CREATE INDEX IF NOT EXISTS messages_sender_id_idx ON public.messages (sender_id, id DESC);
+CREATE INDEX IF NOT EXISTS messages_thread_id_idx ON public.messages (thread_id);
+
+CREATE TABLE IF NOT EXISTS public.message_recipients
+(
+    message_id integer NOT NULL,
+    user_id integer NOT NULL,
+    read_at timestamp,
+    CONSTRAINT message_recipients_pkey PRIMARY KEY (message_id, user_id),
+    CONSTRAINT message_recipients_message_id_fkey FOREIGN KEY (message_id)
+        REFERENCES public.messages (id)
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE,
+    CONSTRAINT message_recipients_user_id_fkey FOREIGN KEY (user_id)
+        REFERENCES public.users (id)
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE
+)
+    TABLESPACE pg_default;
+
+CREATE INDEX IF NOT EXISTS message_recipients_user_id_idx ON public.message_recipients (user_id, message_id DESC);
+
+CREATE TABLE IF NOT EXISTS public.message_attachments
+(
+    id serial NOT NULL,
+    message_id integer NOT NULL,
+    file_path character varying(255) NOT NULL,
+    file_name character varying(255) NOT NULL,
+    CONSTRAINT message_attachments_pkey PRIMARY KEY (id),
+    CONSTRAINT message_attachments_message_id_fkey FOREIGN KEY (message_id)
+        REFERENCES public.messages (id)
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE
+)
+    TABLESPACE pg_default;
+
+ALTER TABLE IF EXISTS public.messages
+    OWNER TO roo;
+ALTER TABLE IF EXISTS public.message_recipients
+    OWNER TO roo;
+ALTER TABLE IF EXISTS public.message_attachments
+    OWNER TO roo;
+
+-- +goose Down
+DROP TABLE IF EXISTS message_attachments;
+DROP TABLE IF EXISTS message_recipients;
+DROP TABLE IF EXISTS messages;
@@ -0,0 +1,52 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS public.announcements
+(
+    id serial NOT NULL,
+    title character varying(255) NOT NULL,
+    body text NOT NULL DEFAULT '',
+    requires_ack boolean NOT NULL DEFAULT false,
+    audience jsonb NOT NULL DEFAULT '{}',
+    created_by integer,
+    created_at timestamp without time zone DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT announcements_pkey PRIMARY KEY (id),
+    CONSTRAINT announcements_created_by_fkey FOREIGN KEY (created_by)
+        REFERENCES public.users (id)
+        ON UPDATE NO ACTION
+        ON DELETE SET NULL
+)
+    TABLESPACE pg_default;
+
+CREATE TABLE IF NOT EXISTS public.announcement_recipients
+(
+    announcement_id integer NOT NULL,
+    user_id integer NOT NULL,
+    assigned_at timestamp DEFAULT CURRENT_TIMESTAMP,
+    sent_by integer,
+    read_at timestamp,
+    acknowledged_at timestamp,
+    CONSTRAINT announcement_recipients_pkey PRIMARY KEY (announcement_id, user_id),
+    CONSTRAINT announcement_recipients_announcement_id_fkey FOREIGN KEY (announcement_id)
+        REFERENCES public.announcements (id)
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE,
+    CONSTRAINT announcement_recipients_user_id_fkey FOREIGN KEY (user_id)
+        REFERENCES public.users (id)
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE,
+    CONSTRAINT announcement_recipients_sent_by_fkey FOREIGN KEY (sent_by)
+        REFERENCES public.users (id)
+        ON UPDATE NO ACTION
+        ON DELETE SET NULL
+)
+    TABLESPACE pg_default;
+
+CREATE INDEX IF NOT EXISTS announcement_recipients_user_id_idx ON public.announcement_recipients (user_id, announcement_id DESC);
+
+ALTER TABLE IF EXISTS public.announcements
+    OWNER TO roo;
+ALTER TABLE IF EXISTS public.announcement_recipients
+    OWNER TO roo;
+
+-- +goose Down
+DROP TABLE IF EXISTS announcement_recipients;
+DROP TABLE IF EXISTS announcements;
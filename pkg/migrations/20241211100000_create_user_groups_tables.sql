@@ -0,0 +1,58 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS public.user_groups
+(
+    id serial NOT NULL,
+    name character varying(100) NOT NULL,
+    description text NOT NULL DEFAULT '',
+    created_by integer,
+    created_at timestamp without time zone DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT user_groups_pkey PRIMARY KEY (id),
+    CONSTRAINT user_groups_name_key UNIQUE (name),
+    CONSTRAINT user_groups_created_by_fkey FOREIGN KEY (created_by)
+        REFERENCES public.users (id)
+        ON UPDATE NO ACTION
+        ON DELETE SET NULL
+)
+    TABLESPACE pg_default;
+
+CREATE TABLE IF NOT EXISTS public.user_group_members
+(
+    group_id integer NOT NULL,
+    user_id integer NOT NULL,
+    added_at timestamp without time zone DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT user_group_members_pkey PRIMARY KEY (group_id, user_id),
+    CONSTRAINT user_group_members_group_id_fkey FOREIGN KEY (group_id)
+        REFERENCES public.user_groups (id)
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE,
+    CONSTRAINT user_group_members_user_id_fkey FOREIGN KEY (user_id)
+        REFERENCES public.users (id)
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE
+)
+    TABLESPACE pg_default;
+
+CREATE INDEX IF NOT EXISTS user_group_members_user_id_idx ON public.user_group_members (user_id);
+
+ALTER TABLE IF EXISTS public.user_groups
+    OWNER TO roo;
+ALTER TABLE IF EXISTS public.user_group_members
+    OWNER TO roo;
+
+ALTER TABLE IF EXISTS public.tasks_users
+    ADD COLUMN IF NOT EXISTS group_id integer
+        REFERENCES public.user_groups (id)
+        ON UPDATE NO ACTION
+        ON DELETE SET NULL;
+
+ALTER TABLE IF EXISTS public.announcement_recipients
+    ADD COLUMN IF NOT EXISTS group_id integer
+        REFERENCES public.user_groups (id)
+        ON UPDATE NO ACTION
+        ON DELETE SET NULL;
+
+-- +goose Down
+ALTER TABLE IF EXISTS public.announcement_recipients DROP COLUMN IF EXISTS group_id;
+ALTER TABLE IF EXISTS public.tasks_users DROP COLUMN IF EXISTS group_id;
+DROP TABLE IF EXISTS user_group_members;
+DROP TABLE IF EXISTS user_groups;
@@ -0,0 +1,88 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS public.organizations
+(
+    id serial NOT NULL,
+    name character varying(255) NOT NULL,
+    parent_id integer,
+    created_at timestamp without time zone DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT organizations_pkey PRIMARY KEY (id),
+    CONSTRAINT organizations_parent_id_fkey FOREIGN KEY (parent_id)
+        REFERENCES public.organizations (id)
+        ON UPDATE NO ACTION
+        ON DELETE RESTRICT
+)
+    TABLESPACE pg_default;
+
+-- Названия уникальны среди организаций одного уровня
+CREATE UNIQUE INDEX IF NOT EXISTS organizations_parent_name_key ON public.organizations (COALESCE(parent_id, 0), name);
+
+ALTER TABLE IF EXISTS public.users
+    ADD COLUMN IF NOT EXISTS organization_id integer
+        REFERENCES public.organizations (id)
+        ON UPDATE NO ACTION
+        ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS users_organization_id_idx ON public.users (organization_id);
+
+-- Назначение задачи организации: статус общий для всех ее сотрудников
+CREATE TABLE IF NOT EXISTS public.tasks_organizations
+(
+    task_id integer NOT NULL,
+    organization_id integer NOT NULL,
+    assigned_at timestamp DEFAULT CURRENT_TIMESTAMP,
+    sent_by integer,
+    status character varying(20) NOT NULL DEFAULT 'new',
+    seen_at timestamp,
+    started_at timestamp,
+    completed_at timestamp,
+    CONSTRAINT tasks_organizations_pkey PRIMARY KEY (task_id, organization_id),
+    CONSTRAINT tasks_organizations_task_id_fkey FOREIGN KEY (task_id)
+        REFERENCES public.tasks (id)
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE,
+    CONSTRAINT tasks_organizations_organization_id_fkey FOREIGN KEY (organization_id)
+        REFERENCES public.organizations (id)
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE,
+    CONSTRAINT tasks_organizations_sent_by_fkey FOREIGN KEY (sent_by)
+        REFERENCES public.users (id)
+        ON UPDATE NO ACTION
+        ON DELETE SET NULL,
+    CONSTRAINT tasks_organizations_status_check
+        CHECK (status IN ('new', 'seen', 'in_progress', 'done'))
+)
+    TABLESPACE pg_default;
+
+CREATE INDEX IF NOT EXISTS tasks_organizations_organization_id_idx ON public.tasks_organizations (organization_id);
+
+ALTER TABLE IF EXISTS public.task_responses
+    ADD COLUMN IF NOT EXISTS organization_id integer
+        REFERENCES public.organizations (id)
+        ON UPDATE NO ACTION
+        ON DELETE SET NULL;
+
+-- Организация и все вложенные в нее: задача, назначенная району, достается сотрудникам его школ.
+-- depth - удаленность вложенной организации от корневой, 0 для самой организации.
+CREATE OR REPLACE VIEW public.organization_tree AS
+WITH RECURSIVE tree (root_id, organization_id, depth) AS (
+    SELECT id, id, 0 FROM public.organizations
+    UNION ALL
+    SELECT tree.root_id, o.id, tree.depth + 1
+    FROM tree
+    JOIN public.organizations o ON o.parent_id = tree.organization_id
+)
+SELECT root_id, organization_id, depth FROM tree;
+
+ALTER TABLE IF EXISTS public.organizations
+    OWNER TO roo;
+ALTER TABLE IF EXISTS public.tasks_organizations
+    OWNER TO roo;
+ALTER VIEW IF EXISTS public.organization_tree
+    OWNER TO roo;
+
+-- +goose Down
+DROP VIEW IF EXISTS organization_tree;
+ALTER TABLE IF EXISTS public.task_responses DROP COLUMN IF EXISTS organization_id;
+DROP TABLE IF EXISTS tasks_organizations;
+ALTER TABLE IF EXISTS public.users DROP COLUMN IF EXISTS organization_id;
+DROP TABLE IF EXISTS organizations;
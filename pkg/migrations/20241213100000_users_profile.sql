@@ -0,0 +1,21 @@
+-- +goose Up
+ALTER TABLE IF EXISTS public.users
+    ADD COLUMN IF NOT EXISTS full_name character varying(255),
+    ADD COLUMN IF NOT EXISTS "position" character varying(255),
+    ADD COLUMN IF NOT EXISTS phone character varying(50),
+    ADD COLUMN IF NOT EXISTS is_active boolean NOT NULL DEFAULT true;
+
+-- Поиск по справочнику и выбор получателей ищут подстроку (ILIKE '%...%') в имени пользователя и ФИО:
+-- обычный B-tree индекс для этого не подходит, нужны триграммы
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+CREATE INDEX IF NOT EXISTS users_username_trgm_idx ON public.users USING gin (username gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS users_full_name_trgm_idx ON public.users USING gin (full_name gin_trgm_ops);
+
+-- +goose Down
+DROP INDEX IF EXISTS users_full_name_trgm_idx;
+DROP INDEX IF EXISTS users_username_trgm_idx;
+ALTER TABLE IF EXISTS public.users
+    DROP COLUMN IF EXISTS is_active,
+    DROP COLUMN IF EXISTS phone,
+    DROP COLUMN IF EXISTS "position",
+    DROP COLUMN IF EXISTS full_name;
@@ -0,0 +1,8 @@
+-- +goose Up
+-- Токены, выданные до смены пароля, считаются отозванными
+ALTER TABLE IF EXISTS public.users
+    ADD COLUMN IF NOT EXISTS password_changed_at timestamp with time zone;
+
+-- +goose Down
+ALTER TABLE IF EXISTS public.users
+    DROP COLUMN IF EXISTS password_changed_at;
@@ -0,0 +1,13 @@
+-- +goose Up
+ALTER TABLE IF EXISTS public.users
+    ADD COLUMN IF NOT EXISTS must_change_password boolean NOT NULL DEFAULT false;
+
+-- Срок действия существующих паролей отсчитывается от момента миграции. Сдвиг на час
+-- (время жизни токена) нужен, чтобы уже выданные токены не были признаны отозванными.
+UPDATE public.users
+SET password_changed_at = NOW() - interval '1 hour'
+WHERE password_changed_at IS NULL;
+
+-- +goose Down
+ALTER TABLE IF EXISTS public.users
+    DROP COLUMN IF EXISTS must_change_password;
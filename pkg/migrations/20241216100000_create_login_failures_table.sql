@@ -0,0 +1,22 @@
+-- +goose Up
+-- Неудачные попытки входа по имени пользователя и по IP-адресу
+CREATE TABLE IF NOT EXISTS public.login_failures
+(
+    kind character varying(10) NOT NULL,
+    key character varying(255) NOT NULL,
+    failed_count integer NOT NULL DEFAULT 0,
+    window_started_at timestamp with time zone NOT NULL DEFAULT NOW(),
+    last_failed_at timestamp with time zone NOT NULL DEFAULT NOW(),
+    locked_until timestamp with time zone,
+    CONSTRAINT login_failures_pkey PRIMARY KEY (kind, key),
+    CONSTRAINT login_failures_kind_check CHECK (kind IN ('username', 'ip'))
+)
+    TABLESPACE pg_default;
+
+CREATE INDEX IF NOT EXISTS login_failures_last_failed_at_idx ON public.login_failures (last_failed_at);
+
+ALTER TABLE IF EXISTS public.login_failures
+    OWNER TO roo;
+
+-- +goose Down
+DROP TABLE IF EXISTS login_failures;
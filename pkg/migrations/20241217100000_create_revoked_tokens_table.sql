@@ -0,0 +1,23 @@
+-- +goose Up
+-- Отозванные токены по идентификатору (jti). Запись нужна только до истечения токена.
+CREATE TABLE IF NOT EXISTS public.revoked_tokens
+(
+    jti character varying(64) NOT NULL,
+    user_id integer,
+    expires_at timestamp with time zone NOT NULL,
+    revoked_at timestamp with time zone NOT NULL DEFAULT NOW(),
+    CONSTRAINT revoked_tokens_pkey PRIMARY KEY (jti),
+    CONSTRAINT revoked_tokens_user_id_fkey FOREIGN KEY (user_id)
+        REFERENCES public.users (id)
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE
+)
+    TABLESPACE pg_default;
+
+CREATE INDEX IF NOT EXISTS revoked_tokens_expires_at_idx ON public.revoked_tokens (expires_at);
+
+ALTER TABLE IF EXISTS public.revoked_tokens
+    OWNER TO roo;
+
+-- +goose Down
+DROP TABLE IF EXISTS revoked_tokens;
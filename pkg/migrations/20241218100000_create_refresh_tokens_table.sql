@@ -0,0 +1,36 @@
+-- +goose Up
+-- Refresh-токены хранятся только в виде SHA-256. Токены одной цепочки ротаций
+-- объединены family_id: повторное использование токена отзывает всю цепочку.
+CREATE TABLE IF NOT EXISTS public.refresh_tokens
+(
+    id serial NOT NULL,
+    user_id integer NOT NULL,
+    family_id character varying(32) NOT NULL,
+    parent_id integer,
+    token_hash character(64) NOT NULL,
+    created_at timestamp with time zone NOT NULL DEFAULT NOW(),
+    expires_at timestamp with time zone NOT NULL,
+    used_at timestamp with time zone,
+    revoked_at timestamp with time zone,
+    CONSTRAINT refresh_tokens_pkey PRIMARY KEY (id),
+    CONSTRAINT refresh_tokens_token_hash_key UNIQUE (token_hash),
+    CONSTRAINT refresh_tokens_user_id_fkey FOREIGN KEY (user_id)
+        REFERENCES public.users (id)
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE,
+    CONSTRAINT refresh_tokens_parent_id_fkey FOREIGN KEY (parent_id)
+        REFERENCES public.refresh_tokens (id)
+        ON UPDATE NO ACTION
+        ON DELETE SET NULL
+)
+    TABLESPACE pg_default;
+
+CREATE INDEX IF NOT EXISTS refresh_tokens_family_id_idx ON public.refresh_tokens (family_id);
+CREATE INDEX IF NOT EXISTS refresh_tokens_user_id_idx ON public.refresh_tokens (user_id);
+CREATE INDEX IF NOT EXISTS refresh_tokens_expires_at_idx ON public.refresh_tokens (expires_at);
+
+ALTER TABLE IF EXISTS public.refresh_tokens
+    OWNER TO roo;
+
+-- +goose Down
+DROP TABLE IF EXISTS refresh_tokens;
@@ -0,0 +1,44 @@
+-- +goose Up
+-- Сессия создается при входе и соответствует цепочке refresh-токенов (refresh_tokens.family_id).
+-- Токены доступа несут идентификатор сессии и не принимаются после ее завершения.
+CREATE TABLE IF NOT EXISTS public.sessions
+(
+    id character varying(32) NOT NULL,
+    user_id integer NOT NULL,
+    ip character varying(64),
+    user_agent text,
+    created_at timestamp with time zone NOT NULL DEFAULT NOW(),
+    last_seen_at timestamp with time zone NOT NULL DEFAULT NOW(),
+    expires_at timestamp with time zone NOT NULL,
+    revoked_at timestamp with time zone,
+    CONSTRAINT sessions_pkey PRIMARY KEY (id),
+    CONSTRAINT sessions_user_id_fkey FOREIGN KEY (user_id)
+        REFERENCES public.users (id)
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE
+)
+    TABLESPACE pg_default;
+
+CREATE INDEX IF NOT EXISTS sessions_user_id_idx ON public.sessions (user_id);
+CREATE INDEX IF NOT EXISTS sessions_expires_at_idx ON public.sessions (expires_at);
+
+-- Существующие цепочки refresh-токенов становятся сессиями без IP и User-Agent
+INSERT INTO public.sessions (id, user_id, created_at, last_seen_at, expires_at, revoked_at)
+SELECT family_id, MIN(user_id), MIN(created_at), MAX(created_at), MAX(expires_at),
+       CASE WHEN bool_and(revoked_at IS NOT NULL) THEN MAX(revoked_at) END
+FROM public.refresh_tokens
+GROUP BY family_id
+ON CONFLICT (id) DO NOTHING;
+
+ALTER TABLE IF EXISTS public.refresh_tokens
+    ADD CONSTRAINT refresh_tokens_family_id_fkey FOREIGN KEY (family_id)
+        REFERENCES public.sessions (id)
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE;
+
+ALTER TABLE IF EXISTS public.sessions
+    OWNER TO roo;
+
+-- +goose Down
+ALTER TABLE IF EXISTS public.refresh_tokens DROP CONSTRAINT IF EXISTS refresh_tokens_family_id_fkey;
+DROP TABLE IF EXISTS sessions;
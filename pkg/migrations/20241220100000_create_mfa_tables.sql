@@ -0,0 +1,59 @@
+-- +goose Up
+-- Двухфакторная аутентификация по TOTP. Пока вход не подтвержден кодом, totp_secret
+-- хранит секрет незавершенной настройки, а totp_enabled остается false.
+-- totp_last_step - шаг последнего принятого кода, чтобы код нельзя было использовать повторно.
+ALTER TABLE IF EXISTS public.users
+    ADD COLUMN IF NOT EXISTS totp_secret character varying(64),
+    ADD COLUMN IF NOT EXISTS totp_enabled boolean NOT NULL DEFAULT false,
+    ADD COLUMN IF NOT EXISTS totp_last_step bigint;
+
+-- Одноразовые коды восстановления на случай потери устройства, хранятся в виде SHA-256
+CREATE TABLE IF NOT EXISTS public.mfa_recovery_codes
+(
+    id serial NOT NULL,
+    user_id integer NOT NULL,
+    code_hash character(64) NOT NULL,
+    created_at timestamp with time zone NOT NULL DEFAULT NOW(),
+    used_at timestamp with time zone,
+    CONSTRAINT mfa_recovery_codes_pkey PRIMARY KEY (id),
+    CONSTRAINT mfa_recovery_codes_user_id_fkey FOREIGN KEY (user_id)
+        REFERENCES public.users (id)
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE
+)
+    TABLESPACE pg_default;
+
+CREATE INDEX IF NOT EXISTS mfa_recovery_codes_user_id_idx ON public.mfa_recovery_codes (user_id);
+
+ALTER TABLE IF EXISTS public.mfa_recovery_codes
+    OWNER TO roo;
+
+-- Промежуточные токены входа: выдаются после проверки пароля и обмениваются
+-- на токены сессии после ввода кода. Хранятся в виде SHA-256.
+CREATE TABLE IF NOT EXISTS public.mfa_challenges
+(
+    token_hash character(64) NOT NULL,
+    user_id integer NOT NULL,
+    attempts integer NOT NULL DEFAULT 0,
+    created_at timestamp with time zone NOT NULL DEFAULT NOW(),
+    expires_at timestamp with time zone NOT NULL,
+    CONSTRAINT mfa_challenges_pkey PRIMARY KEY (token_hash),
+    CONSTRAINT mfa_challenges_user_id_fkey FOREIGN KEY (user_id)
+        REFERENCES public.users (id)
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE
+)
+    TABLESPACE pg_default;
+
+CREATE INDEX IF NOT EXISTS mfa_challenges_expires_at_idx ON public.mfa_challenges (expires_at);
+
+ALTER TABLE IF EXISTS public.mfa_challenges
+    OWNER TO roo;
+
+-- +goose Down
+DROP TABLE IF EXISTS mfa_challenges;
+DROP TABLE IF EXISTS mfa_recovery_codes;
+ALTER TABLE IF EXISTS public.users
+    DROP COLUMN IF EXISTS totp_secret,
+    DROP COLUMN IF EXISTS totp_enabled,
+    DROP COLUMN IF EXISTS totp_last_step;
@@ -0,0 +1,93 @@
+-- +goose Up
+-- Разрешения проверяются в маршрутах по коду; роль - именованный набор разрешений.
+-- Новые разрешения добавляются миграциями вместе с кодом, который их проверяет.
+CREATE TABLE IF NOT EXISTS public.permissions
+(
+    code character varying(64) NOT NULL,
+    description text NOT NULL,
+    CONSTRAINT permissions_pkey PRIMARY KEY (code)
+)
+    TABLESPACE pg_default;
+
+ALTER TABLE IF EXISTS public.permissions
+    OWNER TO roo;
+
+-- Встроенные роли (builtin) нельзя удалить, а набор разрешений администратора - изменить
+CREATE TABLE IF NOT EXISTS public.roles
+(
+    name character varying(50) NOT NULL,
+    description text NOT NULL DEFAULT '',
+    builtin boolean NOT NULL DEFAULT false,
+    created_at timestamp with time zone NOT NULL DEFAULT NOW(),
+    CONSTRAINT roles_pkey PRIMARY KEY (name)
+)
+    TABLESPACE pg_default;
+
+ALTER TABLE IF EXISTS public.roles
+    OWNER TO roo;
+
+CREATE TABLE IF NOT EXISTS public.role_permissions
+(
+    role character varying(50) NOT NULL,
+    permission character varying(64) NOT NULL,
+    CONSTRAINT role_permissions_pkey PRIMARY KEY (role, permission),
+    CONSTRAINT role_permissions_role_fkey FOREIGN KEY (role)
+        REFERENCES public.roles (name)
+        ON UPDATE CASCADE
+        ON DELETE CASCADE,
+    CONSTRAINT role_permissions_permission_fkey FOREIGN KEY (permission)
+        REFERENCES public.permissions (code)
+        ON UPDATE CASCADE
+        ON DELETE CASCADE
+)
+    TABLESPACE pg_default;
+
+ALTER TABLE IF EXISTS public.role_permissions
+    OWNER TO roo;
+
+INSERT INTO public.permissions (code, description) VALUES
+    ('tasks:read', 'Просмотр всех задач и ответов исполнителей'),
+    ('tasks:create', 'Создание задач'),
+    ('tasks:update', 'Изменение задач'),
+    ('tasks:delete', 'Удаление задач'),
+    ('tasks:review', 'Проверка ответов исполнителей'),
+    ('tasks:execute', 'Получение назначенных задач и ответы на них'),
+    ('users:read', 'Просмотр справочника пользователей'),
+    ('users:manage', 'Создание, изменение и удаление пользователей'),
+    ('groups:manage', 'Управление группами пользователей'),
+    ('organizations:manage', 'Управление организациями'),
+    ('announcements:manage', 'Рассылка объявлений и отчеты об ознакомлении'),
+    ('files:upload', 'Загрузка файлов'),
+    ('logs:read', 'Просмотр журналов сервера'),
+    ('security:manage', 'Блокировки входа, сессии и второй фактор пользователей'),
+    ('roles:manage', 'Управление ролями и разрешениями')
+ON CONFLICT (code) DO NOTHING;
+
+INSERT INTO public.roles (name, description, builtin) VALUES
+    ('admin', 'Администратор: все разрешения', true),
+    ('users', 'Исполнитель задач', true)
+ON CONFLICT (name) DO NOTHING;
+
+-- Роли, которые уже встречаются у пользователей, сохраняются без разрешений
+INSERT INTO public.roles (name)
+SELECT DISTINCT role FROM public.users
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO public.role_permissions (role, permission)
+SELECT 'admin', code FROM public.permissions
+ON CONFLICT DO NOTHING;
+
+INSERT INTO public.role_permissions (role, permission) VALUES ('users', 'tasks:execute')
+ON CONFLICT DO NOTHING;
+
+ALTER TABLE IF EXISTS public.users
+    ADD CONSTRAINT users_role_fkey FOREIGN KEY (role)
+        REFERENCES public.roles (name)
+        ON UPDATE CASCADE
+        ON DELETE RESTRICT;
+
+-- +goose Down
+ALTER TABLE IF EXISTS public.users DROP CONSTRAINT IF EXISTS users_role_fkey;
+DROP TABLE IF EXISTS role_permissions;
+DROP TABLE IF EXISTS roles;
+DROP TABLE IF EXISTS permissions;
@@ -0,0 +1,36 @@
+-- +goose Up
+-- API-ключи для интеграций. Ключ действует от имени пользователя user_id, но только
+-- в пределах scopes - разрешений, выданных при создании. Сам ключ не хранится, только его SHA-256.
+CREATE TABLE IF NOT EXISTS public.api_keys
+(
+    id serial NOT NULL,
+    name character varying(100) NOT NULL,
+    prefix character varying(16) NOT NULL,
+    key_hash character(64) NOT NULL,
+    user_id integer NOT NULL,
+    scopes text[] NOT NULL DEFAULT '{}',
+    created_by integer,
+    created_at timestamp with time zone NOT NULL DEFAULT NOW(),
+    expires_at timestamp with time zone,
+    last_used_at timestamp with time zone,
+    revoked_at timestamp with time zone,
+    CONSTRAINT api_keys_pkey PRIMARY KEY (id),
+    CONSTRAINT api_keys_key_hash_key UNIQUE (key_hash),
+    CONSTRAINT api_keys_user_id_fkey FOREIGN KEY (user_id)
+        REFERENCES public.users (id)
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE,
+    CONSTRAINT api_keys_created_by_fkey FOREIGN KEY (created_by)
+        REFERENCES public.users (id)
+        ON UPDATE NO ACTION
+        ON DELETE SET NULL
+)
+    TABLESPACE pg_default;
+
+CREATE INDEX IF NOT EXISTS api_keys_user_id_idx ON public.api_keys (user_id);
+
+ALTER TABLE IF EXISTS public.api_keys
+    OWNER TO roo;
+
+-- +goose Down
+DROP TABLE IF EXISTS api_keys;
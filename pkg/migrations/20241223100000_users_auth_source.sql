@@ -0,0 +1,9 @@
+-- +goose Up
+-- Источник учетной записи: local - пароль хранится в password_hash, ldap - пароль проверяет
+-- каталог, а запись создана при первом входе и обновляется при каждом входе
+ALTER TABLE IF EXISTS public.users
+    ADD COLUMN IF NOT EXISTS auth_source character varying(20) NOT NULL DEFAULT 'local';
+
+-- +goose Down
+ALTER TABLE IF EXISTS public.users
+    DROP COLUMN IF EXISTS auth_source;
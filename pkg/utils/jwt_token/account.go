@@ -0,0 +1,94 @@
+package jwt_token
+
+import (
+	"ROOmail/pkg/db"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"golang.org/x/net/context"
+	"time"
+)
+
+var (
+	ErrAccountDisabled = errors.New("Учетная запись отключена")
+	ErrTokenSuperseded = errors.New("Токен отозван после смены пароля")
+	ErrTokenRevoked    = errors.New("Токен отозван")
+	ErrSessionRevoked  = errors.New("Сессия завершена")
+	ErrTokenExpired    = errors.New("Срок действия токена истек")
+	ErrAccountCheck    = errors.New("Не удалось проверить учетную запись")
+
+	ErrPasswordChangeRequired = errors.New("Необходимо сменить пароль")
+)
+
+// passwordMaxAge - срок действия пароля, ноль - без ограничения. Задается при запуске через SetPasswordMaxAge.
+var passwordMaxAge time.Duration
+
+// SetPasswordMaxAge задает срок действия пароля, после которого доступна только его смена
+func SetPasswordMaxAge(maxAge time.Duration) {
+	passwordMaxAge = maxAge
+}
+
+// checkAccount проверяет, что токен и его сессия не отозваны, учетная запись владельца активна
+// и сессия открыта после последней смены пароля. Заодно не чаще раза в минуту отмечает активность
+// сессии и заменяет роль в claims текущей ролью пользователя с ее разрешениями, чтобы изменения
+// ролей действовали сразу. Если пароль нужно сменить по требованию администратора или по сроку
+// действия, отмечает это в claims.PasswordChangeRequired. Без подключения к базе проверка пропускается.
+func checkAccount(ctx context.Context, claims *Claims) error {
+	if db.DB == nil {
+		return nil
+	}
+	// Токен без идентификатора или сессии нельзя отозвать, такие токены не принимаются
+	if claims.ID == "" {
+		return ErrTokenRevoked
+	}
+	if claims.SessionID == "" {
+		return ErrSessionRevoked
+	}
+
+	var active, revoked, sessionActive, superseded, changeRequired bool
+	var role string
+	var permissions []string
+	err := db.DB.QueryRow(ctx, `
+		WITH touch AS (
+			UPDATE sessions SET last_seen_at = NOW()
+			WHERE id = $3 AND last_seen_at < NOW() - interval '1 minute'
+		)
+		SELECT u.is_active,
+		       EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = $2),
+		       EXISTS (SELECT 1 FROM sessions s WHERE s.id = $3 AND s.user_id = u.id AND s.revoked_at IS NULL AND s.expires_at > NOW()),
+		       EXISTS (SELECT 1 FROM sessions s WHERE s.id = $3 AND s.created_at < u.password_changed_at),
+		       u.must_change_password OR COALESCE(u.auth_source = 'local' AND $4::float8 > 0
+		           AND u.password_changed_at + $4::float8 * interval '1 second' <= NOW(), false),
+		       u.role,
+		       ARRAY(SELECT rp.permission FROM role_permissions rp WHERE rp.role = u.role ORDER BY rp.permission)
+		FROM users u
+		WHERE u.id = $1
+	`, claims.UserID, claims.ID, claims.SessionID, passwordMaxAge.Seconds()).
+		Scan(&active, &revoked, &sessionActive, &superseded, &changeRequired, &role, &permissions)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrAccountDisabled
+		}
+		return ErrAccountCheck
+	}
+	if revoked {
+		return ErrTokenRevoked
+	}
+	if !sessionActive {
+		return ErrSessionRevoked
+	}
+	if !active {
+		return ErrAccountDisabled
+	}
+
+	// Время открытия сессии и смены пароля сравнивается в базе с точностью до микросекунды,
+	// а не по iat с точностью до секунды: сессия, открытая параллельно со сменой пароля
+	// и не попавшая под отзыв, все равно не принимается
+	if superseded {
+		return ErrTokenSuperseded
+	}
+
+	claims.Role = role
+	claims.Permissions = permissions
+	claims.PasswordChangeRequired = changeRequired
+	return nil
+}
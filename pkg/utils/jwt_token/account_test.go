@@ -0,0 +1,98 @@
+package jwt_token_test
+
+import (
+	"ROOmail/internal/models"
+	"ROOmail/internal/tokens"
+	"ROOmail/pkg/db"
+	"ROOmail/pkg/testdb"
+	"ROOmail/pkg/utils/jwt_token"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJWTMiddlewarePasswordChangeRequired(t *testing.T) {
+	pool := testdb.New(t)
+	ctx := context.Background()
+	db.DB = pool
+	t.Cleanup(func() {
+		db.DB = nil
+		jwt_token.SetPasswordMaxAge(0)
+	})
+	ks, err := jwt_token.NewSecretKeySet("account-test-secret")
+	require.NoError(t, err)
+	jwt_token.SetKeySet(ks)
+	jwt_token.AllowWithPasswordChangeRequired("/user/password")
+
+	userID := testdb.CreateUser(t, pool, "teacher", "users")
+	pair, err := tokens.NewStore(pool, time.Hour).Issue(ctx, &models.User{ID: userID, Username: "teacher", Role: "users"}, models.SessionMeta{})
+	require.NoError(t, err)
+
+	handler := jwt_token.JWTMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	serve := func(path string) int {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer "+pair.AccessToken)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusOK, serve("/user/tasks/all/get"))
+
+	// Смену пароля потребовал администратор
+	_, err = pool.Exec(ctx, `UPDATE users SET must_change_password = true WHERE id = $1`, userID)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, serve("/user/tasks/all/get"))
+	assert.Equal(t, http.StatusOK, serve("/user/password"))
+
+	// Истек срок действия пароля
+	_, err = pool.Exec(ctx, `UPDATE users SET must_change_password = false, password_changed_at = NOW() - interval '2 hours' WHERE id = $1`, userID)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, serve("/user/tasks/all/get"))
+	jwt_token.SetPasswordMaxAge(time.Hour)
+	assert.Equal(t, http.StatusForbidden, serve("/user/tasks/all/get"))
+	assert.Equal(t, http.StatusOK, serve("/user/password"))
+}
+
+func TestCheckStream(t *testing.T) {
+	pool := testdb.New(t)
+	ctx := context.Background()
+	db.DB = pool
+	t.Cleanup(func() { db.DB = nil })
+	ks, err := jwt_token.NewSecretKeySet("account-test-secret")
+	require.NoError(t, err)
+	jwt_token.SetKeySet(ks)
+
+	userID := testdb.CreateUser(t, pool, "teacher", "users")
+	store := tokens.NewStore(pool, time.Hour)
+	pair, err := store.Issue(ctx, &models.User{ID: userID, Username: "teacher", Role: "users"}, models.SessionMeta{})
+	require.NoError(t, err)
+	claims, err := jwt_token.ParseToken(pair.AccessToken)
+	require.NoError(t, err)
+
+	require.NoError(t, jwt_token.CheckStream(ctx, claims))
+
+	// Поток не переживает токен, с которым открыт
+	expired := *claims
+	expired.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Second))
+	assert.ErrorIs(t, jwt_token.CheckStream(ctx, &expired), jwt_token.ErrTokenExpired)
+
+	// Учетную запись отключили после подключения
+	_, err = pool.Exec(ctx, `UPDATE users SET is_active = false WHERE id = $1`, userID)
+	require.NoError(t, err)
+	assert.ErrorIs(t, jwt_token.CheckStream(ctx, claims), jwt_token.ErrAccountDisabled)
+	_, err = pool.Exec(ctx, `UPDATE users SET is_active = true WHERE id = $1`, userID)
+	require.NoError(t, err)
+
+	// Сессию завершили после подключения
+	require.NoError(t, store.RevokeSession(ctx, claims.SessionID, nil))
+	assert.ErrorIs(t, jwt_token.CheckStream(ctx, claims), jwt_token.ErrSessionRevoked)
+}
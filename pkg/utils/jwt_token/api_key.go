@@ -0,0 +1,101 @@
+package jwt_token
+
+import (
+	"ROOmail/pkg/db"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"golang.org/x/net/context"
+	"strings"
+	"time"
+)
+
+// APIKeyHeader - заголовок, в котором интеграции передают API-ключ вместо токена
+const APIKeyHeader = "X-API-Key"
+
+// apiKeyPrefix отличает API-ключи от других секретов, например при поиске утечек в логах
+const apiKeyPrefix = "roo_"
+
+var (
+	ErrInvalidAPIKey = errors.New("Недействительный API-ключ")
+	ErrAPIKeyRevoked = errors.New("API-ключ отозван")
+	ErrAPIKeyExpired = errors.New("Срок действия API-ключа истек")
+)
+
+// NewAPIKey создает ключ вида roo_<8 hex>_<секрет>. Возвращает сам ключ, его видимое начало
+// и хеш для хранения.
+func NewAPIKey() (key, prefix, hash string, err error) {
+	id := make([]byte, 4)
+	if _, err = rand.Read(id); err != nil {
+		return "", "", "", err
+	}
+	secret := make([]byte, 32)
+	if _, err = rand.Read(secret); err != nil {
+		return "", "", "", err
+	}
+
+	prefix = apiKeyPrefix + hex.EncodeToString(id)
+	key = prefix + "_" + base64.RawURLEncoding.EncodeToString(secret)
+	return key, prefix, HashAPIKey(key), nil
+}
+
+// HashAPIKey возвращает SHA-256 ключа. Ключ случайный и длинный, поэтому медленный хеш
+// вроде bcrypt не нужен, а поиск по хешу не требует перебора ключей.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// checkAPIKey находит действующий ключ и возвращает claims его владельца с разрешениями,
+// которые есть и у ключа, и у текущей роли владельца. Не чаще раза в минуту отмечает
+// использование ключа.
+func checkAPIKey(ctx context.Context, key string) (*Claims, error) {
+	if db.DB == nil || !strings.HasPrefix(key, apiKeyPrefix) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	var keyID, userID int
+	var username, role string
+	var active bool
+	var expiresAt, revokedAt *time.Time
+	var permissions []string
+	err := db.DB.QueryRow(ctx, `
+		WITH touch AS (
+			UPDATE api_keys SET last_used_at = NOW()
+			WHERE key_hash = $1 AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > NOW())
+			  AND (last_used_at IS NULL OR last_used_at < NOW() - interval '1 minute')
+		)
+		SELECT k.id, k.expires_at, k.revoked_at, u.id, u.username, u.is_active, u.role,
+		       ARRAY(SELECT rp.permission FROM role_permissions rp
+		             WHERE rp.role = u.role AND rp.permission = ANY(k.scopes) ORDER BY rp.permission)
+		FROM api_keys k
+		JOIN users u ON u.id = k.user_id
+		WHERE k.key_hash = $1
+	`, HashAPIKey(key)).Scan(&keyID, &expiresAt, &revokedAt, &userID, &username, &active, &role, &permissions)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrInvalidAPIKey
+		}
+		return nil, ErrAccountCheck
+	}
+	if revokedAt != nil {
+		return nil, ErrAPIKeyRevoked
+	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return nil, ErrAPIKeyExpired
+	}
+	if !active {
+		return nil, ErrAccountDisabled
+	}
+
+	return &Claims{
+		UserID:      userID,
+		Username:    username,
+		Role:        role,
+		Permissions: permissions,
+		APIKeyID:    keyID,
+	}, nil
+}
@@ -0,0 +1,69 @@
+package jwt_token_test
+
+import (
+	"ROOmail/pkg/utils/jwt_token"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewAPIKey(t *testing.T) {
+	key, prefix, hash, err := jwt_token.NewAPIKey()
+	require.NoError(t, err)
+
+	assert.True(t, strings.HasPrefix(prefix, "roo_"))
+	assert.True(t, strings.HasPrefix(key, prefix+"_"))
+	assert.Len(t, hash, 64)
+	assert.Equal(t, jwt_token.HashAPIKey(key), hash)
+	assert.NotContains(t, hash, key)
+
+	other, _, otherHash, err := jwt_token.NewAPIKey()
+	require.NoError(t, err)
+	assert.NotEqual(t, key, other)
+	assert.NotEqual(t, hash, otherHash)
+}
+
+func TestJWTMiddlewareRejectsUnknownAPIKey(t *testing.T) {
+	called := false
+	handler := jwt_token.JWTMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/tasks/list", nil)
+	req.Header.Set(jwt_token.APIKeyHeader, "roo_00000000_secret")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	assert.False(t, called)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Contains(t, rec.Body.String(), jwt_token.ErrInvalidAPIKey.Error())
+}
+
+func TestSessionOnlyMiddleware(t *testing.T) {
+	handler := jwt_token.SessionOnlyMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name   string
+		claims *jwt_token.Claims
+		want   int
+	}{
+		{name: "токен пользователя", claims: &jwt_token.Claims{UserID: 1, SessionID: "sid"}, want: http.StatusOK},
+		{name: "API-ключ", claims: &jwt_token.Claims{UserID: 1, APIKeyID: 7}, want: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/user/me", nil)
+			req = req.WithContext(context.WithValue(req.Context(), "user", tt.claims))
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			assert.Equal(t, tt.want, rec.Code)
+		})
+	}
+}
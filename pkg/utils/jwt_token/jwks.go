@@ -0,0 +1,70 @@
+package jwt_token
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+)
+
+// JWK - открытый ключ в формате RFC 7517
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Ed25519
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKS - набор открытых ключей
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS возвращает открытые ключи набора. Симметричный ключ HS256 не публикуется.
+func (ks *KeySet) JWKS() JWKS {
+	set := JWKS{Keys: []JWK{}}
+	for _, key := range ks.sortedKeys() {
+		jwk := JWK{Kid: key.kid, Use: "sig", Alg: key.method.Alg()}
+		switch pub := key.public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		default:
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
+
+// JWKSHandler публикует открытые ключи проверки токенов
+// @Summary Открытые ключи подписи токенов
+// @Description Ключи в формате JWKS (RFC 7517) для проверки токенов ROOmail другими сервисами. Ключ выбирается по заголовку kid токена. При подписи общим секретом (HS256) список пуст.
+// @Tags auth
+// @Produce json
+// @Success 200 {object} JWKS "Открытые ключи"
+// @Router /.well-known/jwks.json [get]
+func JWKSHandler(w http.ResponseWriter, r *http.Request) {
+	set := JWKS{Keys: []JWK{}}
+	if keySet != nil {
+		set = keySet.JWKS()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	// Новый ключ появляется в наборе при ротации, поэтому долго кэшировать ответ нельзя
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(set)
+}
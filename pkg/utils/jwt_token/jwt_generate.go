@@ -1,8 +1,9 @@
 package jwt_token
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"github.com/golang-jwt/jwt/v5"
-	"os"
 	"time"
 )
 
@@ -10,25 +11,85 @@ type Claims struct {
 	UserID   int    `json:"user_id"`
 	Username string `json:"username"`
 	Role     string `json:"role"`
+	// SessionID - сессия, в рамках которой выдан токен
+	SessionID string `json:"sid,omitempty"`
+	// Permissions - разрешения текущей роли пользователя. В токен не записываются,
+	// JWTMiddleware загружает их из базы при каждом запросе.
+	Permissions []string `json:"-"`
+	// APIKeyID - ключ, которым авторизован запрос, если вместо токена передан API-ключ
+	APIKeyID int `json:"-"`
+	// PasswordChangeRequired - пароль нужно сменить, до этого доступна только смена пароля
+	PasswordChangeRequired bool `json:"-"`
 	jwt.RegisteredClaims
 }
 
-var jwtKey = []byte(os.Getenv("JWT_SECRET")) // Секретный ключ
+// HasPermission сообщает, есть ли у владельца токена разрешение
+func (c *Claims) HasPermission(permission string) bool {
+	for _, p := range c.Permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// AccessTokenTTL - срок действия токена доступа
+const AccessTokenTTL = time.Hour
+
+// keySet задается при запуске через SetKeySet
+var keySet *KeySet
+
+// SetKeySet задает ключи, которыми подписываются и проверяются токены
+func SetKeySet(ks *KeySet) {
+	keySet = ks
+}
+
+func GenerateJWT(userID int, username, role, sessionID string) (string, error) {
+	tokenID, err := newTokenID()
+	if err != nil {
+		return "", err
+	}
 
-func GenerateJWT(userID int, username, role string) (string, error) {
-	expirationTime := time.Now().Add(1 * time.Hour)
+	now := time.Now()
+	expirationTime := now.Add(AccessTokenTTL)
 	claims := &Claims{
-		UserID:   userID,
-		Username: username,
-		Role:     role,
+		UserID:    userID,
+		Username:  username,
+		Role:      role,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        tokenID,
+			IssuedAt:  jwt.NewNumericDate(now),
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 		},
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(jwtKey)
+	if keySet == nil {
+		return "", ErrKeysNotConfigured
+	}
+	return keySet.sign(claims)
+}
+
+// ParseToken проверяет подпись и срок действия токена и возвращает его утверждения
+func ParseToken(tokenString string) (*Claims, error) {
+	if keySet == nil {
+		return nil, ErrKeysNotConfigured
+	}
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, keySet.keyFunc, jwt.WithValidMethods(keySet.methods()))
 	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, jwt.ErrTokenInvalidClaims
+	}
+	return claims, nil
+}
+
+// newTokenID возвращает случайный идентификатор токена (jti), по которому токен отзывается
+func newTokenID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
 		return "", err
 	}
-	return tokenString, nil
+	return hex.EncodeToString(b), nil
 }
@@ -0,0 +1,385 @@
+package jwt_token
+
+import (
+	"ROOmail/pkg/logger"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"golang.org/x/net/context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Алгоритмы подписи для ключей из файлов
+const (
+	AlgorithmRS256 = "RS256"
+	AlgorithmEdDSA = "EdDSA"
+)
+
+// rsaKeyBits - размер RSA-ключей, создаваемых при ротации
+const rsaKeyBits = 3072
+
+// reloadInterval - как часто можно перечитывать каталог, встретив токен с неизвестным kid.
+// Нужно, когда несколько экземпляров сервера используют общий каталог ключей.
+const reloadInterval = 10 * time.Second
+
+var (
+	ErrKeysNotConfigured = errors.New("ключи подписи токенов не настроены")
+	ErrUnknownKey        = errors.New("токен подписан неизвестным ключом")
+)
+
+// signingKey - ключ подписи. Для HS256 используется secret, для остальных алгоритмов - пара ключей.
+type signingKey struct {
+	kid     string
+	method  jwt.SigningMethod
+	private crypto.Signer
+	public  crypto.PublicKey
+	secret  []byte
+	created time.Time
+	file    string
+}
+
+// newerThan сообщает, что ключ создан позже other; при равном времени новее больший kid
+func (k *signingKey) newerThan(other *signingKey) bool {
+	return k.created.After(other.created) || (k.created.Equal(other.created) && k.kid > other.kid)
+}
+
+func (k *signingKey) signWith() interface{} {
+	if k.secret != nil {
+		return k.secret
+	}
+	return k.private
+}
+
+func (k *signingKey) verifyWith() interface{} {
+	if k.secret != nil {
+		return k.secret
+	}
+	return k.public
+}
+
+// KeySet хранит ключи подписи токенов. Токены подписываются самым новым ключом и несут
+// его идентификатор в заголовке kid; проверяются любым ключом набора. Ключи из каталога
+// публикуются в JWKS, чтобы другие сервисы могли проверять токены ROOmail.
+type KeySet struct {
+	mu         sync.RWMutex
+	dir        string
+	algorithm  string
+	rotation   time.Duration
+	keys       map[string]*signingKey
+	current    *signingKey
+	reloadedAt time.Time
+}
+
+// NewSecretKeySet возвращает набор из одного симметричного ключа (HS256) без kid
+func NewSecretKeySet(secret string) (*KeySet, error) {
+	if secret == "" {
+		return nil, errors.New("секрет для подписи токенов пуст")
+	}
+	key := &signingKey{method: jwt.SigningMethodHS256, secret: []byte(secret)}
+	return &KeySet{keys: map[string]*signingKey{"": key}, current: key}, nil
+}
+
+// LoadKeySet загружает закрытые ключи RSA или Ed25519 из PEM-файлов каталога (*.pem).
+// Имя файла без расширения становится kid. Если rotation больше нуля, раз в rotation
+// создается новый ключ алгоритма algorithm, а ключи, которыми уже не может быть подписан
+// ни один действующий токен, удаляются; пустой каталог при этом допустим.
+func LoadKeySet(dir, algorithm string, rotation time.Duration) (*KeySet, error) {
+	if algorithm != AlgorithmRS256 && algorithm != AlgorithmEdDSA {
+		return nil, fmt.Errorf("неизвестный алгоритм подписи %q, допустимы %s и %s", algorithm, AlgorithmRS256, AlgorithmEdDSA)
+	}
+	ks := &KeySet{dir: dir, algorithm: algorithm, rotation: rotation}
+
+	if rotation > 0 {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return nil, fmt.Errorf("не удалось создать каталог ключей: %w", err)
+		}
+		if _, err := ks.Rotate(time.Now()); err != nil {
+			return nil, err
+		}
+		return ks, nil
+	}
+
+	if err := ks.Reload(); err != nil {
+		return nil, err
+	}
+	if ks.current == nil {
+		return nil, fmt.Errorf("в каталоге %s нет ключей подписи", dir)
+	}
+	return ks, nil
+}
+
+// Reload перечитывает ключи из каталога
+func (ks *KeySet) Reload() error {
+	if ks.dir == "" {
+		return nil
+	}
+
+	files, err := filepath.Glob(filepath.Join(ks.dir, "*.pem"))
+	if err != nil {
+		return fmt.Errorf("не удалось прочитать каталог ключей: %w", err)
+	}
+
+	keys := make(map[string]*signingKey, len(files))
+	var current *signingKey
+	for _, file := range files {
+		key, err := readKeyFile(file)
+		if err != nil {
+			return err
+		}
+		keys[key.kid] = key
+		if current == nil || key.newerThan(current) {
+			current = key
+		}
+	}
+
+	ks.mu.Lock()
+	ks.keys = keys
+	ks.current = current
+	ks.reloadedAt = time.Now()
+	ks.mu.Unlock()
+	return nil
+}
+
+// Rotate создает новый ключ, если текущему больше rotation, и удаляет ключи, которые
+// перестали быть текущими раньше чем AccessTokenTTL назад. Возвращает true, если ключ создан.
+func (ks *KeySet) Rotate(now time.Time) (bool, error) {
+	if ks.dir == "" || ks.rotation <= 0 {
+		return false, nil
+	}
+	if err := ks.Reload(); err != nil {
+		return false, err
+	}
+
+	ks.mu.RLock()
+	current := ks.current
+	ordered := make([]*signingKey, 0, len(ks.keys))
+	for _, key := range ks.keys {
+		ordered = append(ordered, key)
+	}
+	ks.mu.RUnlock()
+
+	// Ключ перестает быть текущим, когда создан следующий за ним. Срок ротации для этого
+	// не подходит: если сервер был остановлен, ключ сменится намного позже.
+	sort.Slice(ordered, func(i, j int) bool { return ordered[j].newerThan(ordered[i]) })
+	var expired []*signingKey
+	for i := 0; i+1 < len(ordered); i++ {
+		if ordered[i+1].created.Add(AccessTokenTTL).Before(now) {
+			expired = append(expired, ordered[i])
+		}
+	}
+
+	for _, key := range expired {
+		if err := os.Remove(key.file); err != nil && !os.IsNotExist(err) {
+			return false, fmt.Errorf("не удалось удалить старый ключ %s: %w", key.kid, err)
+		}
+	}
+
+	if current != nil && now.Sub(current.created) < ks.rotation {
+		if len(expired) > 0 {
+			return false, ks.Reload()
+		}
+		return false, nil
+	}
+
+	if err := ks.generate(now); err != nil {
+		return false, err
+	}
+	return true, ks.Reload()
+}
+
+// StartRotation периодически выполняет ротацию ключей, пока не отменен контекст
+func (ks *KeySet) StartRotation(ctx context.Context, interval time.Duration, log logger.Logger) {
+	if ks.dir == "" || ks.rotation <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		rotated, err := ks.Rotate(time.Now())
+		if err != nil {
+			log.Error("Ошибка ротации ключей подписи токенов: ", err)
+			continue
+		}
+		if rotated {
+			log.Info("Создан новый ключ подписи токенов: ", ks.CurrentKeyID())
+		}
+	}
+}
+
+// CurrentKeyID возвращает kid ключа, которым подписываются новые токены
+func (ks *KeySet) CurrentKeyID() string {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	if ks.current == nil {
+		return ""
+	}
+	return ks.current.kid
+}
+
+// sign подписывает утверждения текущим ключом
+func (ks *KeySet) sign(claims jwt.Claims) (string, error) {
+	ks.mu.RLock()
+	key := ks.current
+	ks.mu.RUnlock()
+	if key == nil {
+		return "", ErrKeysNotConfigured
+	}
+
+	token := jwt.NewWithClaims(key.method, claims)
+	if key.kid != "" {
+		token.Header["kid"] = key.kid
+	}
+	return token.SignedString(key.signWith())
+}
+
+// keyFunc выбирает ключ проверки по kid и не дает подменить алгоритм
+func (ks *KeySet) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	key := ks.lookup(kid)
+	if key == nil && ks.dir != "" && ks.reloadDue() {
+		if err := ks.Reload(); err != nil {
+			return nil, err
+		}
+		key = ks.lookup(kid)
+	}
+	if key == nil {
+		return nil, ErrUnknownKey
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("алгоритм токена %s не соответствует ключу %q", token.Method.Alg(), kid)
+	}
+	return key.verifyWith(), nil
+}
+
+// methods возвращает алгоритмы ключей набора для проверки заголовка alg
+func (ks *KeySet) methods() []string {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	seen := make(map[string]bool)
+	var methods []string
+	for _, key := range ks.keys {
+		if alg := key.method.Alg(); !seen[alg] {
+			seen[alg] = true
+			methods = append(methods, alg)
+		}
+	}
+	return methods
+}
+
+func (ks *KeySet) lookup(kid string) *signingKey {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	return ks.keys[kid]
+}
+
+func (ks *KeySet) reloadDue() bool {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	return time.Since(ks.reloadedAt) > reloadInterval
+}
+
+// generate создает ключ и записывает его в каталог. Файл сначала пишется под временным
+// именем, чтобы другие экземпляры сервера не прочитали его частично.
+func (ks *KeySet) generate(now time.Time) error {
+	var private crypto.Signer
+	var err error
+	switch ks.algorithm {
+	case AlgorithmRS256:
+		private, err = rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	default:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	}
+	if err != nil {
+		return fmt.Errorf("не удалось создать ключ подписи: %w", err)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return fmt.Errorf("не удалось сохранить ключ подписи: %w", err)
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return fmt.Errorf("не удалось создать идентификатор ключа: %w", err)
+	}
+	kid := now.UTC().Format("20060102T150405") + "-" + hex.EncodeToString(suffix)
+
+	file := filepath.Join(ks.dir, kid+".pem")
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		return fmt.Errorf("не удалось записать ключ подписи: %w", err)
+	}
+	if err := os.Rename(tmp, file); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("не удалось записать ключ подписи: %w", err)
+	}
+	return nil
+}
+
+// readKeyFile читает закрытый ключ RSA (PKCS#1 или PKCS#8) или Ed25519 (PKCS#8)
+func readKeyFile(file string) (*signingKey, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось прочитать ключ %s: %w", file, err)
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось прочитать ключ %s: %w", file, err)
+	}
+
+	key := &signingKey{
+		kid:     strings.TrimSuffix(filepath.Base(file), ".pem"),
+		created: info.ModTime(),
+		file:    file,
+	}
+	if rsaKey, err := jwt.ParseRSAPrivateKeyFromPEM(data); err == nil {
+		key.method = jwt.SigningMethodRS256
+		key.private = rsaKey
+		key.public = &rsaKey.PublicKey
+		return key, nil
+	}
+	if edKey, err := jwt.ParseEdPrivateKeyFromPEM(data); err == nil {
+		signer := edKey.(ed25519.PrivateKey)
+		key.method = jwt.SigningMethodEdDSA
+		key.private = signer
+		key.public = signer.Public()
+		return key, nil
+	}
+	return nil, fmt.Errorf("файл %s не содержит закрытый ключ RSA или Ed25519 в формате PEM", file)
+}
+
+// sortedKeys возвращает ключи набора в порядке kid
+func (ks *KeySet) sortedKeys() []*signingKey {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	keys := make([]*signingKey, 0, len(ks.keys))
+	for _, key := range ks.keys {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].kid < keys[j].kid })
+	return keys
+}
@@ -0,0 +1,167 @@
+package jwt_token_test
+
+import (
+	"ROOmail/pkg/utils/jwt_token"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSecretKeySet(t *testing.T) {
+	_, err := jwt_token.NewSecretKeySet("")
+	assert.Error(t, err)
+
+	ks, err := jwt_token.NewSecretKeySet("secret")
+	require.NoError(t, err)
+	jwt_token.SetKeySet(ks)
+
+	token, err := jwt_token.GenerateJWT(1, "user", "users", "sid")
+	require.NoError(t, err)
+
+	claims, err := jwt_token.ParseToken(token)
+	require.NoError(t, err)
+	assert.Equal(t, 1, claims.UserID)
+	assert.Equal(t, "sid", claims.SessionID)
+
+	assert.Empty(t, ks.JWKS().Keys, "общий секрет не публикуется")
+}
+
+func TestLoadKeySetRSA(t *testing.T) {
+	dir := t.TempDir()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	data := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.pem"), data, 0o600))
+
+	ks, err := jwt_token.LoadKeySet(dir, jwt_token.AlgorithmRS256, 0)
+	require.NoError(t, err)
+	assert.Equal(t, "main", ks.CurrentKeyID())
+	jwt_token.SetKeySet(ks)
+
+	token, err := jwt_token.GenerateJWT(2, "admin", "admin", "sid")
+	require.NoError(t, err)
+	claims, err := jwt_token.ParseToken(token)
+	require.NoError(t, err)
+	assert.Equal(t, "admin", claims.Username)
+
+	jwks := ks.JWKS()
+	require.Len(t, jwks.Keys, 1)
+	assert.Equal(t, "RSA", jwks.Keys[0].Kty)
+	assert.Equal(t, "main", jwks.Keys[0].Kid)
+	assert.Equal(t, "RS256", jwks.Keys[0].Alg)
+	assert.Equal(t, "AQAB", jwks.Keys[0].E)
+
+	// Токен, подписанный общим секретом, не принимается
+	secret, err := jwt_token.NewSecretKeySet("secret")
+	require.NoError(t, err)
+	jwt_token.SetKeySet(secret)
+	forged, err := jwt_token.GenerateJWT(2, "admin", "admin", "sid")
+	require.NoError(t, err)
+	jwt_token.SetKeySet(ks)
+	_, err = jwt_token.ParseToken(forged)
+	assert.Error(t, err)
+}
+
+func TestLoadKeySetEmptyDir(t *testing.T) {
+	_, err := jwt_token.LoadKeySet(t.TempDir(), jwt_token.AlgorithmRS256, 0)
+	assert.Error(t, err)
+
+	_, err = jwt_token.LoadKeySet(t.TempDir(), "HS512", time.Hour)
+	assert.Error(t, err)
+}
+
+func TestKeyRotation(t *testing.T) {
+	dir := t.TempDir()
+	ks, err := jwt_token.LoadKeySet(dir, jwt_token.AlgorithmEdDSA, time.Hour)
+	require.NoError(t, err)
+	jwt_token.SetKeySet(ks)
+
+	oldKid := ks.CurrentKeyID()
+	require.NotEmpty(t, oldKid)
+	oldToken, err := jwt_token.GenerateJWT(3, "user", "users", "sid")
+	require.NoError(t, err)
+
+	// Ротация не нужна, пока ключ моложе интервала
+	rotated, err := ks.Rotate(time.Now())
+	require.NoError(t, err)
+	assert.False(t, rotated)
+
+	oldFile := filepath.Join(dir, oldKid+".pem")
+	past := time.Now().Add(-2 * time.Hour)
+	require.NoError(t, os.Chtimes(oldFile, past, past))
+
+	rotated, err = ks.Rotate(time.Now())
+	require.NoError(t, err)
+	assert.True(t, rotated)
+	assert.NotEqual(t, oldKid, ks.CurrentKeyID())
+
+	// Выданные старым ключом токены продолжают проверяться
+	_, err = jwt_token.ParseToken(oldToken)
+	require.NoError(t, err)
+
+	jwks := ks.JWKS()
+	require.Len(t, jwks.Keys, 2)
+	for _, key := range jwks.Keys {
+		assert.Equal(t, "OKP", key.Kty)
+		assert.Equal(t, "Ed25519", key.Crv)
+		assert.NotEmpty(t, key.X)
+	}
+
+	// Когда все подписанные старым ключом токены истекли, ключ удаляется
+	newKid := ks.CurrentKeyID()
+	newFile := filepath.Join(dir, newKid+".pem")
+	past = time.Now().Add(-jwt_token.AccessTokenTTL - time.Minute)
+	require.NoError(t, os.Chtimes(newFile, past, past))
+	_, err = ks.Rotate(time.Now())
+	require.NoError(t, err)
+	assert.NoFileExists(t, oldFile)
+	assert.FileExists(t, newFile)
+	assert.Len(t, ks.JWKS().Keys, 2)
+
+	_, err = jwt_token.ParseToken(oldToken)
+	assert.ErrorIs(t, err, jwt_token.ErrUnknownKey)
+}
+
+func TestKeyRotationAfterDowntime(t *testing.T) {
+	dir := t.TempDir()
+	ks, err := jwt_token.LoadKeySet(dir, jwt_token.AlgorithmEdDSA, time.Hour)
+	require.NoError(t, err)
+	jwt_token.SetKeySet(ks)
+
+	// Сервер не работал несколько дней, ключ сменяется намного позже срока ротации
+	oldKid := ks.CurrentKeyID()
+	oldFile := filepath.Join(dir, oldKid+".pem")
+	past := time.Now().Add(-10 * 24 * time.Hour)
+	require.NoError(t, os.Chtimes(oldFile, past, past))
+	oldToken, err := jwt_token.GenerateJWT(3, "user", "users", "sid")
+	require.NoError(t, err)
+
+	rotated, err := ks.Rotate(time.Now())
+	require.NoError(t, err)
+	assert.True(t, rotated)
+
+	// Старый ключ был текущим только что, подписанные им токены еще действуют
+	rotated, err = ks.Rotate(time.Now())
+	require.NoError(t, err)
+	assert.False(t, rotated)
+	assert.FileExists(t, oldFile)
+	_, err = jwt_token.ParseToken(oldToken)
+	require.NoError(t, err)
+
+	rotated, err = ks.Rotate(time.Now().Add(jwt_token.AccessTokenTTL - time.Minute))
+	require.NoError(t, err)
+	assert.False(t, rotated)
+	assert.FileExists(t, oldFile)
+
+	_, err = ks.Rotate(time.Now().Add(jwt_token.AccessTokenTTL + time.Minute))
+	require.NoError(t, err)
+	assert.NoFileExists(t, oldFile)
+}
@@ -1,15 +1,35 @@
 package jwt_token
 
 import (
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/gorilla/mux"
 	"golang.org/x/net/context"
 	"net/http"
 	"strings"
 )
 
+// passwordChangePaths - маршруты, доступные пользователю, которому нужно сменить пароль
+var passwordChangePaths = map[string]bool{}
+
+// AllowWithPasswordChangeRequired разрешает маршрут path пользователю, которому нужно сменить пароль.
+// Остальные маршруты под JWTMiddleware до смены пароля отвечают 403.
+func AllowWithPasswordChangeRequired(path string) {
+	passwordChangePaths[path] = true
+}
+
 func JWTMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Интеграции авторизуются API-ключом, пользователи - токеном доступа
+		if apiKey := r.Header.Get(APIKeyHeader); apiKey != "" {
+			claims, err := checkAPIKey(r.Context(), apiKey)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			}
+			ctx := context.WithValue(r.Context(), "user", claims)
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+
 		authHeader := r.Header.Get("Authorization")
 		if authHeader == "" {
 			http.Error(w, "Отсутствует токен авторизации", http.StatusUnauthorized)
@@ -17,17 +37,21 @@ func JWTMiddleware(next http.Handler) http.Handler {
 		}
 
 		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-		claims := &Claims{}
-
-		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-			return jwtKey, nil
-		})
-
-		if err != nil || !token.Valid {
+		claims, err := ParseToken(tokenString)
+		if err != nil {
 			http.Error(w, "Недействительный токен", http.StatusUnauthorized)
 			return
 		}
 
+		if err := checkAccount(r.Context(), claims); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		if claims.PasswordChangeRequired && !passwordChangePaths[r.URL.Path] {
+			http.Error(w, ErrPasswordChangeRequired.Error(), http.StatusForbidden)
+			return
+		}
+
 		ctx := context.WithValue(r.Context(), "user", claims)
 		r = r.WithContext(ctx)
 
@@ -35,11 +59,26 @@ func JWTMiddleware(next http.Handler) http.Handler {
 	})
 }
 
-func RoleMiddleware(requiredRole string) mux.MiddlewareFunc {
+// SessionOnlyMiddleware не пропускает запросы с API-ключом. Подключается после JWTMiddleware
+// к маршрутам без проверки разрешения: API-ключ ограничен разрешениями, поэтому ему доступны
+// только маршруты, защищенные PermissionMiddleware.
+func SessionOnlyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, ok := r.Context().Value("user").(*Claims); ok && user.APIKeyID != 0 {
+			http.Error(w, "Маршрут недоступен по API-ключу", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// PermissionMiddleware пропускает запрос, если у роли пользователя есть разрешение.
+// Подключается после JWTMiddleware, который загружает разрешения.
+func PermissionMiddleware(permission string) mux.MiddlewareFunc {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			user, ok := r.Context().Value("user").(*Claims)
-			if !ok || user.Role != requiredRole {
+			if !ok || !user.HasPermission(permission) {
 				http.Error(w, "Доступ запрещен", http.StatusForbidden)
 				return
 			}
@@ -0,0 +1,97 @@
+package jwt_token
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"golang.org/x/net/context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// StreamTicketTTL - срок действия билета на подключение к потоку событий
+const StreamTicketTTL = 30 * time.Second
+
+var ErrInvalidStreamTicket = errors.New("Недействительный или уже использованный билет")
+
+// Браузерный EventSource не передает заголовки, а токен доступа в адресе попадает в логи
+// прокси и историю браузера. Поэтому поток открывается по одноразовому короткоживущему
+// билету, который клиент получает обычным запросом с токеном.
+var streamTickets = struct {
+	mu      sync.Mutex
+	tickets map[string]streamTicket
+}{tickets: make(map[string]streamTicket)}
+
+type streamTicket struct {
+	claims    Claims
+	expiresAt time.Time
+}
+
+// IssueStreamTicket выдает одноразовый билет на подключение к потоку событий от имени владельца токена
+func IssueStreamTicket(claims *Claims) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	ticket := base64.RawURLEncoding.EncodeToString(b)
+	now := time.Now()
+
+	streamTickets.mu.Lock()
+	defer streamTickets.mu.Unlock()
+	for t, st := range streamTickets.tickets {
+		if now.After(st.expiresAt) {
+			delete(streamTickets.tickets, t)
+		}
+	}
+	streamTickets.tickets[ticket] = streamTicket{claims: *claims, expiresAt: now.Add(StreamTicketTTL)}
+	return ticket, nil
+}
+
+// redeemStreamTicket погашает билет и возвращает claims, для которых он выдан
+func redeemStreamTicket(ticket string) (*Claims, error) {
+	streamTickets.mu.Lock()
+	st, ok := streamTickets.tickets[ticket]
+	delete(streamTickets.tickets, ticket)
+	streamTickets.mu.Unlock()
+
+	if !ok || time.Now().After(st.expiresAt) {
+		return nil, ErrInvalidStreamTicket
+	}
+	return &st.claims, nil
+}
+
+// StreamTicketMiddleware авторизует потоковый запрос по билету из параметра ticket.
+// Без билета запрос проверяется как обычно, через JWTMiddleware.
+func StreamTicketMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ticket := r.URL.Query().Get("ticket")
+		if ticket == "" {
+			JWTMiddleware(next).ServeHTTP(w, r)
+			return
+		}
+
+		claims, err := redeemStreamTicket(ticket)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		// Сессию и учетную запись проверяем заново: за время жизни билета их могли отозвать
+		if err := checkAccount(r.Context(), claims); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), "user", claims)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// CheckStream повторно проверяет claims открытого потока событий: поток живет дольше
+// запроса, и за это время токен может истечь, а сессию или учетную запись - отозвать
+func CheckStream(ctx context.Context, claims *Claims) error {
+	if claims.ExpiresAt != nil && !claims.ExpiresAt.After(time.Now()) {
+		return ErrTokenExpired
+	}
+	return checkAccount(ctx, claims)
+}
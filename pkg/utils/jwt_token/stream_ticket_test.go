@@ -0,0 +1,47 @@
+package jwt_token_test
+
+import (
+	"ROOmail/pkg/utils/jwt_token"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamTicketIsSingleUse(t *testing.T) {
+	var got *jwt_token.Claims
+	handler := jwt_token.StreamTicketMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = r.Context().Value("user").(*jwt_token.Claims)
+	}))
+
+	ticket, err := jwt_token.IssueStreamTicket(&jwt_token.Claims{UserID: 7, Username: "ivanov"})
+	require.NoError(t, err)
+
+	serve := func(url string) int {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url, nil))
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusOK, serve("/events?ticket="+ticket))
+	require.NotNil(t, got)
+	assert.Equal(t, 7, got.UserID)
+
+	got = nil
+	assert.Equal(t, http.StatusUnauthorized, serve("/events?ticket="+ticket))
+	assert.Equal(t, http.StatusUnauthorized, serve("/events?ticket=unknown"))
+	assert.Nil(t, got)
+}
+
+func TestStreamTicketMiddlewareRequiresAuthorization(t *testing.T) {
+	handler := jwt_token.StreamTicketMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("запрос без билета и токена не должен пройти")
+	}))
+
+	// Токен в адресе больше не принимается
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/events?token=abc", nil))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}